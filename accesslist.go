@@ -0,0 +1,228 @@
+// accesslist.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// === Allow/deny lists (ACCESS_LIST_FILE) ===
+// {"allow": [...], "deny": [...]} where each entry is a peer ID, an IP or a
+// CIDR. Deny wins; a non-empty allow list admits only what it matches. The
+// optional "denyDestinations" peer IDs are refused as circuit destinations
+// (see destdeny.go), and "allowReservations" / "denyReservations" peer IDs
+// decide who may reserve, on top of the connection lists: deny wins, and a
+// non-empty allowReservations lets only those peers reserve while others can
+// still connect and open circuits to peers that did. The file is watched and
+// the lists swapped atomically on every valid change.
+type accessLists struct {
+	allowPeers map[peer.ID]bool
+	allowNets  []*net.IPNet
+	denyPeers  map[peer.ID]bool
+	denyNets   []*net.IPNet
+	denyDests  map[peer.ID]bool
+
+	allowReserve map[peer.ID]bool
+	denyReserve  map[peer.ID]bool
+}
+
+func parseAccessLists(b []byte) (*accessLists, error) {
+	var doc struct {
+		Allow     []string `json:"allow"`
+		Deny      []string `json:"deny"`
+		DenyDests []string `json:"denyDestinations"`
+
+		AllowReserve []string `json:"allowReservations"`
+		DenyReserve  []string `json:"denyReservations"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	l := &accessLists{
+		allowPeers:   map[peer.ID]bool{},
+		denyPeers:    map[peer.ID]bool{},
+		denyDests:    map[peer.ID]bool{},
+		allowReserve: map[peer.ID]bool{},
+		denyReserve:  map[peer.ID]bool{},
+	}
+	for _, e := range doc.Allow {
+		if err := l.add(e, l.allowPeers, &l.allowNets); err != nil {
+			return nil, fmt.Errorf("allow: %w", err)
+		}
+	}
+	for _, e := range doc.Deny {
+		if err := l.add(e, l.denyPeers, &l.denyNets); err != nil {
+			return nil, fmt.Errorf("deny: %w", err)
+		}
+	}
+	for name, list := range map[string]struct {
+		entries []string
+		into    map[peer.ID]bool
+	}{
+		"denyDestinations":  {doc.DenyDests, l.denyDests},
+		"allowReservations": {doc.AllowReserve, l.allowReserve},
+		"denyReservations":  {doc.DenyReserve, l.denyReserve},
+	} {
+		for _, e := range list.entries {
+			p, err := peer.Decode(strings.TrimSpace(e))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %q is not a peer ID", name, e)
+			}
+			list.into[p] = true
+		}
+	}
+	return l, nil
+}
+
+func (l *accessLists) add(entry string, peers map[peer.ID]bool, nets *[]*net.IPNet) error {
+	entry = strings.TrimSpace(entry)
+	if _, n, err := net.ParseCIDR(entry); err == nil {
+		*nets = append(*nets, n)
+		return nil
+	}
+	if ip := net.ParseIP(entry); ip != nil {
+		bits := 8 * len(ip.To16())
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		*nets = append(*nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		return nil
+	}
+	p, err := peer.Decode(entry)
+	if err != nil {
+		return fmt.Errorf("%q is not a peer ID, IP or CIDR", entry)
+	}
+	peers[p] = true
+	return nil
+}
+
+// allowAddr decides on the remote IP alone (before the peer is known).
+func (l *accessLists) allowAddr(a ma.Multiaddr) bool {
+	return !matchNets(l.denyNets, a)
+}
+
+// allowPeer decides once the peer ID is known.
+func (l *accessLists) allowPeer(p peer.ID, a ma.Multiaddr) bool {
+	if l.denyPeers[p] || matchNets(l.denyNets, a) {
+		return false
+	}
+	if len(l.allowPeers) == 0 && len(l.allowNets) == 0 {
+		return true
+	}
+	return l.allowPeers[p] || matchNets(l.allowNets, a)
+}
+
+// allowReservation decides a RESERVE from p.
+func (l *accessLists) allowReservation(p peer.ID) bool {
+	if l.denyReserve[p] {
+		return false
+	}
+	return len(l.allowReserve) == 0 || l.allowReserve[p]
+}
+
+func matchNets(nets []*net.IPNet, a ma.Multiaddr) bool {
+	if len(nets) == 0 || a == nil {
+		return false
+	}
+	ip, err := manet.ToIP(a)
+	if err != nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessWatcher holds the active lists; a nil pointer means no lists.
+type accessWatcher struct {
+	path    string
+	current atomic.Pointer[accessLists]
+}
+
+func newAccessWatcher(path string) (*accessWatcher, error) {
+	w := &accessWatcher{path: path}
+	if path == "" {
+		return w, nil
+	}
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *accessWatcher) lists() *accessLists {
+	return w.current.Load()
+}
+
+func (w *accessWatcher) load() error {
+	b, err := os.ReadFile(w.path)
+	if err != nil {
+		return fmt.Errorf("read access list: %w", err)
+	}
+	l, err := parseAccessLists(b)
+	if err != nil {
+		return fmt.Errorf("access list %s: %w", w.path, err)
+	}
+	w.current.Store(l)
+	log.Printf("✅ Access list loaded from %s: allow %d peers / %d nets, deny %d peers / %d nets, deny %d destinations, reservations allow %d / deny %d peers",
+		w.path, len(l.allowPeers), len(l.allowNets), len(l.denyPeers), len(l.denyNets), len(l.denyDests), len(l.allowReserve), len(l.denyReserve))
+	return nil
+}
+
+// watch reloads on change. The directory is watched, not the file, so
+// editors' rename-over-write and Kubernetes ConfigMap symlink swaps are seen.
+func (w *accessWatcher) watch() error {
+	if w.path == "" {
+		return nil
+	}
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := fw.Add(filepath.Dir(w.path)); err != nil {
+		_ = fw.Close()
+		return err
+	}
+
+	go func() {
+		defer fw.Close()
+		var debounce <-chan time.Time
+		for {
+			select {
+			case ev, ok := <-fw.Events:
+				if !ok {
+					return
+				}
+				if filepath.Base(ev.Name) == filepath.Base(w.path) || strings.HasPrefix(filepath.Base(ev.Name), "..") {
+					debounce = time.After(200 * time.Millisecond)
+				}
+			case err, ok := <-fw.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("⚠️ Access list watcher: %v", err)
+			case <-debounce:
+				debounce = nil
+				if err := w.load(); err != nil {
+					log.Printf("⚠️ Access list reload rejected, keeping previous lists: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,100 @@
+// acl.go
+package main
+
+import (
+	"log"
+	"sync/atomic"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Reservation ACL (relay.ACLFilter) ===
+type relayACL struct {
+	reservations *reservationTracker
+	access       *accessWatcher
+	duplicates   string
+	limiter      *reserveLimiter
+	queue        *reserveQueue
+	schedule     *reserveSchedule
+	clients      *clientPolicy
+	vip          *vipPool
+	protocols    *circuitProtocols
+	capacity     *capacityBudget
+	diagnostics  *diagnostics
+
+	// maintenance refuses reservations from peers that don't already hold
+	// one; renewals and open circuits keep working so clients drain away.
+	maintenance atomic.Bool
+
+	// draining refuses every reservation and new circuit before shutdown.
+	draining atomic.Bool
+}
+
+func newRelayACL(cfg *relayConfig, reservations *reservationTracker, access *accessWatcher) *relayACL {
+	a := &relayACL{
+		reservations: reservations,
+		access:       access,
+		duplicates:   cfg.DuplicatePolicy,
+		limiter:      newReserveLimiter(cfg.ReserveRateLimit),
+		queue:        newReserveQueue(cfg, reservations),
+		schedule:     cfg.reserveSchedule,
+		vip:          newVIPPool(cfg, reservations),
+	}
+	a.queue.vip = a.vip
+	a.maintenance.Store(cfg.MaintenanceMode)
+	return a
+}
+
+func (a *relayACL) AllowReserve(p peer.ID, _ ma.Multiaddr) bool {
+	if a.draining.Load() {
+		return false
+	}
+	if l := a.access.lists(); l != nil && !l.allowReservation(p) {
+		log.Printf("Refusing reservation from %s: not allowed to reserve by ACCESS_LIST_FILE", p)
+		return false
+	}
+	if !a.limiter.allow(p) {
+		return false
+	}
+	if !a.allowDuplicate(p) {
+		return false
+	}
+	if !a.reservations.has(p) && cpuPressure.refusing() {
+		eventf("cpu_pressure", "⚠️ event=cpu_pressure peer=%s cpu=%.2f: refusing new reservation", p, cpuPressure.currentUsage())
+		return false
+	}
+	if a.maintenance.Load() && !a.reservations.has(p) {
+		log.Printf("Refusing new reservation from %s: maintenance mode", p)
+		return false
+	}
+	if a.schedule != nil && !a.reservations.has(p) && !a.schedule.allow() {
+		return false
+	}
+	if a.clients != nil && !a.clients.allow(p) {
+		return false
+	}
+	a.queue.wait(p)
+	if !a.vip.allow(p) {
+		return false
+	}
+	return a.capacity.admit(p)
+}
+
+func (a *relayACL) AllowConnect(src peer.ID, srcAddr ma.Multiaddr, dest peer.ID) bool {
+	ok := !a.draining.Load() && a.protocols.allow(src, dest)
+	if a.diagnostics != nil {
+		return a.diagnostics.refuse(src, srcAddr, dest, ok)
+	}
+	return ok
+}
+
+func (a *relayACL) setMaintenance(on bool) {
+	if a.maintenance.Swap(on) != on {
+		if on {
+			log.Println("🔧 Maintenance mode ON: refusing new reservations, existing ones stay")
+		} else {
+			log.Println("✅ Maintenance mode OFF: accepting reservations")
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// addrcap.go
+package main
+
+import (
+	"slices"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// === Advertised address cap (MAX_ADVERTISED_ADDRS) ===
+// Some client libraries give up when identify hands them too many addresses.
+// With a cap the address factory keeps the most reachable ones: DNS over wss,
+// then DNS over ws, other DNS addresses, public IPs, and private or loopback
+// addresses last. Ties keep their original order.
+func addrReachRank(a ma.Multiaddr) int {
+	dns, secure, ws := false, false, false
+	for _, c := range a {
+		switch c.Protocol().Code {
+		case ma.P_DNS, ma.P_DNS4, ma.P_DNS6, ma.P_DNSADDR:
+			dns = true
+		case ma.P_WSS, ma.P_TLS:
+			secure = true
+		case ma.P_WS:
+			ws = true
+		}
+	}
+	switch {
+	case dns && secure:
+		return 0
+	case dns && ws:
+		return 1
+	case dns:
+		return 2
+	case manet.IsPublicAddr(a):
+		return 3
+	default:
+		return 4
+	}
+}
+
+// capAddrs returns at most max addresses, most reachable first, and the ones
+// left out. max <= 0 means no cap.
+func capAddrs(addrs []ma.Multiaddr, max int) (kept, dropped []ma.Multiaddr) {
+	if max <= 0 || len(addrs) <= max {
+		return addrs, nil
+	}
+	sorted := slices.Clone(addrs)
+	slices.SortStableFunc(sorted, func(a, b ma.Multiaddr) int {
+		return addrReachRank(a) - addrReachRank(b)
+	})
+	return sorted[:max], sorted[max:]
+}
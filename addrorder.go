@@ -0,0 +1,70 @@
+// addrorder.go
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Advertised address order (ADVERTISE_ORDER) ===
+// Clients typically dial a relay's addresses in the order they're listed,
+// moving on only when one fails. "static" (the default) keeps each list's
+// own order: ADVERTISE_TRANSPORTS order for the public addresses, most
+// reachable first on /transports and /client-config. "least-used" moves the
+// transport with the least load on this relay to the front, so new clients
+// spread over transports without changes on their side: load is the open
+// direct connections over the transport, times its TRANSPORT_LOAD_WEIGHTS
+// weight, as a share of its TRANSPORT_CONN_LIMITS cap when it has one. The
+// static order breaks ties. It applies to the lists the relay publishes
+// itself (/multiaddr, /transports, /client-config, the QR code, coordinator
+// registration); go-libp2p sorts identify's and the signed peer record's
+// addresses on its own, so they can't carry an order.
+const (
+	advertiseOrderStatic    = "static"
+	advertiseOrderLeastUsed = "least-used"
+)
+
+func advertiseOrder() (string, error) {
+	v := envString("ADVERTISE_ORDER", advertiseOrderStatic)
+	if v != advertiseOrderStatic && v != advertiseOrderLeastUsed {
+		return "", fmt.Errorf("invalid ADVERTISE_ORDER %q (want %s or %s)", v, advertiseOrderStatic, advertiseOrderLeastUsed)
+	}
+	return v, nil
+}
+
+// orderAddrs re-sorts addrs in place for ADVERTISE_ORDER, keeping their
+// order among equals.
+func (n *relayNode) orderAddrs(addrs []ma.Multiaddr) {
+	if n.cfg.AdvertiseOrder != advertiseOrderLeastUsed {
+		return
+	}
+	load := n.transportLoad()
+	slices.SortStableFunc(addrs, func(a, b ma.Multiaddr) int {
+		la, lb := load[transportOf(a)], load[transportOf(b)]
+		switch {
+		case la < lb:
+			return -1
+		case la > lb:
+			return 1
+		}
+		return 0
+	})
+}
+
+// transportLoad is each transport's load as least-used ordering sees it.
+func (n *relayNode) transportLoad() map[string]float64 {
+	out := make(map[string]float64)
+	for name, t := range n.transports.info() {
+		load := float64(t.Open)
+		if w, ok := n.cfg.TransportLoadWeights[name]; ok {
+			load *= w
+		}
+		if t.Limit > 0 {
+			load /= float64(t.Limit)
+		}
+		out[name] = load
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+// addrwatch.go
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+)
+
+// === Local address changes (EvtLocalAddressesUpdated) ===
+// Logs every change to the host's advertised addresses, so shifts in
+// addrFactory output show up in the logs, and keeps the latest set for /stats.
+type addrWatcher struct {
+	mu      sync.Mutex
+	current []string
+}
+
+func watchLocalAddrs(h host.Host) (*addrWatcher, error) {
+	sub, err := h.EventBus().Subscribe(new(event.EvtLocalAddressesUpdated))
+	if err != nil {
+		return nil, err
+	}
+	w := &addrWatcher{}
+	go func() {
+		defer sub.Close()
+		for e := range sub.Out() {
+			w.update(e.(event.EvtLocalAddressesUpdated))
+		}
+	}()
+	return w, nil
+}
+
+func (w *addrWatcher) update(ev event.EvtLocalAddressesUpdated) {
+	var current, added, removed []string
+	for _, u := range ev.Current {
+		current = append(current, u.Address.String())
+		if u.Action == event.Added {
+			added = append(added, u.Address.String())
+		}
+	}
+	for _, u := range ev.Removed {
+		removed = append(removed, u.Address.String())
+	}
+
+	w.mu.Lock()
+	w.current = current
+	w.mu.Unlock()
+
+	log.Printf("event=local_addrs_updated diffs=%t added=[%s] removed=[%s] current=[%s]",
+		ev.Diffs, strings.Join(added, " "), strings.Join(removed, " "), strings.Join(current, " "))
+}
+
+func (w *addrWatcher) addrs() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string{}, w.current...)
+}
@@ -0,0 +1,69 @@
+// admintls.go
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// === Admin mutual TLS (ADMIN_TLS_CERT, ADMIN_TLS_KEY, ADMIN_CLIENT_CA) ===
+// With a certificate and key the whole status server speaks HTTPS. With
+// ADMIN_CLIENT_CA as well, admin endpoints also need a client certificate
+// chaining to that CA. The handshake only asks for one, so public endpoints
+// still work without it, and each admin request checks it, so a missing or
+// untrusted certificate gets a 403 rather than a failed handshake.
+type adminTLS struct {
+	config *tls.Config
+	// clientCAs is nil when client certificates aren't required.
+	clientCAs *x509.CertPool
+}
+
+func loadAdminTLS(cfg *relayConfig) (*adminTLS, error) {
+	if cfg.AdminTLSCert == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.AdminTLSCert, cfg.AdminTLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("ADMIN_TLS_CERT/ADMIN_TLS_KEY: %w", err)
+	}
+	a := &adminTLS{config: &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}}
+	if cfg.AdminClientCA == "" {
+		return a, nil
+	}
+	pem, err := os.ReadFile(cfg.AdminClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("ADMIN_CLIENT_CA: %w", err)
+	}
+	a.clientCAs = x509.NewCertPool()
+	if !a.clientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("ADMIN_CLIENT_CA: no PEM certificates in %s", cfg.AdminClientCA)
+	}
+	a.config.ClientAuth = tls.RequestClientCert
+	a.config.ClientCAs = a.clientCAs
+	return a, nil
+}
+
+// verifyClient checks the client certificate r was sent over the connection
+// with.
+func (a *adminTLS) verifyClient(r *http.Request) error {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return errors.New("client certificate required")
+	}
+	certs := r.TLS.PeerCertificates
+	opts := x509.VerifyOptions{
+		Roots:         a.clientCAs,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, c := range certs[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	if _, err := certs[0].Verify(opts); err != nil {
+		return errors.New("client certificate not trusted")
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// advertrefresh.go
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// === Advertisement refresh (ADVERTISE_REFRESH_INTERVAL) ===
+// The advertised addresses are built once and only change on POST
+// /readvertise. With ADVERTISE_REFRESH_INTERVAL set, every node re-asserts
+// them on that interval as /readvertise does: the advertisement is rebuilt
+// (re-resolving the hostname setting), the signed peer record re-sealed and
+// the addresses pushed to connected peers over identify. With COORDINATOR_URL
+// and a registration through, the relay also re-registers, which a
+// coordinator that ages entries out can treat as a heartbeat. There is no DHT
+// or rendezvous publishing to refresh.
+type advertRefresher struct {
+	interval time.Duration
+	nodes    []*relayNode
+	coord    *coordinator
+
+	refreshes atomic.Int64
+	mu        sync.Mutex
+	last      time.Time
+	lastErr   string
+}
+
+type advertRefreshInfo struct {
+	Interval  string     `json:"interval,omitempty"`
+	Last      *time.Time `json:"lastRefresh,omitempty"`
+	Refreshes int64      `json:"refreshes"`
+	LastError string     `json:"lastError,omitempty"`
+}
+
+func startAdvertRefresher(ctx context.Context, cfg *relayConfig, nodes []*relayNode, coord *coordinator) *advertRefresher {
+	r := &advertRefresher{interval: cfg.advertRefreshInterval, nodes: nodes, coord: coord}
+	if r.interval > 0 {
+		go r.run(ctx)
+		log.Printf("✅ Re-asserting advertised addresses every %s", r.interval)
+	}
+	return r
+}
+
+func (r *advertRefresher) run(ctx context.Context) {
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			r.refresh(ctx)
+		}
+	}
+}
+
+func (r *advertRefresher) refresh(ctx context.Context) {
+	var errs []string
+	for _, n := range r.nodes {
+		if _, err := n.readvertise(); err != nil {
+			log.Printf("⚠️ event=advert_refresh_failed node=%s err=%q", n.name, err)
+			errs = append(errs, n.name+": "+err.Error())
+		}
+	}
+	if err := r.coord.refresh(ctx); err != nil {
+		errs = append(errs, "coordinator: "+err.Error())
+	}
+	r.refreshes.Add(1)
+	r.mu.Lock()
+	r.last = time.Now().UTC()
+	r.lastErr = ""
+	if len(errs) > 0 {
+		r.lastErr = errs[0]
+	}
+	r.mu.Unlock()
+}
+
+func (r *advertRefresher) info() advertRefreshInfo {
+	info := advertRefreshInfo{Refreshes: r.refreshes.Load()}
+	if r.interval > 0 {
+		info.Interval = r.interval.String()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.last.IsZero() {
+		last := r.last
+		info.Last = &last
+	}
+	info.LastError = r.lastErr
+	return info
+}
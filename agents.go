@@ -0,0 +1,149 @@
+// agents.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
+)
+
+// === Client requirements (MIN_CLIENT_AGENT, REQUIRED_CLIENT_PROTOCOLS) ===
+// MIN_CLIENT_AGENT is comma-separated <name>/<min version> rules, e.g.
+// "torrentium/1.4.0". A rule applies to agents "<name>/<version>" or
+// "<name>@<version>"; clients on an older version are refused reservations.
+// Agents no rule names are allowed. REQUIRED_CLIENT_PROTOCOLS lists
+// protocols the client must announce in identify.
+const identifyWait = 2 * time.Second
+
+type agentRule struct {
+	name string
+	min  []int
+}
+
+type clientPolicy struct {
+	h         host.Host
+	rules     []agentRule
+	protocols []protocol.ID
+}
+
+func parseAgentRules(v string) ([]agentRule, error) {
+	var out []agentRule
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		i := strings.LastIndex(f, "/")
+		if i <= 0 {
+			return nil, fmt.Errorf("MIN_CLIENT_AGENT: %q is not <name>/<version>", f)
+		}
+		min, ok := parseVersion(f[i+1:])
+		if !ok {
+			return nil, fmt.Errorf("MIN_CLIENT_AGENT: %q has an invalid version", f)
+		}
+		out = append(out, agentRule{name: f[:i], min: min})
+	}
+	return out, nil
+}
+
+// parseVersion reads v1.2.3-style versions, ignoring pre-release/build
+// suffixes.
+func parseVersion(v string) ([]int, bool) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+ "); i >= 0 {
+		v = v[:i]
+	}
+	var out []int
+	for _, part := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		out = append(out, n)
+	}
+	return out, len(out) > 0
+}
+
+func newClientPolicy(h host.Host, cfg *relayConfig) *clientPolicy {
+	if len(cfg.minClientAgent) == 0 && len(cfg.RequiredClientProtocols) == 0 {
+		return nil
+	}
+	return &clientPolicy{h: h, rules: cfg.minClientAgent, protocols: cfg.RequiredClientProtocols}
+}
+
+// allow reports whether p meets the requirements, waiting briefly for
+// identify when the reservation arrives before it finished.
+func (c *clientPolicy) allow(p peer.ID) bool {
+	awaitIdentify(c.h, p)
+
+	agent := "unknown"
+	if v, err := c.h.Peerstore().Get(p, "AgentVersion"); err == nil {
+		agent, _ = v.(string)
+	}
+	if reason := c.check(agent); reason != "" {
+		log.Printf("Refusing reservation from %s: agent %q %s", p, agent, reason)
+		return false
+	}
+
+	if len(c.protocols) > 0 {
+		have, _ := c.h.Peerstore().SupportsProtocols(p, c.protocols...)
+		for _, want := range c.protocols {
+			if !slices.Contains(have, want) {
+				log.Printf("Refusing reservation from %s: agent %q does not support %s", p, agent, want)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// awaitIdentify waits up to identifyWait per connection for identify with p
+// to finish, so its agent and protocols are in the peerstore.
+func awaitIdentify(h host.Host, p peer.ID) {
+	// libp2p.New wraps the basic host, so match the method, not the type
+	bh, ok := h.(interface{ IDService() identify.IDService })
+	if !ok {
+		return
+	}
+	for _, conn := range h.Network().ConnsToPeer(p) {
+		select {
+		case <-bh.IDService().IdentifyWait(conn):
+		case <-time.After(identifyWait):
+		}
+	}
+}
+
+// check returns why agent fails a MIN_CLIENT_AGENT rule, or "".
+func (c *clientPolicy) check(agent string) string {
+	for _, r := range c.rules {
+		rest, ok := strings.CutPrefix(agent, r.name)
+		if !ok || rest == "" || (rest[0] != '/' && rest[0] != '@') {
+			continue
+		}
+		v, ok := parseVersion(rest[1:])
+		if !ok {
+			return "has an unparseable version"
+		}
+		if slices.Compare(v, r.min) < 0 {
+			return fmt.Sprintf("is older than the required %s/%s", r.name, versionString(r.min))
+		}
+		return ""
+	}
+	return ""
+}
+
+func versionString(v []int) string {
+	parts := make([]string, len(v))
+	for i, n := range v {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,190 @@
+// capacity.go
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// === Declared capacity (RESERVE_BANDWIDTH_BUDGET) ===
+// Circuit v2 RESERVE carries nothing about what the client means to use, so
+// a client may first declare it on capacityProto: one JSON line with the
+// bandwidth (bytes/s) it expects to relay, answered with one line saying
+// whether the budget has room right now. The declaration holds for
+// capacityDeclareTTL and is taken by the next RESERVE, which is refused when
+// it doesn't fit in what is left of RESERVE_BANDWIDTH_BUDGET and otherwise
+// holds that much of it while the reservation lives. Renewals keep their
+// share. Clients that declare nothing count as RESERVE_BANDWIDTH_DEFAULT,
+// 0 by default so they can always reserve as before.
+const (
+	capacityProto       = protocol.ID("/torrentium-relay/capacity/1.0.0")
+	capacityDeclareTTL  = time.Minute
+	capacityHoldGrace   = 30 * time.Second // from admission to the reservation showing up
+	capacityMaxDeclLine = 1024
+)
+
+type capacityDeclaration struct {
+	Version   int   `json:"v"`
+	Bandwidth int64 `json:"bandwidth"`
+}
+
+type capacityAnswer struct {
+	Version   int    `json:"v"`
+	OK        bool   `json:"ok"`
+	Remaining int64  `json:"remaining"`
+	Error     string `json:"error,omitempty"`
+}
+
+type capacityShare struct {
+	bandwidth int64
+	at        time.Time
+}
+
+type capacityBudget struct {
+	h            host.Host
+	reservations *reservationTracker
+	budget       int64
+	def          int64
+
+	mu       sync.Mutex
+	declared map[peer.ID]capacityShare
+	held     map[peer.ID]capacityShare
+	refused  atomic.Int64
+}
+
+type capacityInfo struct {
+	Budget    int64 `json:"budget"`
+	Default   int64 `json:"defaultBandwidth"`
+	Held      int64 `json:"held"`
+	Remaining int64 `json:"remaining"`
+	Holders   int   `json:"holders"`
+	Declared  int   `json:"pendingDeclarations"`
+	Refused   int64 `json:"refused"`
+}
+
+// newCapacityBudget returns nil without RESERVE_BANDWIDTH_BUDGET; a nil
+// budget admits everyone.
+func newCapacityBudget(h host.Host, cfg *relayConfig, reservations *reservationTracker) *capacityBudget {
+	if cfg.ReserveBandwidthBudget == 0 {
+		return nil
+	}
+	return &capacityBudget{
+		h:            h,
+		reservations: reservations,
+		budget:       cfg.ReserveBandwidthBudget,
+		def:          cfg.ReserveBandwidthDefault,
+		declared:     make(map[peer.ID]capacityShare),
+		held:         make(map[peer.ID]capacityShare),
+	}
+}
+
+func (c *capacityBudget) serve() {
+	c.h.SetStreamHandler(capacityProto, func(s network.Stream) {
+		defer s.Close()
+		_ = s.SetDeadline(time.Now().Add(5 * time.Second))
+		ans := capacityAnswer{Version: 1}
+		line, err := bufio.NewReaderSize(s, capacityMaxDeclLine).ReadSlice('\n')
+		var decl capacityDeclaration
+		switch {
+		case err != nil:
+			ans.Error = "want one JSON line"
+		case json.Unmarshal(line, &decl) != nil || decl.Version != 1:
+			ans.Error = `want {"v":1,"bandwidth":<bytes/s>}`
+		case decl.Bandwidth < 0:
+			ans.Error = "bandwidth must not be negative"
+		default:
+			ans.Remaining, ans.OK = c.declare(s.Conn().RemotePeer(), decl.Bandwidth)
+		}
+		_ = json.NewEncoder(s).Encode(ans)
+	})
+}
+
+// declare records p's bandwidth for its next RESERVE and reports what is
+// left for it and whether that would fit now.
+func (c *capacityBudget) declare(p peer.ID, bandwidth int64) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.pruneLocked(now)
+	c.declared[p] = capacityShare{bandwidth: bandwidth, at: now}
+	left := c.budget - c.heldLocked() + c.held[p].bandwidth
+	return left, bandwidth <= left
+}
+
+// admit decides p's RESERVE against the remaining budget, holding its share
+// when it fits.
+func (c *capacityBudget) admit(p peer.ID) bool {
+	if c == nil {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.pruneLocked(now)
+	want := c.def
+	if d, ok := c.declared[p]; ok {
+		want = d.bandwidth
+		delete(c.declared, p)
+	} else if h, ok := c.held[p]; ok {
+		want = h.bandwidth
+	}
+	left := c.budget - c.heldLocked() + c.held[p].bandwidth
+	if want > left {
+		n := c.refused.Add(1)
+		log.Printf("Refusing reservation from %s: declared bandwidth %d B/s, %d B/s of RESERVE_BANDWIDTH_BUDGET left (%d refused so far)", p, want, left, n)
+		return false
+	}
+	c.held[p] = capacityShare{bandwidth: want, at: now}
+	return true
+}
+
+// pruneLocked drops stale declarations and the shares of peers whose
+// reservation is gone (or never came). Callers hold c.mu.
+func (c *capacityBudget) pruneLocked(now time.Time) {
+	for p, d := range c.declared {
+		if now.Sub(d.at) > capacityDeclareTTL {
+			delete(c.declared, p)
+		}
+	}
+	for p, h := range c.held {
+		if now.Sub(h.at) > capacityHoldGrace && !c.reservations.has(p) {
+			delete(c.held, p)
+		}
+	}
+}
+
+func (c *capacityBudget) heldLocked() int64 {
+	var sum int64
+	for _, h := range c.held {
+		sum += h.bandwidth
+	}
+	return sum
+}
+
+func (c *capacityBudget) info() *capacityInfo {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked(time.Now())
+	held := c.heldLocked()
+	return &capacityInfo{
+		Budget:    c.budget,
+		Default:   c.def,
+		Held:      held,
+		Remaining: c.budget - held,
+		Holders:   len(c.held),
+		Declared:  len(c.declared),
+		Refused:   c.refused.Load(),
+	}
+}
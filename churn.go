@@ -0,0 +1,165 @@
+// churn.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Connection churn detector (CHURN_MAX_CONNECTS) ===
+// A peer that opens more than CHURN_MAX_CONNECTS inbound connections within
+// CHURN_WINDOW is flapping: it is logged once as event=peer_flapping and its
+// connections are refused at the security handshake (reason "flapping") for
+// CHURN_BAN, doubling with every repeat up to CHURN_BAN_MAX. A peer that
+// stays clean for CHURN_BAN_MAX after a ban starts over at CHURN_BAN.
+// Connection caps only bound how many connections are open at once; this
+// catches the peer that keeps one open and churns it.
+type churnConfig struct {
+	MaxConnects int    `json:"maxConnects"`
+	Window      string `json:"window,omitempty"`
+	Ban         string `json:"ban,omitempty"`
+	BanMax      string `json:"banMax,omitempty"`
+
+	window, ban, banMax time.Duration
+}
+
+func loadChurnConfig() (churnConfig, error) {
+	maxConnects, err := envInt("CHURN_MAX_CONNECTS", 0)
+	if err != nil {
+		return churnConfig{}, err
+	}
+	if maxConnects < 0 {
+		return churnConfig{}, fmt.Errorf("CHURN_MAX_CONNECTS must not be negative, got %d", maxConnects)
+	}
+	if maxConnects == 0 {
+		return churnConfig{}, nil
+	}
+	window, err := envDuration("CHURN_WINDOW", time.Minute)
+	if err != nil {
+		return churnConfig{}, err
+	}
+	ban, err := envDuration("CHURN_BAN", time.Minute)
+	if err != nil {
+		return churnConfig{}, err
+	}
+	banMax, err := envDuration("CHURN_BAN_MAX", time.Hour)
+	if err != nil {
+		return churnConfig{}, err
+	}
+	if window < time.Second || ban < time.Second {
+		return churnConfig{}, fmt.Errorf("CHURN_WINDOW and CHURN_BAN must be at least 1s")
+	}
+	if banMax < ban {
+		return churnConfig{}, fmt.Errorf("CHURN_BAN_MAX must be at least CHURN_BAN (%s), got %s", ban, banMax)
+	}
+	return churnConfig{
+		MaxConnects: maxConnects,
+		Window:      window.String(),
+		Ban:         ban.String(),
+		BanMax:      banMax.String(),
+		window:      window,
+		ban:         ban,
+		banMax:      banMax,
+	}, nil
+}
+
+type churnDetector struct {
+	cfg churnConfig
+
+	mu        sync.Mutex
+	peers     map[peer.ID]*churnState
+	lastPrune time.Time
+}
+
+type churnState struct {
+	connects    []time.Time // inside the window
+	bannedUntil time.Time
+	strikes     int
+}
+
+type flappingPeer struct {
+	Peer        string    `json:"peer"`
+	BannedUntil time.Time `json:"bannedUntil"`
+	Strikes     int       `json:"strikes"`
+}
+
+func newChurnDetector(cfg churnConfig) *churnDetector {
+	return &churnDetector{cfg: cfg, peers: make(map[peer.ID]*churnState)}
+}
+
+// connect records an inbound connection from p and reports whether it is to
+// be refused, with the time left on the ban.
+func (d *churnDetector) connect(p peer.ID) (time.Duration, bool) {
+	if d.cfg.MaxConnects == 0 {
+		return 0, false
+	}
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prune(now)
+
+	st, ok := d.peers[p]
+	if !ok {
+		st = &churnState{}
+		d.peers[p] = st
+	}
+	if now.Before(st.bannedUntil) {
+		return st.bannedUntil.Sub(now), true
+	}
+	if st.strikes > 0 && now.Sub(st.bannedUntil) > d.cfg.banMax {
+		st.strikes = 0
+	}
+
+	cut := now.Add(-d.cfg.window)
+	kept := st.connects[:0]
+	for _, t := range st.connects {
+		if t.After(cut) {
+			kept = append(kept, t)
+		}
+	}
+	st.connects = append(kept, now)
+	if len(st.connects) <= d.cfg.MaxConnects {
+		return 0, false
+	}
+
+	ban := min(d.cfg.banMax, d.cfg.ban<<min(st.strikes, 30))
+	st.strikes++
+	st.bannedUntil = now.Add(ban)
+	log.Printf("⚠️ event=peer_flapping peer=%s connects=%d window=%s ban=%s strikes=%d", p, len(st.connects), d.cfg.window, ban, st.strikes)
+	st.connects = nil
+	return ban, true
+}
+
+// prune drops peers with nothing in the window, no ban and no strikes that
+// still count, once per window. Callers hold d.mu.
+func (d *churnDetector) prune(now time.Time) {
+	if now.Sub(d.lastPrune) < d.cfg.window {
+		return
+	}
+	d.lastPrune = now
+	cut := now.Add(-d.cfg.window)
+	for p, st := range d.peers {
+		recent := len(st.connects) > 0 && st.connects[len(st.connects)-1].After(cut)
+		if !recent && now.Sub(st.bannedUntil) > d.cfg.banMax {
+			delete(d.peers, p)
+		}
+	}
+}
+
+// flapping lists the peers banned right now.
+func (d *churnDetector) flapping() []flappingPeer {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := []flappingPeer{}
+	for p, st := range d.peers {
+		if now.Before(st.bannedUntil) {
+			out = append(out, flappingPeer{Peer: p.String(), BannedUntil: st.bannedUntil, Strikes: st.strikes})
+		}
+	}
+	return out
+}
@@ -0,0 +1,93 @@
+// circuitbuffers.go
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Circuit buffers (RELAY_BUFFER_SIZE, RELAY_BUFFER_BUDGET) ===
+// go-libp2p copies each circuit direction through a buffer of
+// RELAY_BUFFER_SIZE bytes taken from its shared pool (go-buffer-pool, built
+// on sync.Pool) and holds it until the circuit closes, because the copy loop
+// sits in Read even when nothing arrives. Another pool in front of it
+// wouldn't free anything, so the knobs are the size of those buffers and,
+// with RELAY_BUFFER_BUDGET, a cap on their total: a circuit that would take
+// the relay past it isn't opened (CONNECTION_FAILED, logged as
+// event=buffer_budget). A circuit counts from its stop stream being opened
+// until the relay closes it, like DEST_MAX_CIRCUITS.
+var errBufferBudget = errors.New("circuit buffer budget reached")
+
+type circuitBuffers struct {
+	size   int64
+	budget int64
+
+	inUse   atomic.Int64
+	peak    atomic.Int64
+	refused atomic.Int64
+
+	mu      sync.Mutex
+	lastLog time.Time
+}
+
+type circuitBuffersInfo struct {
+	BufferSize int64 `json:"bufferSize"`
+	PerCircuit int64 `json:"perCircuit"`
+	InUse      int64 `json:"inUseBytes"`
+	Peak       int64 `json:"peakBytes"`
+	Budget     int64 `json:"budgetBytes,omitempty"`
+	Refused    int64 `json:"refused"`
+}
+
+func newCircuitBuffers(cfg *relayConfig) *circuitBuffers {
+	return &circuitBuffers{size: int64(cfg.RelayBufferSize), budget: cfg.RelayBufferBudget}
+}
+
+// perCircuit is what one circuit holds: a buffer per direction.
+func (b *circuitBuffers) perCircuit() int64 {
+	return 2 * b.size
+}
+
+// acquire accounts for a circuit to p, refusing it past the budget.
+func (b *circuitBuffers) acquire(p peer.ID) error {
+	need := b.perCircuit()
+	for {
+		cur := b.inUse.Load()
+		if b.budget > 0 && cur+need > b.budget {
+			n := b.refused.Add(1)
+			// one line per 10s at most during a burst
+			b.mu.Lock()
+			if time.Since(b.lastLog) >= 10*time.Second {
+				b.lastLog = time.Now()
+				log.Printf("⚠️ event=buffer_budget dest=%s in_use=%d budget=%d refused_total=%d", p, cur, b.budget, n)
+			}
+			b.mu.Unlock()
+			return errBufferBudget
+		}
+		if next := cur + need; b.inUse.CompareAndSwap(cur, next) {
+			for peak := b.peak.Load(); next > peak && !b.peak.CompareAndSwap(peak, next); peak = b.peak.Load() {
+			}
+			return nil
+		}
+	}
+}
+
+func (b *circuitBuffers) release() {
+	b.inUse.Add(-b.perCircuit())
+}
+
+func (b *circuitBuffers) info() circuitBuffersInfo {
+	return circuitBuffersInfo{
+		BufferSize: b.size,
+		PerCircuit: b.perCircuit(),
+		InUse:      b.inUse.Load(),
+		Peak:       b.peak.Load(),
+		Budget:     b.budget,
+		Refused:    b.refused.Load(),
+	}
+}
@@ -0,0 +1,193 @@
+// circuitpriority.go
+package main
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/prometheus/client_golang/prometheus"
+	xrate "golang.org/x/time/rate"
+)
+
+// === Circuit priority (RELAY_BANDWIDTH_LIMIT) ===
+// RELAY_BANDWIDTH_LIMIT caps the bytes/s a node relays over all its circuits,
+// both directions together. Under the cap, circuits are scheduled by the
+// priority of the reservation they go to: its RELAY_TIERS tier's "priority"
+// (default 1), or VIP_PRIORITY for VIP_PEERS if that is higher. Every
+// bandwidthTick the cap is split among the priorities that moved data or
+// waited during the last tick, in proportion to their priority, and the
+// circuits of one priority share theirs first come first served. An idle
+// priority's share goes to the busy ones, so a lone free-tier circuit still
+// gets the whole cap. The wait happens in the relay's copy loop (hopStream
+// Read and Write), so a throttled circuit just slows down.
+const bandwidthTick = 100 * time.Millisecond
+
+type bandwidthScheduler struct {
+	limit int64
+	burst int
+
+	mu      sync.Mutex
+	classes map[int]*priorityClass
+}
+
+type priorityClass struct {
+	priority int
+	lim      *xrate.Limiter
+
+	bytes     atomic.Int64
+	waiting   atomic.Int64
+	throttled atomic.Int64 // nanoseconds spent waiting
+	share     atomic.Int64 // bytes/s allocated at the last tick, 0 while idle
+
+	lastBytes int64 // bytes at the last tick, under mu
+}
+
+type bandwidthInfo struct {
+	Limit      int64          `json:"limitBytesPerSec"`
+	Priorities []priorityInfo `json:"priorities"`
+}
+
+type priorityInfo struct {
+	Priority  int     `json:"priority"`
+	Share     int64   `json:"shareBytesPerSec"`
+	Bytes     int64   `json:"relayedBytes"`
+	Waiting   int64   `json:"waiting"`
+	Throttled float64 `json:"throttledSeconds"`
+}
+
+// newBandwidthScheduler returns nil without RELAY_BANDWIDTH_LIMIT; a nil
+// scheduler never waits.
+func newBandwidthScheduler(cfg *relayConfig) *bandwidthScheduler {
+	if cfg.RelayBandwidthLimit == 0 {
+		return nil
+	}
+	s := &bandwidthScheduler{
+		limit:   cfg.RelayBandwidthLimit,
+		burst:   max(cfg.RelayBufferSize, int(cfg.RelayBandwidthLimit*int64(bandwidthTick)/int64(time.Second))),
+		classes: make(map[int]*priorityClass),
+	}
+	go func() {
+		for range time.Tick(bandwidthTick) {
+			s.mu.Lock()
+			s.rebalanceLocked(nil)
+			s.mu.Unlock()
+		}
+	}()
+	return s
+}
+
+// priorityFor is the scheduling priority of circuits to p's reservation.
+func (c *relayConfig) priorityFor(p peer.ID, tier *limitTier) int {
+	prio := max(tier.Priority, 1)
+	if c.vipPeers[p] {
+		prio = max(prio, c.VIPPriority)
+	}
+	return prio
+}
+
+// wait blocks until n bytes of a priority prio circuit fit in its share.
+func (s *bandwidthScheduler) wait(prio, n int) {
+	if s == nil || n <= 0 {
+		return
+	}
+	c := s.class(prio)
+	c.waiting.Add(1)
+	start := time.Now()
+	for left := n; left > 0; left -= s.burst {
+		_ = c.lim.WaitN(context.Background(), min(left, s.burst))
+	}
+	c.throttled.Add(int64(time.Since(start)))
+	c.waiting.Add(-1)
+	c.bytes.Add(int64(n))
+}
+
+func (s *bandwidthScheduler) class(prio int) *priorityClass {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.classes[prio]
+	if !ok {
+		c = &priorityClass{priority: prio, lim: xrate.NewLimiter(xrate.Limit(s.limit), s.burst)}
+		s.classes[prio] = c
+		s.rebalanceLocked(c)
+	}
+	return c
+}
+
+// rebalanceLocked splits the limit among the active priorities, joining
+// counting as active. An idle priority keeps the rate it would get on
+// becoming active, so it can't overshoot before the next tick. Callers hold
+// s.mu.
+func (s *bandwidthScheduler) rebalanceLocked(joining *priorityClass) {
+	active := make(map[*priorityClass]bool, len(s.classes))
+	var sum int
+	for _, c := range s.classes {
+		bytes := c.bytes.Load()
+		if c == joining || c.waiting.Load() > 0 || bytes != c.lastBytes {
+			active[c] = true
+			sum += c.priority
+		}
+		c.lastBytes = bytes
+	}
+	for _, c := range s.classes {
+		if active[c] {
+			share := s.limit * int64(c.priority) / int64(sum)
+			c.share.Store(share)
+			c.lim.SetLimit(xrate.Limit(share))
+			continue
+		}
+		c.share.Store(0)
+		c.lim.SetLimit(xrate.Limit(s.limit * int64(c.priority) / int64(sum+c.priority)))
+	}
+}
+
+func (s *bandwidthScheduler) info() *bandwidthInfo {
+	if s == nil {
+		return nil
+	}
+	info := &bandwidthInfo{Limit: s.limit, Priorities: []priorityInfo{}}
+	s.mu.Lock()
+	for _, c := range s.classes {
+		info.Priorities = append(info.Priorities, priorityInfo{
+			Priority:  c.priority,
+			Share:     c.share.Load(),
+			Bytes:     c.bytes.Load(),
+			Waiting:   c.waiting.Load(),
+			Throttled: time.Duration(c.throttled.Load()).Seconds(),
+		})
+	}
+	s.mu.Unlock()
+	slices.SortFunc(info.Priorities, func(a, b priorityInfo) int { return b.Priority - a.Priority })
+	return info
+}
+
+// bandwidthCollector reports each priority's current share of
+// RELAY_BANDWIDTH_LIMIT and the bytes it relayed; nothing when the limit is
+// off.
+type bandwidthCollector struct{ s *bandwidthScheduler }
+
+var (
+	bandwidthShareDesc = prometheus.NewDesc("torrentium_relay_priority_bandwidth_share_bytes", "Bytes/s of RELAY_BANDWIDTH_LIMIT allocated to circuits of this priority (0 while idle).", []string{"priority"}, nil)
+	bandwidthBytesDesc = prometheus.NewDesc("torrentium_relay_priority_relayed_bytes_total", "Bytes relayed over circuits of this priority under RELAY_BANDWIDTH_LIMIT.", []string{"priority"}, nil)
+)
+
+func (bandwidthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- bandwidthShareDesc
+	ch <- bandwidthBytesDesc
+}
+
+func (c bandwidthCollector) Collect(ch chan<- prometheus.Metric) {
+	info := c.s.info()
+	if info == nil {
+		return
+	}
+	for _, p := range info.Priorities {
+		prio := strconv.Itoa(p.Priority)
+		ch <- prometheus.MustNewConstMetric(bandwidthShareDesc, prometheus.GaugeValue, float64(p.Share), prio)
+		ch <- prometheus.MustNewConstMetric(bandwidthBytesDesc, prometheus.CounterValue, float64(p.Bytes), prio)
+	}
+}
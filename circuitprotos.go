@@ -0,0 +1,70 @@
+// circuitprotos.go
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// === Circuit protocol filter (CIRCUIT_PROTOCOLS) ===
+// What a circuit carries is out of the relay's sight: source and destination
+// run Noise or TLS end to end over it, and their application protocols are
+// negotiated inside that, on muxed streams. What the relay can see is what
+// each side announced in identify, so with CIRCUIT_PROTOCOLS set a CONNECT
+// is refused (PERMISSION_DENIED, event=circuit_protocol_denied) unless source
+// and destination both announce at least one protocol on the list. It keeps
+// clients of other applications off the relay; it doesn't stop a peer that
+// announces a listed protocol from relaying anything else.
+type circuitProtocols struct {
+	h         host.Host
+	protocols []protocol.ID
+
+	refusedSource atomic.Int64
+	refusedDest   atomic.Int64
+}
+
+type circuitProtocolsInfo struct {
+	Protocols     []protocol.ID `json:"protocols"`
+	RefusedSource int64         `json:"refusedSource"`
+	RefusedDest   int64         `json:"refusedDest"`
+}
+
+func newCircuitProtocols(h host.Host, cfg *relayConfig) *circuitProtocols {
+	if len(cfg.CircuitProtocols) == 0 {
+		return nil
+	}
+	return &circuitProtocols{h: h, protocols: cfg.CircuitProtocols}
+}
+
+// allow reports whether src and dest share a listed protocol. The destination
+// holds a reservation, so identify with it is long done; the source may have
+// connected just now and gets a short wait.
+func (c *circuitProtocols) allow(src, dest peer.ID) bool {
+	if c == nil {
+		return true
+	}
+	destHas, _ := c.h.Peerstore().SupportsProtocols(dest, c.protocols...)
+	if len(destHas) == 0 {
+		n := c.refusedDest.Add(1)
+		eventf("circuit_protocol_denied", "⚠️ event=circuit_protocol_denied src=%s dest=%s side=dest refused_total=%d", src, dest, n)
+		return false
+	}
+	awaitIdentify(c.h, src)
+	srcHas, _ := c.h.Peerstore().SupportsProtocols(src, destHas...)
+	if len(srcHas) == 0 {
+		n := c.refusedSource.Add(1)
+		eventf("circuit_protocol_denied", "⚠️ event=circuit_protocol_denied src=%s dest=%s side=source refused_total=%d", src, dest, n)
+		return false
+	}
+	return true
+}
+
+func (c *circuitProtocols) info() *circuitProtocolsInfo {
+	if c == nil {
+		return nil
+	}
+	return &circuitProtocolsInfo{Protocols: c.protocols, RefusedSource: c.refusedSource.Load(), RefusedDest: c.refusedDest.Load()}
+}
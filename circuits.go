@@ -0,0 +1,244 @@
+// circuits.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+)
+
+// === Active relayed circuits ===
+// A circuit is opened when the relay answers a CONNECT with OK and closed
+// when its hop stream is closed or reset.
+type circuit struct {
+	id    uint64
+	src   peer.ID
+	dst   peer.ID
+	start time.Time
+
+	// tier is the destination's limit tier; limitData is the per-direction
+	// byte limit the circuit is cut at and warnAt the count at which it is
+	// flagged as nearing it (0 = off). advertisedData is the tier's limit as
+	// sent to clients and softAt the ENFORCED_LIMIT_DATA to log at in soft
+	// mode (0 = off).
+	tier           string
+	priority       int
+	limitData      int64
+	warnAt         int64
+	advertisedData int64
+	softAt         int64
+
+	srcToDst atomic.Int64
+	dstToSrc atomic.Int64
+	warned   atomic.Bool
+
+	enforcedHit atomic.Bool
+
+	// sample is the head of the relayed bytes with RELAY_COMPRESSION, else nil.
+	sample *circuitSample
+
+	// The data limit applies to the bytes counted since winStart (unix
+	// nanos); with a cumulative CIRCUIT_DATA_WINDOW that is the whole
+	// circuit, otherwise the counts restart every window or renewal.
+	window    time.Duration
+	winStart  atomic.Int64
+	winSrcDst atomic.Int64
+	winDstSrc atomic.Int64
+}
+
+// tag is the conn manager protection tag held on both ends of the circuit.
+func (c *circuit) tag() string {
+	return fmt.Sprintf("relay-circuit-%d", c.id)
+}
+
+type circuitInfo struct {
+	ID        uint64    `json:"id"`
+	Src       string    `json:"src"`
+	Dst       string    `json:"dst"`
+	Start     time.Time `json:"start"`
+	Tier      string    `json:"tier"`
+	BytesUp   int64     `json:"bytesSrcToDst"`
+	BytesDown int64     `json:"bytesDstToSrc"`
+}
+
+func (c *circuit) info() circuitInfo {
+	return circuitInfo{
+		ID:        c.id,
+		Src:       c.src.String(),
+		Dst:       c.dst.String(),
+		Start:     c.start,
+		Tier:      c.tier,
+		BytesUp:   c.srcToDst.Load(),
+		BytesDown: c.dstToSrc.Load(),
+	}
+}
+
+type circuitTracker struct {
+	mu     sync.Mutex
+	nextID uint64
+	open   map[uint64]*circuit
+
+	// warnPct is the share of a circuit's data limit at which it is flagged
+	// as nearing it (0 = off).
+	warnPct float64
+	stats   *relayStats
+	cfg     *relayConfig
+	sizes   *circuitSizes
+
+	compression *compressionSampler
+
+	dataWindow    time.Duration
+	renewalWindow bool
+}
+
+func newCircuitTracker(cfg *relayConfig, stats *relayStats) *circuitTracker {
+	return &circuitTracker{
+		open:          make(map[uint64]*circuit),
+		warnPct:       cfg.DataWarnPercent,
+		stats:         stats,
+		cfg:           cfg,
+		sizes:         newCircuitSizes(cfg.CircuitSizeBuckets),
+		compression:   &compressionSampler{},
+		dataWindow:    cfg.circuitDataWindow,
+		renewalWindow: cfg.CircuitDataWindow == dataWindowRenewal,
+	}
+}
+
+func (t *circuitTracker) add(src, dst peer.ID, tier *limitTier) *circuit {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nextID++
+	limit, softAt := t.cfg.enforcedLimits(tier.limit.Data)
+	c := &circuit{
+		id:             t.nextID,
+		src:            src,
+		dst:            dst,
+		start:          time.Now(),
+		tier:           tier.Name,
+		priority:       t.cfg.priorityFor(dst, tier),
+		limitData:      limit,
+		warnAt:         int64(float64(limit) * t.warnPct / 100),
+		advertisedData: tier.limit.Data,
+		softAt:         softAt,
+		window:         t.dataWindow,
+	}
+	if t.cfg.RelayCompression {
+		c.sample = &circuitSample{}
+	}
+	c.winStart.Store(c.start.UnixNano())
+	t.open[c.id] = c
+	t.stats.circuitsOpened.Add(1)
+	return c
+}
+
+func (t *circuitTracker) remove(c *circuit) {
+	t.mu.Lock()
+	delete(t.open, c.id)
+	t.mu.Unlock()
+	t.sizes.observe(c)
+	if c.sample != nil {
+		t.compression.measure(c.sample)
+	}
+}
+
+// remaining is how many more bytes may go in a direction before the tier's
+// data limit is reached in the current window.
+func (c *circuit) remaining(srcToDst bool) int64 {
+	if c.window > 0 {
+		start := c.winStart.Load()
+		if now := time.Now().UnixNano(); now-start >= int64(c.window) && c.winStart.CompareAndSwap(start, now) {
+			c.resetWindow(now)
+		}
+	}
+	if srcToDst {
+		return c.limitData - c.winSrcDst.Load()
+	}
+	return c.limitData - c.winDstSrc.Load()
+}
+
+func (c *circuit) resetWindow(now int64) {
+	c.winStart.Store(now)
+	c.winSrcDst.Store(0)
+	c.winDstSrc.Store(0)
+	c.warned.Store(false)
+	c.enforcedHit.Store(false)
+}
+
+// observe is a relayHost hop observer: with CIRCUIT_DATA_WINDOW=renewal a
+// destination renewing its reservation restarts the data count of its
+// circuits.
+func (t *circuitTracker) observe(ev hopEvent) {
+	if !t.renewalWindow || ev.Type != pbv2.HopMessage_RESERVE || ev.Status != pbv2.Status_OK {
+		return
+	}
+	now := time.Now().UnixNano()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range t.open {
+		if c.dst == ev.Peer {
+			c.resetWindow(now)
+		}
+	}
+}
+
+// record accounts n relayed bytes and warns once when a direction crosses warnAt.
+func (t *circuitTracker) record(c *circuit, srcToDst bool, n int) {
+	if n <= 0 {
+		return
+	}
+	t.stats.relayedBytes.Add(int64(n))
+	var total int64
+	if srcToDst {
+		t.stats.bytesSrcToDst.Add(int64(n))
+		c.srcToDst.Add(int64(n))
+		total = c.winSrcDst.Add(int64(n))
+	} else {
+		t.stats.bytesDstToSrc.Add(int64(n))
+		c.dstToSrc.Add(int64(n))
+		total = c.winDstSrc.Add(int64(n))
+	}
+	if c.warnAt > 0 && total >= c.warnAt && c.warned.CompareAndSwap(false, true) {
+		t.stats.nearLimitWarnings.Add(1)
+		log.Printf("⚠️ Circuit %d (%s -> %s) passed %d bytes, nearing the data limit", c.id, c.src, c.dst, total)
+	}
+	if c.softAt > 0 && total >= c.softAt {
+		t.enforcedLimitHit(c, total)
+	}
+}
+
+// nearLimit returns open circuits that have crossed their warnAt.
+func (t *circuitTracker) nearLimit() []circuitInfo {
+	var out []circuitInfo
+	t.mu.Lock()
+	for _, c := range t.open {
+		if c.warnAt > 0 && max(c.winSrcDst.Load(), c.winDstSrc.Load()) >= c.warnAt {
+			out = append(out, c.info())
+		}
+	}
+	t.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// list returns open circuits oldest first; empty src/dst match any peer.
+func (t *circuitTracker) list(src, dst peer.ID) []circuitInfo {
+	t.mu.Lock()
+	out := make([]circuitInfo, 0, len(t.open))
+	for _, c := range t.open {
+		if (src != "" && c.src != src) || (dst != "" && c.dst != dst) {
+			continue
+		}
+		out = append(out, c.info())
+	}
+	t.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
@@ -0,0 +1,93 @@
+// circuitsize.go
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// === Circuit size distribution (CIRCUIT_SIZE_BUCKETS) ===
+// Every closed circuit's total bytes (both directions) goes into the
+// torrentium_relay_circuit_bytes histogram on /metrics, with the bucket
+// bounds from CIRCUIT_SIZE_BUCKETS, and into a ring of the last
+// circuitSizeWindow circuits that /stats reports p50/p95/p99 from. Tells
+// signalling-sized circuits apart from bulk transfers when tuning limits.
+const circuitSizeWindow = 1024
+
+var defaultCircuitSizeBuckets = []float64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 128 << 10, 512 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20}
+
+func circuitSizeBuckets() ([]float64, error) {
+	v := envString("CIRCUIT_SIZE_BUCKETS", "")
+	if v == "" {
+		return defaultCircuitSizeBuckets, nil
+	}
+	var out []float64
+	for _, f := range strings.Split(v, ",") {
+		n, err := strconv.ParseInt(strings.TrimSpace(f), 10, 64)
+		if err != nil || n <= 0 || (len(out) > 0 && float64(n) <= out[len(out)-1]) {
+			return nil, fmt.Errorf("invalid CIRCUIT_SIZE_BUCKETS %q (want increasing positive byte counts, e.g. 1024,65536,1048576)", v)
+		}
+		out = append(out, float64(n))
+	}
+	return out, nil
+}
+
+type circuitSizes struct {
+	hist prometheus.Histogram
+
+	mu     sync.Mutex
+	recent []int64 // ring, next write at recent[count%len]
+	count  int64
+}
+
+type circuitSizeInfo struct {
+	Circuits int64 `json:"circuits"`
+	Window   int   `json:"window"`
+	P50      int64 `json:"p50"`
+	P95      int64 `json:"p95"`
+	P99      int64 `json:"p99"`
+}
+
+func newCircuitSizes(buckets []float64) *circuitSizes {
+	return &circuitSizes{
+		hist: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "torrentium_relay", Name: "circuit_bytes",
+			Help:    "Total bytes relayed per closed circuit, both directions.",
+			Buckets: buckets,
+		}),
+		recent: make([]int64, 0, circuitSizeWindow),
+	}
+}
+
+func (s *circuitSizes) observe(c *circuit) {
+	n := c.srcToDst.Load() + c.dstToSrc.Load()
+	s.hist.Observe(float64(n))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.recent) < circuitSizeWindow {
+		s.recent = append(s.recent, n)
+	} else {
+		s.recent[s.count%circuitSizeWindow] = n
+	}
+	s.count++
+}
+
+// info returns nearest-rank percentiles over the ring.
+func (s *circuitSizes) info() circuitSizeInfo {
+	s.mu.Lock()
+	sorted := slices.Clone(s.recent)
+	info := circuitSizeInfo{Circuits: s.count, Window: len(sorted)}
+	s.mu.Unlock()
+	if len(sorted) == 0 {
+		return info
+	}
+	slices.Sort(sorted)
+	rank := func(p int) int64 { return sorted[(len(sorted)*p+99)/100-1] }
+	info.P50, info.P95, info.P99 = rank(50), rank(95), rank(99)
+	return info
+}
@@ -0,0 +1,68 @@
+// clientconfig.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// === Client configuration (/client-config) ===
+// A block to paste into a Torrentium client's config as is, so it isn't
+// sent in the usual API envelope:
+//
+//	{"format": 1, "relays": [{"peerId": "12D3KooW...",
+//	  "multiaddrs": ["/dns4/relay.example.com/tcp/443/wss/p2p/12D3KooW..."],
+//	  "transports": ["wss"], "limits": {"reservationTTL": "1h0m0s",
+//	  "limitDuration": "2m0s", "limitDataBytes": 131072}, "vouchers": true}]}
+//
+// There is one entry per relay node, primary first. Multiaddrs are every
+// advertised address, most reachable first, which is the order clients
+// should dial them in. Limits are the default tier's; a client on a
+// RELAY_TIERS tier gets its own in the reservation. format changes only when
+// the shape does.
+const clientConfigFormat = 1
+
+type clientConfig struct {
+	Format int                 `json:"format"`
+	Relays []clientRelayConfig `json:"relays"`
+}
+
+type clientRelayConfig struct {
+	PeerID     string            `json:"peerId"`
+	Multiaddrs []string          `json:"multiaddrs"`
+	Transports []string          `json:"transports"`
+	Limits     clientRelayLimits `json:"limits"`
+	Vouchers   bool              `json:"vouchers"`
+}
+
+type clientRelayLimits struct {
+	ReservationTTL string `json:"reservationTTL"`
+	LimitDuration  string `json:"limitDuration,omitempty"`
+	LimitData      int64  `json:"limitDataBytes,omitempty"`
+}
+
+func (s *statusServer) clientConfig() clientConfig {
+	l := s.cfg.limits()
+	limits := clientRelayLimits{ReservationTTL: l.ReservationTTL, LimitDuration: l.LimitDuration, LimitData: l.LimitDataBytes}
+	out := clientConfig{Format: clientConfigFormat, Relays: []clientRelayConfig{}}
+	for _, n := range s.nodes {
+		t := n.advertisedTransports()
+		rc := clientRelayConfig{PeerID: t.PeerID, Multiaddrs: []string{}, Transports: []string{}, Limits: limits, Vouchers: s.cfg.ReservationVouchers}
+		for _, a := range t.Advertised {
+			rc.Transports = append(rc.Transports, a.Transport)
+			rc.Multiaddrs = append(rc.Multiaddrs, a.Addrs...)
+		}
+		out.Relays = append(out.Relays, rc)
+	}
+	return out
+}
+
+// GET /client-config
+func (s *statusServer) handleClientConfig(w http.ResponseWriter, r *http.Request) {
+	body, err := json.MarshalIndent(s.clientConfig(), "", "  ")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeCached(w, r, "application/json", append(body, '\n'))
+}
@@ -0,0 +1,167 @@
+// clockskew.go
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// === Clock skew check (CLOCK_SKEW_NTP_SERVER) ===
+// Reservations carry an absolute expiry that clients read against their own
+// clocks, and TTLs, idle revocation and vouchers all go by the host clock, so
+// a skewed host hands out reservations that look expired early or linger.
+// With an NTP server set, the relay asks it for the time (SNTP, one UDP
+// exchange) at startup and every CLOCK_SKEW_INTERVAL after, and logs
+// event=clock_skew when the offset is beyond CLOCK_SKEW_THRESHOLD either
+// way. The last measurement is on /stats as clockSkew. A failed query is
+// logged and leaves the previous offset in place.
+const (
+	ntpEpochOffset = 2208988800 // seconds from 1900 (NTP) to 1970 (Unix)
+	ntpTimeout     = 5 * time.Second
+)
+
+type clockSkew struct {
+	server    string
+	interval  time.Duration
+	threshold time.Duration
+
+	mu   sync.Mutex
+	info clockSkewInfo
+}
+
+type clockSkewInfo struct {
+	Server    string     `json:"server"`
+	Offset    string     `json:"offset,omitempty"`
+	OffsetMs  int64      `json:"offsetMs"`
+	Skewed    bool       `json:"skewed"`
+	Threshold string     `json:"threshold"`
+	CheckedAt *time.Time `json:"checkedAt,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+}
+
+func startClockSkewCheck(ctx context.Context, cfg *relayConfig) *clockSkew {
+	if cfg.ClockSkewServer == "" {
+		return nil
+	}
+	c := &clockSkew{server: cfg.ClockSkewServer, interval: cfg.clockSkewInterval, threshold: cfg.clockSkewThreshold}
+	c.info = clockSkewInfo{Server: c.server, Threshold: c.threshold.String()}
+	go c.run(ctx)
+	log.Printf("✅ Clock skew check against %s every %s (threshold %s)", c.server, c.interval, c.threshold)
+	return c
+}
+
+func (c *clockSkew) run(ctx context.Context) {
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+	for {
+		c.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (c *clockSkew) check(ctx context.Context) {
+	offset, err := sntpOffset(ctx, c.server)
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.info.LastError = err.Error()
+		log.Printf("⚠️ Clock skew check against %s failed: %v", c.server, err)
+		return
+	}
+	wasSkewed := c.info.Skewed
+	c.info.Offset = offset.Round(time.Millisecond).String()
+	c.info.OffsetMs = offset.Milliseconds()
+	c.info.Skewed = offset > c.threshold || offset < -c.threshold
+	c.info.CheckedAt = &now
+	c.info.LastError = ""
+	switch {
+	case c.info.Skewed:
+		log.Printf("⚠️ event=clock_skew server=%s offset=%s threshold=%s (host clock is %s; reservation expiry and TTLs are off by that much)",
+			c.server, c.info.Offset, c.threshold, aheadOrBehind(offset))
+	case wasSkewed:
+		log.Printf("✅ event=clock_skew_resolved server=%s offset=%s", c.server, c.info.Offset)
+	}
+}
+
+// aheadOrBehind describes the host clock given the server's offset from it.
+func aheadOrBehind(offset time.Duration) string {
+	if offset < 0 {
+		return "ahead"
+	}
+	return "behind"
+}
+
+func (c *clockSkew) snapshot() *clockSkewInfo {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info := c.info
+	return &info
+}
+
+// sntpOffset asks server for the time and returns how far it is ahead of the
+// host clock (negative when the host is ahead), per RFC 4330.
+func sntpOffset(ctx context.Context, server string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, ntpTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	req := make([]byte, 48)
+	req[0] = 0x23 // LI 0, version 4, mode 3 (client)
+	t1 := time.Now()
+	putNTPTime(req[40:], t1)
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	t4 := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	if n < 48 {
+		return 0, fmt.Errorf("short NTP reply (%d bytes)", n)
+	}
+	if mode := resp[0] & 0x7; mode != 4 && mode != 5 {
+		return 0, fmt.Errorf("unexpected NTP mode %d", mode)
+	}
+	if resp[1] == 0 {
+		return 0, errors.New("NTP server sent a kiss-of-death (stratum 0)")
+	}
+	if binary.BigEndian.Uint64(resp[24:32]) != binary.BigEndian.Uint64(req[40:48]) {
+		return 0, errors.New("NTP reply doesn't match the request")
+	}
+	t2, t3 := ntpTime(resp[32:40]), ntpTime(resp[40:48])
+	return (t2.Sub(t1) + t3.Sub(t4)) / 2, nil
+}
+
+func ntpTime(b []byte) time.Time {
+	secs := int64(binary.BigEndian.Uint32(b[:4])) - ntpEpochOffset
+	frac := int64(binary.BigEndian.Uint32(b[4:]))
+	return time.Unix(secs, (frac*1e9)>>32)
+}
+
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b[:4], uint32(t.Unix()+ntpEpochOffset))
+	binary.BigEndian.PutUint32(b[4:], uint32((int64(t.Nanosecond())<<32)/1e9))
+}
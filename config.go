@@ -0,0 +1,1820 @@
+// config.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	relay "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
+	"go.uber.org/zap/zapcore"
+)
+
+// === Effective relay configuration (served on /config) ===
+type relayConfig struct {
+	RelayProtocolVersions string `json:"relayProtocolVersions"`
+
+	Resources resourcesInfo `json:"resources"`
+
+	ReservationTTL       string  `json:"reservationTTL"`
+	ReservationTTLJitter bool    `json:"reservationTTLJitter"`
+	JitterPercent        float64 `json:"reservationTTLJitterPercent"`
+
+	WSCompression       bool `json:"wsCompression"`
+	WSCompressionActive bool `json:"wsCompressionActive"`
+	RelayCompression    bool `json:"relayCompression"`
+
+	WarmupPeriod  string `json:"warmupPeriod"`
+	StartupJitter string `json:"startupJitter,omitempty"`
+
+	HTTPMaxConns int    `json:"httpMaxConns"`
+	HTTPBindAddr string `json:"httpBindAddr"`
+	HTTPCacheTTL string `json:"httpCacheTTL"`
+
+	HTTPHeavyMaxConcurrent int `json:"httpHeavyMaxConcurrent"`
+
+	ShutdownTimeouts map[string]string `json:"shutdownStepTimeouts"`
+
+	AdminTLSCert  string `json:"adminTLSCert,omitempty"`
+	AdminTLSKey   string `json:"adminTLSKey,omitempty"`
+	AdminClientCA string `json:"adminClientCA,omitempty"`
+
+	Tracing bool `json:"tracing"`
+
+	ConnHandshakeTimeout string               `json:"connHandshakeTimeout"`
+	HandshakePhases      handshakePhaseConfig `json:"handshakePhaseTimeouts"`
+
+	AddrFactoryMode     string   `json:"addrFactoryMode"`
+	AdvertiseTransports []string `json:"advertiseTransports"`
+	AdvertiseOrder      string   `json:"advertiseOrder"`
+	MaxAdvertisedAddrs  int      `json:"maxAdvertisedAddrs,omitempty"`
+	IPFamily            string   `json:"listenIPFamily"`
+	AdvertRefresh       string   `json:"advertiseRefreshInterval,omitempty"`
+	HostnameGrace       string   `json:"hostnameChangeGrace,omitempty"`
+
+	PrintGeneratedKey bool   `json:"printGeneratedKey"`
+	KeyExportPath     string `json:"keyExportPath,omitempty"`
+	RenderEnvSnippet  bool   `json:"renderEnvSnippet"`
+	DeterministicKey  bool   `json:"deterministicKey"`
+	KeyConflictPolicy string `json:"keyConflictPolicy"`
+	WipeKeyOnShutdown bool   `json:"wipeKeyOnShutdown"`
+
+	ReservationVouchers bool   `json:"reservationVouchers"`
+	VoucherDomain       string `json:"voucherDomain,omitempty"`
+	LogVouchers         bool   `json:"logVouchers"`
+
+	DedupConns string `json:"dedupConnsPerPeer"`
+
+	DisabledProtocols []protocol.ID `json:"disabledProtocols,omitempty"`
+
+	WebTransportPort   string `json:"webTransportPort,omitempty"`
+	AllowEphemeralPort bool   `json:"allowEphemeralPort"`
+	PartialTransports  bool   `json:"allowPartialTransports"`
+
+	DataWarnPercent    float64   `json:"circuitDataWarnPercent"`
+	CircuitDataWindow  string    `json:"circuitDataWindow"`
+	EnforcedLimitData  int64     `json:"enforcedLimitDataBytes,omitempty"`
+	EnforcedLimitMode  string    `json:"enforcedLimitMode,omitempty"`
+	CircuitSizeBuckets []float64 `json:"circuitSizeBuckets"`
+
+	CircuitCloseGrace string `json:"circuitCloseGrace"`
+	StopTimeout       string `json:"stopTimeout"`
+
+	MaintenanceMode bool `json:"maintenanceModeAtStartup"`
+	DiagnosticMode  bool `json:"diagnosticMode"`
+
+	FDLimitThreshold float64 `json:"fdLimitThreshold"`
+	FDLimitAction    string  `json:"fdLimitAction"`
+
+	CPUAdmissionThreshold float64 `json:"cpuAdmissionThreshold,omitempty"`
+	CPUAdmissionWindow    string  `json:"cpuAdmissionWindow,omitempty"`
+
+	MinClientAgent          string        `json:"minClientAgent,omitempty"`
+	RequiredClientProtocols []protocol.ID `json:"requiredClientProtocols,omitempty"`
+	CircuitProtocols        []protocol.ID `json:"circuitProtocols,omitempty"`
+
+	ReserveBlackout   string `json:"reserveBlackoutWindows,omitempty"`
+	ReserveScheduleTZ string `json:"reserveScheduleTZ,omitempty"`
+
+	ReserveRateLimit int `json:"reserveRateLimitPerMinute"`
+
+	HopMaxConcurrent int    `json:"hopMaxConcurrent"`
+	HopQueueTimeout  string `json:"hopQueueTimeout"`
+
+	ReserveMaxConcurrent int    `json:"reserveMaxConcurrent"`
+	ReserveProcTimeout   string `json:"reserveConcurrencyTimeout"`
+
+	ReservationsPerMB float64 `json:"reservationsPerMB,omitempty"`
+
+	MaxReservations    int `json:"maxReservations,omitempty"`
+	MaxCircuitsPerPeer int `json:"maxCircuitsPerPeer"`
+
+	PerIPReservations  string `json:"maxReservationsPerIP,omitempty"`
+	PerASNReservations string `json:"maxReservationsPerASN,omitempty"`
+
+	RcmgrBlockResponse string `json:"rcmgrBlockResponse"`
+
+	DialMaxConcurrent int    `json:"dialMaxConcurrent"`
+	DialTimeout       string `json:"dialTimeout"`
+
+	StopDialMaxConcurrent int `json:"stopDialMaxConcurrent"`
+	StopDialQueueSize     int `json:"stopDialQueueSize"`
+	DestMaxCircuits       int `json:"destMaxCircuits"`
+	StopDialPerSource     int `json:"stopDialPerSource"`
+
+	SourceDialWait string `json:"stopDialPerSourceWait,omitempty"`
+
+	RelayBufferSize   int   `json:"relayBufferSize"`
+	RelayBufferBudget int64 `json:"relayBufferBudget,omitempty"`
+
+	RelayBandwidthLimit int64 `json:"relayBandwidthLimit,omitempty"`
+	VIPPriority         int   `json:"vipPriority,omitempty"`
+
+	ReserveQueueSize    int    `json:"reserveQueueSize"`
+	ReserveQueueTimeout string `json:"reserveQueueTimeout"`
+
+	VIPSlots int `json:"vipSlots"`
+	// only the count: the list would tell anyone whose identity wins a slot
+	VIPPeerCount int `json:"vipPeerCount,omitempty"`
+
+	DebugPeerCount int `json:"debugPeerCount,omitempty"` // DEBUG_PEER_IDS, counted like VIP_PEERS
+
+	SessionSummaries   bool   `json:"sessionSummaries"`
+	SessionSummaryFile string `json:"sessionSummaryFile,omitempty"`
+
+	ReserveBandwidthBudget  int64 `json:"reserveBandwidthBudget,omitempty"`
+	ReserveBandwidthDefault int64 `json:"reserveBandwidthDefault,omitempty"`
+
+	MaxReservingPeers    int    `json:"maxReservingPeers"`
+	MaxNonReservingPeers int    `json:"maxNonReservingPeers"`
+	NonReservingGrace    string `json:"nonReservingGrace,omitempty"`
+
+	MDNS           bool   `json:"mdns"`
+	MDNSServiceTag string `json:"mdnsServiceTag,omitempty"`
+
+	LogLevel        string `json:"logLevel"`
+	SlowOpThreshold string `json:"slowOpThreshold"`
+	LogSampling     string `json:"logSampling,omitempty"`
+
+	StatusPage bool `json:"httpStatusPage"`
+	QRSize     int  `json:"qrSize"`
+
+	PolicyFile     string `json:"policyFile,omitempty"`
+	AccessListFile string `json:"accessListFile,omitempty"`
+
+	Yamux yamuxConfig `json:"yamux"`
+	Churn churnConfig `json:"churn"`
+
+	IdentifyLimits identifyLimits `json:"identifyLimits"`
+
+	MaxAddrsPerPeer int `json:"peerstoreMaxAddrsPerPeer"`
+
+	DrainTimeout    string `json:"drainTimeout"`
+	DrainFlagFile   string `json:"drainFlagFile,omitempty"`
+	DrainCloseGrace string `json:"drainCloseGrace"`
+	MaxLifetime     string `json:"maxProcessLifetime,omitempty"`
+
+	Instances []relayInstance `json:"instances,omitempty"`
+
+	Tiers []*limitTier `json:"tiers,omitempty"`
+
+	ScaleUpPercent   float64 `json:"scaleUpPct"`
+	ScaleDownPercent float64 `json:"scaleDownPct"`
+	ScaleHintWindow  string  `json:"scaleHintWindow"`
+
+	EventBufferSize int `json:"eventBufferSize"`
+
+	ReservationIdleTimeout  string `json:"reservationIdleTimeout,omitempty"`
+	ReservationExpiryNotice string `json:"reservationExpiryNotice,omitempty"`
+	DuplicatePolicy         string `json:"duplicateReservationPolicy"`
+
+	KeepaliveInterval string `json:"keepalivePingInterval"`
+	KeepaliveTimeout  string `json:"keepalivePingTimeout"`
+
+	LivenessInterval string `json:"reservationLivenessInterval,omitempty"`
+	LivenessTimeout  string `json:"reservationLivenessTimeout,omitempty"`
+	LivenessFailures int    `json:"reservationLivenessFailures,omitempty"`
+
+	ClockSkewServer    string `json:"clockSkewNtpServer,omitempty"`
+	ClockSkewInterval  string `json:"clockSkewInterval,omitempty"`
+	ClockSkewThreshold string `json:"clockSkewThreshold,omitempty"`
+
+	PeerstorePruneAfter string `json:"peerstorePruneAfter,omitempty"`
+
+	MetricsShedHeapMB    int `json:"metricsShedHeapMB,omitempty"`
+	MetricsRestoreHeapMB int `json:"metricsRestoreHeapMB,omitempty"`
+
+	TCPKeepaliveIdle     string `json:"tcpKeepaliveIdle"`
+	TCPKeepaliveInterval string `json:"tcpKeepaliveInterval"`
+	TCPKeepaliveCount    int    `json:"tcpKeepaliveCount"`
+
+	TransportConnLimits  map[string]int     `json:"transportConnLimits,omitempty"`
+	TransportLoadWeights map[string]float64 `json:"transportLoadWeights,omitempty"`
+	TransportLogLevels   map[string]string  `json:"transportLogLevels"`
+
+	StatsdAddr     string   `json:"statsdAddr,omitempty"`
+	StatsdPrefix   string   `json:"statsdPrefix,omitempty"`
+	StatsdInterval string   `json:"statsdFlushInterval,omitempty"`
+	StatsdTags     []string `json:"statsdTags,omitempty"`
+
+	CoordinatorURL string `json:"coordinatorUrl,omitempty"`
+
+	HeartbeatURL      string `json:"heartbeatUrl,omitempty"`
+	HeartbeatInterval string `json:"heartbeatInterval,omitempty"`
+
+	LoadHints bool `json:"loadHintProtocol"`
+
+	Discovery         bool   `json:"discoveryProtocol"`
+	DiscoveryTTL      string `json:"discoveryTTL"`
+	DiscoveryMaxPeers int    `json:"discoveryMaxPeers"`
+
+	SelfProbeInterval   string `json:"selfProbeInterval"`
+	SelfProbeMaxBackoff string `json:"selfProbeMaxBackoff"`
+
+	WarmConnection string `json:"warmConnection,omitempty"`
+	WarmInterval   string `json:"warmInterval,omitempty"`
+
+	StaticPeers          []string `json:"staticPeers,omitempty"`
+	StaticPeerMaxBackoff string   `json:"staticPeerMaxBackoff"`
+	StaticPeerMaxRetries int      `json:"staticPeerMaxRetriesPerHour"`
+
+	MigrationHints   bool     `json:"migrationHints"`
+	MigrationTargets []string `json:"migrationTargets,omitempty"`
+
+	keySeed string
+
+	maxReservations int // from MAX_RESERVATIONS or RESERVATIONS_PER_MB; 0 keeps the libp2p default
+	perIP, perASN   int // from MAX_RESERVATIONS_PER_IP and _PER_ASN
+
+	baseTTL time.Duration
+	warmup  time.Duration
+
+	jitterMin, jitterMax time.Duration
+
+	handshakeTimeout time.Duration
+	circuitGrace     time.Duration
+	drainTimeout     time.Duration
+	drainCloseGrace  time.Duration
+	maxLifetime      time.Duration
+	stopTimeout      time.Duration
+	dialTimeout      time.Duration
+	scaleWindow      time.Duration
+
+	disabledProtocols   []protocol.ID
+	reserveQueueTimeout time.Duration
+	vipPeers            map[peer.ID]bool
+	debugPeers          map[peer.ID]bool
+	cpuAdmissionWindow  time.Duration
+	slowOpThreshold     time.Duration
+	logSamplers         map[string]*logSampler
+	transportLogLevels  map[string]zapcore.Level
+	hopQueueTimeout     time.Duration
+
+	reserveProcTimeout time.Duration
+	nonReservingGrace  time.Duration
+
+	httpSocketMode    os.FileMode
+	httpCacheTTL      time.Duration
+	circuitDataWindow time.Duration
+
+	keepaliveInterval   time.Duration
+	keepaliveTimeout    time.Duration
+	sourceDialWait      time.Duration
+	shutdownTimeouts    map[string]time.Duration
+	peerstorePruneAfter time.Duration
+	tcpKeepalive        net.KeepAliveConfig
+	statsdInterval      time.Duration
+	coordinatorURL      *url.URL
+	heartbeatURL        *url.URL
+	heartbeatInterval   time.Duration
+
+	advertRefreshInterval time.Duration
+	hostnameGrace         time.Duration
+
+	reservationIdleTimeout time.Duration
+	expiryNotice           time.Duration
+	livenessInterval       time.Duration
+	livenessTimeout        time.Duration
+	clockSkewInterval      time.Duration
+	clockSkewThreshold     time.Duration
+
+	discoveryTTL time.Duration
+
+	selfProbeInterval   time.Duration
+	warmSibling         *peer.AddrInfo
+	warmInterval        time.Duration
+	selfProbeMaxBackoff time.Duration
+	selfProbeTimeout    time.Duration
+
+	defaultTier     *limitTier
+	reserveSchedule *reserveSchedule
+	minClientAgent  []agentRule
+
+	staticPeers          []peer.AddrInfo
+	migrationTargets     []peer.AddrInfo
+	staticPeerMaxBackoff time.Duration
+}
+
+func loadConfig() (*relayConfig, error) {
+	versions, err := relayProtocolVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	jitter, err := envFloat("RESERVATION_TTL_JITTER_PCT", 0)
+	if err != nil {
+		return nil, err
+	}
+	if jitter < 0 || jitter >= 100 {
+		return nil, fmt.Errorf("RESERVATION_TTL_JITTER_PCT must be in [0, 100), got %v", jitter)
+	}
+
+	wsCompression, err := envBool("WS_COMPRESSION", false)
+	if err != nil {
+		return nil, err
+	}
+	if wsCompression {
+		// go-libp2p's websocket transport doesn't expose permessage-deflate,
+		// and the frames carry noise/TLS ciphertext that wouldn't shrink anyway.
+		log.Println("⚠️ WS_COMPRESSION requested but not supported by the libp2p websocket transport; continuing uncompressed")
+	}
+	relayCompression, err := envBool("RELAY_COMPRESSION", false)
+	if err != nil {
+		return nil, err
+	}
+	if relayCompression {
+		log.Println("⚠️ RELAY_COMPRESSION requested, but circuits carry end-to-end encrypted data and no peer supports a compressed circuit; relaying raw and sampling compressibility only")
+	}
+
+	warmup, err := envDuration("WARMUP_PERIOD", 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	startupJitterSpec := envString("STARTUP_JITTER", "")
+	jitterMin, jitterMax, err := parseStartupJitter(startupJitterSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	httpMaxConns, err := envInt("HTTP_MAX_CONNS", 256)
+	if err != nil {
+		return nil, err
+	}
+	httpHeavy, err := envInt("HTTP_HEAVY_MAX_CONCURRENT", 4)
+	if err != nil {
+		return nil, err
+	}
+	if httpHeavy < 0 {
+		return nil, fmt.Errorf("HTTP_HEAVY_MAX_CONCURRENT must not be negative, got %d", httpHeavy)
+	}
+	shutdownTimeouts, err := parseShutdownTimeouts(envString("SHUTDOWN_STEP_TIMEOUTS", ""))
+	if err != nil {
+		return nil, err
+	}
+	shutdownTimeoutStrs := make(map[string]string, len(shutdownTimeouts))
+	for step, d := range shutdownTimeouts {
+		shutdownTimeoutStrs[step] = d.String()
+	}
+	httpBindAddr := envString("HTTP_BIND_ADDR", ":"+statusPort)
+	if path, ok := strings.CutPrefix(httpBindAddr, "unix:"); ok {
+		if path == "" {
+			return nil, fmt.Errorf("invalid HTTP_BIND_ADDR %q: missing socket path", httpBindAddr)
+		}
+	} else if _, p, err := net.SplitHostPort(httpBindAddr); err != nil {
+		return nil, fmt.Errorf("invalid HTTP_BIND_ADDR %q (want host:port or unix:/path): %w", httpBindAddr, err)
+	} else if _, err := strconv.ParseUint(p, 10, 16); err != nil {
+		return nil, fmt.Errorf("invalid HTTP_BIND_ADDR %q: bad port", httpBindAddr)
+	}
+	socketMode, err := strconv.ParseUint(envString("HTTP_SOCKET_MODE", "0660"), 8, 32)
+	if err != nil || socketMode > 0o777 {
+		return nil, fmt.Errorf("invalid HTTP_SOCKET_MODE %q (want octal permissions like 0660)", os.Getenv("HTTP_SOCKET_MODE"))
+	}
+	adminCert, adminKey, adminCA := envString("ADMIN_TLS_CERT", ""), envString("ADMIN_TLS_KEY", ""), envString("ADMIN_CLIENT_CA", "")
+	if (adminCert == "") != (adminKey == "") {
+		return nil, fmt.Errorf("ADMIN_TLS_CERT and ADMIN_TLS_KEY must be set together")
+	}
+	if adminCA != "" && adminCert == "" {
+		return nil, fmt.Errorf("ADMIN_CLIENT_CA needs ADMIN_TLS_CERT and ADMIN_TLS_KEY")
+	}
+	cacheTTL, err := envDuration("HTTP_CACHE_TTL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if cacheTTL < 0 {
+		return nil, fmt.Errorf("HTTP_CACHE_TTL must not be negative, got %s", cacheTTL)
+	}
+
+	tracing, err := envBool("ENABLE_TRACING", false)
+	if err != nil {
+		return nil, err
+	}
+
+	handshakeTimeout, err := envDuration("CONN_HANDSHAKE_TIMEOUT", 15*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if handshakeTimeout == 0 {
+		return nil, fmt.Errorf("CONN_HANDSHAKE_TIMEOUT must be positive")
+	}
+	handshakePhases, err := loadHandshakePhases(handshakeTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	addrMode := strings.ToLower(envString("ADDR_FACTORY_MODE", "replace"))
+	if addrMode != "replace" && addrMode != "append" {
+		return nil, fmt.Errorf("invalid ADDR_FACTORY_MODE %q (want replace or append)", addrMode)
+	}
+	advOrder, err := advertiseOrder()
+	if err != nil {
+		return nil, err
+	}
+	ipFamily, err := listenIPFamily()
+	if err != nil {
+		return nil, err
+	}
+	advertRefresh, err := envDuration("ADVERTISE_REFRESH_INTERVAL", 0)
+	if err != nil {
+		return nil, err
+	}
+	if advertRefresh < 0 || (advertRefresh > 0 && advertRefresh < time.Minute) {
+		return nil, fmt.Errorf("ADVERTISE_REFRESH_INTERVAL must be 0 or at least 1m, got %s", advertRefresh)
+	}
+	advertRefreshStr := ""
+	if advertRefresh > 0 {
+		advertRefreshStr = advertRefresh.String()
+	}
+	hostnameGrace, err := envDuration("HOSTNAME_CHANGE_GRACE", 0)
+	if err != nil {
+		return nil, err
+	}
+	if hostnameGrace < 0 {
+		return nil, fmt.Errorf("HOSTNAME_CHANGE_GRACE must not be negative, got %s", hostnameGrace)
+	}
+	hostnameGraceStr := ""
+	if hostnameGrace > 0 {
+		hostnameGraceStr = hostnameGrace.String()
+	}
+
+	dedup := strings.ToLower(envString("DEDUP_CONNS_PER_PEER", "off"))
+	switch dedup {
+	case "off", "close-old", "reject-new":
+	default:
+		return nil, fmt.Errorf("invalid DEDUP_CONNS_PER_PEER %q (want off, close-old or reject-new)", dedup)
+	}
+
+	advertise, err := advertiseTransports()
+	if err != nil {
+		return nil, err
+	}
+	maxAdvertised, err := envInt("MAX_ADVERTISED_ADDRS", 0)
+	if err != nil {
+		return nil, err
+	}
+	if maxAdvertised < 0 {
+		return nil, fmt.Errorf("MAX_ADVERTISED_ADDRS must be >= 0, got %d", maxAdvertised)
+	}
+
+	disabled, err := disabledProtocols()
+	if err != nil {
+		return nil, err
+	}
+
+	printKey, err := envBool("PRINT_GENERATED_KEY", false)
+	if err != nil {
+		return nil, err
+	}
+	keyExportPath := envString("KEY_EXPORT_PATH", "")
+	if keyExportPath != "" && filepath.Clean(keyExportPath) == privKeyFileName {
+		return nil, fmt.Errorf("KEY_EXPORT_PATH must not be the %s file itself", privKeyFileName)
+	}
+	renderEnvSnippet, err := envBool("RENDER_ENV_SNIPPET", false)
+	if err != nil {
+		return nil, err
+	}
+	keySeed := os.Getenv("RELAY_KEY_SEED")
+	keyConflict := strings.ToLower(envString("KEY_CONFLICT_POLICY", "prefer-env"))
+	switch keyConflict {
+	case "prefer-env", "prefer-file", "fail":
+	default:
+		return nil, fmt.Errorf("invalid KEY_CONFLICT_POLICY %q (want prefer-env, prefer-file or fail)", keyConflict)
+	}
+	wipeKey, err := envBool("WIPE_KEY_ON_SHUTDOWN", false)
+	if err != nil {
+		return nil, err
+	}
+
+	vouchers, err := envBool("RESERVATION_VOUCHERS", true)
+	if err != nil {
+		return nil, err
+	}
+	logVouchers, err := envBool("LOG_VOUCHERS", false)
+	if err != nil {
+		return nil, err
+	}
+	voucherDomain := ""
+	if vouchers {
+		voucherDomain = proto.RecordDomain
+	}
+
+	wtPort := envString("WEBTRANSPORT_PORT", "")
+	if wtPort != "" {
+		if _, err := strconv.ParseUint(wtPort, 10, 16); err != nil {
+			return nil, fmt.Errorf("invalid WEBTRANSPORT_PORT %q", wtPort)
+		}
+	}
+	ephemeral, err := envBool("ALLOW_EPHEMERAL_PORT", false)
+	if err != nil {
+		return nil, err
+	}
+	partial, err := envBool("ALLOW_PARTIAL_TRANSPORTS", true)
+	if err != nil {
+		return nil, err
+	}
+
+	dataWarn, err := envFloat("CIRCUIT_DATA_WARN_PCT", 80)
+	if err != nil {
+		return nil, err
+	}
+	if dataWarn < 0 || dataWarn > 100 {
+		return nil, fmt.Errorf("CIRCUIT_DATA_WARN_PCT must be in [0, 100], got %v", dataWarn)
+	}
+	dataWindowMode, dataWindow, err := circuitDataWindow()
+	if err != nil {
+		return nil, err
+	}
+	enforcedData, enforcedMode, err := loadEnforcedLimit()
+	if err != nil {
+		return nil, err
+	}
+	sizeBuckets, err := circuitSizeBuckets()
+	if err != nil {
+		return nil, err
+	}
+
+	eventBuffer, err := envInt("EVENT_BUFFER_SIZE", 1024)
+	if err != nil {
+		return nil, err
+	}
+	if eventBuffer < 16 {
+		return nil, fmt.Errorf("EVENT_BUFFER_SIZE must be at least 16, got %d", eventBuffer)
+	}
+
+	duplicates, err := duplicateReservationPolicy()
+	if err != nil {
+		return nil, err
+	}
+	idleTimeout, err := envDuration("RESERVATION_IDLE_TIMEOUT", 0)
+	if err != nil {
+		return nil, err
+	}
+	if idleTimeout < 0 {
+		return nil, fmt.Errorf("RESERVATION_IDLE_TIMEOUT must not be negative, got %s", idleTimeout)
+	}
+	idleTimeoutStr := ""
+	if idleTimeout > 0 {
+		idleTimeoutStr = idleTimeout.String()
+	}
+
+	keepaliveInterval, err := envDuration("KEEPALIVE_PING_INTERVAL", 0)
+	if err != nil {
+		return nil, err
+	}
+	keepaliveTimeout, err := envDuration("KEEPALIVE_PING_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if keepaliveInterval > 0 && (keepaliveTimeout <= 0 || keepaliveTimeout >= keepaliveInterval) {
+		return nil, fmt.Errorf("KEEPALIVE_PING_TIMEOUT must be positive and shorter than KEEPALIVE_PING_INTERVAL")
+	}
+	livenessInterval, err := envDuration("RESERVATION_LIVENESS_INTERVAL", 0)
+	if err != nil {
+		return nil, err
+	}
+	livenessTimeout, err := envDuration("RESERVATION_LIVENESS_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	livenessFailures, err := envInt("RESERVATION_LIVENESS_FAILURES", 2)
+	if err != nil {
+		return nil, err
+	}
+	if livenessInterval < 0 {
+		return nil, fmt.Errorf("RESERVATION_LIVENESS_INTERVAL must not be negative, got %s", livenessInterval)
+	}
+	livenessIntervalStr, livenessTimeoutStr := "", ""
+	if livenessInterval > 0 {
+		if livenessTimeout <= 0 || livenessTimeout >= livenessInterval {
+			return nil, fmt.Errorf("RESERVATION_LIVENESS_TIMEOUT must be positive and shorter than RESERVATION_LIVENESS_INTERVAL")
+		}
+		if livenessFailures < 1 {
+			return nil, fmt.Errorf("RESERVATION_LIVENESS_FAILURES must be at least 1, got %d", livenessFailures)
+		}
+		livenessIntervalStr, livenessTimeoutStr = livenessInterval.String(), livenessTimeout.String()
+	} else {
+		livenessFailures = 0
+	}
+	clockSkewServer := envString("CLOCK_SKEW_NTP_SERVER", "")
+	clockSkewInterval, err := envDuration("CLOCK_SKEW_INTERVAL", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	clockSkewThreshold, err := envDuration("CLOCK_SKEW_THRESHOLD", 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	clockSkewIntervalStr, clockSkewThresholdStr := "", ""
+	if clockSkewServer != "" {
+		if _, _, err := net.SplitHostPort(clockSkewServer); err != nil {
+			clockSkewServer = net.JoinHostPort(clockSkewServer, "123")
+		}
+		if clockSkewInterval < time.Minute {
+			return nil, fmt.Errorf("CLOCK_SKEW_INTERVAL must be at least 1m, got %s", clockSkewInterval)
+		}
+		if clockSkewThreshold <= 0 {
+			return nil, fmt.Errorf("CLOCK_SKEW_THRESHOLD must be positive, got %s", clockSkewThreshold)
+		}
+		clockSkewIntervalStr, clockSkewThresholdStr = clockSkewInterval.String(), clockSkewThreshold.String()
+	}
+	pruneAfter, err := envDuration("PEERSTORE_PRUNE_AFTER", 6*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if pruneAfter < 0 {
+		return nil, fmt.Errorf("PEERSTORE_PRUNE_AFTER must not be negative, got %s", pruneAfter)
+	}
+	pruneAfterStr := ""
+	if pruneAfter > 0 {
+		pruneAfterStr = pruneAfter.String()
+	}
+	shedHeap, err := envInt("METRICS_SHED_HEAP_MB", 0)
+	if err != nil {
+		return nil, err
+	}
+	if shedHeap < 0 {
+		return nil, fmt.Errorf("METRICS_SHED_HEAP_MB must not be negative, got %d", shedHeap)
+	}
+	restoreHeap, err := envInt("METRICS_RESTORE_HEAP_MB", shedHeap*3/4)
+	if err != nil {
+		return nil, err
+	}
+	if shedHeap > 0 && (restoreHeap <= 0 || restoreHeap >= shedHeap) {
+		return nil, fmt.Errorf("METRICS_RESTORE_HEAP_MB must be positive and below METRICS_SHED_HEAP_MB (%d), got %d", shedHeap, restoreHeap)
+	}
+	if shedHeap == 0 {
+		restoreHeap = 0
+	}
+
+	tcpKeepalive, err := tcpKeepaliveConfig()
+	if err != nil {
+		return nil, err
+	}
+	transportLimits, err := transportConnLimits()
+	if err != nil {
+		return nil, err
+	}
+	loadWeights, err := transportLoadWeights()
+	if err != nil {
+		return nil, err
+	}
+	transportLogLevels, err := parseTransportLogLevels(envString("TRANSPORT_LOG_LEVELS", ""))
+	if err != nil {
+		return nil, err
+	}
+	transportLogStrs := make(map[string]string, len(transportLogLevels))
+	for t, l := range transportLogLevels {
+		transportLogStrs[t] = l.String()
+		if l == levelOff {
+			transportLogStrs[t] = "off"
+		}
+	}
+
+	statsdAddr := envString("STATSD_ADDR", "")
+	statsdInterval, err := envDuration("STATSD_FLUSH_INTERVAL", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if statsdInterval < time.Second {
+		return nil, fmt.Errorf("STATSD_FLUSH_INTERVAL must be at least 1s")
+	}
+	statsdPrefix := envString("STATSD_PREFIX", "torrentium_relay.")
+	if statsdPrefix != "" && !strings.HasSuffix(statsdPrefix, ".") {
+		statsdPrefix += "."
+	}
+	var statsdTags []string
+	for _, t := range strings.Split(envString("STATSD_TAGS", ""), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			statsdTags = append(statsdTags, t)
+		}
+	}
+
+	coordinator, err := coordinatorURL()
+	if err != nil {
+		return nil, err
+	}
+	coordinatorStr := ""
+	if coordinator != nil {
+		coordinatorStr = urlOrigin(coordinator)
+	}
+	heartbeat, err := heartbeatURL()
+	if err != nil {
+		return nil, err
+	}
+	heartbeatInterval, err := envDuration("HEARTBEAT_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	heartbeatStr, heartbeatIntervalStr := "", ""
+	if heartbeat != nil {
+		if heartbeatInterval < 10*time.Second {
+			return nil, fmt.Errorf("HEARTBEAT_INTERVAL must be at least 10s, got %s", heartbeatInterval)
+		}
+		heartbeatStr, heartbeatIntervalStr = urlOrigin(heartbeat), heartbeatInterval.String()
+	}
+
+	loadHints, err := envBool("LOAD_HINT_PROTOCOL", false)
+	if err != nil {
+		return nil, err
+	}
+
+	discoveryOn, discoveryTTL, discoveryMaxPeers, err := discoveryConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	selfProbeInterval, err := envDuration("SELF_PROBE_INTERVAL", 0)
+	if err != nil {
+		return nil, err
+	}
+	selfProbeMaxBackoff, err := envDuration("SELF_PROBE_MAX_BACKOFF", 30*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	selfProbeTimeout, err := envDuration("SELF_PROBE_TIMEOUT", 15*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if selfProbeInterval > 0 && (selfProbeMaxBackoff < selfProbeInterval || selfProbeTimeout <= 0) {
+		return nil, fmt.Errorf("SELF_PROBE_MAX_BACKOFF must be at least SELF_PROBE_INTERVAL and SELF_PROBE_TIMEOUT positive")
+	}
+
+	warmTarget := envString("WARM_CONNECTION", "")
+	var warmSibling *peer.AddrInfo
+	if warmTarget != "" && warmTarget != "self" {
+		infos, err := parsePeerAddrs("WARM_CONNECTION", warmTarget)
+		if err != nil {
+			return nil, err
+		}
+		if len(infos) != 1 {
+			return nil, fmt.Errorf("WARM_CONNECTION must be self or one <multiaddr>/p2p/<peerID>, got %d peers", len(infos))
+		}
+		warmSibling = &infos[0]
+	}
+	warmInterval, err := envDuration("WARM_INTERVAL", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if warmInterval < time.Second {
+		return nil, fmt.Errorf("WARM_INTERVAL must be at least 1s, got %s", warmInterval)
+	}
+	warmIntervalStr := ""
+	if warmTarget != "" {
+		warmIntervalStr = warmInterval.String()
+	}
+
+	staticPeers, err := parsePeerAddrs("STATIC_PEERS", envString("STATIC_PEERS", ""))
+	if err != nil {
+		return nil, err
+	}
+	var staticPeerNames []string
+	for _, info := range staticPeers {
+		staticPeerNames = append(staticPeerNames, info.ID.String())
+	}
+
+	migrationHints, err := envBool("MIGRATION_HINTS", false)
+	if err != nil {
+		return nil, err
+	}
+	migrationTargets, err := parsePeerAddrs("MIGRATION_TARGETS", envString("MIGRATION_TARGETS", ""))
+	if err != nil {
+		return nil, err
+	}
+	if len(migrationTargets) == 0 {
+		migrationTargets = staticPeers
+	}
+	if migrationHints && len(migrationTargets) == 0 {
+		return nil, fmt.Errorf("MIGRATION_HINTS needs MIGRATION_TARGETS or STATIC_PEERS")
+	}
+	var migrationTargetNames []string
+	for _, info := range migrationTargets {
+		migrationTargetNames = append(migrationTargetNames, info.ID.String())
+	}
+
+	staticMaxBackoff, err := envDuration("STATIC_PEER_MAX_BACKOFF", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if staticMaxBackoff < staticPeerBaseBackoff {
+		return nil, fmt.Errorf("STATIC_PEER_MAX_BACKOFF must be at least %s", staticPeerBaseBackoff)
+	}
+
+	staticMaxRetries, err := envInt("STATIC_PEER_MAX_RETRIES", 30)
+	if err != nil {
+		return nil, err
+	}
+	if staticMaxRetries < 0 {
+		return nil, fmt.Errorf("STATIC_PEER_MAX_RETRIES must be >= 0, got %d", staticMaxRetries)
+	}
+
+	circuitGrace, err := envDuration("CIRCUIT_CLOSE_GRACE", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	stopTimeout, err := envDuration("STOP_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if stopTimeout == 0 {
+		return nil, fmt.Errorf("STOP_TIMEOUT must be positive")
+	}
+
+	maintenance, err := envBool("MAINTENANCE_MODE", false)
+	if err != nil {
+		return nil, err
+	}
+	diagnostic, err := envBool("DIAGNOSTIC_MODE", false)
+	if err != nil {
+		return nil, err
+	}
+	fdThreshold, fdAction, err := fdLimitConfig()
+	if err != nil {
+		return nil, err
+	}
+	cpuThreshold, cpuWindow, err := cpuAdmissionConfig()
+	if err != nil {
+		return nil, err
+	}
+	cpuWindowStr := ""
+	if cpuThreshold > 0 {
+		cpuWindowStr = cpuWindow.String()
+	}
+
+	reserveRate, err := envInt("RESERVE_RATE_LIMIT", 10)
+	if err != nil {
+		return nil, err
+	}
+	if reserveRate < 0 {
+		return nil, fmt.Errorf("RESERVE_RATE_LIMIT must not be negative, got %d", reserveRate)
+	}
+
+	hopMax, err := envInt("HOP_MAX_CONCURRENT", 0)
+	if err != nil {
+		return nil, err
+	}
+	if hopMax < 0 {
+		return nil, fmt.Errorf("HOP_MAX_CONCURRENT must not be negative, got %d", hopMax)
+	}
+	hopWait, err := envDuration("HOP_QUEUE_TIMEOUT", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	reserveMax, err := envInt("RESERVE_MAX_CONCURRENT", 0)
+	if err != nil {
+		return nil, err
+	}
+	if reserveMax < 0 {
+		return nil, fmt.Errorf("RESERVE_MAX_CONCURRENT must not be negative, got %d", reserveMax)
+	}
+	reserveWait, err := envDuration("RESERVE_CONCURRENCY_TIMEOUT", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	perMB, memReservations, err := reservationsPerMB()
+	if err != nil {
+		return nil, err
+	}
+	maxReservations, err := maxReservationsEnv(perMB, memReservations)
+	if err != nil {
+		return nil, err
+	}
+	maxCircuits, err := maxCircuitsPerPeer()
+	if err != nil {
+		return nil, err
+	}
+	limit, err := defaultLimit()
+	if err != nil {
+		return nil, err
+	}
+	perIPSpec, perIP, perASNSpec, perASN, err := reservationShares(maxReservations)
+	if err != nil {
+		return nil, err
+	}
+	rcmgrBlock := envString("RCMGR_BLOCK_RESPONSE", "status")
+	if rcmgrBlock != "status" && rcmgrBlock != "reset" {
+		return nil, fmt.Errorf("invalid RCMGR_BLOCK_RESPONSE %q (want status or reset)", rcmgrBlock)
+	}
+
+	dialMax, err := envInt("DIAL_MAX_CONCURRENT", 0)
+	if err != nil {
+		return nil, err
+	}
+	if dialMax < 0 {
+		return nil, fmt.Errorf("DIAL_MAX_CONCURRENT must not be negative, got %d", dialMax)
+	}
+	dialTimeout, err := envDuration("DIAL_TIMEOUT", 15*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if dialTimeout <= 0 {
+		return nil, fmt.Errorf("DIAL_TIMEOUT must be positive")
+	}
+
+	stopDialMax, err := envInt("STOP_DIAL_MAX_CONCURRENT", 0)
+	if err != nil {
+		return nil, err
+	}
+	if stopDialMax < 0 {
+		return nil, fmt.Errorf("STOP_DIAL_MAX_CONCURRENT must not be negative, got %d", stopDialMax)
+	}
+	stopDialQueue, err := envInt("STOP_DIAL_QUEUE_SIZE", 64)
+	if err != nil {
+		return nil, err
+	}
+	if stopDialQueue < 0 {
+		return nil, fmt.Errorf("STOP_DIAL_QUEUE_SIZE must not be negative, got %d", stopDialQueue)
+	}
+	stopDialPerSource, err := envInt("STOP_DIAL_PER_SOURCE", 0)
+	if err != nil {
+		return nil, err
+	}
+	if stopDialPerSource < 0 {
+		return nil, fmt.Errorf("STOP_DIAL_PER_SOURCE must not be negative, got %d", stopDialPerSource)
+	}
+	sourceDialWait, err := envDuration("STOP_DIAL_PER_SOURCE_WAIT", 0)
+	if err != nil {
+		return nil, err
+	}
+	if sourceDialWait < 0 {
+		return nil, fmt.Errorf("STOP_DIAL_PER_SOURCE_WAIT must not be negative, got %s", sourceDialWait)
+	}
+	sourceDialWaitStr := ""
+	if stopDialPerSource > 0 && sourceDialWait > 0 {
+		sourceDialWaitStr = sourceDialWait.String()
+	}
+	destMaxCircuits, err := envInt("DEST_MAX_CIRCUITS", 0)
+	if err != nil {
+		return nil, err
+	}
+	if destMaxCircuits < 0 {
+		return nil, fmt.Errorf("DEST_MAX_CIRCUITS must not be negative, got %d", destMaxCircuits)
+	}
+	bufSize, err := envInt("RELAY_BUFFER_SIZE", relay.DefaultResources().BufferSize)
+	if err != nil {
+		return nil, err
+	}
+	if bufSize < 512 || bufSize > 1<<20 {
+		return nil, fmt.Errorf("RELAY_BUFFER_SIZE must be between 512 and 1048576 bytes, got %d", bufSize)
+	}
+	bufBudget, err := envInt("RELAY_BUFFER_BUDGET", 0)
+	if err != nil {
+		return nil, err
+	}
+	if bufBudget != 0 && bufBudget < 2*bufSize {
+		return nil, fmt.Errorf("RELAY_BUFFER_BUDGET must be 0 or at least two buffers (%d bytes), got %d", 2*bufSize, bufBudget)
+	}
+
+	queueSize, err := envInt("RESERVE_QUEUE_SIZE", 0)
+	if err != nil {
+		return nil, err
+	}
+	if queueSize < 0 {
+		return nil, fmt.Errorf("RESERVE_QUEUE_SIZE must not be negative, got %d", queueSize)
+	}
+	queueTimeout, err := envDuration("RESERVE_QUEUE_TIMEOUT", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	vipSlots, err := envInt("VIP_SLOTS", 0)
+	if err != nil {
+		return nil, err
+	}
+	if vipSlots < 0 {
+		return nil, fmt.Errorf("VIP_SLOTS must not be negative, got %d", vipSlots)
+	}
+	vipSet, err := vipPeers()
+	if err != nil {
+		return nil, err
+	}
+	debugSet, err := debugPeerIDs()
+	if err != nil {
+		return nil, err
+	}
+	sessionSummaries, err := envBool("SESSION_SUMMARIES", false)
+	if err != nil {
+		return nil, err
+	}
+	sessionFile := envString("SESSION_SUMMARY_FILE", "")
+	if sessionFile != "" && !sessionSummaries {
+		return nil, fmt.Errorf("SESSION_SUMMARY_FILE needs SESSION_SUMMARIES=true")
+	}
+	if vipSlots > 0 && len(vipSet) == 0 {
+		return nil, fmt.Errorf("VIP_SLOTS needs VIP_PEERS")
+	}
+	bwLimit, err := envInt("RELAY_BANDWIDTH_LIMIT", 0)
+	if err != nil {
+		return nil, err
+	}
+	if bwLimit != 0 && bwLimit < 1024 {
+		return nil, fmt.Errorf("RELAY_BANDWIDTH_LIMIT must be 0 or at least 1024 bytes/s, got %d", bwLimit)
+	}
+	vipPriority, err := envInt("VIP_PRIORITY", 1)
+	if err != nil {
+		return nil, err
+	}
+	if vipPriority < 1 || vipPriority > 100 {
+		return nil, fmt.Errorf("VIP_PRIORITY must be between 1 and 100, got %d", vipPriority)
+	}
+	if vipPriority > 1 && len(vipSet) == 0 {
+		return nil, fmt.Errorf("VIP_PRIORITY needs VIP_PEERS")
+	}
+	bwBudget, err := envInt("RESERVE_BANDWIDTH_BUDGET", 0)
+	if err != nil {
+		return nil, err
+	}
+	bwDefault, err := envInt("RESERVE_BANDWIDTH_DEFAULT", 0)
+	if err != nil {
+		return nil, err
+	}
+	if bwBudget < 0 || bwDefault < 0 {
+		return nil, fmt.Errorf("RESERVE_BANDWIDTH_BUDGET and RESERVE_BANDWIDTH_DEFAULT must not be negative")
+	}
+	if bwBudget > 0 && bwDefault > bwBudget {
+		return nil, fmt.Errorf("RESERVE_BANDWIDTH_DEFAULT must not exceed RESERVE_BANDWIDTH_BUDGET (%d), got %d", bwBudget, bwDefault)
+	}
+	if bwBudget == 0 {
+		bwDefault = 0
+	}
+	maxReserving, err := envInt("MAX_RESERVING_PEERS", 0)
+	if err != nil {
+		return nil, err
+	}
+	if maxReserving < 0 {
+		return nil, fmt.Errorf("MAX_RESERVING_PEERS must not be negative, got %d", maxReserving)
+	}
+	maxNonReserving, err := envInt("MAX_NONRESERVING_PEERS", 0)
+	if err != nil {
+		return nil, err
+	}
+	if maxNonReserving < 0 {
+		return nil, fmt.Errorf("MAX_NONRESERVING_PEERS must not be negative, got %d", maxNonReserving)
+	}
+	nonReservingGrace, err := envDuration("NONRESERVING_GRACE", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	nonReservingGraceStr := ""
+	if maxNonReserving > 0 {
+		nonReservingGraceStr = nonReservingGrace.String()
+	}
+
+	mdnsOn, err := envBool("ENABLE_MDNS", false)
+	if err != nil {
+		return nil, err
+	}
+	mdnsTag := ""
+	if mdnsOn {
+		mdnsTag = envString("MDNS_SERVICE_TAG", mdns.ServiceName)
+	}
+
+	logLevel := strings.ToLower(envString("LOG_LEVEL", "info"))
+	if logLevel != "info" && logLevel != "debug" {
+		return nil, fmt.Errorf("invalid LOG_LEVEL %q (want info or debug)", logLevel)
+	}
+
+	qrSize, err := envInt("QR_SIZE", 256)
+	if err != nil {
+		return nil, err
+	}
+	if qrSize < qrMinSize || qrSize > qrMaxSize {
+		return nil, fmt.Errorf("QR_SIZE must be %d-%d, got %d", qrMinSize, qrMaxSize, qrSize)
+	}
+
+	logSampling := envString("LOG_SAMPLING", "")
+	samplers, err := parseLogSampling(logSampling)
+	if err != nil {
+		return nil, err
+	}
+	slowOp, err := envDuration("SLOW_OP_THRESHOLD", 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	statusPage, err := envBool("HTTP_STATUS_PAGE", false)
+	if err != nil {
+		return nil, err
+	}
+
+	identifyLim, err := loadIdentifyLimits()
+	if err != nil {
+		return nil, err
+	}
+	maxPeerAddrs, err := maxAddrsPerPeer()
+	if err != nil {
+		return nil, err
+	}
+	yamuxCfg, err := loadYamuxConfig()
+	if err != nil {
+		return nil, err
+	}
+	churnCfg, err := loadChurnConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	drainTimeout, err := envDuration("DRAIN_TIMEOUT", 25*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	drainCloseGrace, err := envDuration("DRAIN_CLOSE_GRACE", 0)
+	if err != nil {
+		return nil, err
+	}
+	maxLifetime, err := envDuration("MAX_PROCESS_LIFETIME", 0)
+	if err != nil {
+		return nil, err
+	}
+	maxLifetimeStr := ""
+	if maxLifetime > 0 {
+		maxLifetimeStr = maxLifetime.String()
+	}
+
+	instances, err := relayInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	tiers, err := limitTiers()
+	if err != nil {
+		return nil, err
+	}
+
+	minAgent := envString("MIN_CLIENT_AGENT", "")
+	agentRules, err := parseAgentRules(minAgent)
+	if err != nil {
+		return nil, err
+	}
+	var clientProtos []protocol.ID
+	for _, f := range strings.Split(envString("REQUIRED_CLIENT_PROTOCOLS", ""), ",") {
+		if pid := protocol.ID(strings.TrimSpace(f)); pid != "" {
+			clientProtos = append(clientProtos, pid)
+		}
+	}
+	var circuitProtos []protocol.ID
+	for _, f := range strings.Split(envString("CIRCUIT_PROTOCOLS", ""), ",") {
+		if pid := protocol.ID(strings.TrimSpace(f)); pid != "" {
+			circuitProtos = append(circuitProtos, pid)
+		}
+	}
+
+	blackout := envString("RESERVE_BLACKOUT_WINDOWS", "")
+	scheduleTZ := envString("RESERVE_SCHEDULE_TZ", "UTC")
+	schedule, err := parseSchedule(blackout, scheduleTZ)
+	if err != nil {
+		return nil, err
+	}
+	if schedule == nil {
+		scheduleTZ = ""
+	}
+
+	scaleUp, err := envFloat("SCALE_UP_PCT", 80)
+	if err != nil {
+		return nil, err
+	}
+	scaleDown, err := envFloat("SCALE_DOWN_PCT", 20)
+	if err != nil {
+		return nil, err
+	}
+	if scaleDown < 0 || scaleUp > 100 || scaleDown >= scaleUp {
+		return nil, fmt.Errorf("need 0 <= SCALE_DOWN_PCT < SCALE_UP_PCT <= 100, got %v and %v", scaleDown, scaleUp)
+	}
+	scaleWindow, err := envDuration("SCALE_HINT_WINDOW", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if scaleWindow < scaleSampleEvery {
+		return nil, fmt.Errorf("SCALE_HINT_WINDOW must be at least %s", scaleSampleEvery)
+	}
+
+	baseTTL := relay.DefaultResources().ReservationTTL
+	expiryNotice, err := envDuration("RESERVATION_EXPIRY_NOTICE", 0)
+	if err != nil {
+		return nil, err
+	}
+	if minTTL := time.Duration(float64(baseTTL) * (1 - jitter/100)); expiryNotice < 0 || expiryNotice >= minTTL {
+		return nil, fmt.Errorf("RESERVATION_EXPIRY_NOTICE must be in [0, %s) (the shortest reservation TTL), got %s", minTTL, expiryNotice)
+	}
+	expiryNoticeStr := ""
+	if expiryNotice > 0 {
+		expiryNoticeStr = expiryNotice.String()
+	}
+
+	cfg := &relayConfig{
+		RelayProtocolVersions:   versions,
+		ReservationTTL:          baseTTL.String(),
+		ReservationTTLJitter:    jitter > 0,
+		JitterPercent:           jitter,
+		WSCompression:           wsCompression,
+		RelayCompression:        relayCompression,
+		WarmupPeriod:            warmup.String(),
+		StartupJitter:           startupJitterSpec,
+		HTTPMaxConns:            httpMaxConns,
+		HTTPHeavyMaxConcurrent:  httpHeavy,
+		ShutdownTimeouts:        shutdownTimeoutStrs,
+		HTTPBindAddr:            httpBindAddr,
+		AdminTLSCert:            adminCert,
+		AdminTLSKey:             adminKey,
+		AdminClientCA:           adminCA,
+		HTTPCacheTTL:            cacheTTL.String(),
+		Tracing:                 tracing,
+		ConnHandshakeTimeout:    handshakeTimeout.String(),
+		HandshakePhases:         handshakePhases,
+		AddrFactoryMode:         addrMode,
+		IPFamily:                ipFamily,
+		AdvertiseTransports:     advertise,
+		AdvertiseOrder:          advOrder,
+		MaxAdvertisedAddrs:      maxAdvertised,
+		WebTransportPort:        wtPort,
+		AllowEphemeralPort:      ephemeral,
+		PartialTransports:       partial,
+		PrintGeneratedKey:       printKey,
+		KeyExportPath:           keyExportPath,
+		RenderEnvSnippet:        renderEnvSnippet,
+		DeterministicKey:        keySeed != "",
+		KeyConflictPolicy:       keyConflict,
+		WipeKeyOnShutdown:       wipeKey,
+		ReservationVouchers:     vouchers,
+		VoucherDomain:           voucherDomain,
+		LogVouchers:             logVouchers,
+		DedupConns:              dedup,
+		DisabledProtocols:       disabled,
+		DataWarnPercent:         dataWarn,
+		CircuitDataWindow:       dataWindowMode,
+		EnforcedLimitData:       enforcedData,
+		EnforcedLimitMode:       enforcedMode,
+		CircuitSizeBuckets:      sizeBuckets,
+		CircuitCloseGrace:       circuitGrace.String(),
+		StopTimeout:             stopTimeout.String(),
+		MaintenanceMode:         maintenance,
+		DiagnosticMode:          diagnostic,
+		FDLimitThreshold:        fdThreshold,
+		FDLimitAction:           fdAction,
+		CPUAdmissionThreshold:   cpuThreshold,
+		CPUAdmissionWindow:      cpuWindowStr,
+		MinClientAgent:          minAgent,
+		RequiredClientProtocols: clientProtos,
+		CircuitProtocols:        circuitProtos,
+		ReserveBlackout:         blackout,
+		ReserveScheduleTZ:       scheduleTZ,
+		ReserveRateLimit:        reserveRate,
+		HopMaxConcurrent:        hopMax,
+		HopQueueTimeout:         hopWait.String(),
+		ReserveMaxConcurrent:    reserveMax,
+		ReserveProcTimeout:      reserveWait.String(),
+		RcmgrBlockResponse:      rcmgrBlock,
+		ReservationsPerMB:       perMB,
+		MaxReservations:         maxReservations,
+		MaxCircuitsPerPeer:      maxCircuits,
+		PerIPReservations:       perIPSpec,
+		PerASNReservations:      perASNSpec,
+		DialMaxConcurrent:       dialMax,
+		DialTimeout:             dialTimeout.String(),
+		StopDialMaxConcurrent:   stopDialMax,
+		StopDialQueueSize:       stopDialQueue,
+		StopDialPerSource:       stopDialPerSource,
+		SourceDialWait:          sourceDialWaitStr,
+		DestMaxCircuits:         destMaxCircuits,
+		RelayBufferSize:         bufSize,
+		RelayBufferBudget:       int64(bufBudget),
+		ReserveQueueSize:        queueSize,
+		ReserveQueueTimeout:     queueTimeout.String(),
+		VIPSlots:                vipSlots,
+		VIPPeerCount:            len(vipSet),
+		DebugPeerCount:          len(debugSet),
+		SessionSummaries:        sessionSummaries,
+		SessionSummaryFile:      sessionFile,
+		RelayBandwidthLimit:     int64(bwLimit),
+		VIPPriority:             vipPriority,
+		ReserveBandwidthBudget:  int64(bwBudget),
+		ReserveBandwidthDefault: int64(bwDefault),
+		MaxReservingPeers:       maxReserving,
+		MaxNonReservingPeers:    maxNonReserving,
+		NonReservingGrace:       nonReservingGraceStr,
+		MDNS:                    mdnsOn,
+		MDNSServiceTag:          mdnsTag,
+		LogLevel:                logLevel,
+		SlowOpThreshold:         slowOp.String(),
+		LogSampling:             logSampling,
+		StatusPage:              statusPage,
+		QRSize:                  qrSize,
+		PolicyFile:              envString("RELAY_POLICY_FILE", ""),
+		AccessListFile:          envString("ACCESS_LIST_FILE", ""),
+		Yamux:                   yamuxCfg,
+		IdentifyLimits:          identifyLim,
+		MaxAddrsPerPeer:         maxPeerAddrs,
+		Churn:                   churnCfg,
+		DrainTimeout:            drainTimeout.String(),
+		DrainFlagFile:           envString("DRAIN_FLAG_FILE", ""),
+		DrainCloseGrace:         drainCloseGrace.String(),
+		MaxLifetime:             maxLifetimeStr,
+		Instances:               instances,
+		Tiers:                   tiers,
+		ScaleUpPercent:          scaleUp,
+		ScaleDownPercent:        scaleDown,
+		ScaleHintWindow:         scaleWindow.String(),
+		EventBufferSize:         eventBuffer,
+		KeepaliveInterval:       keepaliveInterval.String(),
+		PeerstorePruneAfter:     pruneAfterStr,
+		AdvertRefresh:           advertRefreshStr,
+		HostnameGrace:           hostnameGraceStr,
+		MetricsShedHeapMB:       shedHeap,
+		MetricsRestoreHeapMB:    restoreHeap,
+		ReservationIdleTimeout:  idleTimeoutStr,
+		DuplicatePolicy:         duplicates,
+		ReservationExpiryNotice: expiryNoticeStr,
+		TCPKeepaliveIdle:        tcpKeepalive.Idle.String(),
+		TCPKeepaliveInterval:    tcpKeepalive.Interval.String(),
+		TCPKeepaliveCount:       tcpKeepalive.Count,
+		TransportConnLimits:     transportLimits,
+		TransportLoadWeights:    loadWeights,
+		TransportLogLevels:      transportLogStrs,
+		LoadHints:               loadHints,
+		Discovery:               discoveryOn,
+		DiscoveryTTL:            discoveryTTL.String(),
+		DiscoveryMaxPeers:       discoveryMaxPeers,
+		SelfProbeInterval:       selfProbeInterval.String(),
+		SelfProbeMaxBackoff:     selfProbeMaxBackoff.String(),
+		WarmConnection:          warmTarget,
+		WarmInterval:            warmIntervalStr,
+		StatsdAddr:              statsdAddr,
+		StatsdPrefix:            statsdPrefix,
+		StatsdInterval:          statsdInterval.String(),
+		CoordinatorURL:          coordinatorStr,
+		HeartbeatURL:            heartbeatStr,
+		HeartbeatInterval:       heartbeatIntervalStr,
+		StatsdTags:              statsdTags,
+		KeepaliveTimeout:        keepaliveTimeout.String(),
+		LivenessInterval:        livenessIntervalStr,
+		LivenessTimeout:         livenessTimeoutStr,
+		LivenessFailures:        livenessFailures,
+		ClockSkewServer:         clockSkewServer,
+		ClockSkewInterval:       clockSkewIntervalStr,
+		ClockSkewThreshold:      clockSkewThresholdStr,
+		StaticPeers:             staticPeerNames,
+		MigrationHints:          migrationHints,
+		MigrationTargets:        migrationTargetNames,
+		StaticPeerMaxBackoff:    staticMaxBackoff.String(),
+		StaticPeerMaxRetries:    staticMaxRetries,
+		baseTTL:                 baseTTL,
+		warmup:                  warmup,
+		jitterMin:               jitterMin,
+		jitterMax:               jitterMax,
+		handshakeTimeout:        handshakeTimeout,
+		circuitGrace:            circuitGrace,
+		drainTimeout:            drainTimeout,
+		drainCloseGrace:         drainCloseGrace,
+		maxLifetime:             maxLifetime,
+		stopTimeout:             stopTimeout,
+		dialTimeout:             dialTimeout,
+		scaleWindow:             scaleWindow,
+		reserveQueueTimeout:     queueTimeout,
+		vipPeers:                vipSet,
+		debugPeers:              debugSet,
+		cpuAdmissionWindow:      cpuWindow,
+		disabledProtocols:       disabled,
+		slowOpThreshold:         slowOp,
+		logSamplers:             samplers,
+		transportLogLevels:      transportLogLevels,
+		hopQueueTimeout:         hopWait,
+		reserveProcTimeout:      reserveWait,
+		nonReservingGrace:       nonReservingGrace,
+		httpSocketMode:          os.FileMode(socketMode),
+		httpCacheTTL:            cacheTTL,
+		keySeed:                 keySeed,
+		maxReservations:         maxReservations,
+		perIP:                   perIP,
+		perASN:                  perASN,
+		circuitDataWindow:       dataWindow,
+		keepaliveInterval:       keepaliveInterval,
+		peerstorePruneAfter:     pruneAfter,
+		advertRefreshInterval:   advertRefresh,
+		hostnameGrace:           hostnameGrace,
+		reservationIdleTimeout:  idleTimeout,
+		livenessInterval:        livenessInterval,
+		livenessTimeout:         livenessTimeout,
+		clockSkewInterval:       clockSkewInterval,
+		clockSkewThreshold:      clockSkewThreshold,
+		expiryNotice:            expiryNotice,
+		tcpKeepalive:            tcpKeepalive,
+		coordinatorURL:          coordinator,
+		heartbeatURL:            heartbeat,
+		heartbeatInterval:       heartbeatInterval,
+		statsdInterval:          statsdInterval,
+		discoveryTTL:            discoveryTTL,
+		selfProbeInterval:       selfProbeInterval,
+		warmSibling:             warmSibling,
+		warmInterval:            warmInterval,
+		selfProbeMaxBackoff:     selfProbeMaxBackoff,
+		selfProbeTimeout:        selfProbeTimeout,
+		keepaliveTimeout:        keepaliveTimeout,
+		sourceDialWait:          sourceDialWait,
+		shutdownTimeouts:        shutdownTimeouts,
+		defaultTier:             defaultTier(limit),
+		reserveSchedule:         schedule,
+		minClientAgent:          agentRules,
+		staticPeers:             staticPeers,
+		migrationTargets:        migrationTargets,
+		staticPeerMaxBackoff:    staticMaxBackoff,
+	}
+	cfg.Resources = cfg.resourcesInfo()
+	if cfg.VIPSlots >= cfg.Resources.MaxReservations {
+		return nil, fmt.Errorf("VIP_SLOTS must be below the reservation limit (%d), got %d", cfg.Resources.MaxReservations, cfg.VIPSlots)
+	}
+	return cfg, nil
+}
+
+// resourcesInfo is the part of relay.Resources clients care about; the limit
+// fields are what the relay puts in every reservation and CONNECT response
+// outside RELAY_TIERS (the default tier).
+type resourcesInfo struct {
+	ReservationTTL    string `json:"reservationTTL"`
+	MaxReservations   int    `json:"maxReservations"`
+	MaxCircuits       int    `json:"maxCircuits"`
+	LimitDuration     string `json:"limitDuration,omitempty"`
+	LimitDataBytes    int64  `json:"limitDataBytes,omitempty"`
+	ReservationsPerIP int    `json:"maxReservationsPerIP"`
+}
+
+func (c *relayConfig) resourcesInfo() resourcesInfo {
+	rc := c.relayResources()
+	return resourcesInfo{
+		ReservationTTL:    rc.ReservationTTL.String(),
+		MaxReservations:   rc.MaxReservations,
+		MaxCircuits:       rc.MaxCircuits,
+		ReservationsPerIP: rc.MaxReservationsPerIP,
+		LimitDuration:     c.defaultTier.limit.Duration.String(),
+		LimitDataBytes:    c.defaultTier.limit.Data,
+	}
+}
+
+// limitsInfo is served on /limits: every field of the relay.Resources passed
+// to relay.New, plus the relay's own admission caps in front of it.
+type limitsInfo struct {
+	ReservationTTL         string `json:"reservationTTL"`
+	ReservationTTLMax      string `json:"reservationTTLMax"`
+	MaxReservations        int    `json:"maxReservations"`
+	MaxCircuits            int    `json:"maxCircuits"`
+	BufferSize             int    `json:"bufferSize"`
+	MaxReservationsPerPeer int    `json:"maxReservationsPerPeer"`
+	MaxReservationsPerIP   int    `json:"maxReservationsPerIP"`
+	MaxReservationsPerASN  int    `json:"maxReservationsPerASN"`
+	LimitDuration          string `json:"limitDuration,omitempty"`
+	LimitDataBytes         int64  `json:"limitDataBytes,omitempty"`
+
+	Tiers []*limitTier `json:"tiers"`
+
+	EnforcedLimitData int64  `json:"enforcedLimitDataBytes,omitempty"`
+	EnforcedLimitMode string `json:"enforcedLimitMode,omitempty"`
+
+	ReserveRateLimit int `json:"reserveRateLimitPerMinute"`
+	HopMaxConcurrent int `json:"hopMaxConcurrent"`
+	ReserveMaxConc   int `json:"reserveMaxConcurrent"`
+	ReserveQueueSize int `json:"reserveQueueSize"`
+	StopDialMax      int `json:"stopDialMaxConcurrent"`
+}
+
+func (c *relayConfig) limits() limitsInfo {
+	rc := c.relayResources()
+	info := limitsInfo{
+		Tiers:                  append([]*limitTier{c.defaultTier}, c.Tiers...),
+		ReservationTTL:         c.baseTTL.String(),
+		ReservationTTLMax:      rc.ReservationTTL.String(),
+		MaxReservations:        rc.MaxReservations,
+		MaxCircuits:            rc.MaxCircuits,
+		BufferSize:             rc.BufferSize,
+		MaxReservationsPerPeer: rc.MaxReservationsPerPeer,
+		MaxReservationsPerIP:   rc.MaxReservationsPerIP,
+		MaxReservationsPerASN:  rc.MaxReservationsPerASN,
+		ReserveRateLimit:       c.ReserveRateLimit,
+		HopMaxConcurrent:       c.HopMaxConcurrent,
+		ReserveMaxConc:         c.ReserveMaxConcurrent,
+		ReserveQueueSize:       c.ReserveQueueSize,
+		StopDialMax:            c.StopDialMaxConcurrent,
+		EnforcedLimitData:      c.EnforcedLimitData,
+		EnforcedLimitMode:      c.EnforcedLimitMode,
+	}
+	l := c.defaultTier.limit
+	info.LimitDuration = l.Duration.String()
+	info.LimitDataBytes = l.Data
+	return info
+}
+
+// relayResources builds the circuit v2 resources from the config. With TTL
+// jitter on, the relay holds slots for the top of the band and the granted
+// (advertised) expiry is pulled forward per reservation by relayHost; in the
+// same way the limit is the largest tier's and relayHost narrows it per peer.
+func (c *relayConfig) relayResources() relay.Resources {
+	rc := relay.DefaultResources()
+	rc.ReservationTTL = c.maxTTL()
+	rc.Limit = c.relayLimit()
+	rc.BufferSize = c.RelayBufferSize
+	rc.MaxCircuits = c.MaxCircuitsPerPeer
+	if c.maxReservations > 0 {
+		rc.MaxReservations = c.maxReservations
+	}
+	if c.perIP > 0 {
+		rc.MaxReservationsPerIP = c.perIP
+	}
+	if c.perASN > 0 {
+		rc.MaxReservationsPerASN = c.perASN
+	}
+	if c.CircuitDataWindow != dataWindowCumulative {
+		// relayHost counts data per window; the relay's own cumulative
+		// cut-off is lifted so it doesn't end the circuit first.
+		rc.Limit.Data = math.MaxInt64
+	}
+	return rc
+}
+
+// === Circuit data window (CIRCUIT_DATA_WINDOW) ===
+// cumulative: a circuit's data limit covers its whole life (the libp2p
+// default). renewal: the count restarts whenever the destination renews its
+// reservation. A duration: the count restarts every window.
+const (
+	dataWindowCumulative = "cumulative"
+	dataWindowRenewal    = "renewal"
+)
+
+func circuitDataWindow() (string, time.Duration, error) {
+	v := strings.ToLower(envString("CIRCUIT_DATA_WINDOW", dataWindowCumulative))
+	switch v {
+	case dataWindowCumulative, dataWindowRenewal:
+		return v, 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < time.Second {
+		return "", 0, fmt.Errorf("invalid CIRCUIT_DATA_WINDOW %q (want cumulative, renewal or a duration of at least 1s)", v)
+	}
+	return d.String(), d, nil
+}
+
+func (c *relayConfig) maxTTL() time.Duration {
+	return time.Duration(float64(c.baseTTL) * (1 + c.JitterPercent/100))
+}
+
+// === Relay protocol gating (RELAY_PROTOCOL_VERSIONS=v2|v1|both) ===
+// go-libp2p only ships the circuit v2 hop service, so v1 can be asked for but
+// never actually registered.
+func relayProtocolVersions() (string, error) {
+	versions := strings.ToLower(envString("RELAY_PROTOCOL_VERSIONS", "v2"))
+
+	switch versions {
+	case "v2":
+		return versions, nil
+	case "v1", "both":
+		log.Println("⚠️ Circuit relay v1 is deprecated; clients should move to v2 reservations")
+		if versions == "v1" {
+			return "", fmt.Errorf("circuit relay v1 is not available in go-libp2p; use RELAY_PROTOCOL_VERSIONS=v2")
+		}
+		log.Println("⚠️ Circuit relay v1 handler unavailable in go-libp2p, serving v2 only")
+		return versions, nil
+	default:
+		return "", fmt.Errorf("invalid RELAY_PROTOCOL_VERSIONS %q (want v2, v1 or both)", versions)
+	}
+}
+
+// === Advertised transports (ADVERTISE_TRANSPORTS) ===
+// Comma-separated <port>/<ws|wss> pairs, e.g. "443/wss,80/ws"; each becomes
+// /dns4/<host>/tcp/<port>/<proto> (/dns6/ with LISTEN_IP_FAMILY=ip6), the
+// first being the primary address.
+func advertiseTransports() ([]string, error) {
+	var out []string
+	for _, f := range strings.Split(envString("ADVERTISE_TRANSPORTS", "443/wss"), ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		port, proto, ok := strings.Cut(f, "/")
+		if _, err := strconv.ParseUint(port, 10, 16); !ok || err != nil || port == "0" {
+			return nil, fmt.Errorf("ADVERTISE_TRANSPORTS: %q is not <port>/<ws|wss>", f)
+		}
+		if proto != "ws" && proto != "wss" {
+			return nil, fmt.Errorf("ADVERTISE_TRANSPORTS: %q has protocol %q (want ws or wss)", f, proto)
+		}
+		if slices.Contains(out, f) {
+			return nil, fmt.Errorf("ADVERTISE_TRANSPORTS: %q listed twice", f)
+		}
+		out = append(out, f)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("ADVERTISE_TRANSPORTS must list at least one <port>/<ws|wss>")
+	}
+	return out, nil
+}
+
+// advertiseAddrs are the public addresses for host, none if host is empty.
+func (c *relayConfig) advertiseAddrs(host string) []string {
+	if host == "" {
+		return nil
+	}
+	out := make([]string, 0, len(c.AdvertiseTransports))
+	for _, t := range c.AdvertiseTransports {
+		port, proto, _ := strings.Cut(t, "/")
+		out = append(out, fmt.Sprintf("/%s/%s/tcp/%s/%s", c.dnsProto(), host, port, proto))
+	}
+	return out
+}
+
+// === DISABLED_PROTOCOLS (comma-separated protocol IDs) ===
+// Identify and the hop protocol are what make this a relay; removing them is
+// refused.
+var requiredProtocols = []protocol.ID{identify.ID, proto.ProtoIDv2Hop}
+
+func disabledProtocols() ([]protocol.ID, error) {
+	var out []protocol.ID
+	for _, f := range strings.Split(envString("DISABLED_PROTOCOLS", ""), ",") {
+		pid := protocol.ID(strings.TrimSpace(f))
+		if pid == "" {
+			continue
+		}
+		if slices.Contains(requiredProtocols, pid) {
+			return nil, fmt.Errorf("DISABLED_PROTOCOLS: %s is required by the relay and cannot be disabled", pid)
+		}
+		out = append(out, pid)
+	}
+	return out, nil
+}
+
+// === Extra relay identities (RELAY_INSTANCES) ===
+// A JSON array, e.g. [{"name":"b","port":"4001","keyB64":"...","host":"b.example"}].
+// keyB64 and host are optional; the key is never echoed on /config.
+type relayInstance struct {
+	Name string `json:"name"`
+	Port string `json:"port"`
+	Host string `json:"host,omitempty"`
+
+	keyB64 string
+}
+
+func relayInstances() ([]relayInstance, error) {
+	v := envString("RELAY_INSTANCES", "")
+	if v == "" {
+		return nil, nil
+	}
+	var raw []struct {
+		Name   string `json:"name"`
+		Port   string `json:"port"`
+		Host   string `json:"host"`
+		KeyB64 string `json:"keyB64"`
+	}
+	if err := json.Unmarshal([]byte(v), &raw); err != nil {
+		return nil, fmt.Errorf("invalid RELAY_INSTANCES: %w", err)
+	}
+
+	out := make([]relayInstance, 0, len(raw))
+	seen := map[string]bool{"primary": true}
+	for i, r := range raw {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("instance-%d", i+1)
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("RELAY_INSTANCES: duplicate name %q", r.Name)
+		}
+		seen[r.Name] = true
+		if _, err := strconv.ParseUint(r.Port, 10, 16); err != nil {
+			return nil, fmt.Errorf("RELAY_INSTANCES: instance %q has invalid port %q", r.Name, r.Port)
+		}
+		out = append(out, relayInstance{Name: r.Name, Port: r.Port, Host: r.Host, keyB64: r.KeyB64})
+	}
+	return out, nil
+}
+
+// === Port collisions ===
+// Render sends public traffic to $PORT, so the libp2p WebSocket listener has
+// to own it; the status server sits on its own fixed internal port that
+// Render never routes. If both ended up on one port the second bind fails
+// with a bare "address already in use", so refuse at startup instead.
+func checkPorts(port string, cfg *relayConfig) error {
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("invalid PORT %q", port)
+	}
+	owners := map[string]string{}
+	status := cfg.statusTCPPort()
+	if status != "" {
+		owners[status] = "the internal status server"
+	}
+	claim := func(p, who string) error {
+		other, ok := owners[p]
+		if !ok {
+			owners[p] = who
+			return nil
+		}
+		if p == status {
+			return fmt.Errorf("%s and %s both need TCP port %s; they must differ: Render routes "+
+				"public traffic to $PORT for libp2p, while the status server stays internal on :%s",
+				who, other, p, status)
+		}
+		return fmt.Errorf("%s and %s both need TCP port %s; they must differ", who, other, p)
+	}
+	if err := claim(port, "PORT (libp2p WebSocket listener)"); err != nil {
+		return err
+	}
+	for _, inst := range cfg.Instances {
+		if err := claim(inst.Port, fmt.Sprintf("RELAY_INSTANCES %q", inst.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statusTCPPort is the status server's TCP port, or "" on a Unix socket.
+func (c *relayConfig) statusTCPPort() string {
+	if strings.HasPrefix(c.HTTPBindAddr, "unix:") {
+		return ""
+	}
+	_, p, _ := net.SplitHostPort(c.HTTPBindAddr)
+	return p
+}
+
+// === Env helpers ===
+func envString(key, def string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return def
+}
+
+func envBool(key string, def bool) (bool, error) {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return b, nil
+}
+
+func envInt(key string, def int) (int, error) {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return n, nil
+}
+
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid %s %q: must not be negative", key, v)
+	}
+	return d, nil
+}
+
+func envFloat(key string, def float64) (float64, error) {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,142 @@
+// connpurpose.go
+package main
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Peer caps by purpose (MAX_RESERVING_PEERS, MAX_NONRESERVING_PEERS) ===
+// A connected peer is reserving while it holds a reservation, non-reserving
+// otherwise (identify, pings, circuit sources, clients yet to reserve). Each
+// kind has its own cap, checked when a peer that isn't connected yet secures
+// an inbound connection. A reserving peer over its cap is refused
+// (reserving_limit). A non-reserving one isn't simply refused, since every
+// client starts out non-reserving: the peer connected longest without
+// reserving, if past NONRESERVING_GRACE and not protected by an open circuit,
+// is disconnected to make room (event=nonreserving_evicted), and only when
+// there is none is the newcomer refused (nonreserving_limit).
+type connPurpose struct {
+	maxReserving    int
+	maxNonReserving int
+	grace           time.Duration
+
+	h            host.Host
+	reservations *reservationTracker
+
+	mu        sync.Mutex
+	connected map[peer.ID]time.Time
+	evicted   atomic.Int64
+}
+
+type connPurposeInfo struct {
+	Reserving       int   `json:"reserving"`
+	NonReserving    int   `json:"nonReserving"`
+	MaxReserving    int   `json:"maxReserving,omitempty"`
+	MaxNonReserving int   `json:"maxNonReserving,omitempty"`
+	Evicted         int64 `json:"nonReservingEvicted"`
+}
+
+func newConnPurpose(cfg *relayConfig) *connPurpose {
+	return &connPurpose{
+		maxReserving:    cfg.MaxReservingPeers,
+		maxNonReserving: cfg.MaxNonReservingPeers,
+		grace:           cfg.nonReservingGrace,
+		connected:       make(map[peer.ID]time.Time),
+	}
+}
+
+// bind hands over what's only built after the gater: the host and its
+// reservation tracker.
+func (c *connPurpose) bind(h host.Host, reservations *reservationTracker) {
+	c.h = h
+	c.reservations = reservations
+	h.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(n network.Network, conn network.Conn) {
+			c.mu.Lock()
+			if _, ok := c.connected[conn.RemotePeer()]; !ok {
+				c.connected[conn.RemotePeer()] = time.Now()
+			}
+			c.mu.Unlock()
+		},
+		DisconnectedF: func(n network.Network, conn network.Conn) {
+			if n.Connectedness(conn.RemotePeer()) == network.Connected {
+				return
+			}
+			c.mu.Lock()
+			delete(c.connected, conn.RemotePeer())
+			c.mu.Unlock()
+		},
+	})
+}
+
+// admit decides on a newly secured inbound connection from p.
+func (c *connPurpose) admit(p peer.ID, remote ma.Multiaddr) bool {
+	if c.h == nil || (c.maxReserving == 0 && c.maxNonReserving == 0) {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.connected[p]; ok {
+		return true
+	}
+	reserving, nonReserving, oldest := c.countLocked(time.Now())
+	if c.reservations.has(p) {
+		if c.maxReserving > 0 && reserving >= c.maxReserving {
+			connRejections.reject(rejectReservingLimit, remote, p, "")
+			return false
+		}
+		return true
+	}
+	if c.maxNonReserving == 0 || nonReserving < c.maxNonReserving {
+		return true
+	}
+	if oldest == "" {
+		connRejections.reject(rejectNonReservingLimit, remote, p, "")
+		return false
+	}
+	since := c.connected[oldest]
+	delete(c.connected, oldest)
+	c.evicted.Add(1)
+	log.Printf("event=nonreserving_evicted peer=%s connected_for=%s for=%s", oldest, time.Since(since).Round(time.Second), p)
+	go func() { _ = c.h.Network().ClosePeer(oldest) }()
+	return true
+}
+
+// countLocked splits connected peers by purpose and picks the non-reserving
+// peer to evict first, if any is eligible. Callers hold c.mu.
+func (c *connPurpose) countLocked(now time.Time) (reserving, nonReserving int, oldest peer.ID) {
+	var oldestAt time.Time
+	for p, since := range c.connected {
+		if c.reservations.has(p) {
+			reserving++
+			continue
+		}
+		nonReserving++
+		if now.Sub(since) < c.grace || c.h.ConnManager().IsProtected(p, "") {
+			continue
+		}
+		if oldest == "" || since.Before(oldestAt) {
+			oldest, oldestAt = p, since
+		}
+	}
+	return reserving, nonReserving, oldest
+}
+
+func (c *connPurpose) info() connPurposeInfo {
+	info := connPurposeInfo{MaxReserving: c.maxReserving, MaxNonReserving: c.maxNonReserving, Evicted: c.evicted.Load()}
+	if c.h == nil {
+		return info
+	}
+	c.mu.Lock()
+	info.Reserving, info.NonReserving, _ = c.countLocked(time.Now())
+	c.mu.Unlock()
+	return info
+}
@@ -0,0 +1,204 @@
+// coordinator.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// === Coordinator registration (COORDINATOR_URL) ===
+// Once warmup completes the relay POSTs a "register" event with its peer
+// IDs and advertised addresses (every node, primary first) to
+// COORDINATOR_URL, retrying with exponential backoff (1s to 1m, ±20%
+// jitter) until a 2xx arrives. On shutdown, after any drain, it POSTs a
+// "deregister" event, a few quick tries at most so exit isn't held up.
+// Credentials can go in the URL's userinfo (sent as basic auth). /config
+// and /stats show only the URL's scheme and host (urlOrigin): the path can
+// be a secret too.
+const (
+	coordinatorTimeout     = 10 * time.Second
+	coordinatorMaxBackoff  = time.Minute
+	coordinatorDeregTries  = 3
+	coordinatorDeregBudget = 5 * time.Second
+)
+
+func coordinatorURL() (*url.URL, error) {
+	raw := envString("COORDINATOR_URL", "")
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid COORDINATOR_URL %q (want an http or https URL)", raw)
+	}
+	return u, nil
+}
+
+// urlOrigin is u cut to scheme://host, which is all that's published of the
+// coordinator and heartbeat URLs: a token in the path (a healthchecks.io
+// check UUID, say) is as good as a password.
+func urlOrigin(u *url.URL) string {
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host}).String()
+}
+
+// originError cuts the URL an http.Client error carries to its origin, so
+// the error can go out on /stats.
+func originError(err error) error {
+	var uerr *url.Error
+	if !errors.As(err, &uerr) {
+		return err
+	}
+	e := *uerr
+	if u, perr := url.Parse(e.URL); perr == nil {
+		e.URL = urlOrigin(u)
+	} else {
+		e.URL = ""
+	}
+	return &e
+}
+
+type coordinatorEvent struct {
+	Event   string          `json:"event"` // register, deregister
+	Version string          `json:"version"`
+	Time    time.Time       `json:"time"`
+	Relays  []relayNodeInfo `json:"relays"`
+}
+
+type coordinator struct {
+	url    *url.URL
+	nodes  []*relayNode
+	client *http.Client
+
+	mu         sync.Mutex
+	cancel     context.CancelFunc
+	registered bool
+}
+
+// newCoordinator returns nil without COORDINATOR_URL; a nil coordinator
+// does nothing.
+func newCoordinator(cfg *relayConfig, nodes []*relayNode) *coordinator {
+	if cfg.coordinatorURL == nil {
+		return nil
+	}
+	return &coordinator{url: cfg.coordinatorURL, nodes: nodes, client: &http.Client{Timeout: coordinatorTimeout}}
+}
+
+// register starts registering in the background.
+func (c *coordinator) register(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c.mu.Lock()
+	c.cancel = cancel
+	c.mu.Unlock()
+	go func() {
+		for attempt := 1; ; attempt++ {
+			err := c.post(ctx, "register")
+			if err == nil {
+				c.mu.Lock()
+				c.registered = true
+				c.mu.Unlock()
+				log.Printf("✅ event=coordinator_registered url=%s attempts=%d", c.url.Redacted(), attempt)
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			backoff := min(coordinatorMaxBackoff, time.Second<<min(attempt-1, 30))
+			backoff = time.Duration(float64(backoff) * (0.8 + 0.4*rand.Float64()))
+			log.Printf("⚠️ event=coordinator_register_failed url=%s attempt=%d retry_in=%s err=%q",
+				c.url.Redacted(), attempt, backoff.Round(time.Millisecond), err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+		}
+	}()
+}
+
+// deregister stops a pending registration and, if one went through, tells
+// the coordinator the relay is going away.
+func (c *coordinator) deregister() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	registered := c.registered
+	c.mu.Unlock()
+	if !registered {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), coordinatorDeregBudget)
+	defer cancel()
+	var err error
+	for attempt := 1; attempt <= coordinatorDeregTries; attempt++ {
+		if err = c.post(ctx, "deregister"); err == nil {
+			log.Printf("event=coordinator_deregistered url=%s", c.url.Redacted())
+			return
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		time.Sleep(time.Duration(attempt) * 200 * time.Millisecond)
+	}
+	log.Printf("⚠️ event=coordinator_deregister_failed url=%s err=%q", c.url.Redacted(), err)
+}
+
+// refresh re-sends the registration once, if one went through, so the
+// coordinator sees current addresses. Failures are logged and left for the
+// next refresh.
+func (c *coordinator) refresh(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	registered := c.registered
+	c.mu.Unlock()
+	if !registered {
+		return nil
+	}
+	if err := c.post(ctx, "register"); err != nil {
+		log.Printf("⚠️ event=coordinator_refresh_failed url=%s err=%q", c.url.Redacted(), err)
+		return err
+	}
+	return nil
+}
+
+func (c *coordinator) post(ctx context.Context, event string) error {
+	ev := coordinatorEvent{Event: event, Version: relayVersion(), Time: time.Now().UTC()}
+	for _, n := range c.nodes {
+		ev.Relays = append(ev.Relays, n.info())
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return originError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// cpuadmission.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// === CPU admission control (CPU_ADMISSION_THRESHOLD) ===
+// Every new connection costs a TLS or Noise handshake, and once those keep
+// the CPU busy the circuits already open slow down with them. The relay's
+// own CPU time, as a share of what GOMAXPROCS allows, is sampled every second
+// and averaged over CPU_ADMISSION_WINDOW (default 10s). From the moment that
+// average reaches CPU_ADMISSION_THRESHOLD (e.g. 0.85; 0, the default, turns
+// it off) it backs off: new inbound connections are refused at accept as
+// cpu_pressure, and so are reservations from peers that don't hold one
+// (renewals still go through). It restores admission once the average is
+// back under the threshold by cpuAdmissionHysteresis (or half the threshold
+// if that is less), so it doesn't flap around it. Both changes are logged
+// (event=cpu_backoff, cpu_backoff_resolved); usage and state are on /stats
+// as cpuAdmission and on /metrics as cpu_usage and cpu_admission_backoff.
+// Where process CPU time can't be read (Windows) it stays off.
+const (
+	cpuSampleInterval      = time.Second
+	cpuAdmissionHysteresis = 0.1
+)
+
+var cpuPressure = &cpuAdmission{}
+
+type cpuAdmission struct {
+	threshold float64
+	window    time.Duration
+
+	usage   atomic.Uint64 // math.Float64bits of the windowed average
+	backoff atomic.Bool
+	refused atomic.Int64
+	since   atomic.Pointer[time.Time]
+}
+
+type cpuAdmissionInfo struct {
+	Usage     float64    `json:"usage"`
+	Threshold float64    `json:"threshold"`
+	Window    string     `json:"window"`
+	Backoff   bool       `json:"backoff"`
+	Since     *time.Time `json:"backoffSince,omitempty"`
+	Refused   int64      `json:"refused"`
+}
+
+func cpuAdmissionConfig() (float64, time.Duration, error) {
+	threshold, err := envFloat("CPU_ADMISSION_THRESHOLD", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	if threshold < 0 || threshold > 1 {
+		return 0, 0, fmt.Errorf("CPU_ADMISSION_THRESHOLD must be between 0 and 1, got %v", threshold)
+	}
+	window, err := envDuration("CPU_ADMISSION_WINDOW", 10*time.Second)
+	if err != nil {
+		return 0, 0, err
+	}
+	if window < 2*cpuSampleInterval {
+		return 0, 0, fmt.Errorf("CPU_ADMISSION_WINDOW must be at least %s, got %s", 2*cpuSampleInterval, window)
+	}
+	return threshold, window, nil
+}
+
+// startCPUAdmission starts sampling when CPU_ADMISSION_THRESHOLD is set.
+func startCPUAdmission(ctx context.Context, cfg *relayConfig) {
+	if cfg.CPUAdmissionThreshold == 0 {
+		return
+	}
+	if _, err := processCPUTime(); err != nil {
+		log.Printf("⚠️ Process CPU time unavailable (%v); CPU_ADMISSION_THRESHOLD not enforced", err)
+		return
+	}
+	c := cpuPressure
+	c.threshold, c.window = cfg.CPUAdmissionThreshold, cfg.cpuAdmissionWindow
+	log.Printf("CPU admission control: backing off at %v CPU over %s", c.threshold, c.window)
+	go c.run(ctx)
+}
+
+type cpuSample struct {
+	at  time.Time
+	cpu time.Duration
+}
+
+func (c *cpuAdmission) run(ctx context.Context) {
+	n := int(c.window / cpuSampleInterval)
+	samples := make([]cpuSample, 0, n+1)
+	t := time.NewTicker(cpuSampleInterval)
+	defer t.Stop()
+	for {
+		cpu, err := processCPUTime()
+		if err == nil {
+			samples = append(samples, cpuSample{time.Now(), cpu})
+			if len(samples) > n+1 {
+				samples = samples[1:]
+			}
+			if first, last := samples[0], samples[len(samples)-1]; len(samples) > 1 {
+				avail := last.at.Sub(first.at).Seconds() * float64(runtime.GOMAXPROCS(0))
+				c.update(min(1, (last.cpu-first.cpu).Seconds()/avail))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (c *cpuAdmission) update(usage float64) {
+	c.usage.Store(math.Float64bits(usage))
+	switch {
+	case !c.backoff.Load() && usage >= c.threshold:
+		now := time.Now()
+		c.since.Store(&now)
+		c.backoff.Store(true)
+		log.Printf("⚠️ event=cpu_backoff usage=%.3f threshold=%.3f window=%s: refusing new connections and reservations", usage, c.threshold, c.window)
+	case c.backoff.Load() && usage < c.threshold-min(cpuAdmissionHysteresis, c.threshold/2):
+		c.backoff.Store(false)
+		log.Printf("✅ event=cpu_backoff_resolved usage=%.3f after=%s refused=%d", usage, time.Since(*c.since.Load()).Round(time.Second), c.refused.Load())
+	}
+}
+
+func (c *cpuAdmission) currentUsage() float64 {
+	return math.Float64frombits(c.usage.Load())
+}
+
+// refusing reports whether something new is to be turned away.
+func (c *cpuAdmission) refusing() bool {
+	if !c.backoff.Load() {
+		return false
+	}
+	c.refused.Add(1)
+	return true
+}
+
+func (c *cpuAdmission) backoffGauge() float64 {
+	if c.backoff.Load() {
+		return 1
+	}
+	return 0
+}
+
+func (c *cpuAdmission) info() *cpuAdmissionInfo {
+	if c.threshold == 0 {
+		return nil
+	}
+	info := &cpuAdmissionInfo{
+		Usage:     c.currentUsage(),
+		Threshold: c.threshold,
+		Window:    c.window.String(),
+		Backoff:   c.backoff.Load(),
+		Refused:   c.refused.Load(),
+	}
+	if info.Backoff {
+		info.Since = c.since.Load()
+	}
+	return info
+}
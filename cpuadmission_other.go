@@ -0,0 +1,13 @@
+//go:build !unix
+
+// cpuadmission_other.go
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+func processCPUTime() (time.Duration, error) {
+	return 0, errors.New("no getrusage on this platform")
+}
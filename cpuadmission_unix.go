@@ -0,0 +1,18 @@
+//go:build unix
+
+// cpuadmission_unix.go
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPUTime is the user and system CPU time the process has used.
+func processCPUTime() (time.Duration, error) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, err
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano()), nil
+}
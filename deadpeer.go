@@ -0,0 +1,130 @@
+// deadpeer.go
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	msmux "github.com/multiformats/go-multistream"
+)
+
+// === Dead-peer detection (RESERVATION_LIVENESS_INTERVAL) ===
+// A client that crashed behind a connection that never saw a FIN keeps its
+// reservation, and can even look busy, until the TTL runs out. With an
+// interval set, every peer holding a reservation is pinged that often,
+// open streams or not (KEEPALIVE_PING_INTERVAL only pings idle peers). After
+// RESERVATION_LIVENESS_FAILURES pings in a row without an answer within
+// RESERVATION_LIVENESS_TIMEOUT the reservation is revoked by disconnecting
+// the peer, which frees its slot at once; logged as
+// event=reservation_dead_revoked and counted as deadRevokedReservations.
+// Peers that don't speak the ping protocol are never judged.
+type deadPeerChecker struct {
+	node     *relayNode
+	interval time.Duration
+	timeout  time.Duration
+	failures int
+
+	mu     sync.Mutex
+	missed map[peer.ID]int
+}
+
+func startDeadPeerChecker(ctx context.Context, n *relayNode, cfg *relayConfig) {
+	if cfg.livenessInterval <= 0 {
+		return
+	}
+	d := &deadPeerChecker{
+		node:     n,
+		interval: cfg.livenessInterval,
+		timeout:  cfg.livenessTimeout,
+		failures: cfg.LivenessFailures,
+		missed:   make(map[peer.ID]int),
+	}
+	go d.run(ctx)
+	log.Printf("✅ Pinging reserving peers every %s, revoking after %d missed pings (timeout %s)", d.interval, d.failures, d.timeout)
+}
+
+func (d *deadPeerChecker) run(ctx context.Context) {
+	t := time.NewTicker(d.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			d.sweep(ctx)
+		}
+	}
+}
+
+func (d *deadPeerChecker) sweep(ctx context.Context) {
+	sem := make(chan struct{}, keepaliveMaxConcurrent)
+	var wg sync.WaitGroup
+	live := make(map[peer.ID]bool)
+	for _, r := range d.node.reservations.list() {
+		p, err := peer.Decode(r.Peer)
+		if err != nil {
+			continue
+		}
+		live[p] = true
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			d.check(ctx, p)
+		}()
+	}
+	wg.Wait()
+
+	d.mu.Lock()
+	for p := range d.missed {
+		if !live[p] {
+			delete(d.missed, p)
+		}
+	}
+	d.mu.Unlock()
+}
+
+func (d *deadPeerChecker) check(ctx context.Context, p peer.ID) {
+	h := d.node.h
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	// Ping closes the channel without a result when ctx runs out.
+	res, ok := <-ping.Ping(ctx, h, p)
+	if !ok {
+		if ctx.Err() != context.DeadlineExceeded {
+			return
+		}
+		res.Error = ctx.Err()
+	}
+	var unsupported msmux.ErrNotSupported[protocol.ID]
+	if res.Error == nil || errors.As(res.Error, &unsupported) {
+		d.mu.Lock()
+		delete(d.missed, p)
+		d.mu.Unlock()
+		return
+	}
+	if h.Network().Connectedness(p) != network.Connected {
+		return
+	}
+
+	d.mu.Lock()
+	d.missed[p]++
+	missed := d.missed[p]
+	if missed >= d.failures {
+		delete(d.missed, p)
+	}
+	d.mu.Unlock()
+	if missed < d.failures {
+		return
+	}
+	log.Printf("⚠️ event=reservation_dead_revoked peer=%s missed_pings=%d err=%q", p, missed, res.Error)
+	d.node.rh.stats.deadRevokedReservations.Add(1)
+	_ = h.Network().ClosePeer(p)
+}
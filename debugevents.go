@@ -0,0 +1,77 @@
+// debugevents.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+)
+
+// === libp2p event bus capture (GET /debug/events?seconds=N) ===
+// Subscribes to every event on the primary host's bus for a bounded window
+// and returns what went by: reachability changes, address updates, peer
+// identification and protocol updates, connectedness changes.
+const (
+	debugEventsDefault = 10 * time.Second
+	debugEventsMaxWait = 60 * time.Second
+	debugEventsMax     = 1000
+)
+
+type capturedEvent struct {
+	Time  time.Time       `json:"time"`
+	Type  string          `json:"type"`
+	Event json.RawMessage `json:"event"`
+}
+
+func (s *statusServer) handleDebugEvents(w http.ResponseWriter, r *http.Request) {
+	window := debugEventsDefault
+	if v := r.URL.Query().Get("seconds"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > int(debugEventsMaxWait/time.Second) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("seconds must be 1-%d", int(debugEventsMaxWait/time.Second)))
+			return
+		}
+		window = time.Duration(n) * time.Second
+	}
+
+	sub, err := s.h.EventBus().Subscribe(event.WildcardSubscription, eventbus.BufSize(debugEventsMax))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer sub.Close()
+
+	t := time.NewTimer(window)
+	defer t.Stop()
+	out := []capturedEvent{}
+	truncated := false
+loop:
+	for {
+		select {
+		case e := <-sub.Out():
+			if len(out) == debugEventsMax {
+				truncated = true
+				break loop
+			}
+			b, err := json.Marshal(e)
+			if err != nil {
+				b, _ = json.Marshal(fmt.Sprintf("%+v", e))
+			}
+			out = append(out, capturedEvent{Time: time.Now(), Type: fmt.Sprintf("%T", e), Event: b})
+		case <-t.C:
+			break loop
+		case <-r.Context().Done():
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"window":    window.String(),
+		"events":    out,
+		"truncated": truncated,
+	})
+}
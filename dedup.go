@@ -0,0 +1,39 @@
+// dedup.go
+package main
+
+import (
+	"log"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// === One connection per peer (DEDUP_CONNS_PER_PEER) ===
+// close-old keeps the newest connection from a peer, reject-new keeps the
+// first. Peers with open circuits (protected in the conn manager) are left
+// alone so deduplication never cuts a live circuit.
+func dedupNotifiee(mode string, h host.Host) network.Notifiee {
+	return &network.NotifyBundle{
+		ConnectedF: func(n network.Network, c network.Conn) {
+			p := c.RemotePeer()
+			conns := n.ConnsToPeer(p)
+			if len(conns) < 2 || h.ConnManager().IsProtected(p, "") {
+				return
+			}
+
+			switch mode {
+			case "reject-new":
+				connRejections.reject(rejectDuplicateConn, c.RemoteMultiaddr(), p, "already connected")
+				go c.Close()
+			case "close-old":
+				for _, old := range conns {
+					if old.ID() == c.ID() {
+						continue
+					}
+					log.Printf("Dedup: closing older connection from %s (%s)", p, old.RemoteMultiaddr())
+					go old.Close()
+				}
+			}
+		},
+	}
+}
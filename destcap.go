@@ -0,0 +1,64 @@
+// destcap.go
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Per-destination circuit cap (DEST_MAX_CIRCUITS) ===
+// Caps how many circuits may run to one destination at once, counting from
+// the stop stream being opened until the relay closes or resets it, so a
+// popular destination can't take every circuit slot. Over the cap the stop
+// stream isn't opened and the circuit fails with CONNECTION_FAILED.
+// libp2p's MaxCircuits counts a peer's circuits in both directions together;
+// this only counts the destination side.
+var errDestCircuitLimit = errors.New("destination circuit limit reached")
+
+type destCircuits struct {
+	max   int
+	stats *relayStats
+
+	mu      sync.Mutex
+	open    map[peer.ID]int
+	lastLog time.Time
+}
+
+func newDestCircuits(cfg *relayConfig, stats *relayStats) *destCircuits {
+	return &destCircuits{max: cfg.DestMaxCircuits, stats: stats, open: make(map[peer.ID]int)}
+}
+
+// acquire takes a circuit slot to p.
+func (d *destCircuits) acquire(p peer.ID) error {
+	if d.max == 0 {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.open[p] >= d.max {
+		n := d.stats.destCircuitRefused.Add(1)
+		// one line per 10s at most during a burst
+		if time.Since(d.lastLog) >= 10*time.Second {
+			d.lastLog = time.Now()
+			log.Printf("⚠️ event=dest_circuit_limit dest=%s open=%d limit=%d refused_total=%d", p, d.open[p], d.max, n)
+		}
+		return errDestCircuitLimit
+	}
+	d.open[p]++
+	return nil
+}
+
+func (d *destCircuits) release(p peer.ID) {
+	if d.max == 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.open[p]--; d.open[p] <= 0 {
+		delete(d.open, p)
+	}
+}
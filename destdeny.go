@@ -0,0 +1,76 @@
+// destdeny.go
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Destination denylist (ACCESS_LIST_FILE "denyDestinations") ===
+// Peers on the list can still connect and reserve (the allow/deny lists
+// decide that), but the relay won't open a stop stream to them, so nobody
+// reaches them through it: the circuit fails with CONNECTION_FAILED and is
+// logged as event=dest_denied. Counts are kept per denied destination, which
+// the list itself bounds, and in total; METRICS_SHED_HEAP_MB drops the former.
+// Only the total goes on /metrics: a peer ID has no place in a label there.
+var errDestDenied = errors.New("destination denied by access list")
+
+type deniedDests struct {
+	mu       sync.Mutex
+	counts   map[peer.ID]int64
+	detailed bool
+	total    atomic.Int64
+}
+
+func newDeniedDests() *deniedDests {
+	return &deniedDests{counts: make(map[peer.ID]int64), detailed: true}
+}
+
+// setDetailed turns the per-destination counts on or off, dropping them when
+// off.
+func (d *deniedDests) setDetailed(on bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.detailed = on
+	if !on {
+		d.counts = make(map[peer.ID]int64)
+	}
+}
+
+// check refuses a stop stream to p if the access list denies it.
+func (d *deniedDests) check(access *accessWatcher, p peer.ID) error {
+	if access == nil {
+		return nil
+	}
+	if l := access.lists(); l == nil || !l.denyDests[p] {
+		return nil
+	}
+	total := d.total.Add(1)
+	d.mu.Lock()
+	detailed := d.detailed
+	if detailed {
+		d.counts[p]++
+	}
+	n := d.counts[p]
+	d.mu.Unlock()
+	if !detailed {
+		eventf("dest_denied", "⚠️ event=dest_denied dest=%s reason=access_list all_dests_total=%d", p, total)
+		return errDestDenied
+	}
+	eventf("dest_denied", "⚠️ event=dest_denied dest=%s reason=access_list refused_total=%d", p, n)
+	return errDestDenied
+}
+
+// snapshot returns the refusals so far by destination (none while shed).
+func (d *deniedDests) snapshot() map[string]int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make(map[string]int64, len(d.counts))
+	for p, n := range d.counts {
+		out[p.String()] = n
+	}
+	return out
+}
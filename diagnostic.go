@@ -0,0 +1,103 @@
+// diagnostic.go
+package main
+
+import (
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Diagnostic mode (DIAGNOSTIC_MODE) ===
+// For watching what clients do without relaying their data: connections and
+// reservations are handled as usual, but every CONNECT is refused
+// (PERMISSION_DENIED) after the relay's own checks have had their say, so no
+// stop stream is ever opened. Each connection, hop request and refused
+// circuit gets a line starting with 🔬, the last one saying whether the
+// circuit would have been opened and, if not, why. Nothing is sampled, so
+// keep it to troubleshooting.
+type diagnostics struct {
+	acl     *relayACL
+	refused atomic.Int64
+	wouldOK atomic.Int64
+}
+
+type diagnosticsInfo struct {
+	RefusedCircuits int64 `json:"refusedCircuits"`
+	WouldHaveOpened int64 `json:"wouldHaveOpened"`
+}
+
+// startDiagnostics hooks n up for DIAGNOSTIC_MODE; nil when it's off.
+func startDiagnostics(n *relayNode, cfg *relayConfig) *diagnostics {
+	if !cfg.DiagnosticMode {
+		return nil
+	}
+	d := &diagnostics{acl: n.acl}
+	n.rh.onHop(d.observe)
+	n.h.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(_ network.Network, c network.Conn) {
+			log.Printf("🔬 event=diagnostic_connected peer=%s addr=%s direction=%s transport=%s",
+				c.RemotePeer(), c.RemoteMultiaddr(), c.Stat().Direction, transportOf(c.RemoteMultiaddr()))
+		},
+		DisconnectedF: func(_ network.Network, c network.Conn) {
+			log.Printf("🔬 event=diagnostic_disconnected peer=%s addr=%s after=%s reserved=%t",
+				c.RemotePeer(), c.RemoteMultiaddr(), time.Since(c.Stat().Opened).Round(time.Millisecond), n.reservations.has(c.RemotePeer()))
+		},
+	})
+	log.Printf("🔬 DIAGNOSTIC_MODE on: accepting connections and reservations, refusing every circuit, logging each step")
+	return d
+}
+
+func (d *diagnostics) observe(ev hopEvent) {
+	var b strings.Builder
+	b.WriteString("🔬 event=diagnostic_hop type=")
+	b.WriteString(ev.Type.String())
+	b.WriteString(" peer=" + ev.Peer.String())
+	if ev.Addr != nil {
+		b.WriteString(" addr=" + ev.Addr.String())
+	}
+	if ev.Dest != "" {
+		b.WriteString(" dest=" + ev.Dest.String())
+	}
+	b.WriteString(" status=" + ev.Status.String())
+	if ev.Tier != "" {
+		b.WriteString(" tier=" + ev.Tier)
+	}
+	if !ev.Expire.IsZero() {
+		b.WriteString(" expire=" + ev.Expire.Format(time.RFC3339))
+	}
+	b.WriteString(" took=" + time.Since(ev.Start).Round(time.Millisecond).String())
+	log.Print(b.String())
+}
+
+// refuse is the last word on a CONNECT from src to dest that the relay's
+// checks would have let through as far as allowed says.
+func (d *diagnostics) refuse(src peer.ID, srcAddr ma.Multiaddr, dest peer.ID, allowed bool) bool {
+	n := d.refused.Add(1)
+	why := ""
+	switch {
+	case !allowed:
+		why = "refused by acl"
+	case !d.acl.reservations.has(dest):
+		why = "no reservation (" + pbv2.Status_NO_RESERVATION.String() + ")"
+	}
+	if why == "" {
+		d.wouldOK.Add(1)
+		log.Printf("🔬 event=diagnostic_circuit_refused src=%s src_addr=%s dest=%s would_have=opened refused_total=%d", src, srcAddr, dest, n)
+	} else {
+		log.Printf("🔬 event=diagnostic_circuit_refused src=%s src_addr=%s dest=%s would_have=failed reason=%q refused_total=%d", src, srcAddr, dest, why, n)
+	}
+	return false
+}
+
+func (d *diagnostics) info() *diagnosticsInfo {
+	if d == nil {
+		return nil
+	}
+	return &diagnosticsInfo{RefusedCircuits: d.refused.Load(), WouldHaveOpened: d.wouldOK.Load()}
+}
@@ -0,0 +1,169 @@
+// dialability.go
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Dialability (GET /dialability) ===
+// One place for "can this relay connect and be connected to":
+//
+//   - dialOut: the last outbound connection the relay made and the last stop
+//     dial (to a circuit's destination) that failed, each with its time.
+//   - dialIn: the SELF_PROBE_INTERVAL probe state.
+//   - reachability: what libp2p says, forced public by the relay, and since
+//     when.
+//   - addresses: every advertised address with its last probe result.
+//
+// assessment sums it up: reachable when the probe passes, unreachable when
+// every probed address fails, unknown with the probe off or not run yet;
+// "degraded" when some addresses failed or the last outbound attempt did.
+type connectivity struct {
+	mu            sync.Mutex
+	lastOutbound  time.Time
+	outboundPeer  peer.ID
+	lastDialErr   string
+	lastDialErrAt time.Time
+	reachability  network.Reachability
+	reachSince    time.Time
+}
+
+type dialOutInfo struct {
+	State           string     `json:"state"` // ok, failing, unknown
+	LastConnected   *time.Time `json:"lastOutboundConnection,omitempty"`
+	LastPeer        string     `json:"lastOutboundPeer,omitempty"`
+	LastDialError   string     `json:"lastDialError,omitempty"`
+	LastDialErrorAt *time.Time `json:"lastDialErrorAt,omitempty"`
+}
+
+type reachabilityInfo struct {
+	State  string     `json:"state"`
+	Forced bool       `json:"forced"`
+	Since  *time.Time `json:"since,omitempty"`
+}
+
+type dialabilityReport struct {
+	Assessment   string           `json:"assessment"` // reachable, degraded, unreachable, unknown
+	CheckedAt    time.Time        `json:"checkedAt"`
+	DialOut      dialOutInfo      `json:"dialOut"`
+	DialIn       selfProbeState   `json:"dialIn"`
+	Reachability reachabilityInfo `json:"reachability"`
+	Addresses    []addrProbe      `json:"addresses"`
+}
+
+// newConnectivity starts watching h's outbound connections and reachability.
+func newConnectivity(h host.Host) *connectivity {
+	c := &connectivity{}
+	h.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(_ network.Network, conn network.Conn) {
+			if conn.Stat().Direction != network.DirOutbound {
+				return
+			}
+			c.mu.Lock()
+			c.lastOutbound, c.outboundPeer = time.Now(), conn.RemotePeer()
+			c.mu.Unlock()
+		},
+	})
+	sub, err := h.EventBus().Subscribe(new(event.EvtLocalReachabilityChanged))
+	if err != nil {
+		log.Printf("⚠️ dialability: no reachability events: %v", err)
+		return c
+	}
+	go func() {
+		defer sub.Close()
+		for e := range sub.Out() {
+			ev := e.(event.EvtLocalReachabilityChanged)
+			c.mu.Lock()
+			c.reachability, c.reachSince = ev.Reachability, time.Now()
+			c.mu.Unlock()
+		}
+	}()
+	return c
+}
+
+// dialFailed records a failed outbound dial to p.
+func (c *connectivity) dialFailed(p peer.ID, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastDialErr, c.lastDialErrAt = p.String()+": "+err.Error(), time.Now()
+}
+
+func (c *connectivity) dialOut() dialOutInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := dialOutInfo{State: "unknown", LastDialError: c.lastDialErr}
+	if !c.lastOutbound.IsZero() {
+		t := c.lastOutbound
+		out.LastConnected, out.LastPeer, out.State = &t, c.outboundPeer.String(), "ok"
+	}
+	if !c.lastDialErrAt.IsZero() {
+		t := c.lastDialErrAt
+		out.LastDialErrorAt = &t
+		if c.lastOutbound.Before(t) {
+			out.State = "failing"
+		}
+	}
+	return out
+}
+
+func (c *connectivity) reach() reachabilityInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := reachabilityInfo{State: c.reachability.String(), Forced: true}
+	if !c.reachSince.IsZero() {
+		t := c.reachSince
+		out.Since = &t
+	}
+	return out
+}
+
+func (s *statusServer) dialability() dialabilityReport {
+	n := s.nodes[0]
+	r := dialabilityReport{
+		CheckedAt:    time.Now().UTC(),
+		DialOut:      n.connectivity.dialOut(),
+		DialIn:       s.probe.info(),
+		Reachability: n.connectivity.reach(),
+		Addresses:    s.probe.addrResults(),
+	}
+	if r.Addresses == nil {
+		r.Addresses = []addrProbe{}
+	}
+	failed := 0
+	for _, a := range r.Addresses {
+		if !a.LastProbe.IsZero() && !a.Passed {
+			failed++
+		}
+	}
+	switch r.DialIn.State {
+	case "reachable":
+		r.Assessment = "reachable"
+		if failed > 0 || r.DialOut.State == "failing" {
+			r.Assessment = "degraded"
+		}
+	case "unreachable":
+		r.Assessment = "unreachable"
+	default:
+		r.Assessment = "unknown"
+	}
+	return r
+}
+
+// GET /dialability. Public; like /stats it only names peers to admin
+// requests, so others get dialOut without the last peer dialled and without
+// the last dial error, which carries that peer's ID.
+func (s *statusServer) handleDialability(w http.ResponseWriter, r *http.Request) {
+	rep := s.dialability()
+	if code, _ := s.checkAdmin(r); code != 0 {
+		rep.DialOut.LastPeer, rep.DialOut.LastDialError = "", ""
+	}
+	writeJSON(w, http.StatusOK, rep)
+}
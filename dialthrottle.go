@@ -0,0 +1,85 @@
+// dialthrottle.go
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Outbound dial throttle (DIAL_MAX_CONCURRENT) ===
+// go-libp2p's swarm no longer has a global dial worker limit, so relayHost
+// caps how many outbound connection attempts (Connect to peers it isn't
+// connected to yet: static peers, circuit destinations) run at once. Extra
+// dials wait for a slot within their own context.
+type dialThrottle struct {
+	sem chan struct{}
+
+	inFlight atomic.Int64
+	queued   atomic.Int64
+
+	mu      sync.Mutex
+	lastLog time.Time
+}
+
+func newDialThrottle(cfg *relayConfig) *dialThrottle {
+	t := &dialThrottle{}
+	if cfg.DialMaxConcurrent > 0 {
+		t.sem = make(chan struct{}, cfg.DialMaxConcurrent)
+	}
+	return t
+}
+
+func (t *dialThrottle) acquire(ctx context.Context, p peer.ID) error {
+	if t.sem != nil {
+		select {
+		case t.sem <- struct{}{}:
+		default:
+			t.wait(p)
+			select {
+			case t.sem <- struct{}{}:
+				t.queued.Add(-1)
+			case <-ctx.Done():
+				t.queued.Add(-1)
+				return ctx.Err()
+			}
+		}
+	}
+	t.inFlight.Add(1)
+	return nil
+}
+
+func (t *dialThrottle) release() {
+	t.inFlight.Add(-1)
+	if t.sem != nil {
+		<-t.sem
+	}
+}
+
+// wait counts a queued dial and logs at most once per 10s.
+func (t *dialThrottle) wait(p peer.ID) {
+	n := t.queued.Add(1)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if time.Since(t.lastLog) >= 10*time.Second {
+		t.lastLog = time.Now()
+		log.Printf("⚠️ Dial limit reached (%d in flight), queued dial to %s (%d waiting)", cap(t.sem), p, n)
+	}
+}
+
+// Connect throttles dials to peers the relay has no connection to yet.
+func (rh *relayHost) Connect(ctx context.Context, pi peer.AddrInfo) error {
+	if rh.Network().Connectedness(pi.ID) == network.Connected {
+		return rh.Host.Connect(ctx, pi)
+	}
+	if err := rh.dials.acquire(ctx, pi.ID); err != nil {
+		return err
+	}
+	defer rh.dials.release()
+	return rh.Host.Connect(ctx, pi)
+}
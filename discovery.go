@@ -0,0 +1,381 @@
+// discovery.go
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Peer discovery (DISCOVERY) ===
+// A tracker on the relay, so Torrentium peers can find each other without a
+// separate service. A client opens a stream on discoveryProto and writes one
+// JSON line: announce puts it under an infohash (any topic up to
+// discoveryMaxTopicLen bytes) with the addresses given, or, when none are,
+// its relayed address through this relay, which needs a reservation; query
+// lists who else is there; unannounce takes it off. The relay answers with
+// one line, announce and query both carrying up to limit other peers, most
+// recent first. A registration lasts the ttl asked for, at most
+// DISCOVERY_TTL (default 15m), so clients re-announce to stay listed.
+// DISCOVERY_MAX_PEERS (default 200) bounds each infohash, the registration
+// closest to expiry making room for a new one. GET /swarm/{infohash} shows
+// the same lists read-only; counts are on /stats as discovery.
+const (
+	discoveryProto            = protocol.ID("/torrentium-relay/discovery/1.0.0")
+	discoveryMaxLine          = 4096
+	discoveryMaxTopicLen      = 128
+	discoveryMaxAddrs         = 8
+	discoveryMaxTopicsPerPeer = 32
+	discoveryMaxRegistrations = 50000
+	discoveryDefaultLimit     = 50
+)
+
+type discoveryRequest struct {
+	Version  int      `json:"v"`
+	Op       string   `json:"op"`
+	Infohash string   `json:"infohash"`
+	Addrs    []string `json:"addrs,omitempty"`
+	TTL      int      `json:"ttl,omitempty"` // seconds
+	Limit    int      `json:"limit,omitempty"`
+}
+
+type discoveryAnswer struct {
+	Version int             `json:"v"`
+	OK      bool            `json:"ok"`
+	TTL     int             `json:"ttl,omitempty"`
+	Peers   []discoveryPeer `json:"peers,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+type discoveryPeer struct {
+	Peer      string     `json:"peer"`
+	Addrs     []string   `json:"addrs"`
+	Announced *time.Time `json:"announced,omitempty"`
+	Expire    *time.Time `json:"expire,omitempty"`
+}
+
+type registration struct {
+	addrs     []string
+	announced time.Time
+	expire    time.Time
+}
+
+type discovery struct {
+	n        *relayNode
+	ttl      time.Duration
+	maxPeers int
+
+	mu      sync.Mutex
+	topics  map[string]map[peer.ID]*registration
+	perPeer map[peer.ID]int
+	count   int
+
+	announces atomic.Int64
+	queries   atomic.Int64
+	refused   atomic.Int64
+}
+
+type discoveryInfo struct {
+	Infohashes    int    `json:"infohashes"`
+	Registrations int    `json:"registrations"`
+	TTL           string `json:"ttl"`
+	MaxPeers      int    `json:"maxPeers"`
+	Announces     int64  `json:"announces"`
+	Queries       int64  `json:"queries"`
+	Refused       int64  `json:"refused"`
+}
+
+func discoveryConfig() (bool, time.Duration, int, error) {
+	on, err := envBool("DISCOVERY", false)
+	if err != nil {
+		return false, 0, 0, err
+	}
+	ttl, err := envDuration("DISCOVERY_TTL", 15*time.Minute)
+	if err != nil {
+		return false, 0, 0, err
+	}
+	if ttl < time.Minute {
+		return false, 0, 0, fmt.Errorf("DISCOVERY_TTL must be at least 1m, got %s", ttl)
+	}
+	maxPeers, err := envInt("DISCOVERY_MAX_PEERS", 200)
+	if err != nil {
+		return false, 0, 0, err
+	}
+	if maxPeers < 1 {
+		return false, 0, 0, fmt.Errorf("DISCOVERY_MAX_PEERS must be positive, got %d", maxPeers)
+	}
+	return on, ttl, maxPeers, nil
+}
+
+// newDiscovery returns nil without DISCOVERY.
+func newDiscovery(n *relayNode, cfg *relayConfig) *discovery {
+	if !cfg.Discovery {
+		return nil
+	}
+	return &discovery{
+		n:        n,
+		ttl:      cfg.discoveryTTL,
+		maxPeers: cfg.DiscoveryMaxPeers,
+		topics:   make(map[string]map[peer.ID]*registration),
+		perPeer:  make(map[peer.ID]int),
+	}
+}
+
+func (d *discovery) serve() {
+	d.n.h.SetStreamHandler(discoveryProto, func(s network.Stream) {
+		defer s.Close()
+		_ = s.SetDeadline(time.Now().Add(5 * time.Second))
+		ans := discoveryAnswer{Version: 1}
+		line, err := bufio.NewReaderSize(s, discoveryMaxLine).ReadSlice('\n')
+		var req discoveryRequest
+		switch {
+		case err != nil:
+			ans.Error = "want one JSON line"
+		case json.Unmarshal(line, &req) != nil || req.Version != 1:
+			ans.Error = `want {"v":1,"op":"announce|query|unannounce","infohash":"..."}`
+		default:
+			ans = d.handle(s.Conn().RemotePeer(), req)
+		}
+		_ = json.NewEncoder(s).Encode(ans)
+	})
+	log.Printf("Discovery on %s for %s: registrations last up to %s, %d peers per infohash", d.n.name, discoveryProto, d.ttl, d.maxPeers)
+}
+
+func (d *discovery) handle(p peer.ID, req discoveryRequest) discoveryAnswer {
+	ans := discoveryAnswer{Version: 1}
+	if err := validTopic(req.Infohash); err != nil {
+		ans.Error = err.Error()
+		return ans
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = discoveryDefaultLimit
+	}
+	switch req.Op {
+	case "announce":
+		d.announces.Add(1)
+		addrs, err := d.announceAddrs(p, req.Addrs)
+		if err != nil {
+			d.refused.Add(1)
+			ans.Error = err.Error()
+			return ans
+		}
+		ttl := d.ttl
+		if req.TTL > 0 {
+			ttl = min(ttl, time.Duration(req.TTL)*time.Second)
+		}
+		if err := d.register(p, req.Infohash, addrs, ttl); err != nil {
+			d.refused.Add(1)
+			ans.Error = err.Error()
+			return ans
+		}
+		ans.TTL = int(ttl / time.Second)
+	case "query":
+		d.queries.Add(1)
+	case "unannounce":
+		d.unregister(p, req.Infohash)
+		ans.OK = true
+		return ans
+	default:
+		ans.Error = "op must be announce, query or unannounce"
+		return ans
+	}
+	ans.OK = true
+	ans.Peers = d.peers(req.Infohash, p, limit, false)
+	return ans
+}
+
+func validTopic(t string) error {
+	if t == "" || len(t) > discoveryMaxTopicLen {
+		return fmt.Errorf("infohash must be 1 to %d bytes", discoveryMaxTopicLen)
+	}
+	if strings.ContainsFunc(t, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) || r == '/' }) {
+		return fmt.Errorf("infohash must not contain spaces, control characters or /")
+	}
+	return nil
+}
+
+// announceAddrs checks the addresses p announces, or derives its relayed
+// ones through this relay when it gave none.
+func (d *discovery) announceAddrs(p peer.ID, given []string) ([]string, error) {
+	if len(given) > discoveryMaxAddrs {
+		return nil, fmt.Errorf("at most %d addrs", discoveryMaxAddrs)
+	}
+	var out []string
+	for _, s := range given {
+		a, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid addr %q", s)
+		}
+		// an address naming a peer must name the announcer
+		if _, id := peer.SplitAddr(a); id != "" && id != p {
+			return nil, fmt.Errorf("addr %s is for another peer", s)
+		}
+		out = append(out, a.String())
+	}
+	if len(out) > 0 {
+		return out, nil
+	}
+	if !d.n.reservations.has(p) {
+		return nil, fmt.Errorf("no addrs given and no reservation to announce a relayed address for")
+	}
+	for _, relayAddr := range d.n.publicMultiaddrs() {
+		out = append(out, fmt.Sprintf("%s/p2p-circuit/p2p/%s", relayAddr, p))
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no addrs given and the relay has no public address to derive a relayed one from")
+	}
+	return out, nil
+}
+
+func (d *discovery) register(p peer.ID, topic string, addrs []string, ttl time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	regs := d.pruneLocked(topic, now)
+	if r, ok := regs[p]; ok {
+		r.addrs, r.announced, r.expire = addrs, now, now.Add(ttl)
+		return nil
+	}
+	if d.perPeer[p] >= discoveryMaxTopicsPerPeer {
+		// expired registrations elsewhere still count until pruned
+		d.pruneAllLocked(now)
+		if d.perPeer[p] >= discoveryMaxTopicsPerPeer {
+			return fmt.Errorf("announced under %d infohashes already", discoveryMaxTopicsPerPeer)
+		}
+	}
+	if d.count >= discoveryMaxRegistrations {
+		d.pruneAllLocked(now)
+		if d.count >= discoveryMaxRegistrations {
+			return fmt.Errorf("discovery table full")
+		}
+	}
+	if len(regs) >= d.maxPeers {
+		var victim peer.ID
+		for id, r := range regs {
+			if victim == "" || r.expire.Before(regs[victim].expire) {
+				victim = id
+			}
+		}
+		d.dropLocked(regs, victim)
+	}
+	if regs == nil {
+		regs = make(map[peer.ID]*registration)
+		d.topics[topic] = regs
+	}
+	regs[p] = &registration{addrs: addrs, announced: now, expire: now.Add(ttl)}
+	d.perPeer[p]++
+	d.count++
+	return nil
+}
+
+func (d *discovery) unregister(p peer.ID, topic string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	regs := d.pruneLocked(topic, time.Now())
+	if _, ok := regs[p]; ok {
+		d.dropLocked(regs, p)
+		if len(regs) == 0 {
+			delete(d.topics, topic)
+		}
+	}
+}
+
+// peers lists up to limit registrations under topic other than except's,
+// most recently announced first; detail adds the times, for /swarm.
+func (d *discovery) peers(topic string, except peer.ID, limit int, detail bool) []discoveryPeer {
+	d.mu.Lock()
+	regs := d.pruneLocked(topic, time.Now())
+	type entry struct {
+		id peer.ID
+		r  registration
+	}
+	list := make([]entry, 0, len(regs))
+	for id, r := range regs {
+		if id != except {
+			list = append(list, entry{id, *r})
+		}
+	}
+	d.mu.Unlock()
+
+	slices.SortFunc(list, func(a, b entry) int { return b.r.announced.Compare(a.r.announced) })
+	out := make([]discoveryPeer, 0, min(limit, len(list)))
+	for _, e := range list[:min(limit, len(list))] {
+		dp := discoveryPeer{Peer: e.id.String(), Addrs: e.r.addrs}
+		if detail {
+			dp.Announced, dp.Expire = &e.r.announced, &e.r.expire
+		}
+		out = append(out, dp)
+	}
+	return out
+}
+
+// pruneLocked drops topic's expired registrations and returns what is left
+// (nil for none). Callers hold d.mu.
+func (d *discovery) pruneLocked(topic string, now time.Time) map[peer.ID]*registration {
+	regs := d.topics[topic]
+	for id, r := range regs {
+		if !now.Before(r.expire) {
+			d.dropLocked(regs, id)
+		}
+	}
+	if regs != nil && len(regs) == 0 {
+		delete(d.topics, topic)
+		return nil
+	}
+	return regs
+}
+
+func (d *discovery) pruneAllLocked(now time.Time) {
+	for topic := range d.topics {
+		d.pruneLocked(topic, now)
+	}
+}
+
+func (d *discovery) dropLocked(regs map[peer.ID]*registration, p peer.ID) {
+	delete(regs, p)
+	d.count--
+	if d.perPeer[p]--; d.perPeer[p] == 0 {
+		delete(d.perPeer, p)
+	}
+}
+
+func (d *discovery) registrations() float64 {
+	if d == nil {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return float64(d.count)
+}
+
+func (d *discovery) info() *discoveryInfo {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	d.pruneAllLocked(time.Now())
+	info := &discoveryInfo{
+		Infohashes:    len(d.topics),
+		Registrations: d.count,
+		TTL:           d.ttl.String(),
+		MaxPeers:      d.maxPeers,
+		Announces:     d.announces.Load(),
+		Queries:       d.queries.Load(),
+		Refused:       d.refused.Load(),
+	}
+	d.mu.Unlock()
+	return info
+}
@@ -0,0 +1,34 @@
+// discovery_test.go
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// TestDiscoveryPerPeerCapSkipsExpired fills a peer's topic cap, lets the
+// registrations expire and announces under a new infohash.
+func TestDiscoveryPerPeerCapSkipsExpired(t *testing.T) {
+	d := newDiscovery(nil, &relayConfig{Discovery: true, discoveryTTL: time.Minute, DiscoveryMaxPeers: 200})
+	p := peer.ID("announcer")
+	const ttl = 20 * time.Millisecond
+	for i := range discoveryMaxTopicsPerPeer {
+		if err := d.register(p, fmt.Sprintf("topic-%d", i), nil, ttl); err != nil {
+			t.Fatalf("register %d: %v", i, err)
+		}
+	}
+	if err := d.register(p, "one-too-many", nil, ttl); err == nil {
+		t.Fatal("register past the cap succeeded while every registration is live")
+	}
+
+	time.Sleep(2 * ttl)
+	if err := d.register(p, "after-ttl", nil, time.Minute); err != nil {
+		t.Fatalf("register after the TTL: %v", err)
+	}
+	if got := d.registrations(); got != 1 {
+		t.Errorf("registrations = %v, want 1 (the expired ones pruned)", got)
+	}
+}
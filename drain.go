@@ -0,0 +1,163 @@
+// drain.go
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+)
+
+// === Drain (pre-shutdown) ===
+// On SIGTERM the relay stops granting reservations and circuits, then waits
+// for open circuits to finish, up to DRAIN_TIMEOUT. /drain reports progress
+// so an orchestrator can wait for it instead of sleeping.
+//
+// With DRAIN_CLOSE_GRACE set, circuits still open at the timeout are reset
+// with the Shutdown stream error code on both legs, so clients can tell a
+// redeploy from a network failure and fail over right away, and the relay
+// waits the grace before exiting so the resets reach them.
+type drainer struct {
+	cfg      *relayConfig
+	h        host.Host
+	acl      *relayACL
+	circuits *circuitTracker
+
+	mu       sync.Mutex
+	started  time.Time
+	initial  int
+	finished time.Time
+}
+
+type drainStatus struct {
+	Draining            bool       `json:"draining"`
+	Done                bool       `json:"done"`
+	StartedAt           *time.Time `json:"startedAt,omitempty"`
+	Elapsed             string     `json:"elapsed,omitempty"`
+	InitialCircuits     int        `json:"initialCircuits"`
+	RemainingCircuits   int        `json:"remainingCircuits"`
+	Deadline            *time.Time `json:"deadline,omitempty"`
+	EstimatedCompletion *time.Time `json:"estimatedCompletion,omitempty"`
+}
+
+func newDrainer(cfg *relayConfig, h host.Host, acl *relayACL, circuits *circuitTracker) *drainer {
+	return &drainer{cfg: cfg, h: h, acl: acl, circuits: circuits}
+}
+
+// run drains and returns once no circuits remain or the timeout passes. A
+// false on cancel (the drain flag file going away) stops the drain early,
+// lets reservations back in and returns false; pass nil when it can't be
+// called off.
+func (d *drainer) run(cancel <-chan bool) bool {
+	d.mu.Lock()
+	d.started = time.Now()
+	d.initial = len(d.circuits.list("", ""))
+	d.mu.Unlock()
+	d.acl.draining.Store(true)
+	log.Printf("Draining: refusing new reservations and circuits, %d circuits open (timeout %s)", d.initial, d.cfg.drainTimeout)
+	if d.cfg.MigrationHints {
+		// before waiting: with no circuits open the drain ends straight away
+		d.sendMigrationHints(d.started.Add(d.cfg.drainTimeout))
+	}
+
+	if !d.wait(cancel) {
+		d.acl.draining.Store(false)
+		d.mu.Lock()
+		d.started, d.initial = time.Time{}, 0
+		d.mu.Unlock()
+		log.Printf("✅ Drain cancelled, accepting reservations again")
+		return false
+	}
+	if d.cfg.drainCloseGrace > 0 && len(d.circuits.list("", "")) > 0 {
+		d.closeCircuits()
+	}
+
+	d.mu.Lock()
+	d.finished = time.Now()
+	d.mu.Unlock()
+	return true
+}
+
+// closeCircuits resets every relayed stream (hop towards sources, stop
+// towards destinations) with StreamShutdown, then sleeps DRAIN_CLOSE_GRACE.
+func (d *drainer) closeCircuits() {
+	n := 0
+	for _, c := range d.h.Network().Conns() {
+		for _, s := range c.GetStreams() {
+			if pid := s.Protocol(); pid == proto.ProtoIDv2Hop || pid == proto.ProtoIDv2Stop {
+				_ = s.ResetWithError(network.StreamShutdown)
+				n++
+			}
+		}
+	}
+	log.Printf("event=drain_close streams=%d code=%#x grace=%s", n, network.StreamShutdown, d.cfg.drainCloseGrace)
+	time.Sleep(d.cfg.drainCloseGrace)
+}
+
+func (d *drainer) wait(cancel <-chan bool) bool {
+	deadline := time.After(d.cfg.drainTimeout)
+	tick := time.NewTicker(250 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		remaining := len(d.circuits.list("", ""))
+		if remaining == 0 {
+			log.Printf("✅ Drain complete after %s", time.Since(d.started).Round(time.Millisecond))
+			return true
+		}
+		select {
+		case <-deadline:
+			log.Printf("⚠️ Drain timeout after %s, %d circuits still open", d.cfg.drainTimeout, remaining)
+			return true
+		case on := <-cancel:
+			if !on {
+				return false
+			}
+		case <-tick.C:
+		}
+	}
+}
+
+// status estimates completion from circuit lifetimes: each circuit is cut by
+// the relay at start+Limit.Duration at the latest, and the drain itself stops
+// at the deadline.
+func (d *drainer) status() drainStatus {
+	d.mu.Lock()
+	started, initial, finished := d.started, d.initial, d.finished
+	d.mu.Unlock()
+
+	open := d.circuits.list("", "")
+	st := drainStatus{RemainingCircuits: len(open)}
+	if started.IsZero() {
+		return st
+	}
+
+	deadline := started.Add(d.cfg.drainTimeout)
+	st.Draining = true
+	st.Done = !finished.IsZero()
+	st.StartedAt = &started
+	st.Elapsed = time.Since(started).Round(time.Millisecond).String()
+	st.InitialCircuits = initial
+	st.Deadline = &deadline
+
+	eta := time.Now()
+	if limit := d.cfg.relayResources().Limit; limit != nil && limit.Duration > 0 {
+		for _, c := range open {
+			if end := c.Start.Add(limit.Duration); end.After(eta) {
+				eta = end
+			}
+		}
+	} else if len(open) > 0 {
+		eta = deadline
+	}
+	if eta.After(deadline) {
+		eta = deadline
+	}
+	if st.Done {
+		eta = finished
+	}
+	st.EstimatedCompletion = &eta
+	return st
+}
@@ -0,0 +1,73 @@
+// drainflag.go
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// === Drain flag file ===
+// DRAIN_FLAG_FILE lets an orchestrator drain the relay by creating a file on a
+// shared volume instead of sending SIGTERM. watchDrainFlag sends true when the
+// file appears and false when it goes away; only changes are sent. Like the
+// access list, the directory is watched so rename-over-write is seen.
+func watchDrainFlag(path string) (<-chan bool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := fw.Add(filepath.Dir(path)); err != nil {
+		_ = fw.Close()
+		return nil, err
+	}
+
+	ch := make(chan bool)
+	go func() {
+		defer fw.Close()
+		var present bool
+		check := func() {
+			_, err := os.Stat(path)
+			now := err == nil
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				log.Printf("⚠️ Drain flag %s: %v", path, err)
+				return
+			}
+			if now == present {
+				return
+			}
+			present = now
+			if present {
+				log.Printf("Drain flag %s created", path)
+			} else {
+				log.Printf("Drain flag %s removed", path)
+			}
+			ch <- present
+		}
+		check()
+		for {
+			select {
+			case ev, ok := <-fw.Events:
+				if !ok {
+					return
+				}
+				if filepath.Base(ev.Name) == filepath.Base(path) {
+					check()
+				}
+			case err, ok := <-fw.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("⚠️ Drain flag watcher: %v", err)
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,51 @@
+// dupreserve.go
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Duplicate reservations (DUPLICATE_RESERVATION_POLICY) ===
+// A RESERVE from a peer that already holds a live reservation. go-libp2p
+// always answers it with a fresh expiry (now plus the TTL); the policy
+// decides what the relay makes of it:
+//
+//   - extend (default): a renewal. The reservation keeps its grant time,
+//     idle clock and renewal count, only the expiry moves out.
+//   - replace: a new reservation in place of the old one. Grant time, idle
+//     clock and renewal count start over.
+//   - reject: refused with PERMISSION_DENIED until the old one expires, so a
+//     reservation lasts exactly one TTL and the client reserves again after.
+//
+// Every decision is logged as event=duplicate_reservation with the action.
+const (
+	dupExtend  = "extend"
+	dupReplace = "replace"
+	dupReject  = "reject"
+)
+
+func duplicateReservationPolicy() (string, error) {
+	v := strings.ToLower(envString("DUPLICATE_RESERVATION_POLICY", dupExtend))
+	switch v {
+	case dupExtend, dupReplace, dupReject:
+		return v, nil
+	}
+	return "", fmt.Errorf("invalid DUPLICATE_RESERVATION_POLICY %q (want extend, replace or reject)", v)
+}
+
+// allowDuplicate refuses p's RESERVE under the reject policy while p holds a
+// live reservation.
+func (a *relayACL) allowDuplicate(p peer.ID) bool {
+	if a.duplicates != dupReject {
+		return true
+	}
+	r, ok := a.reservations.get(p)
+	if !ok {
+		return true
+	}
+	eventf("duplicate_reservation", "event=duplicate_reservation peer=%s policy=%s action=rejected expire=%s", p, dupReject, r.Expire.UTC().Format("15:04:05"))
+	return false
+}
@@ -0,0 +1,82 @@
+// enforcedlimit.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// === Enforced vs advertised data limit (ENFORCED_LIMIT_DATA) ===
+// The data limit in RESERVE/CONNECT responses (and /config, /limits) stays
+// the tier's limitDataBytes; ENFORCED_LIMIT_DATA is what circuits are held
+// to when it is lower. Advertising stays the contract clients plan around,
+// so it can be tightened in two steps:
+//
+//   - soft: circuits still run to the advertised limit; crossing the
+//     enforced one is logged (once per circuit and data window) and counted.
+//   - hard: circuits are reset at the enforced limit, before the advertised
+//     one, with the same log line.
+//
+// A value at or above a tier's advertised limit changes nothing for it.
+const (
+	enforceHard = "hard"
+	enforceSoft = "soft"
+)
+
+func loadEnforcedLimit() (int64, string, error) {
+	n, err := envInt("ENFORCED_LIMIT_DATA", 0)
+	if err != nil {
+		return 0, "", err
+	}
+	if n < 0 {
+		return 0, "", fmt.Errorf("ENFORCED_LIMIT_DATA must not be negative, got %d", n)
+	}
+	mode := strings.ToLower(envString("ENFORCED_LIMIT_MODE", enforceHard))
+	if mode != enforceHard && mode != enforceSoft {
+		return 0, "", fmt.Errorf("invalid ENFORCED_LIMIT_MODE %q (want hard or soft)", mode)
+	}
+	if n == 0 {
+		mode = ""
+	}
+	return int64(n), mode, nil
+}
+
+// enforcedLimits returns the per-direction byte limit a circuit is cut at
+// and, in soft mode, the count at which it is logged for passing the
+// enforced limit (0 = never).
+func (c *relayConfig) enforcedLimits(advertised int64) (limit, softAt int64) {
+	if c.EnforcedLimitData == 0 || c.EnforcedLimitData >= advertised {
+		return advertised, 0
+	}
+	if c.EnforcedLimitMode == enforceSoft {
+		return advertised, c.EnforcedLimitData
+	}
+	return c.EnforcedLimitData, 0
+}
+
+// logEnforcedLimits says at startup which tiers are held to less than they
+// advertise.
+func logEnforcedLimits(cfg *relayConfig) {
+	for _, t := range append([]*limitTier{cfg.defaultTier}, cfg.Tiers...) {
+		if limit, softAt := cfg.enforcedLimits(t.limit.Data); limit < t.limit.Data || softAt > 0 {
+			log.Printf("⚠️ Tier %q advertises %d bytes per direction, enforcing %d (ENFORCED_LIMIT_MODE=%s)",
+				t.Name, t.limit.Data, cfg.EnforcedLimitData, cfg.EnforcedLimitMode)
+		}
+	}
+}
+
+// enforcedLimitHit logs and counts (once per window) a circuit whose data
+// passed the enforced limit while still under the advertised one.
+func (t *circuitTracker) enforcedLimitHit(c *circuit, total int64) {
+	if !c.enforcedHit.CompareAndSwap(false, true) {
+		return
+	}
+	t.stats.enforcedLimitHits.Add(1)
+	enforced, action := c.limitData, "reset"
+	if c.softAt > 0 {
+		enforced, action = c.softAt, "warn"
+	}
+	eventf("enforced_limit", "⚠️ event=enforced_limit id=%d src=%s dst=%s tier=%s bytes=%d enforced=%d advertised=%d action=%s",
+		c.id, c.src, c.dst, c.tier, total, enforced, c.advertisedData, action)
+}
@@ -0,0 +1,81 @@
+// ephemeralport.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Ephemeral port fallback (ALLOW_EPHEMERAL_PORT) ===
+// For dev and tests where fixed ports collide: a listen port that can't be
+// bound is swapped for one the kernel picks, and the swap is logged. The
+// port is picked up front rather than listening on :0 so the gater's
+// transport classification and confirmListeners see the real one. Off by
+// default, so a port clash in production still fails startup (exit code 5),
+// or leaves that transport out under ALLOW_PARTIAL_TRANSPORTS.
+func ephemeralFallback(node string, listen []string) []string {
+	out := make([]string, 0, len(listen))
+	for _, l := range listen {
+		a, err := ma.NewMultiaddr(l)
+		key := portKey(a)
+		network, port, _ := strings.Cut(key, "/")
+		if err != nil || key == "" || port == "0" {
+			out = append(out, l)
+			continue
+		}
+		if err := probePort(network, port); err == nil || !isListenError(err) {
+			out = append(out, l)
+			continue
+		}
+		free, err := freePort(network)
+		if err != nil {
+			// leave it; libp2p reports the original bind error
+			log.Printf("⚠️ node=%s %s port %s unavailable and no ephemeral port free: %v", node, network, port, err)
+			out = append(out, l)
+			continue
+		}
+		repl := strings.Replace(l, "/"+key+"/", fmt.Sprintf("/%s/%d/", network, free), 1)
+		log.Printf("⚠️ node=%s %s port %s unavailable, listening on ephemeral port %d instead (ALLOW_EPHEMERAL_PORT): %s", node, network, port, free, repl)
+		out = append(out, repl)
+	}
+	return out
+}
+
+// probePort binds and releases port on all interfaces, like the listener
+// would.
+func probePort(network, port string) error {
+	if network == "udp" {
+		c, err := net.ListenPacket("udp", ":"+port)
+		if err != nil {
+			return err
+		}
+		return c.Close()
+	}
+	l, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+	return l.Close()
+}
+
+// freePort asks the kernel for an unused port.
+func freePort(network string) (int, error) {
+	if network == "udp" {
+		c, err := net.ListenPacket("udp", ":0")
+		if err != nil {
+			return 0, err
+		}
+		defer c.Close()
+		return c.LocalAddr().(*net.UDPAddr).Port, nil
+	}
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,160 @@
+// eventfeed.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// === Event fan-out (EVENT_BUFFER_SIZE) ===
+// One shared ring buffer of relay events; every real-time consumer (the
+// /events SSE stream today) reads it through its own cursor. Publishing never
+// blocks: once the ring is full the oldest event is overwritten, and a
+// subscriber that hadn't read it yet skips ahead and counts it as dropped.
+// Delivery is best-effort and at-most-once; nothing is replayed across
+// reconnects beyond what is still in the ring.
+type relayEvent struct {
+	Seq    uint64    `json:"seq"`
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	Peer   string    `json:"peer,omitempty"`
+	Dest   string    `json:"dest,omitempty"`
+	Status string    `json:"status,omitempty"`
+}
+
+type eventFeed struct {
+	mu     sync.Mutex
+	buf    []relayEvent
+	next   uint64 // seq of the next event; the first is 1
+	notify chan struct{}
+
+	published   atomic.Int64
+	dropped     atomic.Int64
+	subscribers atomic.Int64
+}
+
+type eventSub struct {
+	feed   *eventFeed
+	cursor uint64
+}
+
+func newEventFeed(size int) *eventFeed {
+	return &eventFeed{buf: make([]relayEvent, size), next: 1, notify: make(chan struct{})}
+}
+
+// hopObserver turns hop requests into feed events; register it with onHop.
+func (f *eventFeed) hopObserver(ev hopEvent) {
+	e := relayEvent{
+		Type:   strings.ToLower(ev.Type.String()),
+		Peer:   ev.Peer.String(),
+		Status: ev.Status.String(),
+	}
+	if ev.Dest != "" {
+		e.Dest = ev.Dest.String()
+	}
+	f.publish(e)
+}
+
+func (f *eventFeed) publish(e relayEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e.Seq = f.next
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	f.buf[e.Seq%uint64(len(f.buf))] = e
+	f.next++
+	f.published.Add(1)
+
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+// subscribe starts a cursor at the next event to be published.
+func (f *eventFeed) subscribe() *eventSub {
+	f.subscribers.Add(1)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &eventSub{feed: f, cursor: f.next}
+}
+
+func (s *eventSub) close() {
+	s.feed.subscribers.Add(-1)
+}
+
+// next blocks until there are unread events or ctx is done. missed is how
+// many events were overwritten before this subscriber got to them.
+func (s *eventSub) next(ctx context.Context) (events []relayEvent, missed uint64, err error) {
+	f := s.feed
+	for {
+		f.mu.Lock()
+		if s.cursor < f.next {
+			size := uint64(len(f.buf))
+			if f.next > size && s.cursor < f.next-size {
+				missed = f.next - size - s.cursor
+				s.cursor = f.next - size
+				f.dropped.Add(int64(missed))
+			}
+			for ; s.cursor < f.next; s.cursor++ {
+				events = append(events, f.buf[s.cursor%size])
+			}
+			f.mu.Unlock()
+			return events, missed, nil
+		}
+		wait := f.notify
+		f.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+	}
+}
+
+func (f *eventFeed) stats() map[string]int64 {
+	return map[string]int64{
+		"capacity":    int64(len(f.buf)),
+		"published":   f.published.Load(),
+		"dropped":     f.dropped.Load(),
+		"subscribers": f.subscribers.Load(),
+	}
+}
+
+// GET /events streams the feed as server-sent events. Gaps are announced
+// with an "event: dropped" message carrying the number of missed events.
+func (s *statusServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	sub := s.events.subscribe()
+	defer sub.close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		events, missed, err := sub.next(r.Context())
+		if err != nil {
+			return
+		}
+		if missed > 0 {
+			fmt.Fprintf(w, "event: dropped\ndata: {\"missed\":%d}\n\n", missed)
+		}
+		for _, e := range events {
+			b, _ := json.Marshal(e)
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.Seq, b)
+		}
+		flusher.Flush()
+	}
+}
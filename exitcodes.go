@@ -0,0 +1,61 @@
+// exitcodes.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// === Startup failures and exit codes ===
+// Every startup failure ends with one event=startup_failed line and an exit
+// code per failure class, so an orchestrator can retry the transient ones
+// (secrets backend down, port still held by the previous process) and stop
+// restarting on the ones that won't fix themselves (bad config or key).
+type exitClass struct {
+	name      string
+	code      int
+	transient bool
+}
+
+var (
+	exitConfig    = exitClass{"config", 2, false}     // invalid env values or combinations
+	exitKey       = exitClass{"key", 3, false}        // private key unreadable or invalid
+	exitSecrets   = exitClass{"secrets", 4, true}     // RELAY_SECRETS_URL could not be resolved
+	exitBind      = exitClass{"bind", 5, true}        // a listener could not be bound
+	exitInputFile = exitClass{"input_file", 6, false} // access list, GeoIP database, policy file or admin TLS files
+	exitSetup     = exitClass{"setup", 7, true}       // relay service, tracing, mDNS or other setup
+	exitSelfTest  = exitClass{"selftest", 8, false}   // --selftest failed
+)
+
+// startupError carries the class of a failure from where it is known (e.g.
+// newRelayNode can tell a bind failure apart) to the fatal call in main.
+type startupError struct {
+	class exitClass
+	err   error
+}
+
+func (e *startupError) Error() string { return e.err.Error() }
+func (e *startupError) Unwrap() error { return e.err }
+
+// fatal logs the structured failure line and exits. A startupError in err
+// overrides class.
+func fatal(class exitClass, format string, args ...any) {
+	err := fmt.Errorf(format, args...)
+	var se *startupError
+	if errors.As(err, &se) {
+		class = se.class
+	}
+	log.Printf("event=startup_failed class=%s exit_code=%d transient=%t err=%q", class.name, class.code, class.transient, err)
+	os.Exit(class.code)
+}
+
+// isListenError reports whether err came from binding a listen address.
+// The swarm formats its listen errors with %s, so the message is checked too.
+func isListenError(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE) || errors.Is(err, syscall.EACCES) ||
+		strings.Contains(err.Error(), "failed to listen") || strings.Contains(err.Error(), "address already in use")
+}
@@ -0,0 +1,124 @@
+// expirynotice.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// === Reservation expiry notices (RESERVATION_EXPIRY_NOTICE) ===
+// go-libp2p's circuit v2 client renews on its own schedule, and identify has
+// nothing to say about reservations, so a client that missed its renewal
+// only learns when the reservation is gone. With a notice period set, every
+// client whose reservation is within it and whose identify lists
+// expiryProto gets one JSON expiryNotice, once per expiry: renewing moves
+// the expiry and re-arms it.
+const (
+	expiryProto       = protocol.ID("/torrentium-relay/expiry/1.0.0")
+	expirySendTimeout = 5 * time.Second
+	expirySenders     = 16
+)
+
+type expiryNotice struct {
+	Version   int       `json:"v"`
+	Expire    time.Time `json:"expire"`
+	Remaining string    `json:"remaining"`
+}
+
+type expiryNotifier struct {
+	node   *relayNode
+	notice time.Duration
+
+	// notified maps each peer to the expiry it was last notified for.
+	notified map[peer.ID]time.Time
+}
+
+func startExpiryNotifier(ctx context.Context, n *relayNode, cfg *relayConfig) {
+	if cfg.expiryNotice <= 0 {
+		return
+	}
+	e := &expiryNotifier{node: n, notice: cfg.expiryNotice, notified: make(map[peer.ID]time.Time)}
+	go e.run(ctx)
+	log.Printf("✅ Sending reservation expiry notices %s before expiry over %s", e.notice, expiryProto)
+}
+
+func (e *expiryNotifier) run(ctx context.Context) {
+	t := time.NewTicker(max(time.Second, min(30*time.Second, e.notice/4)))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			e.sweep()
+		}
+	}
+}
+
+func (e *expiryNotifier) sweep() {
+	n := e.node
+	now := time.Now()
+	live := make(map[peer.ID]bool)
+	var sent, unsupported, failed atomic.Int64
+	sem := make(chan struct{}, expirySenders)
+	var wg sync.WaitGroup
+	for _, r := range n.reservations.list() {
+		p, err := peer.Decode(r.Peer)
+		if err != nil {
+			continue
+		}
+		live[p] = true
+		left := r.Expire.Sub(now)
+		if left <= 0 || left > e.notice || e.notified[p].Equal(r.Expire) {
+			continue
+		}
+		e.notified[p] = r.Expire
+		if ok, _ := n.h.Peerstore().SupportsProtocols(p, expiryProto); len(ok) == 0 {
+			unsupported.Add(1)
+			continue
+		}
+		msg := expiryNotice{Version: 1, Expire: r.Expire, Remaining: left.Round(time.Second).String()}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			if err := e.send(p, msg); err != nil {
+				failed.Add(1)
+				eventf("expiry_notice_failed", "event=expiry_notice_failed peer=%s err=%q", p, err)
+				return
+			}
+			sent.Add(1)
+			n.rh.stats.expiryNoticesSent.Add(1)
+		}()
+	}
+	wg.Wait()
+	for p := range e.notified {
+		if !live[p] {
+			delete(e.notified, p)
+		}
+	}
+	if sent.Load()+unsupported.Load()+failed.Load() > 0 {
+		log.Printf("event=expiry_notices sent=%d unsupported=%d failed=%d", sent.Load(), unsupported.Load(), failed.Load())
+	}
+}
+
+func (e *expiryNotifier) send(p peer.ID, msg expiryNotice) error {
+	ctx, cancel := context.WithTimeout(context.Background(), expirySendTimeout)
+	defer cancel()
+	s, err := e.node.h.NewStream(network.WithNoDial(ctx, "expiry notice"), p, expiryProto)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	_ = s.SetDeadline(time.Now().Add(expirySendTimeout))
+	return json.NewEncoder(s).Encode(msg)
+}
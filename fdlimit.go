@@ -0,0 +1,160 @@
+// fdlimit.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// === File descriptor limit (FD_LIMIT_THRESHOLD, FD_LIMIT_ACTION) ===
+// Every connection holds a file descriptor, and a relay that runs out of
+// them fails in odd places: accept loops spinning on EMFILE, dials and
+// listeners erroring, /stats and the config files unreadable. At startup the
+// soft RLIMIT_NOFILE is raised to the hard limit (the Go runtime usually has
+// done so already) and both are logged. Open descriptors are then counted
+// every few seconds, and once they reach FD_LIMIT_THRESHOLD (default 0.9)
+// of the soft limit the relay logs event=fd_limit and, with FD_LIMIT_ACTION
+// refuse (the default), turns new inbound connections away at accept as
+// fd_limit, leaving headroom for the ones it has. warn only logs. Refusal
+// stops once usage drops back below the threshold (event=fd_limit_resolved).
+// Usage is on /stats as fdLimit and on /metrics as fd_usage. Where the limit
+// or the count can't be read (Windows, no /proc or /dev/fd) the check is off.
+const fdCheckInterval = 2 * time.Second
+
+const (
+	fdActionRefuse = "refuse"
+	fdActionWarn   = "warn"
+)
+
+var fdUsage = &fdMonitor{}
+
+type fdMonitor struct {
+	threshold float64
+	action    string
+	soft      uint64
+	hard      uint64
+
+	open    atomic.Int64
+	over    atomic.Bool
+	refused atomic.Int64
+}
+
+type fdLimitInfo struct {
+	Open      int64   `json:"open"`
+	Soft      uint64  `json:"softLimit"`
+	Hard      uint64  `json:"hardLimit"`
+	Usage     float64 `json:"usage"`
+	Threshold float64 `json:"threshold"`
+	Action    string  `json:"action"`
+	Over      bool    `json:"overThreshold"`
+}
+
+func fdLimitConfig() (float64, string, error) {
+	threshold, err := envFloat("FD_LIMIT_THRESHOLD", 0.9)
+	if err != nil {
+		return 0, "", err
+	}
+	if threshold <= 0 || threshold > 1 {
+		return 0, "", fmt.Errorf("FD_LIMIT_THRESHOLD must be above 0 and at most 1, got %v", threshold)
+	}
+	action := envString("FD_LIMIT_ACTION", fdActionRefuse)
+	if action != fdActionRefuse && action != fdActionWarn {
+		return 0, "", fmt.Errorf("invalid FD_LIMIT_ACTION %q (want %s or %s)", action, fdActionRefuse, fdActionWarn)
+	}
+	return threshold, action, nil
+}
+
+// startFDMonitor raises the soft limit and starts counting. It leaves
+// fdUsage inactive where the limit or the count isn't available.
+func startFDMonitor(ctx context.Context, cfg *relayConfig) {
+	soft, hard, err := raiseFDLimit()
+	if err != nil {
+		log.Printf("⚠️ File descriptor limit unknown (%v); FD_LIMIT_THRESHOLD not enforced", err)
+		return
+	}
+	if _, err := countOpenFDs(); err != nil {
+		log.Printf("⚠️ Open file descriptors can't be counted (%v); FD_LIMIT_THRESHOLD not enforced", err)
+		return
+	}
+	m := fdUsage
+	m.threshold, m.action, m.soft, m.hard = cfg.FDLimitThreshold, cfg.FDLimitAction, soft, hard
+	log.Printf("File descriptor limit: %d (hard %d), %s new connections above %.0f%%", soft, hard, m.action, m.threshold*100)
+	m.check()
+	go func() {
+		t := time.NewTicker(fdCheckInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				m.check()
+			}
+		}
+	}()
+}
+
+func (m *fdMonitor) check() {
+	n, err := countOpenFDs()
+	if err != nil {
+		return
+	}
+	m.open.Store(int64(n))
+	usage := m.usage()
+	switch over := usage >= m.threshold; {
+	case over && !m.over.Load():
+		m.over.Store(true)
+		log.Printf("⚠️ event=fd_limit open=%d limit=%d usage=%.3f threshold=%.3f action=%s", n, m.soft, usage, m.threshold, m.action)
+	case !over && m.over.Load():
+		m.over.Store(false)
+		log.Printf("✅ event=fd_limit_resolved open=%d limit=%d refused=%d", n, m.soft, m.refused.Load())
+	}
+}
+
+func (m *fdMonitor) usage() float64 {
+	if m.soft == 0 {
+		return 0
+	}
+	return float64(m.open.Load()) / float64(m.soft)
+}
+
+// refusing reports whether new connections are to be turned away.
+func (m *fdMonitor) refusing() bool {
+	if m.action != fdActionRefuse || !m.over.Load() {
+		return false
+	}
+	m.refused.Add(1)
+	return true
+}
+
+func (m *fdMonitor) info() *fdLimitInfo {
+	if m.soft == 0 {
+		return nil
+	}
+	return &fdLimitInfo{
+		Open:      m.open.Load(),
+		Soft:      m.soft,
+		Hard:      m.hard,
+		Usage:     m.usage(),
+		Threshold: m.threshold,
+		Action:    m.action,
+		Over:      m.over.Load(),
+	}
+}
+
+// countOpenFDs counts this process's open descriptors (Linux /proc, the
+// BSDs' and macOS's /dev/fd).
+func countOpenFDs() (int, error) {
+	var err error
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		var entries []os.DirEntry
+		if entries, err = os.ReadDir(dir); err == nil {
+			return len(entries) - 1, nil // the directory being read
+		}
+	}
+	return 0, err
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+// fdlimit_other.go
+package main
+
+import "errors"
+
+func raiseFDLimit() (soft, hard uint64, err error) {
+	return 0, 0, errors.New("no RLIMIT_NOFILE on this platform")
+}
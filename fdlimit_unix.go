@@ -0,0 +1,23 @@
+//go:build unix
+
+// fdlimit_unix.go
+package main
+
+import "syscall"
+
+// raiseFDLimit sets the soft RLIMIT_NOFILE to the hard one and returns both.
+// A refused raise keeps the soft limit that was there.
+func raiseFDLimit() (soft, hard uint64, err error) {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return 0, 0, err
+	}
+	if lim.Cur < lim.Max {
+		raised := lim
+		raised.Cur = raised.Max
+		if syscall.Setrlimit(syscall.RLIMIT_NOFILE, &raised) == nil {
+			lim = raised
+		}
+	}
+	return uint64(lim.Cur), uint64(lim.Max), nil
+}
@@ -0,0 +1,254 @@
+// gater.go
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/pnet"
+	"github.com/libp2p/go-libp2p/core/sec"
+	"github.com/libp2p/go-libp2p/core/transport"
+	tptu "github.com/libp2p/go-libp2p/p2p/net/upgrader"
+	ma "github.com/multiformats/go-multiaddr"
+	"go.uber.org/fx"
+)
+
+// === Connection gater ===
+// relayGater sees every inbound connection from raw accept to fully upgraded.
+// It tracks handshakes through their phases so stalled ones (cut by the
+// upgrader after CONN_HANDSHAKE_TIMEOUT, or by the gater after a phase
+// timeout) get logged with the remote address and phase, and enforces
+// the ACCESS_LIST_FILE allow/deny lists, the GeoIP filter,
+// TRANSPORT_CONN_LIMITS, the churn detector and the per-purpose peer caps.
+type relayGater struct {
+	handshakeTimeout time.Duration
+	tcpKeepalive     net.KeepAliveConfig
+	access           *accessWatcher
+	geo              *geoFilter
+	transports       *transportConns
+	churn            *churnDetector
+	purpose          *connPurpose
+	phases           *handshakePhases
+
+	mu      sync.Mutex
+	pending map[string]*pendingHandshake
+}
+
+type pendingHandshake struct {
+	remote ma.Multiaddr
+	conn   io.Closer // the raw socket, closed when a phase times out
+	start  time.Time
+	timer  *time.Timer
+
+	phase      string
+	securityAt time.Time
+	securedAt  time.Time
+}
+
+func newRelayGater(cfg *relayConfig, access *accessWatcher, geo *geoFilter) *relayGater {
+	return &relayGater{
+		handshakeTimeout: cfg.handshakeTimeout,
+		tcpKeepalive:     cfg.tcpKeepalive,
+		access:           access,
+		geo:              geo,
+		transports:       newTransportConns(cfg.TransportConnLimits),
+		churn:            newChurnDetector(cfg.Churn),
+		purpose:          newConnPurpose(cfg),
+		phases:           newHandshakePhases(cfg.HandshakePhases),
+		pending:          make(map[string]*pendingHandshake),
+	}
+}
+
+func (g *relayGater) InterceptPeerDial(peer.ID) bool { return true }
+
+func (g *relayGater) InterceptAddrDial(peer.ID, ma.Multiaddr) bool { return true }
+
+func (g *relayGater) InterceptAccept(addrs network.ConnMultiaddrs) bool {
+	remote := addrs.RemoteMultiaddr()
+	if fdUsage.refusing() {
+		connRejections.reject(rejectFDLimit, remote, "", fmt.Sprintf("%d of %d file descriptors open", fdUsage.open.Load(), fdUsage.soft))
+		return false
+	}
+	if cpuPressure.refusing() {
+		connRejections.reject(rejectCPUPressure, remote, "", fmt.Sprintf("cpu %.2f over %s", cpuPressure.currentUsage(), cpuPressure.window))
+		return false
+	}
+	if l := g.access.lists(); l != nil && !l.allowAddr(remote) {
+		connRejections.reject(rejectAccessListAddr, remote, "", "")
+		return false
+	}
+	if reason, detail := g.geo.check(remote); reason != "" {
+		connRejections.reject(reason, remote, "", detail)
+		return false
+	}
+	if name, limit, full := g.transports.full(addrs); full {
+		connRejections.reject(rejectTransportLimit, remote, "", fmt.Sprintf("%s at %d connections", name, limit))
+		return false
+	}
+	setTCPKeepalive(addrs, g.tcpKeepalive)
+	key := hostPortKey(remote)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if ph, ok := g.pending[key]; ok {
+		ph.timer.Stop()
+	}
+	ph := &pendingHandshake{remote: remote, start: time.Now(), phase: phaseTransport}
+	ph.conn, _ = addrs.(io.Closer)
+	ph.timer = time.AfterFunc(g.deadline(ph, ph.start), func() { g.expire(key, ph) })
+	g.pending[key] = ph
+	return true
+}
+
+// deadline is how long ph may stay in its current phase, entered at since:
+// the phase's own timeout or what is left of CONN_HANDSHAKE_TIMEOUT,
+// whichever is sooner.
+func (g *relayGater) deadline(ph *pendingHandshake, since time.Time) time.Duration {
+	left := g.handshakeTimeout - since.Sub(ph.start)
+	if t := g.phases.timeout(ph.phase); t > 0 && t < left {
+		return t
+	}
+	return left
+}
+
+// advance moves remote's handshake into phase, re-arming its timer.
+func (g *relayGater) advance(remote ma.Multiaddr, phase string) {
+	key := hostPortKey(remote)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ph, ok := g.pending[key]
+	if !ok || ph.phase == phase {
+		return
+	}
+	now := time.Now()
+	ph.phase = phase
+	switch phase {
+	case phaseSecurity:
+		ph.securityAt = now
+	case phaseMuxer:
+		ph.securedAt = now
+	}
+	if ph.timer.Stop() {
+		ph.timer.Reset(g.deadline(ph, now))
+	}
+}
+
+func (g *relayGater) expire(key string, ph *pendingHandshake) {
+	g.mu.Lock()
+	if g.pending[key] != ph {
+		g.mu.Unlock()
+		return
+	}
+	delete(g.pending, key)
+	phase := ph.phase
+	since := ph.start
+	switch phase {
+	case phaseSecurity:
+		since = ph.securityAt
+	case phaseMuxer:
+		since = ph.securedAt
+	}
+	g.mu.Unlock()
+
+	elapsed := time.Since(since).Round(time.Millisecond)
+	detail := fmt.Sprintf("phase=%s no handshake within %s", phase, g.handshakeTimeout)
+	if time.Since(ph.start) < g.handshakeTimeout {
+		// a phase timeout: the upgrader won't cut this one yet
+		if ph.conn != nil {
+			_ = ph.conn.Close()
+		}
+		detail = fmt.Sprintf("phase=%s after %s", phase, elapsed)
+	}
+	g.phases.timedOut(phase)
+	connRejections.reject(rejectHandshakeTimeout, ph.remote, "", detail)
+}
+
+func (g *relayGater) InterceptSecured(dir network.Direction, p peer.ID, addrs network.ConnMultiaddrs) bool {
+	if dir != network.DirInbound {
+		return true
+	}
+	if !g.admitSecured(p, addrs.RemoteMultiaddr()) {
+		// refused before the upgrade: don't let it count as a stalled handshake too
+		g.settle(addrs.RemoteMultiaddr())
+		return false
+	}
+	g.advance(addrs.RemoteMultiaddr(), phaseMuxer)
+	return true
+}
+
+func (g *relayGater) admitSecured(p peer.ID, remote ma.Multiaddr) bool {
+	if l := g.access.lists(); l != nil && !l.allowPeer(p, remote) {
+		connRejections.reject(rejectAccessListPeer, remote, p, "")
+		return false
+	}
+	if left, banned := g.churn.connect(p); banned {
+		connRejections.reject(rejectFlapping, remote, p, "banned for "+left.Round(time.Second).String())
+		return false
+	}
+	return g.purpose.admit(p, remote)
+}
+
+func (g *relayGater) InterceptUpgraded(c network.Conn) (bool, control.DisconnectReason) {
+	if c.Stat().Direction == network.DirInbound {
+		if ph, ok := g.settle(c.RemoteMultiaddr()); ok {
+			now := time.Now()
+			g.phases.observe(ph, now)
+			logSlow("handshake", now.Sub(ph.start), c.RemotePeer().String())
+		}
+	}
+	return true, 0
+}
+
+// settle ends tracking of remote's handshake, returning it if it was pending.
+func (g *relayGater) settle(remote ma.Multiaddr) (*pendingHandshake, bool) {
+	key := hostPortKey(remote)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ph, ok := g.pending[key]
+	if ok {
+		ph.timer.Stop()
+		delete(g.pending, key)
+	}
+	return ph, ok
+}
+
+// hostPortKey trims a multiaddr down to its IP and TCP/UDP port, so the raw
+// accepted socket and the upgraded /ws connection compare equal.
+func hostPortKey(a ma.Multiaddr) string {
+	var out ma.Multiaddr
+	for _, c := range a {
+		out = append(out, c)
+		if code := c.Protocol().Code; code == ma.P_TCP || code == ma.P_UDP {
+			break
+		}
+	}
+	return out.String()
+}
+
+// handshakeTimeout rebuilds the libp2p upgrader with a custom accept timeout
+// (security + muxer negotiation); libp2p has no direct option for it. The
+// security transports are wrapped on the way for the phase tracking.
+func handshakeTimeout(t time.Duration) libp2p.Option {
+	return libp2p.WithFxOption(fx.Decorate(fx.Annotate(
+		func(_ transport.Upgrader, security []sec.SecureTransport, muxers []tptu.StreamMuxer,
+			psk pnet.PSK, rcmgr network.ResourceManager, gater connmgr.ConnectionGater) (transport.Upgrader, error) {
+			if g, ok := gater.(*relayGater); ok {
+				wrapped := make([]sec.SecureTransport, len(security))
+				for i, st := range security {
+					wrapped[i] = phasedSecurity{SecureTransport: st, gater: g}
+				}
+				security = wrapped
+			}
+			return tptu.New(security, muxers, psk, rcmgr, gater, tptu.WithAcceptTimeout(t))
+		},
+		fx.ParamTags(``, `name:"security"`),
+	)))
+}
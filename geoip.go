@@ -0,0 +1,171 @@
+// geoip.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// === GeoIP / ASN filtering (ENABLE_GEOIP) ===
+// The gater looks up each inbound connection's source IP in MaxMind
+// databases (GeoLite2/GeoIP2 Country or City for GEOIP_DB_PATH, ASN for
+// GEOIP_ASN_DB_PATH) and applies country and ASN allow/deny lists. Deny wins;
+// a non-empty allow list refuses everything not on it, including addresses
+// the database has no record for. Private and loopback addresses are never
+// filtered.
+type geoFilter struct {
+	country *maxminddb.Reader
+	asn     *maxminddb.Reader
+
+	allowCountries, denyCountries []string
+	allowASNs, denyASNs           []uint
+}
+
+type geoRecord struct {
+	Country string
+	ASN     uint
+	Org     string
+}
+
+func (r geoRecord) String() string {
+	country := r.Country
+	if country == "" {
+		country = "unknown"
+	}
+	if r.ASN == 0 {
+		return "country=" + country
+	}
+	return fmt.Sprintf("country=%s asn=AS%d org=%q", country, r.ASN, r.Org)
+}
+
+func newGeoFilter() (*geoFilter, error) {
+	enabled, err := envBool("ENABLE_GEOIP", false)
+	if err != nil || !enabled {
+		return nil, err
+	}
+
+	g := &geoFilter{}
+	for _, v := range strings.Split(envString("GEOIP_ALLOW_COUNTRIES", ""), ",") {
+		if v = strings.ToUpper(strings.TrimSpace(v)); v != "" {
+			g.allowCountries = append(g.allowCountries, v)
+		}
+	}
+	for _, v := range strings.Split(envString("GEOIP_DENY_COUNTRIES", ""), ",") {
+		if v = strings.ToUpper(strings.TrimSpace(v)); v != "" {
+			g.denyCountries = append(g.denyCountries, v)
+		}
+	}
+	if g.allowASNs, err = parseASNs("GEOIP_ALLOW_ASNS"); err != nil {
+		return nil, err
+	}
+	if g.denyASNs, err = parseASNs("GEOIP_DENY_ASNS"); err != nil {
+		return nil, err
+	}
+
+	needCountry := len(g.allowCountries) > 0 || len(g.denyCountries) > 0
+	needASN := len(g.allowASNs) > 0 || len(g.denyASNs) > 0
+	if !needCountry && !needASN {
+		return nil, fmt.Errorf("ENABLE_GEOIP needs at least one of GEOIP_ALLOW_COUNTRIES, GEOIP_DENY_COUNTRIES, GEOIP_ALLOW_ASNS or GEOIP_DENY_ASNS")
+	}
+	if needCountry {
+		if g.country, err = openGeoDB("GEOIP_DB_PATH"); err != nil {
+			return nil, err
+		}
+	}
+	if needASN {
+		if g.asn, err = openGeoDB("GEOIP_ASN_DB_PATH"); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("✅ GeoIP filter: allow countries %v, deny countries %v, allow ASNs %v, deny ASNs %v",
+		g.allowCountries, g.denyCountries, g.allowASNs, g.denyASNs)
+	return g, nil
+}
+
+func openGeoDB(key string) (*maxminddb.Reader, error) {
+	path := envString(key, "")
+	if path == "" {
+		return nil, fmt.Errorf("ENABLE_GEOIP: %s is required for the configured lists", key)
+	}
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	log.Printf("GeoIP database %s: %s built %d", path, db.Metadata.DatabaseType, db.Metadata.BuildEpoch)
+	return db, nil
+}
+
+// parseASNs reads a comma-separated list of "13335" or "AS13335".
+func parseASNs(key string) ([]uint, error) {
+	var out []uint
+	for _, v := range strings.Split(envString(key, ""), ",") {
+		v = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(v)), "AS")
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry %q", key, v)
+		}
+		out = append(out, uint(n))
+	}
+	return out, nil
+}
+
+func (g *geoFilter) lookup(ip net.IP) geoRecord {
+	var rec geoRecord
+	if g.country != nil {
+		var c struct {
+			Country struct {
+				ISOCode string `maxminddb:"iso_code"`
+			} `maxminddb:"country"`
+		}
+		if err := g.country.Lookup(ip, &c); err != nil {
+			debugf("geoip country lookup %s: %v", ip, err)
+		}
+		rec.Country = c.Country.ISOCode
+	}
+	if g.asn != nil {
+		var a struct {
+			ASN uint   `maxminddb:"autonomous_system_number"`
+			Org string `maxminddb:"autonomous_system_organization"`
+		}
+		if err := g.asn.Lookup(ip, &a); err != nil {
+			debugf("geoip asn lookup %s: %v", ip, err)
+		}
+		rec.ASN, rec.Org = a.ASN, a.Org
+	}
+	return rec
+}
+
+// check returns why a connection from remote must be refused (with the
+// resolved region as detail), or "" to let it through.
+func (g *geoFilter) check(remote ma.Multiaddr) (rejectReason, string) {
+	if g == nil {
+		return "", ""
+	}
+	ip, err := manet.ToIP(remote)
+	if err != nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() {
+		return "", ""
+	}
+	rec := g.lookup(ip)
+	switch {
+	case slices.Contains(g.denyCountries, rec.Country):
+		return rejectGeoCountry, rec.String() + " denied"
+	case rec.ASN != 0 && slices.Contains(g.denyASNs, rec.ASN):
+		return rejectGeoASN, rec.String() + " denied"
+	case len(g.allowCountries) > 0 && !slices.Contains(g.allowCountries, rec.Country):
+		return rejectGeoCountry, rec.String() + " not allowed"
+	case len(g.allowASNs) > 0 && !slices.Contains(g.allowASNs, rec.ASN):
+		return rejectGeoASN, rec.String() + " not allowed"
+	}
+	return "", ""
+}
@@ -0,0 +1,153 @@
+// handshakephase.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/sec"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// === Handshake phases (CONN_TRANSPORT/SECURITY/MUXER_TIMEOUT) ===
+// An inbound TCP/WebSocket connection goes through three phases before it is
+// usable: transport (from the TCP accept through the TLS and HTTP upgrade of
+// /wss and /ws, and the multistream pick of a security protocol), security
+// (the Noise or TLS handshake) and muxer (picking and starting yamux). The
+// gater sees the accept, the secured and the upgraded connection, and the
+// security transports are wrapped to mark where the handshake starts.
+//
+// Each phase can get its own bound, enforced by closing the socket; one that
+// passes it is counted as handshake_timeout with detail "phase=<name> after
+// <elapsed>". CONN_HANDSHAKE_TIMEOUT still bounds the whole. Phase durations
+// of connections that complete go into torrentium_relay_handshake_phase_seconds
+// on /metrics. QUIC and WebTransport do their handshake inside the transport
+// and are neither split nor bounded per phase.
+const (
+	phaseTransport = "transport"
+	phaseSecurity  = "security"
+	phaseMuxer     = "muxer"
+)
+
+type handshakePhaseConfig struct {
+	Transport string `json:"transport,omitempty"`
+	Security  string `json:"security,omitempty"`
+	Muxer     string `json:"muxer,omitempty"`
+
+	transport, security, muxer time.Duration
+}
+
+func loadHandshakePhases(overall time.Duration) (handshakePhaseConfig, error) {
+	var c handshakePhaseConfig
+	for _, p := range []struct {
+		env string
+		d   *time.Duration
+		s   *string
+	}{
+		{"CONN_TRANSPORT_TIMEOUT", &c.transport, &c.Transport},
+		{"CONN_SECURITY_TIMEOUT", &c.security, &c.Security},
+		{"CONN_MUXER_TIMEOUT", &c.muxer, &c.Muxer},
+	} {
+		d, err := envDuration(p.env, 0)
+		if err != nil {
+			return c, err
+		}
+		if d < 0 || d >= overall {
+			return c, fmt.Errorf("%s must be 0 or below CONN_HANDSHAKE_TIMEOUT (%s), got %s", p.env, overall, d)
+		}
+		if d > 0 {
+			*p.d, *p.s = d, d.String()
+		}
+	}
+	return c, nil
+}
+
+type handshakePhases struct {
+	cfg  handshakePhaseConfig
+	hist *prometheus.HistogramVec
+
+	timedOutTransport atomic.Int64
+	timedOutSecurity  atomic.Int64
+	timedOutMuxer     atomic.Int64
+}
+
+type handshakePhasesInfo struct {
+	Timeouts handshakePhaseConfig `json:"timeouts"`
+	TimedOut map[string]int64     `json:"timedOut"`
+}
+
+func newHandshakePhases(cfg handshakePhaseConfig) *handshakePhases {
+	return &handshakePhases{
+		cfg: cfg,
+		hist: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "torrentium_relay",
+			Name:      "handshake_phase_seconds",
+			Help:      "Inbound connection setup time by phase (transport, security, muxer), for TCP/WebSocket connections that completed.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+		}, []string{"phase"}),
+	}
+}
+
+// timeout is the phase's own bound, 0 if it has none.
+func (h *handshakePhases) timeout(phase string) time.Duration {
+	switch phase {
+	case phaseTransport:
+		return h.cfg.transport
+	case phaseSecurity:
+		return h.cfg.security
+	case phaseMuxer:
+		return h.cfg.muxer
+	}
+	return 0
+}
+
+func (h *handshakePhases) timedOut(phase string) {
+	switch phase {
+	case phaseTransport:
+		h.timedOutTransport.Add(1)
+	case phaseSecurity:
+		h.timedOutSecurity.Add(1)
+	case phaseMuxer:
+		h.timedOutMuxer.Add(1)
+	}
+}
+
+// observe records a completed handshake's phases; ones that skipped the
+// security transport (QUIC, WebTransport) aren't split.
+func (h *handshakePhases) observe(ph *pendingHandshake, done time.Time) {
+	if ph.securityAt.IsZero() || ph.securedAt.IsZero() {
+		return
+	}
+	h.hist.WithLabelValues(phaseTransport).Observe(ph.securityAt.Sub(ph.start).Seconds())
+	h.hist.WithLabelValues(phaseSecurity).Observe(ph.securedAt.Sub(ph.securityAt).Seconds())
+	h.hist.WithLabelValues(phaseMuxer).Observe(done.Sub(ph.securedAt).Seconds())
+}
+
+func (h *handshakePhases) info() handshakePhasesInfo {
+	return handshakePhasesInfo{
+		Timeouts: h.cfg,
+		TimedOut: map[string]int64{
+			phaseTransport: h.timedOutTransport.Load(),
+			phaseSecurity:  h.timedOutSecurity.Load(),
+			phaseMuxer:     h.timedOutMuxer.Load(),
+		},
+	}
+}
+
+// phasedSecurity marks the start of the security phase for the gater.
+type phasedSecurity struct {
+	sec.SecureTransport
+	gater *relayGater
+}
+
+func (s phasedSecurity) SecureInbound(ctx context.Context, insecure net.Conn, p peer.ID) (sec.SecureConn, error) {
+	if c, ok := insecure.(interface{ RemoteMultiaddr() ma.Multiaddr }); ok {
+		s.gater.advance(c.RemoteMultiaddr(), phaseSecurity)
+	}
+	return s.SecureTransport.SecureInbound(ctx, insecure, p)
+}
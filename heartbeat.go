@@ -0,0 +1,171 @@
+// heartbeat.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// === Heartbeat (HEARTBEAT_URL) ===
+// A push signal for dead man's switch monitors (healthchecks.io, Uptime Kuma
+// push monitors and the like), which alert when pings stop coming: every
+// HEARTBEAT_INTERVAL, from startup, the relay POSTs a small JSON body to
+// HEARTBEAT_URL with its peer ID and what /readyz would say. A relay that
+// is up but not ready keeps pinging, with its state in the body; only a
+// relay that is gone (or can't reach the monitor) goes silent. Failures are
+// logged as event=heartbeat_failed, once per run of them, and retried on the
+// next tick. Credentials can go in the URL's userinfo; like
+// COORDINATOR_URL, /config and /stats show only its scheme and host.
+const heartbeatTimeout = 10 * time.Second
+
+func heartbeatURL() (*url.URL, error) {
+	raw := envString("HEARTBEAT_URL", "")
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid HEARTBEAT_URL %q (want an http or https URL)", raw)
+	}
+	return u, nil
+}
+
+type heartbeatPing struct {
+	PeerID         string    `json:"peerId"`
+	Version        string    `json:"version"`
+	Time           time.Time `json:"time"`
+	Status         string    `json:"status"` // /readyz's answer
+	Healthy        bool      `json:"healthy"`
+	Uptime         string    `json:"uptime"`
+	ConnectedPeers int       `json:"connectedPeers"`
+	Reservations   int       `json:"reservations"`
+	ActiveCircuits int       `json:"activeCircuits"`
+}
+
+type heartbeat struct {
+	url      *url.URL
+	interval time.Duration
+	status   *statusServer
+	client   *http.Client
+
+	sent   atomic.Int64
+	failed atomic.Int64
+
+	mu       sync.Mutex
+	lastSent *time.Time
+	lastErr  string
+}
+
+type heartbeatInfo struct {
+	URL      string     `json:"url"`
+	Interval string     `json:"interval"`
+	Sent     int64      `json:"sent"`
+	Failed   int64      `json:"failed"`
+	LastSent *time.Time `json:"lastSent,omitempty"`
+	LastErr  string     `json:"lastError,omitempty"`
+}
+
+func startHeartbeat(ctx context.Context, cfg *relayConfig, s *statusServer) *heartbeat {
+	if cfg.heartbeatURL == nil {
+		return nil
+	}
+	hb := &heartbeat{url: cfg.heartbeatURL, interval: cfg.heartbeatInterval, status: s, client: &http.Client{Timeout: heartbeatTimeout}}
+	go hb.run(ctx)
+	log.Printf("✅ Heartbeat to %s every %s", hb.url.Redacted(), hb.interval)
+	return hb
+}
+
+func (hb *heartbeat) run(ctx context.Context) {
+	t := time.NewTicker(hb.interval)
+	defer t.Stop()
+	failing := false
+	for {
+		err := hb.ping(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		switch {
+		case err != nil:
+			hb.failed.Add(1)
+			if !failing {
+				log.Printf("⚠️ event=heartbeat_failed url=%s err=%q (retrying every %s)", hb.url.Redacted(), err, hb.interval)
+			}
+			failing = true
+		case failing:
+			log.Printf("✅ event=heartbeat_recovered url=%s", hb.url.Redacted())
+			failing = false
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (hb *heartbeat) ping(ctx context.Context) error {
+	s := hb.status
+	state := s.readiness()
+	body, err := json.Marshal(heartbeatPing{
+		PeerID:         s.h.ID().String(),
+		Version:        relayVersion(),
+		Time:           time.Now().UTC(),
+		Status:         state,
+		Healthy:        state == "ready",
+		Uptime:         time.Since(s.started).Round(time.Second).String(),
+		ConnectedPeers: len(s.h.Network().Peers()),
+		Reservations:   s.reservations.count(),
+		ActiveCircuits: len(s.circuits.list("", "")),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hb.url.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := hb.client.Do(req)
+	err = originError(err)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			err = fmt.Errorf("unexpected status %s", resp.Status)
+		}
+	}
+
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	if err != nil {
+		hb.lastErr = err.Error()
+		return err
+	}
+	now := time.Now()
+	hb.sent.Add(1)
+	hb.lastSent, hb.lastErr = &now, ""
+	return nil
+}
+
+func (hb *heartbeat) info() *heartbeatInfo {
+	if hb == nil {
+		return nil
+	}
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	return &heartbeatInfo{
+		URL:      urlOrigin(hb.url),
+		Interval: hb.interval.String(),
+		Sent:     hb.sent.Load(),
+		Failed:   hb.failed.Load(),
+		LastSent: hb.lastSent,
+		LastErr:  hb.lastErr,
+	}
+}
@@ -0,0 +1,70 @@
+// heavyhttp.go
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// === Heavy endpoint concurrency (HTTP_HEAVY_MAX_CONCURRENT) ===
+// /stats, /metrics.json, /reservations, /circuits and /snapshot walk whole
+// trackers under their locks, the same locks the relay takes on every
+// reservation and circuit. At most
+// HTTP_HEAVY_MAX_CONCURRENT of them run at once; a request past that doesn't
+// wait but gets 503 with Retry-After, so a client hammering them can't stall
+// the data path. Admin endpoints check the token first, so unauthenticated
+// requests never take a slot. Everything else is unrestricted.
+type heavyLimiter struct {
+	sem chan struct{}
+
+	inFlight atomic.Int64
+	refused  atomic.Int64
+	logged   atomic.Int64 // unix seconds of the last refusal line
+}
+
+type heavyLimiterInfo struct {
+	Max      int   `json:"maxConcurrent"`
+	InFlight int64 `json:"inFlight"`
+	Refused  int64 `json:"refused"`
+}
+
+func newHeavyLimiter(max int) *heavyLimiter {
+	l := &heavyLimiter{}
+	if max > 0 {
+		l.sem = make(chan struct{}, max)
+	}
+	return l
+}
+
+func (l *heavyLimiter) wrap(next http.HandlerFunc) http.HandlerFunc {
+	if l.sem == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case l.sem <- struct{}{}:
+		default:
+			n := l.refused.Add(1)
+			// one line per 10s at most during a flood
+			now := time.Now().Unix()
+			if last := l.logged.Load(); now-last >= 10 && l.logged.CompareAndSwap(last, now) {
+				log.Printf("⚠️ HTTP_HEAVY_MAX_CONCURRENT (%d) reached, refused %s from %s (%d refused so far)", cap(l.sem), r.URL.Path, r.RemoteAddr, n)
+			}
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, "too many concurrent requests to heavy endpoints, retry shortly")
+			return
+		}
+		l.inFlight.Add(1)
+		defer func() {
+			l.inFlight.Add(-1)
+			<-l.sem
+		}()
+		next(w, r)
+	}
+}
+
+func (l *heavyLimiter) info() heavyLimiterInfo {
+	return heavyLimiterInfo{Max: cap(l.sem), InFlight: l.inFlight.Load(), Refused: l.refused.Load()}
+}
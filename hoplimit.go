@@ -0,0 +1,95 @@
+// hoplimit.go
+package main
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+)
+
+// === Hop handler concurrency (HOP_MAX_CONCURRENT) ===
+// Caps how many hop streams (RESERVE/CONNECT requests) the relay handles at
+// once. A stream beyond the cap waits up to HOP_QUEUE_TIMEOUT for a slot and
+// is then answered with RESOURCE_LIMIT_EXCEEDED.
+type hopLimiter struct {
+	sem  chan struct{}
+	wait time.Duration
+
+	inFlight atomic.Int64
+	stats    *relayStats
+
+	mu      sync.Mutex
+	lastLog time.Time
+}
+
+func newHopLimiter(cfg *relayConfig, stats *relayStats) *hopLimiter {
+	l := &hopLimiter{wait: cfg.hopQueueTimeout, stats: stats}
+	if cfg.HopMaxConcurrent > 0 {
+		l.sem = make(chan struct{}, cfg.HopMaxConcurrent)
+	}
+	return l
+}
+
+// acquire reserves a handler slot for s, or refuses the stream and returns false.
+func (l *hopLimiter) acquire(s network.Stream) bool {
+	if l.sem == nil {
+		l.inFlight.Add(1)
+		return true
+	}
+
+	select {
+	case l.sem <- struct{}{}:
+	default:
+		if !l.queue() {
+			l.refuse(s)
+			return false
+		}
+	}
+	l.inFlight.Add(1)
+	return true
+}
+
+func (l *hopLimiter) queue() bool {
+	if l.wait <= 0 {
+		return false
+	}
+	t := time.NewTimer(l.wait)
+	defer t.Stop()
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+func (l *hopLimiter) release() {
+	l.inFlight.Add(-1)
+	if l.sem != nil {
+		<-l.sem
+	}
+}
+
+func (l *hopLimiter) refuse(s network.Stream) {
+	n := l.stats.hopRefused.Add(1)
+	_ = s.SetWriteDeadline(time.Now().Add(time.Second))
+	_ = util.NewDelimitedWriter(s).WriteMsg(&pbv2.HopMessage{
+		Type:   pbv2.HopMessage_STATUS.Enum(),
+		Status: pbv2.Status_RESOURCE_LIMIT_EXCEEDED.Enum(),
+	})
+	_ = s.Close()
+
+	// one line per 10s at most during a storm
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.lastLog) >= 10*time.Second {
+		l.lastLog = time.Now()
+		log.Printf("⚠️ Hop handler limit reached (%d in flight), refused stream from %s (%d refused so far)",
+			cap(l.sem), s.Conn().RemotePeer(), n)
+	}
+}
@@ -0,0 +1,101 @@
+// hostgrace.go
+package main
+
+import (
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Hostname change grace (HOSTNAME_CHANGE_GRACE) ===
+// After POST /advertise swaps the hostname, clients that learned the old
+// addresses (from identify, the coordinator or their own cache) would only
+// find them gone. With HOSTNAME_CHANGE_GRACE set the old addresses stay
+// advertised after the new ones for that long, then are dropped and the
+// shorter set is pushed to connected peers again. Each step is logged:
+// event=advertise_changed with old_until, then event=advertise_old_dropped.
+// A hostname changed again within the grace keeps every earlier one until its
+// own deadline; switching back to a retiring hostname just makes it current.
+type retiredHost struct {
+	host   string
+	public []ma.Multiaddr
+	since  time.Time
+	until  time.Time
+}
+
+// retire carries the hostnames still within their grace over to next, adding
+// the one old advertised, and schedules its drop. It returns the old_until
+// part of the advertise_changed line, empty when old isn't kept.
+func (n *relayNode) retire(old, next *advertisement) string {
+	grace := n.cfg.hostnameGrace
+	if grace <= 0 {
+		return ""
+	}
+	now := time.Now()
+	for _, r := range old.retired {
+		if r.host != next.host && now.Before(r.until) {
+			next.retired = append(next.retired, r)
+		}
+	}
+	if old.host == "" || old.host == next.host || len(old.public) == 0 {
+		return ""
+	}
+	next.retired = append(next.retired, retiredHost{host: old.host, public: old.public, since: now, until: now.Add(grace)})
+	time.AfterFunc(grace, n.dropRetired)
+	return " old_until=" + now.Add(grace).UTC().Format(time.RFC3339)
+}
+
+// dropRetired removes the hostnames past their grace from the current
+// advertisement and announces what is left.
+func (n *relayNode) dropRetired() {
+	before := n.h.Addrs()
+	for {
+		cur := n.adv.Load()
+		now := time.Now()
+		var kept, dropped []retiredHost
+		for _, r := range cur.retired {
+			if now.Before(r.until) {
+				kept = append(kept, r)
+			} else {
+				dropped = append(dropped, r)
+			}
+		}
+		if len(dropped) == 0 {
+			return
+		}
+		next := *cur
+		next.retired = kept
+		if !n.adv.CompareAndSwap(cur, &next) {
+			continue
+		}
+		for _, r := range dropped {
+			log.Printf("event=advertise_old_dropped node=%s old=%q current=%q advertised_for=%s", n.name, r.host, cur.host, now.Sub(r.since).Round(time.Second))
+		}
+		if err := n.announceAddrs(before); err != nil {
+			log.Printf("⚠️ node=%s could not announce addresses after dropping old hostname: %v", n.name, err)
+		}
+		return
+	}
+}
+
+// retiredAddrs are the old hostnames' addresses, oldest change last.
+func (adv *advertisement) retiredAddrs() []ma.Multiaddr {
+	var out []ma.Multiaddr
+	for _, r := range slices.Backward(adv.retired) {
+		out = append(out, r.public...)
+	}
+	return out
+}
+
+// retiringInfo lists the hostnames still advertised, with their deadlines,
+// for the /advertise response.
+func (adv *advertisement) retiringInfo() string {
+	var parts []string
+	for _, r := range adv.retired {
+		parts = append(parts, r.host+" until "+r.until.UTC().Format(time.RFC3339))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,121 @@
+// identifylimits.go
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	pb "github.com/libp2p/go-libp2p/p2p/protocol/identify/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// === Identify payload limits (IDENTIFY_MAX_*) ===
+// go-libp2p refuses identify messages over 8 KiB but merges up to 10 of
+// them into one response, and keeps up to 500 addresses per peer; none of
+// that is configurable. On top of it every identify response and push a
+// peer sends is checked against these caps once go-libp2p has parsed it
+// (0 turns a cap off). A peer over any of them is disconnected and dropped
+// from the peerstore, so what it claimed isn't kept, and the refusal is
+// counted as connRejections identify_oversized. The size is the re-encoded
+// size of everything the peer declared, across all merged messages.
+type identifyLimits struct {
+	MaxMessageBytes int `json:"maxMessageBytes"`
+	MaxAddrs        int `json:"maxAddrs"`
+	MaxProtocols    int `json:"maxProtocols"`
+	MaxAgentLen     int `json:"maxAgentLength"`
+}
+
+func loadIdentifyLimits() (identifyLimits, error) {
+	var l identifyLimits
+	for _, f := range []struct {
+		key string
+		def int
+		dst *int
+	}{
+		{"IDENTIFY_MAX_MESSAGE_BYTES", 8192, &l.MaxMessageBytes},
+		{"IDENTIFY_MAX_ADDRS", 64, &l.MaxAddrs},
+		{"IDENTIFY_MAX_PROTOCOLS", 128, &l.MaxProtocols},
+		{"IDENTIFY_MAX_AGENT_LENGTH", 256, &l.MaxAgentLen},
+	} {
+		n, err := envInt(f.key, f.def)
+		if err != nil {
+			return identifyLimits{}, err
+		}
+		if n < 0 {
+			return identifyLimits{}, fmt.Errorf("%s must not be negative, got %d", f.key, n)
+		}
+		*f.dst = n
+	}
+	return l, nil
+}
+
+func (l identifyLimits) off() bool {
+	return l == identifyLimits{}
+}
+
+// violations lists every cap ev exceeds as field=value/limit.
+func (l identifyLimits) violations(ev event.EvtPeerIdentificationCompleted) []string {
+	var out []string
+	over := func(field string, n, limit int) {
+		if limit > 0 && n > limit {
+			out = append(out, fmt.Sprintf("%s=%d/%d", field, n, limit))
+		}
+	}
+	over("addrs", len(ev.ListenAddrs), l.MaxAddrs)
+	over("protocols", len(ev.Protocols), l.MaxProtocols)
+	over("agent_length", len(ev.AgentVersion), l.MaxAgentLen)
+	if l.MaxMessageBytes > 0 {
+		over("bytes", identifySize(ev), l.MaxMessageBytes)
+	}
+	return out
+}
+
+// identifySize re-encodes the parts of an identify message the event
+// carries; the public key, which the peer ID already bounds, is left out.
+func identifySize(ev event.EvtPeerIdentificationCompleted) int {
+	msg := &pb.Identify{
+		AgentVersion:    &ev.AgentVersion,
+		ProtocolVersion: &ev.ProtocolVersion,
+	}
+	for _, a := range ev.ListenAddrs {
+		msg.ListenAddrs = append(msg.ListenAddrs, a.Bytes())
+	}
+	for _, p := range ev.Protocols {
+		msg.Protocols = append(msg.Protocols, string(p))
+	}
+	if ev.ObservedAddr != nil {
+		msg.ObservedAddr = ev.ObservedAddr.Bytes()
+	}
+	if ev.SignedPeerRecord != nil {
+		msg.SignedPeerRecord, _ = ev.SignedPeerRecord.Marshal()
+	}
+	return proto.Size(msg)
+}
+
+// watchIdentifyLimits enforces limits on every identify h completes.
+func watchIdentifyLimits(h host.Host, limits identifyLimits) error {
+	if limits.off() {
+		return nil
+	}
+	sub, err := h.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer sub.Close()
+		for e := range sub.Out() {
+			ev := e.(event.EvtPeerIdentificationCompleted)
+			v := limits.violations(ev)
+			if len(v) == 0 {
+				continue
+			}
+			connRejections.reject(rejectIdentifyOversized, ev.Conn.RemoteMultiaddr(), ev.Peer, strings.Join(v, " "))
+			_ = h.Network().ClosePeer(ev.Peer)
+			h.Peerstore().RemovePeer(ev.Peer)
+			h.Peerstore().ClearAddrs(ev.Peer)
+		}
+	}()
+	return nil
+}
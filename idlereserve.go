@@ -0,0 +1,79 @@
+// idlereserve.go
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Idle reservation revocation (RESERVATION_IDLE_TIMEOUT) ===
+// A reservation is idle from its grant, or from the last circuit opened to
+// its peer, until the next one; it is never idle while a circuit to the peer
+// is open. With a timeout set, reservations idle for longer are revoked by
+// disconnecting the peer (the only way the relay drops a reservation before
+// expiry), logged as event=reservation_idle_revoked and counted as
+// idleRevokedReservations. Clients that reserve and never get dialed stop
+// holding slots a busy relay could give to others.
+type idleRevoker struct {
+	node    *relayNode
+	timeout time.Duration
+}
+
+func startIdleRevoker(ctx context.Context, n *relayNode, cfg *relayConfig) {
+	if cfg.reservationIdleTimeout <= 0 {
+		return
+	}
+	r := &idleRevoker{node: n, timeout: cfg.reservationIdleTimeout}
+	go r.run(ctx)
+	log.Printf("✅ Revoking reservations idle for more than %s", r.timeout)
+}
+
+func (r *idleRevoker) run(ctx context.Context) {
+	t := time.NewTicker(max(time.Second, min(time.Minute, r.timeout/4)))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			r.sweep()
+		}
+	}
+}
+
+func (r *idleRevoker) sweep() {
+	n := r.node
+	for p, idle := range n.reservations.idle(time.Now(), r.timeout) {
+		if len(n.rh.circuits.list("", p)) > 0 {
+			continue
+		}
+		log.Printf("⚠️ event=reservation_idle_revoked peer=%s idle=%s", p, idle.Round(time.Second))
+		n.rh.stats.idleRevokedReservations.Add(1)
+		_ = n.h.Network().ClosePeer(p)
+	}
+}
+
+// idle returns the live reservations idle for longer than timeout, with how
+// long each has been idle.
+func (t *reservationTracker) idle(now time.Time, timeout time.Duration) map[peer.ID]time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[peer.ID]time.Duration)
+	for p, r := range t.byID {
+		if d := r.idleFor(now); now.Before(r.expire) && d > timeout {
+			out[p] = d
+		}
+	}
+	return out
+}
+
+func (r *reservation) idleFor(now time.Time) time.Duration {
+	since := r.granted
+	if r.lastCircuit.After(since) {
+		since = r.lastCircuit
+	}
+	return now.Sub(since)
+}
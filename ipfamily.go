@@ -0,0 +1,69 @@
+// ipfamily.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+)
+
+// === Listen address family (LISTEN_IP_FAMILY) ===
+// The relay listens on /ip4/0.0.0.0 and advertises /dns4/ names. In an
+// IPv6-only network that binds nothing reachable, so with the default "auto"
+// a host with no IPv4 address besides loopback but a routable IPv6 one
+// listens on /ip6/:: and advertises /dns6/ instead, and says so at startup.
+// "ip4" and "ip6" pin the family.
+func listenIPFamily() (string, error) {
+	v := envString("LISTEN_IP_FAMILY", "auto")
+	switch v {
+	case "ip4", "ip6":
+		return v, nil
+	case "auto":
+	default:
+		return "", fmt.Errorf("invalid LISTEN_IP_FAMILY %q (want auto, ip4 or ip6)", v)
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		log.Printf("⚠️ LISTEN_IP_FAMILY=auto could not list interface addresses (%v); listening on IPv4", err)
+		return "ip4", nil
+	}
+	v4, v6 := hostIPFamilies(addrs)
+	if v4 || !v6 {
+		return "ip4", nil
+	}
+	log.Printf("⚠️ No IPv4 address on this host, only IPv6: listening on /ip6/:: and advertising /dns6/ names (LISTEN_IP_FAMILY=auto)")
+	return "ip6", nil
+}
+
+// hostIPFamilies reports whether addrs include a non-loopback IPv4 address
+// and a routable (not loopback or link-local) IPv6 one.
+func hostIPFamilies(addrs []net.Addr) (v4, v6 bool) {
+	for _, a := range addrs {
+		n, ok := a.(*net.IPNet)
+		if !ok || n.IP.IsLoopback() {
+			continue
+		}
+		if n.IP.To4() != nil {
+			v4 = true
+		} else if !n.IP.IsLinkLocalUnicast() {
+			v6 = true
+		}
+	}
+	return v4, v6
+}
+
+// listenHost is the wildcard listen prefix for the family.
+func (c *relayConfig) listenHost() string {
+	if c.IPFamily == "ip6" {
+		return "/ip6/::"
+	}
+	return "/ip4/0.0.0.0"
+}
+
+// dnsProto is the multiaddr protocol the advertised hostname goes under.
+func (c *relayConfig) dnsProto() string {
+	if c.IPFamily == "ip6" {
+		return "dns6"
+	}
+	return "dns4"
+}
@@ -0,0 +1,111 @@
+// keepalive.go
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	msmux "github.com/multiformats/go-multistream"
+)
+
+// === Keepalive pings (KEEPALIVE_PING_INTERVAL) ===
+// Every interval, peers whose connections carry no open streams are pinged;
+// one that doesn't answer within KEEPALIVE_PING_TIMEOUT is disconnected. This
+// keeps NAT mappings warm and clears out clients that vanished without a
+// close. Peers that don't speak the ping protocol are left alone.
+const keepaliveMaxConcurrent = 16
+
+type keepalive struct {
+	h        host.Host
+	interval time.Duration
+	timeout  time.Duration
+
+	pinged atomic.Int64
+	closed atomic.Int64
+}
+
+func startKeepalive(ctx context.Context, h host.Host, cfg *relayConfig) *keepalive {
+	k := &keepalive{h: h, interval: cfg.keepaliveInterval, timeout: cfg.keepaliveTimeout}
+	if k.interval > 0 {
+		go k.run(ctx)
+		log.Printf("✅ Keepalive pings every %s for idle peers (timeout %s)", k.interval, k.timeout)
+	}
+	return k
+}
+
+func (k *keepalive) run(ctx context.Context) {
+	t := time.NewTicker(k.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			k.sweep(ctx)
+		}
+	}
+}
+
+func (k *keepalive) sweep(ctx context.Context) {
+	sem := make(chan struct{}, keepaliveMaxConcurrent)
+	var wg sync.WaitGroup
+	for _, p := range k.h.Network().Peers() {
+		if !k.idle(p) {
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			k.ping(ctx, p)
+		}()
+	}
+	wg.Wait()
+}
+
+// idle reports whether none of p's connections has an open stream.
+func (k *keepalive) idle(p peer.ID) bool {
+	for _, c := range k.h.Network().ConnsToPeer(p) {
+		if len(c.GetStreams()) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (k *keepalive) ping(ctx context.Context, p peer.ID) {
+	ctx, cancel := context.WithTimeout(ctx, k.timeout)
+	defer cancel()
+	k.pinged.Add(1)
+	// Ping closes the channel without a result when ctx runs out.
+	res, ok := <-ping.Ping(ctx, k.h, p)
+	if !ok {
+		if ctx.Err() != context.DeadlineExceeded {
+			return
+		}
+		res.Error = ctx.Err()
+	}
+	if res.Error == nil {
+		return
+	}
+	var unsupported msmux.ErrNotSupported[protocol.ID]
+	if errors.As(res.Error, &unsupported) {
+		return
+	}
+	if k.h.Network().Connectedness(p) != network.Connected {
+		return
+	}
+
+	k.closed.Add(1)
+	eventf("keepalive_failed", "event=keepalive_failed peer=%s err=%q; closing connections", p, res.Error)
+	_ = k.h.Network().ClosePeer(p)
+}
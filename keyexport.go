@@ -0,0 +1,79 @@
+// keyexport.go
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	crypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Generated key export (KEY_EXPORT_PATH) ===
+// The preferred way to get hold of a newly generated key: instead of the log
+// (PRINT_GENERATED_KEY), which ends up in log aggregation, it is written as
+// JSON to KEY_EXPORT_PATH with 0600 permissions and the log only names the
+// path:
+//
+//	{"peerId": "12D3KooW...", "privateKeyB64": "CAESQ...",
+//	  "env": "RELAY_PRIVATE_KEY_B64", "generatedAt": "2025-01-01T00:00:00Z"}
+//
+// Every generation is exported, not just the first, replacing the file. It is
+// written next to itself and renamed into place, so a reader never sees half
+// a key.
+type keyExport struct {
+	PeerID      string    `json:"peerId"`
+	PrivateKey  string    `json:"privateKeyB64"`
+	Env         string    `json:"env"`
+	GeneratedAt time.Time `json:"generatedAt"`
+}
+
+func exportKey(path string, priv crypto.PrivKey) error {
+	id, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	raw, err := crypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	body, err := json.MarshalIndent(keyExport{
+		PeerID:      id.String(),
+		PrivateKey:  base64.StdEncoding.EncodeToString(raw),
+		Env:         "RELAY_PRIVATE_KEY_B64",
+		GeneratedAt: time.Now().UTC().Truncate(time.Second),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	// CreateTemp already uses 0600; Chmod keeps it under any umask quirk.
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(append(body, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename into place: %w", err)
+	}
+	return nil
+}
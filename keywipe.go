@@ -0,0 +1,62 @@
+// keywipe.go
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+
+	crypto "github.com/libp2p/go-libp2p/core/crypto"
+)
+
+// === Key file wipe (WIPE_KEY_ON_SHUTDOWN) ===
+// For ephemeral hosts that shouldn't leave the key on disk: after a graceful
+// shutdown the private_key file is overwritten with random bytes, synced and
+// removed. Only when the relay ran on RELAY_PRIVATE_KEY_B64 (env or secrets),
+// so the identity survives elsewhere; otherwise the file is the only copy
+// and stays, with a warning.
+func wipeKeyFile(path, b64 string, running crypto.PrivKey) {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		log.Printf("WIPE_KEY_ON_SHUTDOWN: no %s to wipe", path)
+		return
+	}
+	if b64 == "" {
+		log.Printf("⚠️ WIPE_KEY_ON_SHUTDOWN: keeping %s, RELAY_PRIVATE_KEY_B64 isn't set and it is the only copy of the key", path)
+		return
+	}
+	if envPriv, err := decodePrivateKey(b64); err != nil || !envPriv.Equals(running) {
+		log.Printf("⚠️ WIPE_KEY_ON_SHUTDOWN: keeping %s, the relay didn't run on RELAY_PRIVATE_KEY_B64 (KEY_CONFLICT_POLICY=prefer-file?)", path)
+		return
+	}
+	if err := overwriteAndRemove(path); err != nil {
+		log.Printf("⚠️ WIPE_KEY_ON_SHUTDOWN: could not wipe %s: %v", path, err)
+		return
+	}
+	log.Printf("event=key_wiped path=%s (WIPE_KEY_ON_SHUTDOWN, identity kept in RELAY_PRIVATE_KEY_B64)", path)
+}
+
+// overwriteAndRemove fills path with random bytes before unlinking it, so the
+// key doesn't linger in freed blocks on filesystems that write in place.
+func overwriteAndRemove(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err == nil {
+		noise := make([]byte, st.Size())
+		_, _ = rand.Read(noise)
+		if _, err = f.WriteAt(noise, 0); err == nil {
+			err = f.Sync()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
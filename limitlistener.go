@@ -0,0 +1,80 @@
+// limitlistener.go
+package main
+
+import (
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// === Connection-capped listener for the status server ===
+// Same idea as x/net/netutil.LimitListener: Accept blocks while max
+// connections are open, so an HTTP flood can't eat the process's FDs, and
+// wakes up with net.ErrClosed once the listener is closed. Unlike netutil it
+// logs when the cap is reached, once until usage drops below 3/4 of it (a
+// flood hovering at the cap would otherwise log on every connection).
+type limitListener struct {
+	net.Listener
+	sem       chan struct{}
+	max       int
+	logged    atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newLimitListener(l net.Listener, max int) net.Listener {
+	if max <= 0 {
+		return l
+	}
+	return &limitListener{Listener: l, sem: make(chan struct{}, max), max: max, done: make(chan struct{})}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	default:
+		if l.logged.CompareAndSwap(false, true) {
+			log.Printf("⚠️ HTTP connection limit reached (%d), new connections wait for a free slot", l.max)
+		}
+		select {
+		case l.sem <- struct{}{}:
+		case <-l.done:
+			return nil, net.ErrClosed
+		}
+	}
+
+	c, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitConn{Conn: c, release: l.release}, nil
+}
+
+func (l *limitListener) Close() error {
+	err := l.Listener.Close()
+	l.closeOnce.Do(func() { close(l.done) })
+	return err
+}
+
+func (l *limitListener) release() {
+	<-l.sem
+	if len(l.sem) < l.max-l.max/4 {
+		l.logged.Store(false)
+	}
+}
+
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
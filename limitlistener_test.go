@@ -0,0 +1,136 @@
+// limitlistener_test.go
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// dialAccept opens one connection through l and returns the accepted end.
+func dialAccept(t *testing.T, l net.Listener) net.Conn {
+	t.Helper()
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	s, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newTestLimitListener(t *testing.T, max int) net.Listener {
+	t.Helper()
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newLimitListener(inner, max)
+	t.Cleanup(func() { _ = l.Close() })
+	return l
+}
+
+func TestLimitListenerAcceptWakesOnClose(t *testing.T) {
+	l := newTestLimitListener(t, 1)
+	dialAccept(t, l) // the only slot, held
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := l.Accept()
+		errc <- err
+	}()
+	time.Sleep(20 * time.Millisecond) // let it block on the full cap
+	_ = l.Close()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("Accept after Close: %v, want net.ErrClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Accept still blocked 1s after Close")
+	}
+}
+
+// syncBuffer is a log sink the listener's goroutines can share.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+// acceptAtCap has Accept block on the full cap, then frees free's slot.
+func acceptAtCap(t *testing.T, l net.Listener, free net.Conn) net.Conn {
+	t.Helper()
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		s, _ := l.Accept()
+		accepted <- s
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_ = free.Close()
+	select {
+	case s := <-accepted:
+		if s == nil {
+			t.Fatal("Accept failed")
+		}
+		return s
+	case <-time.After(time.Second):
+		t.Fatal("Accept still blocked 1s after a slot was freed")
+		return nil
+	}
+}
+
+func TestLimitListenerWarnsOncePerSaturation(t *testing.T) {
+	var out syncBuffer
+	log.SetOutput(&out)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	warnings := func() int { return strings.Count(out.String(), "HTTP connection limit reached") }
+
+	const max = 4
+	l := newTestLimitListener(t, max)
+	held := make([]net.Conn, 0, max)
+	for range max {
+		held = append(held, dialAccept(t, l))
+	}
+	// a flood at the cap: each freed slot is taken again right away
+	for i := range 5 {
+		held[i%max] = acceptAtCap(t, l, held[i%max])
+	}
+	if got := warnings(); got != 1 {
+		t.Fatalf("%d warnings while hovering at the cap, want 1", got)
+	}
+
+	// back below 3/4 of the cap, then saturated again: warned anew
+	_ = held[0].Close()
+	_ = held[1].Close()
+	held[0], held[1] = dialAccept(t, l), dialAccept(t, l)
+	held[2] = acceptAtCap(t, l, held[2])
+	if got := warnings(); got != 2 {
+		t.Fatalf("%d warnings after saturating again, want 2", got)
+	}
+}
@@ -0,0 +1,52 @@
+// loadhint.go
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// === Load hints (LOAD_HINT_PROTOCOL) ===
+// Clients that know several relays open a stream on loadHintProto to each and
+// prefer the least loaded. The relay writes one JSON object and closes the
+// stream; the protocol also shows up in identify, so clients can tell which
+// relays answer it without trying.
+const loadHintProto = protocol.ID("/torrentium-relay/load/1.0.0")
+
+type loadHint struct {
+	Version         int     `json:"v"`
+	LoadPct         float64 `json:"loadPct"`
+	Reservations    int     `json:"reservations"`
+	MaxReservations int     `json:"maxReservations"`
+	ActiveCircuits  int     `json:"activeCircuits"`
+	WeightedLoad    float64 `json:"weightedLoad"`
+	Accepting       bool    `json:"accepting"`
+}
+
+func (n *relayNode) loadHint() loadHint {
+	maxRes := n.cfg.relayResources().MaxReservations
+	hint := loadHint{
+		Version:         1,
+		Reservations:    n.reservations.count(),
+		MaxReservations: maxRes,
+		ActiveCircuits:  len(n.rh.circuits.list("", "")),
+		WeightedLoad:    n.weightedLoad(),
+		Accepting:       !n.acl.draining.Load() && !n.acl.maintenance.Load() && !n.acl.schedule.refusing(time.Now()),
+	}
+	if maxRes > 0 {
+		hint.LoadPct = math.Round(float64(hint.Reservations)/float64(maxRes)*1000) / 10
+	}
+	return hint
+}
+
+func (n *relayNode) serveLoadHints() {
+	n.h.SetStreamHandler(loadHintProto, func(s network.Stream) {
+		defer s.Close()
+		_ = s.SetDeadline(time.Now().Add(5 * time.Second))
+		_ = json.NewEncoder(s).Encode(n.loadHint())
+	})
+}
@@ -0,0 +1,81 @@
+// loadweight.go
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Weighted load (TRANSPORT_LOAD_WEIGHTS) ===
+// Comma-separated <transport>=<weight> pairs, e.g. "quic=0.5,ws=1.5". A
+// circuit costs the mean of its two legs' weights, each leg weighted by the
+// transport of that peer's direct connection to the relay (1 without an
+// entry), so with no weights the load is the active circuit count. It is
+// reported as weightedLoad in load hints and on /stats, letting clients
+// steer by what circuits actually cost rather than how many there are.
+func transportLoadWeights() (map[string]float64, error) {
+	raw := envString("TRANSPORT_LOAD_WEIGHTS", "")
+	if raw == "" {
+		return nil, nil
+	}
+	out := make(map[string]float64)
+	for _, f := range strings.Split(raw, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		name, v, ok := strings.Cut(f, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !slices.Contains(limitTransports, name) {
+			return nil, fmt.Errorf("TRANSPORT_LOAD_WEIGHTS: %q is not <%s>=<weight>", f, strings.Join(limitTransports, "|"))
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || w < 0 || math.IsInf(w, 0) || math.IsNaN(w) {
+			return nil, fmt.Errorf("TRANSPORT_LOAD_WEIGHTS: %q needs a non-negative weight", f)
+		}
+		if _, dup := out[name]; dup {
+			return nil, fmt.Errorf("TRANSPORT_LOAD_WEIGHTS: %q listed twice", name)
+		}
+		out[name] = w
+	}
+	return out, nil
+}
+
+// ends lists the source and destination of every open circuit.
+func (t *circuitTracker) ends() [][2]peer.ID {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([][2]peer.ID, 0, len(t.open))
+	for _, c := range t.open {
+		out = append(out, [2]peer.ID{c.src, c.dst})
+	}
+	return out
+}
+
+func (n *relayNode) weightedLoad() float64 {
+	load := 0.0
+	for _, e := range n.rh.circuits.ends() {
+		load += (n.legWeight(e[0]) + n.legWeight(e[1])) / 2
+	}
+	return math.Round(load*100) / 100
+}
+
+// legWeight is the weight of p's direct connection to the relay; a peer
+// that is gone (the circuit is closing) counts 1.
+func (n *relayNode) legWeight(p peer.ID) float64 {
+	for _, c := range n.h.Network().ConnsToPeer(p) {
+		if c.Stat().Limited {
+			continue
+		}
+		if w, ok := n.cfg.TransportLoadWeights[n.transports.classify(c)]; ok {
+			return w
+		}
+		return 1
+	}
+	return 1
+}
@@ -0,0 +1,133 @@
+// logging.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// debugLogs is set once from LOG_LEVEL at startup.
+var debugLogs bool
+
+func debugf(format string, args ...any) {
+	if debugLogs {
+		log.Printf("[debug] "+format, args...)
+	}
+}
+
+// slowOpThreshold is set once from SLOW_OP_THRESHOLD at startup (0 = off).
+var slowOpThreshold time.Duration
+
+// logSlow emits a structured warning when an operation took too long.
+func logSlow(op string, d time.Duration, peer string) {
+	if slowOpThreshold > 0 && d >= slowOpThreshold {
+		eventf("slow_op", "⚠️ event=slow_op op=%s duration=%s threshold=%s peer=%s",
+			op, d.Round(time.Millisecond), slowOpThreshold, peer)
+	}
+}
+
+// === Log sampling (LOG_SAMPLING) ===
+// Comma-separated <event>=<rate> pairs for the per-connection and
+// per-circuit events that can fire thousands of times a minute, e.g.
+// "conn_rejected=1/100,slow_op=5/s". 1/N logs every Nth occurrence, M/s at
+// most M per second. The next line logged after some were skipped carries
+// sampled_out=<count>. Counters (/stats, /metrics) still see every event,
+// and startup, lifecycle and error lines are never sampled.
+var sampledEvents = []string{"conn_rejected", "circuit_limit", "keepalive_failed", "slow_op", "rcmgr_blocked", "migration_hint_failed", "enforced_limit", "expiry_notice_failed", "dest_denied", "circuit_protocol_denied", "duplicate_reservation", "peer_addrs_evicted", "cpu_pressure"}
+
+// logSamplers is set once from LOG_SAMPLING at startup.
+var logSamplers map[string]*logSampler
+
+type logSampler struct {
+	every  int64 // 1/N
+	perSec int   // M/s
+
+	mu       sync.Mutex
+	seen     int64
+	second   time.Time
+	inSecond int
+	skipped  int64
+}
+
+func parseLogSampling(v string) (map[string]*logSampler, error) {
+	out := make(map[string]*logSampler)
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		name, rate, ok := strings.Cut(f, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !slices.Contains(sampledEvents, name) {
+			return nil, fmt.Errorf("LOG_SAMPLING: %q is not <event>=<rate> (events: %s)", f, strings.Join(sampledEvents, ", "))
+		}
+		if _, dup := out[name]; dup {
+			return nil, fmt.Errorf("LOG_SAMPLING: %q listed twice", name)
+		}
+		s := &logSampler{}
+		rate = strings.TrimSpace(rate)
+		if n, ok := strings.CutPrefix(rate, "1/"); ok {
+			every, err := strconv.ParseInt(n, 10, 64)
+			if err != nil || every < 1 {
+				return nil, fmt.Errorf("LOG_SAMPLING: %q needs 1/<N> with N >= 1", f)
+			}
+			s.every = every
+		} else if m, ok := strings.CutSuffix(rate, "/s"); ok {
+			perSec, err := strconv.Atoi(m)
+			if err != nil || perSec < 1 {
+				return nil, fmt.Errorf("LOG_SAMPLING: %q needs <M>/s with M >= 1", f)
+			}
+			s.perSec = perSec
+		} else {
+			return nil, fmt.Errorf("LOG_SAMPLING: %q needs a rate of 1/<N> or <M>/s", f)
+		}
+		out[name] = s
+	}
+	return out, nil
+}
+
+// allow reports whether this occurrence is logged and how many were skipped
+// since the last one that was.
+func (s *logSampler) allow() (bool, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen++
+	ok := true
+	if s.every > 0 {
+		ok = (s.seen-1)%s.every == 0
+	} else {
+		now := time.Now().Truncate(time.Second)
+		if !now.Equal(s.second) {
+			s.second, s.inSecond = now, 0
+		}
+		s.inSecond++
+		ok = s.inSecond <= s.perSec
+	}
+	if !ok {
+		s.skipped++
+		return false, 0
+	}
+	skipped := s.skipped
+	s.skipped = 0
+	return true, skipped
+}
+
+// eventf logs one event=<event> line, subject to its LOG_SAMPLING rate.
+func eventf(event, format string, args ...any) {
+	if s := logSamplers[event]; s != nil {
+		ok, skipped := s.allow()
+		if !ok {
+			return
+		}
+		if skipped > 0 {
+			format += " sampled_out=%d"
+			args = append(args, skipped)
+		}
+	}
+	log.Printf(format, args...)
+}
@@ -2,43 +2,69 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"log"
-	"net/http"
 	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 	"time"
-	"crypto/rand"
 
-	libp2p "github.com/libp2p/go-libp2p"
-	relay "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
-	ma "github.com/multiformats/go-multiaddr"
 	crypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
 )
 
 const privKeyFileName = "private_key"
 
 // === Private key loader (stable PeerID) ===
-func loadOrMakePrivateKey() (crypto.PrivKey, error) {
-	if b64 := os.Getenv("RELAY_PRIVATE_KEY_B64"); b64 != "" {
-		data, err := base64.StdEncoding.DecodeString(b64)
+// Order: b64 (env/secrets), then the key file at path, then a fresh key that
+// is written to path. A corrupt key file is replaced. With printKey a
+// generated key is printed once, on its first generation: when it was
+// persisted and no key was generated at path before (path+".generated"
+// marks that). A key replacing a corrupt or lost one, or one that couldn't
+// be persisted and will be regenerated on the next start, only gets a
+// warning; admin /key exports it either way. With exportPath
+// (KEY_EXPORT_PATH) every generated key goes to that file instead and is
+// never printed.
+//
+// When b64 and the key file hold different identities, conflict
+// (KEY_CONFLICT_POLICY) picks one: prefer-env, prefer-file or fail.
+func loadOrMakePrivateKey(b64, path string, printKey bool, exportPath, conflict string) (crypto.PrivKey, error) {
+	if b64 != "" {
+		priv, err := decodePrivateKey(b64)
 		if err != nil {
-			return nil, fmt.Errorf("decode key failed: %w", err)
+			return nil, err
 		}
-		priv, err := crypto.UnmarshalPrivateKey(data)
-		if err != nil {
-			return nil, fmt.Errorf("unmarshal key failed: %w", err)
+		if filePriv, ok := keyConflict(priv, path); ok {
+			switch conflict {
+			case "fail":
+				return nil, fmt.Errorf("RELAY_PRIVATE_KEY_B64 and %s hold different identities (KEY_CONFLICT_POLICY=fail)", path)
+			case "prefer-file":
+				log.Printf("⚠️ KEY_CONFLICT_POLICY=prefer-file: using %s", path)
+				return filePriv, nil
+			}
+			log.Println("⚠️ KEY_CONFLICT_POLICY=prefer-env: using RELAY_PRIVATE_KEY_B64")
 		}
-		log.Println("Loaded private key from RELAY_PRIVATE_KEY_B64")
+		log.Println("Loaded private key from RELAY_PRIVATE_KEY_B64 / secrets")
 		return priv, nil
 	}
 
-	if data, err := os.ReadFile(privKeyFileName); err == nil {
+	corrupt := false
+	if data, err := os.ReadFile(path); err == nil {
 		if priv, err := crypto.UnmarshalPrivateKey(data); err == nil {
 			log.Println("Loaded private_key file")
 			return priv, nil
 		}
+		corrupt = true
 	}
 
 	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
@@ -46,15 +72,126 @@ func loadOrMakePrivateKey() (crypto.PrivKey, error) {
 		return nil, fmt.Errorf("generate key failed: %w", err)
 	}
 	privBytes, _ := crypto.MarshalPrivateKey(priv)
-	_ = os.WriteFile(privKeyFileName, privBytes, 0600)
-	log.Println("Generated new libp2p private key")
-	log.Printf("Base64 (set RELAY_PRIVATE_KEY_B64 to persist):\n%s\n",
-		base64.StdEncoding.EncodeToString(privBytes))
+	persisted := true
+	if err := os.WriteFile(path, privBytes, 0600); err != nil {
+		// Read-only container filesystems land here: without the env var every
+		// restart mints a new key and the relay's peer ID changes.
+		persisted = false
+		log.Printf("⚠️ Could not persist %s (%v)", path, err)
+		log.Println("⚠️ PEER ID WILL CHANGE ON EVERY RESTART unless RELAY_PRIVATE_KEY_B64 is set (key available on admin /key)")
+	}
+	marker := path + ".generated"
+	_, err = os.Stat(marker)
+	first := persisted && !corrupt && errors.Is(err, fs.ErrNotExist)
+	if persisted {
+		_ = os.WriteFile(marker, nil, 0600)
+	}
+
+	if exportPath != "" {
+		if err := exportKey(exportPath, priv); err != nil {
+			log.Printf("⚠️ Generated new libp2p private key but could not export it to %s (KEY_EXPORT_PATH): %v; not printing it (admin /key exports it)", exportPath, err)
+		} else {
+			log.Printf("event=key_exported path=%s (generated new libp2p private key; set RELAY_PRIVATE_KEY_B64 from its privateKeyB64 to persist)", exportPath)
+		}
+		return priv, nil
+	}
+	switch {
+	case !printKey:
+		log.Println("Generated new libp2p private key, set RELAY_PRIVATE_KEY_B64 to persist (admin /key exports it)")
+	case first:
+		log.Println("Generated new libp2p private key (first generation, printed this once only)")
+		log.Printf("Base64 (set RELAY_PRIVATE_KEY_B64 to persist):\n%s\n",
+			base64.StdEncoding.EncodeToString(privBytes))
+	case corrupt:
+		log.Printf("⚠️ Replaced corrupt %s with a new key; not printing it (admin /key exports it)", path)
+	case !persisted:
+		log.Println("⚠️ Generated a new libp2p private key that will not survive a restart; not printing it (admin /key exports it)")
+	default:
+		log.Printf("⚠️ Generated a new libp2p private key, %s was lost since the first one; not printing it (admin /key exports it)", path)
+	}
+	return priv, nil
+}
+
+// keyConflict returns the key file's key when it is a valid key for another
+// identity than envPriv, logging both peer IDs.
+func keyConflict(envPriv crypto.PrivKey, path string) (crypto.PrivKey, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	filePriv, err := crypto.UnmarshalPrivateKey(data)
+	if err != nil || filePriv.Equals(envPriv) {
+		return nil, false
+	}
+	envID, _ := peer.IDFromPrivateKey(envPriv)
+	fileID, _ := peer.IDFromPrivateKey(filePriv)
+	log.Printf("⚠️ KEY CONFLICT: RELAY_PRIVATE_KEY_B64 is peer %s but %s is peer %s", envID, path, fileID)
+	return filePriv, true
+}
+
+// seededPrivateKey derives an Ed25519 key from RELAY_KEY_SEED, so test runs
+// get the same peer ID every time. Instances other than the primary mix in
+// their name. Test/dev only: anyone who knows the seed holds the key.
+func seededPrivateKey(seed, name string) (crypto.PrivKey, error) {
+	if name != "primary" {
+		seed += "/" + name
+	}
+	sum := sha256.Sum256([]byte(seed))
+	priv, _, err := crypto.GenerateEd25519Key(bytes.NewReader(sum[:]))
+	if err != nil {
+		return nil, fmt.Errorf("derive seeded key failed: %w", err)
+	}
 	return priv, nil
 }
 
+func decodePrivateKey(b64 string) (crypto.PrivKey, error) {
+	data, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, fmt.Errorf("decode key failed: %w", err)
+	}
+	priv, err := crypto.UnmarshalPrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal key failed: %w", err)
+	}
+	return priv, nil
+}
+
+// startInstance brings up one RELAY_INSTANCES entry. Without a key it gets a
+// throwaway identity; nothing is written to disk.
+func startInstance(cfg *relayConfig, access *accessWatcher, geo *geoFilter, inst relayInstance) (*relayNode, error) {
+	var priv crypto.PrivKey
+	var err error
+	if inst.keyB64 != "" {
+		priv, err = decodePrivateKey(inst.keyB64)
+	} else if cfg.keySeed != "" {
+		priv, err = seededPrivateKey(cfg.keySeed, inst.Name)
+	} else {
+		priv, _, err = crypto.GenerateEd25519Key(rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := newRelayNode(cfg, access, geo, inst.Name, priv, inst.Port, "", inst.Host)
+	if err != nil {
+		return nil, err
+	}
+	if err := n.startRelay(cfg); err != nil {
+		_ = n.h.Close()
+		return nil, err
+	}
+	log.Printf("✅ Relay instance %q on port %s: %s", inst.Name, inst.Port, n.h.ID())
+	return n, nil
+}
+
 func main() {
-	ctx := context.Background()
+	selftest := flag.Bool("selftest", false, "start the relay, relay a round trip through it, print the result and exit")
+	flag.Parse()
+
+	// ctx is the shutdown context: cancelled once the relay starts closing,
+	// which stops every background loop started with it.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	// === Render injected port (MUST be used for libp2p) ===
 	port := os.Getenv("PORT")
@@ -65,80 +202,250 @@ func main() {
 	// External hostname (Render sets this automatically)
 	renderHost := os.Getenv("RENDER_EXTERNAL_HOSTNAME")
 
-	// Build advertised multiaddr
-	publicMaddrStr := ""
-	if renderHost != "" {
-		publicMaddrStr = fmt.Sprintf("/dns4/%s/tcp/443/wss", renderHost)
+	cfg, err := loadConfig()
+	if err != nil {
+		fatal(exitConfig, "config error: %v", err)
+	}
+	if err := checkPorts(port, cfg); err != nil {
+		fatal(exitConfig, "config error: %v", err)
+	}
+	debugLogs = cfg.LogLevel == "debug"
+	slowOpThreshold = cfg.slowOpThreshold
+	logSamplers = cfg.logSamplers
+	if err := setupTransportLogs(cfg.transportLogLevels); err != nil {
+		fatal(exitConfig, "config error: %v", err)
+	}
+	startFDMonitor(ctx, cfg)
+	startCPUAdmission(ctx, cfg)
+
+	secrets, err := loadSecrets()
+	if err != nil {
+		fatal(exitSecrets, "secrets error: %v", err)
+	}
+
+	var priv crypto.PrivKey
+	if cfg.keySeed != "" {
+		if secrets.PrivateKeyB64 != "" {
+			fatal(exitConfig, "config error: RELAY_KEY_SEED and RELAY_PRIVATE_KEY_B64 are mutually exclusive")
+		}
+		log.Println("⚠️ RELAY_KEY_SEED is set: the relay key is derived from a known seed and anyone with it can impersonate this relay")
+		log.Println("⚠️ INSECURE, FOR TESTS AND LOCAL DEVELOPMENT ONLY, NEVER SET RELAY_KEY_SEED IN PRODUCTION")
+		priv, err = seededPrivateKey(cfg.keySeed, "primary")
+	} else {
+		priv, err = loadOrMakePrivateKey(secrets.PrivateKeyB64, privKeyFileName, cfg.PrintGeneratedKey, cfg.KeyExportPath, cfg.KeyConflictPolicy)
+	}
+	if err != nil {
+		fatal(exitKey, "key error: %v", err)
+	}
+
+	access, err := newAccessWatcher(cfg.AccessListFile)
+	if err != nil {
+		fatal(exitInputFile, "access list error: %v", err)
+	}
+	if err := access.watch(); err != nil {
+		fatal(exitInputFile, "access list watch failed: %v", err)
+	}
+	geo, err := newGeoFilter()
+	if err != nil {
+		fatal(exitInputFile, "geoip error: %v", err)
 	}
 
-	priv, err := loadOrMakePrivateKey()
+	if !*selftest {
+		startupJitter(cfg)
+	}
+
+	primary, err := newRelayNode(cfg, access, geo, "primary", priv, port, cfg.WebTransportPort, renderHost)
 	if err != nil {
-		log.Fatalf("key error: %v", err)
+		fatal(exitSetup, "%w", err)
+	}
+	h, rh, acl := primary.h, primary.rh, primary.acl
+	shutdown := newShutdownSequence(cfg)
+	shutdown.add(stepDiscovery, "background loops", func(context.Context) error { cancel(); return nil })
+	shutdown.add(stepHost, "primary", func(context.Context) error { return h.Close() })
+
+	if cfg.Tracing {
+		shutdownTracing, err := setupTracing(ctx, h, rh)
+		if err != nil {
+			fatal(exitSetup, "tracing setup failed: %v", err)
+		}
+		shutdown.add(stepFlush, "tracing", shutdownTracing)
+		log.Println("✅ OpenTelemetry tracing enabled (OTLP/HTTP)")
+	}
+
+	if cfg.MDNS {
+		stopMDNS, err := startMDNS(h, cfg.MDNSServiceTag)
+		if err != nil {
+			fatal(exitSetup, "mdns setup failed: %v", err)
+		}
+		shutdown.add(stepDiscovery, "mdns", func(context.Context) error { return stopMDNS() })
 	}
 
-	// === libp2p must bind on $PORT ===
-	listen := fmt.Sprintf("/ip4/0.0.0.0/tcp/%s/ws", port)
+	events := newEventFeed(cfg.EventBufferSize)
+	rh.onHop(events.hopObserver)
+
+	if err := primary.startRelay(cfg); err != nil {
+		fatal(exitSetup, "%w", err)
+	}
 
-	addrFactory := func(addrs []ma.Multiaddr) []ma.Multiaddr {
-		if publicMaddrStr == "" {
-			return addrs
+	if *selftest {
+		res := runSelfTest(ctx, h)
+		out, _ := json.MarshalIndent(res, "", "  ")
+		fmt.Println(string(out))
+		shutdown.run()
+		if !res.Pass {
+			fatal(exitSelfTest, "selftest failed")
 		}
-		m, err := ma.NewMultiaddr(publicMaddrStr)
+		return
+	}
+
+	// === Extra relay identities (RELAY_INSTANCES, testing/dev only) ===
+	nodes := []*relayNode{primary}
+	for _, inst := range cfg.Instances {
+		n, err := startInstance(cfg, access, geo, inst)
 		if err != nil {
-			return addrs
+			fatal(exitSetup, "relay instance %q: %w", inst.Name, err)
 		}
-		return []ma.Multiaddr{m}
+		shutdown.add(stepHost, n.name, func(context.Context) error { return n.h.Close() })
+		nodes = append(nodes, n)
 	}
 
-	h, err := libp2p.New(
-		libp2p.Identity(priv),
-		libp2p.ListenAddrStrings(listen),
-		libp2p.AddrsFactory(addrFactory),
-		libp2p.ForceReachabilityPublic(),
-	)
+	if cfg.MaintenanceMode {
+		log.Println("🔧 Starting in maintenance mode (MAINTENANCE_MODE=true)")
+	}
+	if cfg.ReservationTTLJitter {
+		log.Printf("Reservation TTL jitter: %s ±%.0f%%", cfg.ReservationTTL, cfg.JitterPercent)
+	}
+
+	// === Warmup: listeners are bound, give transports/identify time to settle ===
+	var ready atomic.Bool
+	coord := newCoordinator(cfg, nodes)
+	shutdown.add(stepDiscovery, "coordinator", func(context.Context) error { coord.deregister(); return nil })
+	time.AfterFunc(cfg.warmup, func() {
+		ready.Store(true)
+		log.Printf("✅ Warmup complete after %s, relay is ready", cfg.warmup)
+		coord.register(ctx)
+	})
+
+	log.Printf("✅ Relay Peer ID: %s", h.ID().String())
+	for _, a := range primary.publicMultiaddrs() {
+		log.Printf("✅ Public relay multiaddr: %s", a)
+	}
+	logEnforcedLimits(cfg)
+
+	registerRelayMetrics(primary)
+
+	scale := newScaleHinter(cfg, primary.reservations, rh.circuits)
+	go scale.run()
+
+	static := startStaticPeers(ctx, rh, cfg)
+	keep := startKeepalive(ctx, h, cfg)
+	pruner := startPeerstorePruner(ctx, h, cfg)
+	shedder := startMetricsShedder(ctx, cfg, rh.denied)
+	refresher := startAdvertRefresher(ctx, cfg, nodes, coord)
+	probe := startSelfProbe(ctx, primary, cfg)
+	warm := startWarmConn(ctx, primary, cfg)
+	clock := startClockSkewCheck(ctx, cfg)
+	startIdleRevoker(ctx, primary, cfg)
+	startDeadPeerChecker(ctx, primary, cfg)
+	startExpiryNotifier(ctx, primary, cfg)
+	statsd, err := startStatsD(ctx, cfg, h, primary.reservations, rh)
 	if err != nil {
-		log.Fatalf("libp2p host failed: %v", err)
+		fatal(exitConfig, "config error: %v", err)
+	}
+	if statsd != nil {
+		shutdown.add(stepFlush, "statsd", statsd.close)
 	}
 
-	_, err = relay.New(h)
+	drain := newDrainer(cfg, h, acl, rh.circuits)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	drainFlag, err := watchDrainFlag(cfg.DrainFlagFile)
 	if err != nil {
-		log.Fatalf("enable relay hop failed: %v", err)
+		fatal(exitInputFile, "drain flag error: %v", err)
+	}
+	// MAX_PROCESS_LIFETIME: drain and exit so the orchestrator starts a fresh process
+	var lifetime <-chan time.Time
+	if cfg.maxLifetime > 0 {
+		lifetime = time.After(cfg.maxLifetime)
+		log.Printf("Max process lifetime %s: scheduled drain and exit at %s", cfg.maxLifetime, time.Now().Add(cfg.maxLifetime).UTC().Format(time.RFC3339))
 	}
 
-	log.Printf("✅ Relay Peer ID: %s", h.ID().String())
-	if publicMaddrStr != "" {
-		log.Printf("✅ Public relay multiaddr: %s/p2p/%s", publicMaddrStr, h.ID().String())
+	policy, err := newPolicyDoc(cfg.PolicyFile)
+	if err != nil {
+		fatal(exitInputFile, "policy error: %v", err)
+	}
+	onSIGHUP(policy.reload)
+	adminTLS, err := loadAdminTLS(cfg)
+	if err != nil {
+		fatal(exitInputFile, "admin TLS error: %v", err)
 	}
 
 	// === Internal HTTP status server (not routed by Render) ===
-	go func() {
-		statusPort := "8080" // any internal port
-		mux := http.NewServeMux()
-		mux.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
-			w.WriteHeader(200)
-			_, _ = w.Write([]byte("ok"))
-		})
-		mux.HandleFunc("/peerid", func(w http.ResponseWriter, _ *http.Request) {
-			_, _ = w.Write([]byte(h.ID().String()))
-		})
-		mux.HandleFunc("/multiaddr", func(w http.ResponseWriter, _ *http.Request) {
-			if publicMaddrStr == "" {
-				_, _ = w.Write([]byte("no-public-hostname-set"))
+	status := &statusServer{
+		cfg:        cfg,
+		h:          h,
+		adminToken: secrets.AdminToken,
+		adminTLS:   adminTLS,
+		heavy:      newHeavyLimiter(cfg.HTTPHeavyMaxConcurrent),
+		ready:      &ready,
+		circuits:   rh.circuits,
+		acl:        acl,
+
+		reservations: primary.reservations,
+		started:      time.Now(),
+		policy:       policy,
+		addrs:        primary.addrs,
+		drain:        drain,
+		nodes:        nodes,
+		scale:        scale,
+		hops:         rh.hops,
+		stopDials:    rh.stopDials,
+		dials:        rh.dials,
+		static:       static,
+		events:       events,
+		keepalive:    keep,
+		pruner:       pruner,
+		shedder:      shedder,
+		refresher:    refresher,
+		probe:        probe,
+		clock:        clock,
+		warm:         warm,
+	}
+	status.heartbeat = startHeartbeat(ctx, cfg, status)
+	shutdown.add(stepHTTP, "status server", status.start())
+
+	awaitShutdown(ctx, cfg, drain, stop, lifetime, drainFlag)
+	shutdown.run()
+	if cfg.WipeKeyOnShutdown && cfg.keySeed == "" {
+		wipeKeyFile(privKeyFileName, secrets.PrivateKeyB64, priv)
+	}
+}
+
+// awaitShutdown blocks until the relay should exit: ctx is cancelled, a
+// signal arrives, MAX_PROCESS_LIFETIME passes or the drain flag appears. All
+// but the first drain circuits first; a drain flag removed mid-drain aborts
+// it and waiting resumes.
+func awaitShutdown(ctx context.Context, cfg *relayConfig, drain *drainer, stop <-chan os.Signal, lifetime <-chan time.Time, drainFlag <-chan bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-stop:
+			log.Printf("%s received, draining before shutdown", sig)
+			drain.run(nil)
+			return
+		case <-lifetime:
+			log.Printf("Max process lifetime %s reached, draining before exit", cfg.maxLifetime)
+			drain.run(nil)
+			return
+		case on := <-drainFlag:
+			if !on {
+				continue
+			}
+			log.Printf("Drain flag present, draining before shutdown")
+			if drain.run(drainFlag) {
 				return
 			}
-			_, _ = w.Write([]byte(fmt.Sprintf("%s/p2p/%s", publicMaddrStr, h.ID().String())))
-		})
-
-		log.Printf("Internal status server on :%s", statusPort)
-		if err := http.ListenAndServe(":"+statusPort, mux); err != nil {
-			log.Printf("status server failed: %v", err)
 		}
-	}()
-
-	// block forever
-	select {
-	case <-ctx.Done():
-		_ = h.Close()
-	case <-time.After(100 * 365 * 24 * time.Hour):
 	}
 }
@@ -0,0 +1,112 @@
+// main_test.go
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+func TestLoadOrMakePrivateKey(t *testing.T) {
+	known, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	knownBytes, err := crypto.MarshalPrivateKey(known)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		envKey  string // RELAY_PRIVATE_KEY_B64
+		file    []byte // private_key contents before the call; nil: no file
+		want    crypto.PrivKey
+		wantErr string
+		written bool // a freshly generated key must end up in the file
+	}{
+		{name: "valid base64", envKey: base64.StdEncoding.EncodeToString(knownBytes), want: known},
+		{name: "invalid base64", envKey: "not*base64", wantErr: "decode key failed"},
+		{name: "valid key file", file: knownBytes, want: known},
+		{name: "corrupt key file", file: []byte("garbage"), written: true},
+		{name: "fresh generation", written: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RELAY_SECRETS_URL", "")
+			t.Setenv("RELAY_PRIVATE_KEY_B64", tt.envKey)
+			path := filepath.Join(t.TempDir(), privKeyFileName)
+			if tt.file != nil {
+				if err := os.WriteFile(path, tt.file, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			secrets, err := loadSecrets()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			priv, err := loadOrMakePrivateKey(secrets.PrivateKeyB64, path, false, "", "prefer-env")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadOrMakePrivateKey: %v", err)
+			}
+			if tt.want != nil && !priv.Equals(tt.want) {
+				t.Fatal("got a different key than the one provided")
+			}
+			if !tt.written {
+				return
+			}
+			if priv.Equals(known) {
+				t.Fatal("generated key equals the provided one")
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("key file not written: %v", err)
+			}
+			onDisk, err := crypto.UnmarshalPrivateKey(data)
+			if err != nil {
+				t.Fatalf("key file holds no valid key: %v", err)
+			}
+			if !onDisk.Equals(priv) {
+				t.Fatal("key file holds another key than the one returned")
+			}
+		})
+	}
+}
+
+func TestAwaitShutdownReturnsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := make(chan os.Signal)
+	drainFlag := make(chan bool)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		awaitShutdown(ctx, &relayConfig{}, nil, stop, nil, drainFlag)
+	}()
+
+	drainFlag <- false // a flag that's absent keeps it waiting
+	select {
+	case <-done:
+		t.Fatal("awaitShutdown returned before ctx was cancelled")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("awaitShutdown still blocked 1s after ctx was cancelled")
+	}
+}
@@ -0,0 +1,34 @@
+// mdns.go
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+)
+
+// === mDNS announcement (ENABLE_MDNS) ===
+// Advertises the relay's interface listen addresses on the LAN; useless on
+// Render, so it is opt-in.
+type mdnsNotifee struct {
+	self peer.ID
+}
+
+func (n mdnsNotifee) HandlePeerFound(pi peer.AddrInfo) {
+	if pi.ID == n.self {
+		return
+	}
+	debugf("mDNS: discovered %s %v", pi.ID, pi.Addrs)
+}
+
+func startMDNS(h host.Host, serviceTag string) (func() error, error) {
+	svc := mdns.NewMdnsService(h, serviceTag, mdnsNotifee{self: h.ID()})
+	if err := svc.Start(); err != nil {
+		return nil, fmt.Errorf("start mdns: %w", err)
+	}
+	log.Printf("✅ mDNS announcing as %q", serviceTag)
+	return svc.Close, nil
+}
@@ -0,0 +1,86 @@
+// memcap.go
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// === Memory-scaled reservation cap (RESERVATIONS_PER_MB) ===
+// With RESERVATIONS_PER_MB set, MaxReservations is computed once at startup
+// from the memory the process can use: the smaller of the cgroup limit (v2
+// memory.max or v1 memory.limit_in_bytes) and MemAvailable in /proc/meminfo.
+// The same image then gets a sensible cap on a small and a large instance.
+// Where neither can be read the libp2p default stays, with a warning.
+func reservationsPerMB() (float64, int, error) {
+	perMB, err := envFloat("RESERVATIONS_PER_MB", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	if perMB < 0 {
+		return 0, 0, fmt.Errorf("RESERVATIONS_PER_MB must not be negative, got %v", perMB)
+	}
+	if perMB == 0 {
+		return 0, 0, nil
+	}
+	mb, source, err := availableMemoryMB()
+	if err != nil {
+		log.Printf("⚠️ RESERVATIONS_PER_MB set but available memory is unknown (%v); keeping the default reservation cap", err)
+		return perMB, 0, nil
+	}
+	n := max(1, int(math.Floor(perMB*float64(mb))))
+	log.Printf("Reservation cap: %d (%v per MB x %d MB available, from %s)", n, perMB, mb, source)
+	return perMB, n, nil
+}
+
+func availableMemoryMB() (int64, string, error) {
+	var best int64 = -1
+	source := ""
+	for _, f := range []string{"/sys/fs/cgroup/memory.max", "/sys/fs/cgroup/memory/memory.limit_in_bytes"} {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		v, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		// "max" (v2) or a huge sentinel (v1) mean no limit
+		if err != nil || v <= 0 || v >= math.MaxInt64/2 {
+			continue
+		}
+		best, source = v>>20, f
+		break
+	}
+	if avail, err := memAvailable(); err == nil && (best < 0 || avail < best) {
+		best, source = avail, "/proc/meminfo MemAvailable"
+	}
+	if best < 0 {
+		return 0, "", fmt.Errorf("no cgroup memory limit or /proc/meminfo")
+	}
+	return best, source, nil
+}
+
+// memAvailable reads MemAvailable from /proc/meminfo, in MB.
+func memAvailable() (int64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		rest, ok := strings.CutPrefix(sc.Text(), "MemAvailable:")
+		if !ok {
+			continue
+		}
+		kb, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(rest), " kB"), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb >> 10, nil
+	}
+	return 0, fmt.Errorf("MemAvailable not in /proc/meminfo")
+}
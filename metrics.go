@@ -0,0 +1,181 @@
+// metrics.go
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// === Prometheus /metrics ===
+// One registry for everything: Go runtime (goroutines, GC pauses, heap,
+// scheduler, threads) and process stats, libp2p's own swarm/identify/relay
+// metrics, and the relay gauges and counters below.
+var metricsRegistry = newMetricsRegistry()
+
+func newMetricsRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(collectors.WithGoCollectorRuntimeMetrics(
+			collectors.GoRuntimeMetricsRule{Matcher: regexp.MustCompile(`^/(gc|memory|sched)/.*`)},
+		)),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return reg
+}
+
+// registerRelayMetrics exposes the primary node's numbers (the same ones
+// /stats and StatsD report), read at scrape time.
+func registerRelayMetrics(n *relayNode) {
+	gauge := func(name, help string, fn func() float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: "torrentium_relay", Name: name, Help: help}, fn)
+	}
+	counter := func(name, help string, fn func() float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Namespace: "torrentium_relay", Name: name, Help: help}, fn)
+	}
+	rh := n.rh
+	metricsRegistry.MustRegister(
+		gauge("reservations", "Live reservations.", func() float64 { return float64(n.reservations.count()) }),
+		gauge("connected_peers", "Connected peers.", func() float64 { return float64(len(n.h.Network().Peers())) }),
+		gauge("flapping_peers", "Peers banned by the churn detector right now.", func() float64 { return float64(len(n.churn.flapping())) }),
+		gauge("active_circuits", "Open relayed circuits.", func() float64 { return float64(len(rh.circuits.list("", ""))) }),
+		counter("circuits_opened_total", "Circuits opened since start.", func() float64 { return float64(rh.stats.snapshot().CircuitsOpened) }),
+		counter("relayed_bytes_total", "Bytes relayed over all circuits, both directions.", func() float64 { return float64(rh.stats.snapshot().RelayedBytes) }),
+		counter("relayed_bytes_src_to_dst_total", "Bytes relayed from circuit sources to destinations.", func() float64 { return float64(rh.stats.snapshot().BytesSrcToDst) }),
+		counter("relayed_bytes_dst_to_src_total", "Bytes relayed from circuit destinations back to sources.", func() float64 { return float64(rh.stats.snapshot().BytesDstToSrc) }),
+		counter("reservations_granted_total", "RESERVE requests granted, renewals included.", func() float64 { return float64(rh.stats.snapshot().ReservationsGranted) }),
+		counter("reservations_refused_total", "RESERVE requests refused, for any reason.", func() float64 { return float64(rh.stats.snapshot().ReservationsRefused) }),
+		counter("hop_refused_total", "Hop streams refused by the hop limiter.", func() float64 { return float64(rh.stats.snapshot().HopRefused) }),
+		gauge("reserve_processing_in_flight", "RESERVE requests being processed (RESERVE_MAX_CONCURRENT).", func() float64 { return float64(rh.reserves.inFlight.Load()) }),
+		gauge("reserve_processing_queued", "RESERVE requests waiting for a processing slot.", func() float64 { return float64(rh.reserves.queued.Load()) }),
+		counter("reserve_processing_refused_total", "RESERVE requests refused after waiting for a processing slot.", func() float64 { return float64(rh.stats.snapshot().ReserveProcRefused) }),
+		counter("stop_dial_refused_total", "Stop dials refused by the stop-dial limiter.", func() float64 { return float64(rh.stats.snapshot().StopDialRefused) }),
+		counter("source_dial_refused_total", "CONNECTs refused by the per-source stop-dial limit.", func() float64 { return float64(rh.stats.snapshot().SourceDialRefused) }),
+		gauge("cpu_usage", "Relay CPU time as a share of GOMAXPROCS, averaged over CPU_ADMISSION_WINDOW (0 with CPU admission off).", cpuPressure.currentUsage),
+		gauge("cpu_admission_backoff", "1 while CPU_ADMISSION_THRESHOLD is refusing new connections and reservations.", cpuPressure.backoffGauge),
+		gauge("discovery_registrations", "Live registrations on the discovery protocol (DISCOVERY).", n.discovery.registrations),
+		gauge("fd_usage", "Open file descriptors as a share of the soft limit (FD_LIMIT_THRESHOLD; 0 where unknown).", fdUsage.usage),
+		gauge("circuit_buffer_bytes", "Relay copy buffer memory held by open circuits (RELAY_BUFFER_SIZE per direction).", func() float64 { return float64(rh.buffers.inUse.Load()) }),
+		counter("buffer_budget_refused_total", "Circuits refused by RELAY_BUFFER_BUDGET.", func() float64 { return float64(rh.buffers.refused.Load()) }),
+		counter("dest_circuit_refused_total", "Circuits refused by the DEST_MAX_CIRCUITS cap.", func() float64 { return float64(rh.stats.snapshot().DestCircuitRefused) }),
+		counter("dest_denied_total", "Circuits refused because the destination is on denyDestinations.", func() float64 { return float64(rh.denied.total.Load()) }),
+		counter("enforced_limit_hits_total", "Circuits that passed ENFORCED_LIMIT_DATA while under their advertised data limit.", func() float64 { return float64(rh.stats.snapshot().EnforcedLimitHits) }),
+		counter("rcmgr_blocked_reservations_total", "Reservations refused by the libp2p resource manager.", func() float64 { return float64(rh.stats.snapshot().RcmgrBlockedReservations) }),
+		counter("idle_revoked_reservations_total", "Reservations revoked after RESERVATION_IDLE_TIMEOUT without a circuit.", func() float64 { return float64(rh.stats.snapshot().IdleRevokedReservations) }),
+		counter("dead_revoked_reservations_total", "Reservations revoked after RESERVATION_LIVENESS_FAILURES missed pings.", func() float64 { return float64(rh.stats.snapshot().DeadRevokedReservations) }),
+		counter("expiry_notices_sent_total", "Reservation expiry notices delivered to clients (RESERVATION_EXPIRY_NOTICE).", func() float64 { return float64(rh.stats.snapshot().ExpiryNoticesSent) }),
+		gauge("circuit_compression_ratio", "Raw/deflated size of sampled circuit data with RELAY_COMPRESSION (0 before the first sample); data is relayed uncompressed.", rh.circuits.compression.ratio),
+		rh.circuits.sizes.hist,
+		n.phases.hist,
+		rejectionCollector{},
+		circuitProtocolCollector{n.acl.protocols},
+		bandwidthCollector{rh.bandwidth},
+		transportErrCollector{},
+	)
+}
+
+// rejectionCollector reports connRejections as one counter per reason.
+type rejectionCollector struct{}
+
+var rejectionDesc = prometheus.NewDesc("torrentium_relay_conn_rejected_total", "Connections refused, by reason.", []string{"reason"}, nil)
+
+func (rejectionCollector) Describe(ch chan<- *prometheus.Desc) { ch <- rejectionDesc }
+
+func (rejectionCollector) Collect(ch chan<- prometheus.Metric) {
+	for reason, n := range connRejections.snapshot() {
+		ch <- prometheus.MustNewConstMetric(rejectionDesc, prometheus.CounterValue, float64(n), string(reason))
+	}
+}
+
+// circuitProtocolCollector reports CIRCUIT_PROTOCOLS refusals by the side
+// that lacked a listed protocol; nothing when the filter is off.
+type circuitProtocolCollector struct{ c *circuitProtocols }
+
+var circuitProtocolDesc = prometheus.NewDesc("torrentium_relay_circuit_protocol_refused_total", "Circuits refused by CIRCUIT_PROTOCOLS, by the side that announced none of them.", []string{"side"}, nil)
+
+func (circuitProtocolCollector) Describe(ch chan<- *prometheus.Desc) { ch <- circuitProtocolDesc }
+
+func (c circuitProtocolCollector) Collect(ch chan<- prometheus.Metric) {
+	if c.c == nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(circuitProtocolDesc, prometheus.CounterValue, float64(c.c.refusedSource.Load()), "source")
+	ch <- prometheus.MustNewConstMetric(circuitProtocolDesc, prometheus.CounterValue, float64(c.c.refusedDest.Load()), "dest")
+}
+
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// === GET /metrics.json ===
+// The same registry gathered into one flat object, keyed like the text
+// format: name, name{label="v",...}, and for histograms and summaries the
+// _count, _sum, _bucket{le=...} and {quantile=...} series. Values that JSON
+// can't hold (NaN, ±Inf) are null.
+func (s *statusServer) handleMetricsJSON(w http.ResponseWriter, _ *http.Request) {
+	families, err := metricsRegistry.Gather()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := make(map[string]any)
+	for _, f := range families {
+		name := f.GetName()
+		for _, m := range f.GetMetric() {
+			labels := m.GetLabel()
+			set := func(suffix string, v float64, extra ...*dto.LabelPair) {
+				out[name+suffix+labelString(append(labels[:len(labels):len(labels)], extra...))] = jsonNumber(v)
+			}
+			switch {
+			case m.Counter != nil:
+				set("", m.Counter.GetValue())
+			case m.Gauge != nil:
+				set("", m.Gauge.GetValue())
+			case m.Untyped != nil:
+				set("", m.Untyped.GetValue())
+			case m.Histogram != nil:
+				set("_count", float64(m.Histogram.GetSampleCount()))
+				set("_sum", m.Histogram.GetSampleSum())
+				for _, b := range m.Histogram.GetBucket() {
+					set("_bucket", float64(b.GetCumulativeCount()), pair("le", fmt.Sprint(b.GetUpperBound())))
+				}
+			case m.Summary != nil:
+				set("_count", float64(m.Summary.GetSampleCount()))
+				set("_sum", m.Summary.GetSampleSum())
+				for _, q := range m.Summary.GetQuantile() {
+					set("", q.GetValue(), pair("quantile", fmt.Sprint(q.GetQuantile())))
+				}
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func pair(name, value string) *dto.LabelPair {
+	return &dto.LabelPair{Name: &name, Value: &value}
+}
+
+func labelString(labels []*dto.LabelPair) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = fmt.Sprintf("%s=%q", l.GetName(), l.GetValue())
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func jsonNumber(v float64) any {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,67 @@
+// metrics_test.go
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestMetricsNameNoPeers denies a destination and bans a flapping peer, then
+// scrapes /metrics and /metrics.json without credentials: the counts are
+// there, the peer IDs aren't.
+func TestMetricsNameNoPeers(t *testing.T) {
+	prev := metricsRegistry
+	metricsRegistry = newMetricsRegistry() // registerRelayMetrics registers once per registry
+	t.Cleanup(func() { metricsRegistry = prev })
+
+	n := newTestRelay(t, map[string]string{"CHURN_MAX_CONNECTS": "1"})
+	registerRelayMetrics(n)
+	denied, flapper := newTestClient(t, n).ID(), newTestClient(t, n).ID()
+
+	path := filepath.Join(t.TempDir(), "access.json")
+	if err := os.WriteFile(path, []byte(`{"denyDestinations": ["`+denied.String()+`"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	access, err := newAccessWatcher(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := n.rh.denied.check(access, denied); !errors.Is(err, errDestDenied) {
+			t.Fatalf("check denied destination: %v", err)
+		}
+	}
+	for range 3 {
+		n.churn.connect(flapper)
+	}
+
+	var ready atomic.Bool
+	s := newTestStatusServer(t, n, &ready)
+	s.adminToken = "secret"
+	mux := s.routes()
+	for path, want := range map[string]string{
+		"/metrics":      "torrentium_relay_dest_denied_total 2",
+		"/metrics.json": `"torrentium_relay_dest_denied_total":2`,
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		body := rec.Body.String()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, rec.Code, body)
+		}
+		if !strings.Contains(body, want) {
+			t.Errorf("%s lacks %s", path, want)
+		}
+		for _, p := range []string{denied.String(), flapper.String()} {
+			if strings.Contains(body, p) {
+				t.Errorf("%s names peer %s", path, p)
+			}
+		}
+	}
+}
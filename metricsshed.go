@@ -0,0 +1,95 @@
+// metricsshed.go
+package main
+
+import (
+	"context"
+	"log"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// === Metrics shedding under memory pressure (METRICS_SHED_HEAP_MB) ===
+// Per-peer metrics grow with the peers they name. With METRICS_SHED_HEAP_MB
+// set, the Go heap is checked every metricsShedInterval; once it reaches the
+// threshold those per-peer series are dropped and only their aggregate
+// counters are kept (event=metrics_shed), until the heap is back under
+// METRICS_RESTORE_HEAP_MB (event=metrics_restored). Counts made while shed
+// are in the aggregates only.
+const metricsShedInterval = 10 * time.Second
+
+// detailedMetrics is a metric set with a per-peer breakdown it can drop.
+type detailedMetrics interface {
+	setDetailed(on bool)
+}
+
+type metricsShedder struct {
+	shedAt    uint64
+	restoreAt uint64
+	sets      []detailedMetrics
+
+	shed   atomic.Bool
+	heap   atomic.Uint64
+	events atomic.Int64
+}
+
+type metricsShedInfo struct {
+	Shed        bool   `json:"shed"`
+	HeapMB      uint64 `json:"heapMB"`
+	ShedAtMB    uint64 `json:"shedAtMB"`
+	RestoreAtMB uint64 `json:"restoreAtMB"`
+	Sheds       int64  `json:"sheds"`
+}
+
+func startMetricsShedder(ctx context.Context, cfg *relayConfig, sets ...detailedMetrics) *metricsShedder {
+	m := &metricsShedder{shedAt: uint64(cfg.MetricsShedHeapMB), restoreAt: uint64(cfg.MetricsRestoreHeapMB), sets: sets}
+	if m.shedAt > 0 {
+		go m.run(ctx)
+		log.Printf("✅ Shedding per-peer metrics above %d MB heap, restoring below %d MB", m.shedAt, m.restoreAt)
+	}
+	return m
+}
+
+func (m *metricsShedder) run(ctx context.Context) {
+	t := time.NewTicker(metricsShedInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			var ms runtime.MemStats
+			runtime.ReadMemStats(&ms)
+			m.check(ms.HeapAlloc >> 20)
+		}
+	}
+}
+
+func (m *metricsShedder) check(heapMB uint64) {
+	m.heap.Store(heapMB)
+	switch shed := m.shed.Load(); {
+	case !shed && heapMB >= m.shedAt:
+		m.shed.Store(true)
+		m.events.Add(1)
+		for _, s := range m.sets {
+			s.setDetailed(false)
+		}
+		log.Printf("⚠️ event=metrics_shed heap_mb=%d threshold_mb=%d (per-peer metrics dropped, aggregates kept)", heapMB, m.shedAt)
+	case shed && heapMB < m.restoreAt:
+		m.shed.Store(false)
+		for _, s := range m.sets {
+			s.setDetailed(true)
+		}
+		log.Printf("✅ event=metrics_restored heap_mb=%d restore_mb=%d", heapMB, m.restoreAt)
+	}
+}
+
+func (m *metricsShedder) info() metricsShedInfo {
+	return metricsShedInfo{
+		Shed:        m.shed.Load(),
+		HeapMB:      m.heap.Load(),
+		ShedAtMB:    m.shedAt,
+		RestoreAtMB: m.restoreAt,
+		Sheds:       m.events.Load(),
+	}
+}
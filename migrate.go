@@ -0,0 +1,111 @@
+// migrate.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// === Migration hints (MIGRATION_HINTS) ===
+// When a drain starts, every client holding a reservation that speaks
+// migrateProto gets one JSON migrationHint naming a sibling relay to move to.
+// Clients are spread round-robin over MIGRATION_TARGETS (default
+// STATIC_PEERS), preferring siblings this relay is connected to right now,
+// so they don't all stampede the same one.
+const (
+	migrateProto       = protocol.ID("/torrentium-relay/migrate/1.0.0")
+	migrateSendTimeout = 5 * time.Second
+	migrateSenders     = 16
+)
+
+type migrationHint struct {
+	Version  int       `json:"v"`
+	Reason   string    `json:"reason"`
+	Peer     string    `json:"peer"`
+	Addrs    []string  `json:"addrs"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// migrationTargets returns the configured siblings, connected ones first when
+// any are connected, otherwise all of them.
+func (d *drainer) migrationTargets() []peer.AddrInfo {
+	var up []peer.AddrInfo
+	for _, t := range d.cfg.migrationTargets {
+		if d.h.Network().Connectedness(t.ID) == network.Connected {
+			up = append(up, t)
+		}
+	}
+	if len(up) > 0 {
+		return up
+	}
+	return d.cfg.migrationTargets
+}
+
+// sendMigrationHints tells each reserved client where to go before deadline.
+func (d *drainer) sendMigrationHints(deadline time.Time) {
+	targets := d.migrationTargets()
+	if len(targets) == 0 {
+		return
+	}
+	var sent, unsupported, failed atomic.Int64
+	sem := make(chan struct{}, migrateSenders)
+	var wg sync.WaitGroup
+	i := 0
+	for _, r := range d.acl.reservations.list() {
+		p, err := peer.Decode(r.Peer)
+		if err != nil {
+			continue
+		}
+		if ok, _ := d.h.Peerstore().SupportsProtocols(p, migrateProto); len(ok) == 0 {
+			unsupported.Add(1)
+			continue
+		}
+		t := targets[i%len(targets)]
+		i++
+		if t.ID == p { // a sibling holding a reservation here
+			if len(targets) == 1 {
+				continue
+			}
+			t = targets[i%len(targets)]
+			i++
+		}
+		hint := migrationHint{Version: 1, Reason: "drain", Peer: t.ID.String(), Deadline: deadline}
+		for _, a := range t.Addrs {
+			hint.Addrs = append(hint.Addrs, a.String())
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			if err := d.sendMigrationHint(p, hint); err != nil {
+				failed.Add(1)
+				eventf("migration_hint_failed", "event=migration_hint_failed peer=%s err=%q", p, err)
+				return
+			}
+			sent.Add(1)
+		}()
+	}
+	wg.Wait()
+	log.Printf("event=migration_hints sent=%d unsupported=%d failed=%d targets=%d", sent.Load(), unsupported.Load(), failed.Load(), len(targets))
+}
+
+func (d *drainer) sendMigrationHint(p peer.ID, hint migrationHint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), migrateSendTimeout)
+	defer cancel()
+	s, err := d.h.NewStream(ctx, p, migrateProto)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	_ = s.SetDeadline(time.Now().Add(migrateSendTimeout))
+	return json.NewEncoder(s).Encode(hint)
+}
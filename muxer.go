@@ -0,0 +1,72 @@
+// muxer.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/p2p/muxer/yamux"
+)
+
+// === Yamux tuning (YAMUX_*) ===
+// Starts from go-libp2p's defaults (256 KiB initial / 16 MiB max stream
+// window, 30s keepalive). mplex is no longer shipped by go-libp2p.
+const yamuxMinWindow = 256 * 1024
+
+type yamuxConfig struct {
+	InitialWindow uint32 `json:"initialStreamWindow"`
+	MaxWindow     uint32 `json:"maxStreamWindow"`
+	KeepAlive     string `json:"keepAliveInterval"`
+
+	keepAlive time.Duration
+}
+
+func loadYamuxConfig() (yamuxConfig, error) {
+	def := yamux.DefaultTransport.Config()
+
+	initial, err := envInt("YAMUX_INITIAL_WINDOW", int(def.InitialStreamWindowSize))
+	if err != nil {
+		return yamuxConfig{}, err
+	}
+	maxWindow, err := envInt("YAMUX_MAX_STREAM_WINDOW", int(def.MaxStreamWindowSize))
+	if err != nil {
+		return yamuxConfig{}, err
+	}
+	keepAlive, err := envDuration("YAMUX_KEEPALIVE_INTERVAL", def.KeepAliveInterval)
+	if err != nil {
+		return yamuxConfig{}, err
+	}
+
+	if initial < yamuxMinWindow || initial > 1<<31 {
+		return yamuxConfig{}, fmt.Errorf("YAMUX_INITIAL_WINDOW must be between %d and %d bytes, got %d", yamuxMinWindow, 1<<31, initial)
+	}
+	if maxWindow < initial || maxWindow > 1<<31 {
+		return yamuxConfig{}, fmt.Errorf("YAMUX_MAX_STREAM_WINDOW must be between YAMUX_INITIAL_WINDOW and %d bytes, got %d", 1<<31, maxWindow)
+	}
+
+	return yamuxConfig{
+		InitialWindow: uint32(initial),
+		MaxWindow:     uint32(maxWindow),
+		KeepAlive:     keepAlive.String(),
+		keepAlive:     keepAlive,
+	}, nil
+}
+
+// muxer returns the libp2p option installing the tuned yamux transport.
+// A zero keepalive interval turns keepalives off.
+func (y yamuxConfig) muxer() libp2p.Option {
+	t := *yamux.DefaultTransport
+	c := t.Config()
+	c.InitialStreamWindowSize = y.InitialWindow
+	c.MaxStreamWindowSize = y.MaxWindow
+	c.EnableKeepAlive = y.keepAlive > 0
+	if c.EnableKeepAlive {
+		c.KeepAliveInterval = y.keepAlive
+	}
+
+	log.Printf("Muxer: yamux initial window %d, max stream window %d, keepalive %s",
+		y.InitialWindow, y.MaxWindow, y.KeepAlive)
+	return libp2p.Muxer(yamux.ID, &t)
+}
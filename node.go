@@ -0,0 +1,483 @@
+// node.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	crypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	relay "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Relay node (one identity: host + circuit v2 relay) ===
+// The process runs a primary node on $PORT plus any RELAY_INSTANCES.
+type relayNode struct {
+	name        string
+	cfg         *relayConfig
+	adv         atomic.Pointer[advertisement]
+	addrEmitter event.Emitter
+	// listening is set once every listener is confirmed bound; until then
+	// nothing is advertised.
+	listening atomic.Bool
+	early     atomic.Bool
+	// unavailable is what ALLOW_PARTIAL_TRANSPORTS let startup go on
+	// without; fixed once listening is set.
+	unavailable []unavailableListener
+	// droppedAddrs is the last set MAX_ADVERTISED_ADDRS left out.
+	droppedAddrs atomic.Pointer[string]
+
+	h            host.Host
+	rh           *relayHost
+	acl          *relayACL
+	reservations *reservationTracker
+	transports   *transportConns
+	churn        *churnDetector
+	purpose      *connPurpose
+	phases       *handshakePhases
+	connectivity *connectivity
+	addrs        *addrWatcher
+	peerstore    *cappedPeerstore
+	discovery    *discovery
+}
+
+// extraHostOptions are appended to every node's libp2p options. Tests use it
+// to swap in a connection manager that trims right away.
+var extraHostOptions []libp2p.Option
+
+type unavailableListener struct {
+	Listener  string `json:"listener"`
+	Transport string `json:"transport"`
+	Error     string `json:"error"`
+}
+
+type relayNodeInfo struct {
+	Name           string   `json:"name"`
+	PeerID         string   `json:"peerId"`
+	Multiaddr      string   `json:"multiaddr,omitempty"`
+	Multiaddrs     []string `json:"multiaddrs,omitempty"`
+	ListenAddrs    []string `json:"listenAddrs"`
+	ConnectedPeers int      `json:"connectedPeers"`
+	Reservations   int      `json:"reservations"`
+	ActiveCircuits int      `json:"activeCircuits"`
+	AddrError      string   `json:"addrError,omitempty"`
+}
+
+// newRelayNode builds the host; the relay service starts with startRelay so
+// hop observers can be registered first.
+func newRelayNode(cfg *relayConfig, access *accessWatcher, geo *geoFilter, name string, priv crypto.PrivKey, port, wtPort, publicHost string) (*relayNode, error) {
+	// === libp2p must bind on $PORT ===
+	listen := []string{fmt.Sprintf("%s/tcp/%s/ws", cfg.listenHost(), port)}
+	if wtPort != "" {
+		listen = append(listen, fmt.Sprintf("%s/udp/%s/quic-v1/webtransport", cfg.listenHost(), wtPort))
+	}
+	if cfg.AllowEphemeralPort {
+		listen = ephemeralFallback(name, listen)
+	}
+
+	n := &relayNode{name: name, cfg: cfg}
+	n.adv.Store(newAdvertisement(publicHost, cfg.advertiseAddrs(publicHost)))
+
+	// replace: advertise only the public address (behind Render's proxy)
+	// append: listen addrs + public address, so dev can dial directly too
+	// The public address is read per call so POST /advertise can swap it.
+	addrFactory := func(addrs []ma.Multiaddr) []ma.Multiaddr {
+		if !n.listening.Load() {
+			if n.early.CompareAndSwap(false, true) {
+				log.Printf("node=%s address factory called before listeners were confirmed; advertising none until they are", name)
+			}
+			return []ma.Multiaddr{}
+		}
+		adv := n.adv.Load()
+		if adv.err != nil {
+			return []ma.Multiaddr{}
+		}
+		var out []ma.Multiaddr
+		switch {
+		case len(adv.public) == 0:
+			out = addrs
+		case cfg.AddrFactoryMode == "append":
+			out = append(addrs[:len(addrs):len(addrs)], adv.public...)
+		case n.transportUnavailable("ws"):
+			// the public addresses front the WebSocket listener
+			out = publicWebTransport(adv.public[0], addrs)
+		default:
+			out = append(slices.Clone(adv.public), publicWebTransport(adv.public[0], addrs)...)
+		}
+		out = append(out, adv.retiredAddrs()...)
+		kept, dropped := capAddrs(out, cfg.MaxAdvertisedAddrs)
+		// the factory runs on every address refresh; log only changes
+		if len(dropped) == 0 {
+			n.droppedAddrs.Store(nil)
+		} else {
+			key := fmt.Sprint(dropped)
+			if prev := n.droppedAddrs.Swap(&key); prev == nil || *prev != key {
+				log.Printf("node=%s advertising %d of %d addresses (MAX_ADVERTISED_ADDRS), dropped %s", name, len(kept), len(out), key)
+			}
+		}
+		return kept
+	}
+
+	self, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := newCappedPeerstore(self, cfg.MaxAddrsPerPeer)
+	if err != nil {
+		return nil, fmt.Errorf("peerstore failed: %w", err)
+	}
+	n.peerstore = ps
+
+	gater := newRelayGater(cfg, access, geo)
+	gater.transports.bind(listen)
+	h, err := libp2p.New(append([]libp2p.Option{
+		libp2p.Identity(priv),
+		libp2p.Peerstore(ps),
+		libp2p.ListenAddrStrings(listen...),
+		libp2p.AddrsFactory(addrFactory),
+		libp2p.ForceReachabilityPublic(),
+		libp2p.ConnectionGater(gater),
+		libp2p.PrometheusRegisterer(metricsRegistry),
+		handshakeTimeout(cfg.handshakeTimeout),
+		libp2p.SwarmOpts(swarm.WithDialTimeout(cfg.dialTimeout)),
+		cfg.Yamux.muxer(),
+	}, extraHostOptions...)...)
+	if err != nil {
+		err = fmt.Errorf("libp2p host failed: %w", err)
+		if isListenError(err) {
+			err = &startupError{exitBind, err}
+		}
+		return nil, err
+	}
+
+	addrs, err := watchLocalAddrs(h)
+	if err != nil {
+		_ = h.Close()
+		return nil, fmt.Errorf("subscribe to address updates failed: %w", err)
+	}
+
+	if err := watchIdentifyLimits(h, cfg.IdentifyLimits); err != nil {
+		_ = h.Close()
+		return nil, fmt.Errorf("subscribe to identify events failed: %w", err)
+	}
+
+	emitter, err := h.EventBus().Emitter(new(event.EvtLocalAddressesUpdated))
+	if err != nil {
+		_ = h.Close()
+		return nil, fmt.Errorf("address update emitter failed: %w", err)
+	}
+
+	h.Network().Notify(gater.transports.notifiee())
+	if cfg.DedupConns != "off" {
+		h.Network().Notify(dedupNotifiee(cfg.DedupConns, h))
+	}
+
+	rh := newRelayHost(h, cfg, access)
+	rh.connectivity = newConnectivity(h)
+	reservations := newReservationTracker(cfg)
+	rh.onHop(reservations.observe)
+	rh.onHop(rh.circuits.observe)
+	rh.onHop(rh.stats.observe)
+	h.Network().Notify(reservations.notifiee())
+	gater.purpose.bind(h, reservations)
+
+	n.addrEmitter = emitter
+	n.h = h
+	n.rh = rh
+	n.acl = newRelayACL(cfg, reservations, access)
+	n.acl.clients = newClientPolicy(h, cfg)
+	n.acl.protocols = newCircuitProtocols(h, cfg)
+	n.acl.capacity = newCapacityBudget(h, cfg, reservations)
+	n.reservations = reservations
+	n.acl.diagnostics = startDiagnostics(n, cfg)
+	n.rh.peerDebug = startPeerDebug(n, cfg)
+	if n.rh.sessions, err = startSessions(n, cfg); err != nil {
+		_ = h.Close()
+		return nil, err
+	}
+	n.transports = gater.transports
+	n.churn = gater.churn
+	n.purpose = gater.purpose
+	n.phases = gater.phases
+	n.connectivity = rh.connectivity
+	n.addrs = addrs
+	if err := n.confirmListeners(listen); err != nil {
+		_ = h.Close()
+		return nil, &startupError{exitBind, err}
+	}
+	if cfg.LoadHints {
+		n.serveLoadHints()
+	}
+	if n.acl.capacity != nil {
+		n.acl.capacity.serve()
+	}
+	if n.discovery = newDiscovery(n, cfg); n.discovery != nil {
+		n.discovery.serve()
+	}
+	return n, nil
+}
+
+// === Advertised address ===
+// A public address that doesn't parse advertises nothing rather than falling
+// back to container-internal listen addrs; /readyz reports it.
+type advertisement struct {
+	host   string
+	addrs  []string
+	public []ma.Multiaddr
+	err    error
+
+	retired []retiredHost // HOSTNAME_CHANGE_GRACE
+}
+
+func newAdvertisement(host string, addrs []string) *advertisement {
+	adv := &advertisement{host: host, addrs: addrs}
+	for _, addr := range addrs {
+		a, err := ma.NewMultiaddr(addr)
+		if err != nil {
+			adv.public = nil
+			adv.err = fmt.Errorf("invalid advertised address %q: %w", addr, err)
+			log.Printf("⚠️ %v; advertising no addresses", adv.err)
+			break
+		}
+		adv.public = append(adv.public, a)
+	}
+	return adv
+}
+
+// publicMultiaddrs are the advertised addresses (ADVERTISE_TRANSPORTS order,
+// then ADVERTISE_ORDER) with the peer ID; publicMultiaddr is the first, or ""
+// if no public hostname is set.
+func (n *relayNode) publicMultiaddrs() []string {
+	adv := n.adv.Load()
+	out := make([]string, 0, len(adv.addrs))
+	if n.transportUnavailable("ws") {
+		for _, a := range n.h.Addrs() {
+			out = append(out, fmt.Sprintf("%s/p2p/%s", a, n.h.ID()))
+		}
+		return out
+	}
+	if len(adv.public) != len(adv.addrs) {
+		for _, a := range adv.addrs {
+			out = append(out, fmt.Sprintf("%s/p2p/%s", a, n.h.ID()))
+		}
+		return out
+	}
+	addrs := slices.Clone(adv.public)
+	n.orderAddrs(addrs)
+	for _, a := range addrs {
+		out = append(out, fmt.Sprintf("%s/p2p/%s", a, n.h.ID()))
+	}
+	return out
+}
+
+// transportUnavailable reports whether startup went on without transport.
+func (n *relayNode) transportUnavailable(transport string) bool {
+	return slices.ContainsFunc(n.unavailable, func(u unavailableListener) bool { return u.Transport == transport })
+}
+
+func (n *relayNode) publicMultiaddr() string {
+	if all := n.publicMultiaddrs(); len(all) > 0 {
+		return all[0]
+	}
+	return ""
+}
+
+// setHostname swaps the advertised hostname and pushes the new addresses to
+// connected peers right away (identify pushes on EvtLocalAddressesUpdated)
+// instead of waiting for the host's next address check.
+func (n *relayNode) setHostname(hostname string) error {
+	if err := validateHostname(hostname); err != nil {
+		return err
+	}
+	before := n.h.Addrs()
+	adv := newAdvertisement(hostname, n.cfg.advertiseAddrs(hostname))
+	if adv.err != nil {
+		return adv.err
+	}
+	old := n.adv.Load()
+	until := n.retire(old, adv)
+	n.adv.Store(adv)
+	log.Printf("event=advertise_changed node=%s old=%q new=%q addrs=[%s]%s",
+		n.name, old.host, adv.host, strings.Join(adv.addrs, " "), until)
+	return n.announceAddrs(before)
+}
+
+// readvertise rebuilds the advertisement for the current hostname and
+// announces it even if nothing changed; the freshly signed peer record alone
+// makes identify push to every connected peer. It returns what the address
+// factory now yields.
+func (n *relayNode) readvertise() ([]string, error) {
+	before := n.h.Addrs()
+	old := n.adv.Load()
+	adv := newAdvertisement(old.host, n.cfg.advertiseAddrs(old.host))
+	if adv.err != nil {
+		return nil, adv.err
+	}
+	adv.retired = old.retired
+	n.adv.Store(adv)
+	if err := n.announceAddrs(before); err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, a := range n.h.Addrs() {
+		out = append(out, a.String())
+	}
+	log.Printf("event=readvertised node=%s host=%q peers=%d addrs=[%s]",
+		n.name, adv.host, len(n.h.Network().Peers()), strings.Join(out, " "))
+	return out, nil
+}
+
+// confirmListeners checks that the swarm is bound on the requested listen
+// addresses before anything is advertised. The swarm itself only fails when
+// none of them bind; with ALLOW_PARTIAL_TRANSPORTS (the default) the node
+// then carries on with the transports that did come up, logging each one
+// that didn't as event=transport_unavailable and listing them on /readyz and
+// /transports. Without it any missing listener fails startup.
+func (n *relayNode) confirmListeners(want []string) error {
+	bound := n.h.Network().ListenAddresses()
+	var missing []string
+	for _, w := range want {
+		if !slices.ContainsFunc(bound, func(a ma.Multiaddr) bool { return strings.HasPrefix(a.String(), w) }) {
+			missing = append(missing, w)
+		}
+	}
+	if len(missing) > 0 && (!n.cfg.PartialTransports || len(missing) == len(want)) {
+		return fmt.Errorf("listener %s is not bound (bound: %v)", missing[0], bound)
+	}
+	for _, w := range missing {
+		u := unavailableListener{Listener: w, Transport: "unknown", Error: "not bound"}
+		if a, err := ma.NewMultiaddr(w); err == nil {
+			u.Transport = transportName(a)
+			// the swarm doesn't return why; binding again tells
+			network, port, _ := strings.Cut(portKey(a), "/")
+			if err := probePort(network, port); err != nil {
+				u.Error = err.Error()
+			}
+		}
+		n.unavailable = append(n.unavailable, u)
+		log.Printf("⚠️ event=transport_unavailable node=%s transport=%s listener=%s error=%q: continuing without it (ALLOW_PARTIAL_TRANSPORTS)", n.name, u.Transport, w, u.Error)
+	}
+	before := n.h.Addrs()
+	n.listening.Store(true)
+	log.Printf("✅ node=%s listeners bound on %v, advertising", n.name, bound)
+	return n.announceAddrs(before)
+}
+
+// announceAddrs emits EvtLocalAddressesUpdated against the addresses held
+// before a change, so identify pushes the new set to connected peers now.
+func (n *relayNode) announceAddrs(before []ma.Multiaddr) error {
+	after := n.h.Addrs()
+	ev := event.EvtLocalAddressesUpdated{Diffs: true, SignedPeerRecord: n.signPeerRecord(after)}
+	for _, a := range after {
+		action := event.Added
+		if slices.ContainsFunc(before, a.Equal) {
+			action = event.Maintained
+		}
+		ev.Current = append(ev.Current, event.UpdatedAddress{Address: a, Action: action})
+	}
+	for _, a := range before {
+		if !slices.ContainsFunc(after, a.Equal) {
+			ev.Removed = append(ev.Removed, event.UpdatedAddress{Address: a, Action: event.Removed})
+		}
+	}
+	return n.addrEmitter.Emit(ev)
+}
+
+// signPeerRecord refreshes the host's own signed peer record, which identify
+// sends alongside the addresses and clients prefer over them.
+func (n *relayNode) signPeerRecord(addrs []ma.Multiaddr) *record.Envelope {
+	cab, ok := peerstore.GetCertifiedAddrBook(n.h.Peerstore())
+	if !ok {
+		return nil
+	}
+	env, err := record.Seal(peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: n.h.ID(), Addrs: addrs}),
+		n.h.Peerstore().PrivKey(n.h.ID()))
+	if err != nil {
+		log.Printf("⚠️ sign peer record failed: %v", err)
+		return nil
+	}
+	if _, err := cab.ConsumePeerRecord(env, peerstore.PermanentAddrTTL); err != nil {
+		log.Printf("⚠️ store peer record failed: %v", err)
+		return nil
+	}
+	return env
+}
+
+// validateHostname accepts a DNS name (RFC 1123 labels), not an IP address.
+func validateHostname(h string) error {
+	if h == "" || len(h) > 253 {
+		return fmt.Errorf("hostname must be 1-253 characters")
+	}
+	if net.ParseIP(h) != nil {
+		return fmt.Errorf("hostname must be a DNS name, not an IP address")
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(h, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("invalid hostname label %q", label)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return fmt.Errorf("invalid character %q in hostname", c)
+			}
+		}
+	}
+	return nil
+}
+
+func (n *relayNode) startRelay(cfg *relayConfig) error {
+	_, err := relay.New(n.rh, relay.WithResources(cfg.relayResources()), relay.WithACL(n.acl))
+	if err != nil {
+		return fmt.Errorf("enable relay hop failed: %w", err)
+	}
+	n.disableProtocols(cfg.disabledProtocols)
+	return nil
+}
+
+// disableProtocols unregisters DISABLED_PROTOCOLS; loadConfig has already
+// refused the ones the relay can't work without.
+func (n *relayNode) disableProtocols(pids []protocol.ID) {
+	registered := n.h.Mux().Protocols()
+	for _, pid := range pids {
+		if !slices.Contains(registered, pid) {
+			log.Printf("⚠️ DISABLED_PROTOCOLS: %s is not registered on %s", pid, n.name)
+			continue
+		}
+		n.h.RemoveStreamHandler(pid)
+	}
+	protos := n.h.Mux().Protocols()
+	slices.Sort(protos)
+	log.Printf("Protocols on %s: %v", n.name, protos)
+}
+
+func (n *relayNode) info() relayNodeInfo {
+	info := relayNodeInfo{
+		Name:           n.name,
+		PeerID:         n.h.ID().String(),
+		ListenAddrs:    []string{},
+		ConnectedPeers: len(n.h.Network().Peers()),
+		Reservations:   len(n.reservations.list()),
+		ActiveCircuits: len(n.rh.circuits.list("", "")),
+	}
+	if err := n.adv.Load().err; err != nil {
+		info.AddrError = err.Error()
+	} else {
+		info.Multiaddr = n.publicMultiaddr()
+		info.Multiaddrs = n.publicMultiaddrs()
+	}
+	for _, a := range n.h.Network().ListenAddresses() {
+		info.ListenAddrs = append(info.ListenAddrs, a.String())
+	}
+	return info
+}
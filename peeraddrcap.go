@@ -0,0 +1,159 @@
+// peeraddrcap.go
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Stored addresses per peer (PEERSTORE_MAX_ADDRS_PER_PEER) ===
+// go-libp2p keeps up to 500 addresses per identify and doesn't bound what a
+// peer accumulates across pushes, signed records and observations, so a
+// client can bloat the relay's peerstore by advertising address after
+// address. The peerstore is wrapped so that every write adding addresses
+// for a peer (other than the relay itself) leaves it with at most this many,
+// evicting first the ones it had that the write didn't repeat, then the last
+// ones the write listed; each eviction is logged as
+// event=peer_addrs_evicted (subject to LOG_SAMPLING). 0 turns the cap off.
+// Stored addresses are on /stats as peerstoreAddrs.
+const defaultMaxAddrsPerPeer = 32
+
+type cappedPeerstore struct {
+	peerstore.Peerstore
+	cab  peerstore.CertifiedAddrBook
+	self peer.ID
+	max  int
+
+	evicted atomic.Int64
+}
+
+type peerstoreAddrsInfo struct {
+	Total      int   `json:"total"`
+	Peers      int   `json:"peers"`
+	MaxPerPeer int   `json:"maxPerPeer"`
+	Evicted    int64 `json:"evicted"`
+}
+
+func maxAddrsPerPeer() (int, error) {
+	n, err := envInt("PEERSTORE_MAX_ADDRS_PER_PEER", defaultMaxAddrsPerPeer)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("PEERSTORE_MAX_ADDRS_PER_PEER must not be negative, got %d", n)
+	}
+	return n, nil
+}
+
+func newCappedPeerstore(self peer.ID, max int) (*cappedPeerstore, error) {
+	ps, err := pstoremem.NewPeerstore()
+	if err != nil {
+		return nil, err
+	}
+	return &cappedPeerstore{Peerstore: ps, cab: ps, self: self, max: max}, nil
+}
+
+func (ps *cappedPeerstore) AddAddr(p peer.ID, a ma.Multiaddr, ttl time.Duration) {
+	ps.AddAddrs(p, []ma.Multiaddr{a}, ttl)
+}
+
+func (ps *cappedPeerstore) AddAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
+	before := ps.before(p, ttl)
+	ps.Peerstore.AddAddrs(p, addrs, ttl)
+	ps.enforce(p, before, addrs)
+}
+
+func (ps *cappedPeerstore) SetAddr(p peer.ID, a ma.Multiaddr, ttl time.Duration) {
+	ps.SetAddrs(p, []ma.Multiaddr{a}, ttl)
+}
+
+func (ps *cappedPeerstore) SetAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
+	before := ps.before(p, ttl)
+	ps.Peerstore.SetAddrs(p, addrs, ttl)
+	ps.enforce(p, before, addrs)
+}
+
+func (ps *cappedPeerstore) ConsumePeerRecord(s *record.Envelope, ttl time.Duration) (bool, error) {
+	rec, err := s.Record()
+	if err != nil {
+		return false, err
+	}
+	r, ok := rec.(*peer.PeerRecord)
+	if !ok {
+		return ps.cab.ConsumePeerRecord(s, ttl)
+	}
+	before := ps.before(r.PeerID, ttl)
+	accepted, err := ps.cab.ConsumePeerRecord(s, ttl)
+	if accepted {
+		ps.enforce(r.PeerID, before, r.Addrs)
+	}
+	return accepted, err
+}
+
+func (ps *cappedPeerstore) GetPeerRecord(p peer.ID) *record.Envelope {
+	return ps.cab.GetPeerRecord(p)
+}
+
+// before is p's addresses ahead of a write that may add some; nil when the
+// write can't (off, the relay itself, a removal).
+func (ps *cappedPeerstore) before(p peer.ID, ttl time.Duration) map[string]bool {
+	if ps.max == 0 || p == ps.self || ttl <= 0 {
+		return nil
+	}
+	out := make(map[string]bool)
+	for _, a := range ps.Peerstore.Addrs(p) {
+		out[string(a.Bytes())] = true
+	}
+	return out
+}
+
+// enforce trims p back to the cap after a write of written.
+func (ps *cappedPeerstore) enforce(p peer.ID, before map[string]bool, written []ma.Multiaddr) {
+	if before == nil {
+		return
+	}
+	now := ps.Peerstore.Addrs(p)
+	excess := len(now) - ps.max
+	if excess <= 0 {
+		return
+	}
+	fresh := make(map[string]bool, len(written))
+	for _, a := range written {
+		fresh[string(a.Bytes())] = true
+	}
+	var victims []ma.Multiaddr
+	for _, a := range now {
+		if len(victims) < excess && before[string(a.Bytes())] && !fresh[string(a.Bytes())] {
+			victims = append(victims, a)
+		}
+	}
+	for i := len(written) - 1; i >= 0 && len(victims) < excess; i-- {
+		if k := string(written[i].Bytes()); fresh[k] {
+			victims = append(victims, written[i])
+			delete(fresh, k) // listed twice
+		}
+	}
+	for _, a := range victims {
+		ps.Peerstore.SetAddr(p, a, 0)
+	}
+	total := ps.evicted.Add(int64(len(victims)))
+	eventf("peer_addrs_evicted", "⚠️ event=peer_addrs_evicted peer=%s evicted=%d kept=%d max=%d evicted_total=%d", p, len(victims), len(now)-len(victims), ps.max, total)
+}
+
+func (ps *cappedPeerstore) info() peerstoreAddrsInfo {
+	info := peerstoreAddrsInfo{MaxPerPeer: ps.max, Evicted: ps.evicted.Load()}
+	for _, p := range ps.Peerstore.PeersWithAddrs() {
+		if n := len(ps.Peerstore.Addrs(p)); n > 0 {
+			info.Total += n
+			info.Peers++
+		}
+	}
+	return info
+}
@@ -0,0 +1,132 @@
+// peerdebug.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Per-peer lifecycle logging (DEBUG_PEER_IDS) ===
+// For following one client through the relay without LOG_LEVEL=debug: for
+// the peers listed, every step is logged as 🔎 event=peer_debug with its
+// stage (connected, identified, identify_failed, the hop requests as reserve
+// or connect with their status, connect_incoming for a circuit asked to it,
+// circuit_closed, disconnected) and the details that step has, such as the
+// address and transport, agent and protocols, granted expiry, destination or
+// bytes relayed. A circuit is logged when either end is listed. Nothing is
+// sampled.
+type peerDebug struct {
+	peers        map[peer.ID]bool
+	reservations *reservationTracker
+}
+
+func debugPeerIDs() (map[peer.ID]bool, error) {
+	peers := make(map[peer.ID]bool)
+	for _, s := range strings.Split(envString("DEBUG_PEER_IDS", ""), ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		p, err := peer.Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DEBUG_PEER_IDS entry %q: %w", s, err)
+		}
+		peers[p] = true
+	}
+	return peers, nil
+}
+
+// startPeerDebug hooks n up for DEBUG_PEER_IDS; nil when none are listed.
+func startPeerDebug(n *relayNode, cfg *relayConfig) *peerDebug {
+	if len(cfg.debugPeers) == 0 {
+		return nil
+	}
+	d := &peerDebug{peers: cfg.debugPeers, reservations: n.reservations}
+	n.rh.onHop(d.observe)
+	n.h.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(_ network.Network, c network.Conn) {
+			if d.peers[c.RemotePeer()] {
+				d.logf(c.RemotePeer(), "connected", "addr=%s direction=%s transport=%s conn=%s",
+					c.RemoteMultiaddr(), c.Stat().Direction, transportOf(c.RemoteMultiaddr()), c.ID())
+			}
+		},
+		DisconnectedF: func(_ network.Network, c network.Conn) {
+			if d.peers[c.RemotePeer()] {
+				d.logf(c.RemotePeer(), "disconnected", "addr=%s conn=%s after=%s reserved=%t",
+					c.RemoteMultiaddr(), c.ID(), time.Since(c.Stat().Opened).Round(time.Millisecond), d.reservations.has(c.RemotePeer()))
+			}
+		},
+	})
+	sub, err := n.h.EventBus().Subscribe([]any{new(event.EvtPeerIdentificationCompleted), new(event.EvtPeerIdentificationFailed)})
+	if err != nil {
+		log.Printf("⚠️ DEBUG_PEER_IDS: identify events unavailable: %v", err)
+	} else {
+		go func() {
+			defer sub.Close()
+			for e := range sub.Out() {
+				switch ev := e.(type) {
+				case event.EvtPeerIdentificationCompleted:
+					if d.peers[ev.Peer] {
+						d.logf(ev.Peer, "identified", "agent=%q protocols=%d listen_addrs=%d observed=%s",
+							ev.AgentVersion, len(ev.Protocols), len(ev.ListenAddrs), ev.ObservedAddr)
+					}
+				case event.EvtPeerIdentificationFailed:
+					if d.peers[ev.Peer] {
+						d.logf(ev.Peer, "identify_failed", "err=%q", ev.Reason)
+					}
+				}
+			}
+		}()
+	}
+	log.Printf("🔎 DEBUG_PEER_IDS: logging the lifecycle of %d peer(s)", len(d.peers))
+	return d
+}
+
+func (d *peerDebug) logf(p peer.ID, stage, format string, args ...any) {
+	log.Printf("🔎 event=peer_debug peer=%s stage=%s "+format, append([]any{p, stage}, args...)...)
+}
+
+func (d *peerDebug) observe(ev hopEvent) {
+	if !d.peers[ev.Peer] && !d.peers[ev.Dest] {
+		return
+	}
+	detail := fmt.Sprintf("status=%s", ev.Status)
+	if ev.Addr != nil {
+		detail += " addr=" + ev.Addr.String()
+	}
+	if ev.Dest != "" {
+		detail += " dest=" + ev.Dest.String()
+	}
+	if ev.Tier != "" {
+		detail += " tier=" + ev.Tier
+	}
+	if !ev.Expire.IsZero() {
+		detail += " expire=" + ev.Expire.Format(time.RFC3339)
+	}
+	took := time.Since(ev.Start).Round(time.Millisecond)
+	stage := strings.ToLower(ev.Type.String())
+	if d.peers[ev.Peer] {
+		d.logf(ev.Peer, stage, "%s took=%s", detail, took)
+	}
+	if ev.Dest != "" && d.peers[ev.Dest] {
+		d.logf(ev.Dest, "connect_incoming", "%s src=%s took=%s", detail, ev.Peer, took)
+	}
+}
+
+// circuitClosed logs c's end if either side is listed; d may be nil.
+func (d *peerDebug) circuitClosed(c *circuit) {
+	if d == nil || (!d.peers[c.src] && !d.peers[c.dst]) {
+		return
+	}
+	p := c.src
+	if !d.peers[p] {
+		p = c.dst
+	}
+	d.logf(p, "circuit_closed", "src=%s dest=%s duration=%s src_to_dst=%d dst_to_src=%d",
+		c.src, c.dst, time.Since(c.start).Round(time.Millisecond), c.srcToDst.Load(), c.dstToSrc.Load())
+}
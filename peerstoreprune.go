@@ -0,0 +1,93 @@
+// peerstoreprune.go
+package main
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Peerstore pruning (PEERSTORE_PRUNE_AFTER) ===
+// go-libp2p lets a departed peer's addresses expire but keeps its key,
+// protocols and metadata until the host closes, so a long-lived relay's
+// peerstore grows with every client it has ever seen. The pruner sweeps every
+// peerstorePruneInterval (or the window, if shorter) and removes peers found
+// disconnected on every sweep for the whole window. Static peers and
+// migration targets are never pruned; they're dialed from the peerstore.
+const peerstorePruneInterval = 5 * time.Minute
+
+type peerstorePruner struct {
+	h     host.Host
+	after time.Duration
+	keep  map[peer.ID]bool
+
+	// away is when each disconnected peer was first found so; only the
+	// pruner's goroutine touches it.
+	away   map[peer.ID]time.Time
+	pruned atomic.Int64
+}
+
+func startPeerstorePruner(ctx context.Context, h host.Host, cfg *relayConfig) *peerstorePruner {
+	p := &peerstorePruner{h: h, after: cfg.peerstorePruneAfter, keep: map[peer.ID]bool{h.ID(): true}, away: make(map[peer.ID]time.Time)}
+	for _, list := range [][]peer.AddrInfo{cfg.staticPeers, cfg.migrationTargets} {
+		for _, ai := range list {
+			p.keep[ai.ID] = true
+		}
+	}
+	if p.after > 0 {
+		go p.run(ctx)
+		log.Printf("✅ Pruning peerstore entries of peers disconnected for %s", p.after)
+	}
+	return p
+}
+
+func (p *peerstorePruner) run(ctx context.Context) {
+	t := time.NewTicker(min(peerstorePruneInterval, p.after))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			p.sweep(time.Now())
+		}
+	}
+}
+
+func (p *peerstorePruner) sweep(now time.Time) {
+	ps := p.h.Peerstore()
+	peers := ps.Peers()
+	away := make(map[peer.ID]time.Time, len(p.away))
+	n := 0
+	for _, id := range peers {
+		if p.keep[id] || p.h.Network().Connectedness(id) == network.Connected {
+			continue
+		}
+		since, ok := p.away[id]
+		if !ok {
+			since = now
+		}
+		if now.Sub(since) < p.after {
+			away[id] = since
+			continue
+		}
+		ps.RemovePeer(id)
+		ps.ClearAddrs(id)
+		n++
+	}
+	p.away = away
+	if n > 0 {
+		p.pruned.Add(int64(n))
+		log.Printf("event=peerstore_pruned peers=%d remaining=%d", n, len(peers)-n)
+	}
+}
+
+// size is the number of peers the peerstore holds anything for.
+func (p *peerstorePruner) size() int {
+	return len(p.h.Peerstore().Peers())
+}
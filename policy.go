@@ -0,0 +1,70 @@
+// policy.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// === Operator policy document (RELAY_POLICY_FILE) ===
+// Free-form JSON (contact, acceptable use, bandwidth, rate limits) served on
+// /policy for clients and relay directories. Cached; re-read on SIGHUP.
+type policyDoc struct {
+	path string
+
+	mu   sync.RWMutex
+	body []byte
+}
+
+func newPolicyDoc(path string) (*policyDoc, error) {
+	p := &policyDoc{path: path}
+	if path == "" {
+		return p, nil
+	}
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *policyDoc) load() error {
+	b, err := os.ReadFile(p.path)
+	if err != nil {
+		return fmt.Errorf("read policy: %w", err)
+	}
+	if !json.Valid(b) {
+		return fmt.Errorf("policy %s is not valid JSON", p.path)
+	}
+	p.mu.Lock()
+	p.body = b
+	p.mu.Unlock()
+	return nil
+}
+
+// reload keeps the previous document if the file is now broken.
+func (p *policyDoc) reload() {
+	if p.path == "" {
+		return
+	}
+	if err := p.load(); err != nil {
+		log.Printf("⚠️ Policy reload failed, keeping previous document: %v", err)
+		return
+	}
+	log.Printf("✅ Policy reloaded from %s", p.path)
+}
+
+func (p *policyDoc) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	p.mu.RLock()
+	body := p.body
+	p.mu.RUnlock()
+
+	if body == nil {
+		writeError(w, http.StatusNotFound, "no policy published (set RELAY_POLICY_FILE)")
+		return
+	}
+	writeJSON(w, http.StatusOK, json.RawMessage(body))
+}
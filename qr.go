@@ -0,0 +1,42 @@
+// qr.go
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// === /qr: advertised multiaddr as a PNG QR code ===
+// Size in pixels from ?size=, else QR_SIZE.
+const (
+	qrMinSize = 64
+	qrMaxSize = 1024
+)
+
+func (s *statusServer) handleQR(w http.ResponseWriter, r *http.Request) {
+	if s.nodes[0].publicMultiaddr() == "" {
+		writeError(w, http.StatusNotFound, "no public hostname set")
+		return
+	}
+
+	size := s.cfg.QRSize
+	if v := r.URL.Query().Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < qrMinSize || n > qrMaxSize {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("size must be %d-%d", qrMinSize, qrMaxSize))
+			return
+		}
+		size = n
+	}
+
+	png, err := qrcode.Encode(s.nodes[0].publicMultiaddr(), qrcode.Medium, size)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	_, _ = w.Write(png)
+}
@@ -0,0 +1,78 @@
+// ratelimit.go
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Per-peer reservation rate limit (RESERVE_RATE_LIMIT) ===
+// Counts RESERVE requests per peer in a one-minute window. A peer going over
+// the limit is refused until a full minute has passed since it tripped.
+const reserveWindow = time.Minute
+
+type reserveCount struct {
+	windowStart  time.Time
+	count        int
+	blockedUntil time.Time
+}
+
+type reserveLimiter struct {
+	perMinute int
+
+	mu        sync.Mutex
+	peers     map[peer.ID]*reserveCount
+	lastSweep time.Time
+}
+
+func newReserveLimiter(perMinute int) *reserveLimiter {
+	return &reserveLimiter{perMinute: perMinute, peers: make(map[peer.ID]*reserveCount)}
+}
+
+// allow records one reservation attempt from p.
+func (l *reserveLimiter) allow(p peer.ID) bool {
+	if l.perMinute <= 0 {
+		return true
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	c, ok := l.peers[p]
+	if !ok {
+		c = &reserveCount{windowStart: now}
+		l.peers[p] = c
+	}
+	if now.Before(c.blockedUntil) {
+		return false
+	}
+	if now.Sub(c.windowStart) >= reserveWindow {
+		c.windowStart, c.count = now, 0
+	}
+	c.count++
+	if c.count > l.perMinute {
+		c.blockedUntil = now.Add(reserveWindow)
+		log.Printf("⚠️ %s sent %d reservation requests within a minute (limit %d), refusing for %s",
+			p, c.count, l.perMinute, reserveWindow)
+		return false
+	}
+	return true
+}
+
+// sweep drops peers that have been quiet for a full window.
+func (l *reserveLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < reserveWindow {
+		return
+	}
+	l.lastSweep = now
+	for p, c := range l.peers {
+		if now.Sub(c.windowStart) >= reserveWindow && !now.Before(c.blockedUntil) {
+			delete(l.peers, p)
+		}
+	}
+}
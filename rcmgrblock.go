@@ -0,0 +1,54 @@
+// rcmgrblock.go
+package main
+
+import (
+	"time"
+
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+)
+
+// === Resource manager blocks (RCMGR_BLOCK_RESPONSE) ===
+// The circuit v2 relay attaches each hop stream to its resource manager
+// service and reserves memory for it before reading the request; when the
+// libp2p resource manager refuses either, the relay resets the stream
+// without an answer. That reset is the only one that comes before any of the
+// request was read, so hopStream.Reset recognises it and hands it here.
+//
+// The request is read (briefly) so the block can be logged as
+// event=rcmgr_blocked with its type and RESERVE blocks counted under
+// rcmgrBlockedReservations, apart from the relay's own refusals. With
+// RCMGR_BLOCK_RESPONSE=status (default) the client then gets a
+// RESOURCE_LIMIT_EXCEEDED status instead of a bare reset; reset keeps the
+// libp2p behaviour.
+const (
+	rcmgrBlockReadTimeout = 500 * time.Millisecond
+	hopMaxMessageSize     = 4096 // circuitv2 relay.maxMessageSize
+)
+
+func (rh *relayHost) rcmgrBlocked(s *hopStream) error {
+	typ := "unknown"
+	_ = s.Stream.SetReadDeadline(time.Now().Add(rcmgrBlockReadTimeout))
+	var msg pbv2.HopMessage
+	rd := util.NewDelimitedReader(s.Stream, hopMaxMessageSize)
+	defer rd.Close()
+	if err := rd.ReadMsg(&msg); err == nil {
+		typ = msg.GetType().String()
+		if msg.GetType() == pbv2.HopMessage_RESERVE {
+			rh.stats.rcmgrBlockedReservations.Add(1)
+		}
+	}
+	eventf("rcmgr_blocked", "⚠️ event=rcmgr_blocked type=%s peer=%s remote=%s response=%s", typ, s.Conn().RemotePeer(), s.Conn().RemoteMultiaddr(), rh.cfg.RcmgrBlockResponse)
+
+	if rh.cfg.RcmgrBlockResponse != "status" {
+		return s.Stream.Reset()
+	}
+	_ = s.Stream.SetWriteDeadline(time.Now().Add(time.Second))
+	if err := util.NewDelimitedWriter(s.Stream).WriteMsg(&pbv2.HopMessage{
+		Type:   pbv2.HopMessage_STATUS.Enum(),
+		Status: pbv2.Status_RESOURCE_LIMIT_EXCEEDED.Enum(),
+	}); err != nil {
+		return s.Stream.Reset()
+	}
+	return s.Stream.Close()
+}
@@ -0,0 +1,74 @@
+// rejections.go
+package main
+
+import (
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Connection rejections ===
+// Every path that turns a connection away logs one event=conn_rejected line
+// (subject to LOG_SAMPLING) with a reason from the list below and bumps its
+// counter (connRejections on /stats, conn_rejected.<reason> on StatsD).
+type rejectReason string
+
+const (
+	rejectAccessListAddr    rejectReason = "access_list_addr"   // remote IP denied or not allowed
+	rejectAccessListPeer    rejectReason = "access_list_peer"   // peer ID denied or not allowed
+	rejectGeoCountry        rejectReason = "geoip_country"      // country denied or not allowed
+	rejectGeoASN            rejectReason = "geoip_asn"          // ASN denied or not allowed
+	rejectDuplicateConn     rejectReason = "duplicate_conn"     // DEDUP_CONNS_PER_PEER=reject-new
+	rejectHandshakeTimeout  rejectReason = "handshake_timeout"  // CONN_HANDSHAKE_TIMEOUT passed
+	rejectTransportLimit    rejectReason = "transport_limit"    // TRANSPORT_CONN_LIMITS cap reached
+	rejectFlapping          rejectReason = "flapping"           // CHURN_MAX_CONNECTS exceeded, peer banned
+	rejectIdentifyOversized rejectReason = "identify_oversized" // IDENTIFY_MAX_* exceeded, peer disconnected
+	rejectReservingLimit    rejectReason = "reserving_limit"    // MAX_RESERVING_PEERS reached
+	rejectNonReservingLimit rejectReason = "nonreserving_limit" // MAX_NONRESERVING_PEERS reached, none to evict
+	rejectFDLimit           rejectReason = "fd_limit"           // FD_LIMIT_THRESHOLD of the descriptor limit reached
+	rejectCPUPressure       rejectReason = "cpu_pressure"       // CPU_ADMISSION_THRESHOLD reached
+)
+
+var rejectReasons = []rejectReason{
+	rejectAccessListAddr, rejectAccessListPeer, rejectGeoCountry, rejectGeoASN,
+	rejectDuplicateConn, rejectHandshakeTimeout, rejectTransportLimit, rejectFlapping,
+	rejectIdentifyOversized, rejectReservingLimit, rejectNonReservingLimit, rejectFDLimit,
+	rejectCPUPressure,
+}
+
+type rejectionCounts struct {
+	mu     sync.Mutex
+	counts map[rejectReason]int64
+}
+
+var connRejections = &rejectionCounts{counts: make(map[rejectReason]int64)}
+
+// reject logs and counts one refused connection. p may be empty when the
+// peer isn't known yet; detail is free text such as the resolved country.
+func (r *rejectionCounts) reject(reason rejectReason, remote ma.Multiaddr, p peer.ID, detail string) {
+	r.mu.Lock()
+	r.counts[reason]++
+	r.mu.Unlock()
+
+	peerStr := "-"
+	if p != "" {
+		peerStr = p.String()
+	}
+	if detail == "" {
+		eventf("conn_rejected", "event=conn_rejected reason=%s remote=%s peer=%s", reason, remote, peerStr)
+		return
+	}
+	eventf("conn_rejected", "event=conn_rejected reason=%s remote=%s peer=%s detail=%q", reason, remote, peerStr, detail)
+}
+
+// snapshot returns a count for every reason, zeros included.
+func (r *rejectionCounts) snapshot() map[rejectReason]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[rejectReason]int64, len(rejectReasons))
+	for _, reason := range rejectReasons {
+		out[reason] = r.counts[reason]
+	}
+	return out
+}
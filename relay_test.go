@@ -0,0 +1,186 @@
+// relay_test.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === In-process relay harness ===
+// A relay node on a free loopback port, built and started the way main does,
+// and throwaway client hosts that reserve on it and dial each other through
+// it. Nothing leaves the machine, so the tests are safe to run in CI.
+const testEchoProto = protocol.ID("/torrentium-relay/test-echo/1.0.0")
+
+// newTestRelay starts a relay configured from env on top of the defaults.
+func newTestRelay(t testing.TB, env map[string]string) *relayNode {
+	t.Helper()
+	t.Setenv("WARMUP_PERIOD", "0s")
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	access, err := newAccessWatcher("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	geo, err := newGeoFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := freePort("tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := newRelayNode(cfg, access, geo, "primary", priv, strconv.Itoa(port), "", "")
+	if err != nil {
+		t.Fatalf("newRelayNode: %v", err)
+	}
+	t.Cleanup(func() { _ = n.h.Close() })
+	if err := n.startRelay(cfg); err != nil {
+		t.Fatalf("startRelay: %v", err)
+	}
+	return n
+}
+
+// testRelayInfo is how clients dial n: its WebSocket listener on loopback.
+func testRelayInfo(t testing.TB, n *relayNode) peer.AddrInfo {
+	t.Helper()
+	for _, a := range n.h.Network().ListenAddresses() {
+		if port, err := a.ValueForProtocol(ma.P_TCP); err == nil {
+			return peer.AddrInfo{ID: n.h.ID(), Addrs: []ma.Multiaddr{ma.StringCast("/ip4/127.0.0.1/tcp/" + port + "/ws")}}
+		}
+	}
+	t.Fatalf("relay has no TCP listener: %v", n.h.Network().ListenAddresses())
+	return peer.AddrInfo{}
+}
+
+// newTestClient is a host connected to the relay that doesn't listen itself.
+func newTestClient(t testing.TB, n *relayNode) host.Host {
+	t.Helper()
+	h, err := libp2p.New(libp2p.NoListenAddrs, libp2p.EnableRelay())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = h.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := h.Connect(ctx, testRelayInfo(t, n)); err != nil {
+		t.Fatalf("connect to relay: %v", err)
+	}
+	return h
+}
+
+// reserveTestClient reserves a slot for h and has it echo testEchoProto.
+func reserveTestClient(t testing.TB, n *relayNode, h host.Host) *client.Reservation {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rsvp, err := client.Reserve(ctx, h, testRelayInfo(t, n))
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	h.SetStreamHandler(testEchoProto, func(s network.Stream) {
+		defer s.Close()
+		_, _ = io.Copy(s, s)
+	})
+	return rsvp
+}
+
+// openTestCircuit opens an echo stream from src to dst through the relay.
+func openTestCircuit(t testing.TB, n *relayNode, src, dst host.Host) network.Stream {
+	t.Helper()
+	circ := ma.StringCast(fmt.Sprintf("/p2p/%s/p2p-circuit/p2p/%s", n.h.ID(), dst.ID()))
+	src.Peerstore().AddAddr(dst.ID(), circ, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s, err := src.NewStream(network.WithAllowLimitedConn(ctx, "test"), dst.ID(), testEchoProto)
+	if err != nil {
+		t.Fatalf("open circuit: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Reset() })
+	_ = s.SetDeadline(time.Now().Add(10 * time.Second))
+	return s
+}
+
+func TestRelayCircuitEndToEnd(t *testing.T) {
+	n := newTestRelay(t, nil)
+	src, dst := newTestClient(t, n), newTestClient(t, n)
+	reserveTestClient(t, n, dst)
+	if !n.reservations.has(dst.ID()) {
+		t.Fatalf("relay doesn't track the reservation of %s", dst.ID())
+	}
+
+	s := openTestCircuit(t, n, src, dst)
+	payload := make([]byte, 4096)
+	_, _ = rand.Read(payload)
+	if _, err := s.Write(payload); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = s.CloseWrite()
+	echo, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(echo, payload) {
+		t.Fatalf("echo: got %d bytes back, want the %d sent", len(echo), len(payload))
+	}
+	if got := n.rh.stats.snapshot().CircuitsOpened; got != 1 {
+		t.Errorf("circuitsOpened = %d, want 1", got)
+	}
+}
+
+// BenchmarkReserve measures RESERVE throughput: every parallel worker holds
+// one client and keeps refreshing its reservation.
+func BenchmarkReserve(b *testing.B) {
+	n := newTestRelay(b, map[string]string{
+		"RESERVE_RATE_LIMIT":       "0",
+		"MAX_RESERVATIONS":         "4096",
+		"MAX_RESERVATIONS_PER_IP":  "4096",
+		"MAX_RESERVATIONS_PER_ASN": "4096",
+	})
+	info := testRelayInfo(b, n)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		// Workers run off the benchmark goroutine, where b.Fatal isn't allowed.
+		h, err := libp2p.New(libp2p.NoListenAddrs, libp2p.EnableRelay())
+		if err != nil {
+			b.Error(err)
+			return
+		}
+		defer h.Close()
+		ctx := context.Background()
+		if err := h.Connect(ctx, info); err != nil {
+			b.Errorf("connect to relay: %v", err)
+			return
+		}
+		for pb.Next() {
+			if _, err := client.Reserve(ctx, h, info); err != nil {
+				b.Errorf("reserve: %v", err)
+				return
+			}
+		}
+	})
+}
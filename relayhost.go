@@ -0,0 +1,686 @@
+// relayhost.go
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/record"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-varint"
+	pb "google.golang.org/protobuf/proto"
+)
+
+// === Relay host wrapper ===
+// relayHost is the host handed to relay.New. It lets us see (and adjust) the
+// hop protocol responses without forking the circuit v2 relay.
+type relayHost struct {
+	host.Host
+	cfg *relayConfig
+
+	stats     *relayStats
+	circuits  *circuitTracker
+	hops      *hopLimiter
+	reserves  *reserveProcLimiter
+	stopDials *stopDialLimiter
+	srcDials  *sourceDialLimiter
+	dests     *destCircuits
+	buffers   *circuitBuffers
+	bandwidth *bandwidthScheduler
+	denied    *deniedDests
+	access    *accessWatcher
+	dials     *dialThrottle
+	observers []func(hopEvent)
+	peerDebug *peerDebug // DEBUG_PEER_IDS
+	sessions  *sessionTracker
+
+	connectivity *connectivity
+
+	limitWarned   atomic.Bool
+	voucherWarned atomic.Bool
+}
+
+// hopEvent describes one handled hop request (RESERVE or CONNECT), emitted
+// when the relay writes its STATUS response.
+type hopEvent struct {
+	Type   pbv2.HopMessage_Type
+	Peer   peer.ID
+	Addr   ma.Multiaddr
+	Dest   peer.ID // CONNECT only
+	Status pbv2.Status
+	Expire time.Time // granted reservations only
+	Start  time.Time
+	Tier   string // OK responses only
+}
+
+// onHop registers fn to be called for every handled hop request. Observers
+// run on the relay's stream goroutine, so they must not block.
+func (rh *relayHost) onHop(fn func(hopEvent)) {
+	rh.observers = append(rh.observers, fn)
+}
+
+func newRelayHost(h host.Host, cfg *relayConfig, access *accessWatcher) *relayHost {
+	stats := &relayStats{}
+	return &relayHost{
+		Host:      h,
+		cfg:       cfg,
+		access:    access,
+		denied:    newDeniedDests(),
+		stats:     stats,
+		circuits:  newCircuitTracker(cfg, stats),
+		hops:      newHopLimiter(cfg, stats),
+		reserves:  newReserveProcLimiter(cfg, stats),
+		stopDials: newStopDialLimiter(cfg, stats),
+		srcDials:  newSourceDialLimiter(cfg, stats),
+		dests:     newDestCircuits(cfg, stats),
+		buffers:   newCircuitBuffers(cfg),
+		bandwidth: newBandwidthScheduler(cfg),
+		dials:     newDialThrottle(cfg),
+	}
+}
+
+func (rh *relayHost) SetStreamHandler(pid protocol.ID, handler network.StreamHandler) {
+	if pid == proto.ProtoIDv2Hop {
+		inner := handler
+		handler = func(s network.Stream) {
+			start := time.Now()
+			if !rh.hops.acquire(s) {
+				return
+			}
+			defer rh.hops.release()
+			hs := &hopStream{Stream: s, rh: rh, start: start}
+			defer hs.releaseReserve()
+			defer hs.releaseConnect()
+			inner(hs)
+		}
+	}
+	rh.Host.SetStreamHandler(pid, handler)
+}
+
+// NewStream wraps the relay's stop streams to the destination so trims of
+// their connection are noticed and the stop handshake is bounded by
+// STOP_TIMEOUT rather than the relay's built-in 30s open / 1m handshake.
+func (rh *relayHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (network.Stream, error) {
+	if !slices.Contains(pids, proto.ProtoIDv2Stop) {
+		return rh.Host.NewStream(ctx, p, pids...)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, rh.cfg.stopTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := rh.denied.check(rh.access, p); err != nil {
+		return nil, err
+	}
+	if err := rh.dests.acquire(p); err != nil {
+		return nil, err
+	}
+	if err := rh.buffers.acquire(p); err != nil {
+		rh.dests.release(p)
+		return nil, err
+	}
+	release := func() {
+		rh.buffers.release()
+		rh.dests.release(p)
+	}
+	if err := rh.stopDials.acquire(ctx, p); err != nil {
+		release()
+		return nil, err
+	}
+	dialing := rh.Network().Connectedness(p) != network.Connected
+	if dialing {
+		if err := rh.dials.acquire(ctx, p); err != nil {
+			rh.stopDials.release()
+			release()
+			return nil, err
+		}
+	}
+	s, err := rh.Host.NewStream(ctx, p, pids...)
+	if dialing {
+		rh.dials.release()
+		if err != nil && rh.Network().Connectedness(p) != network.Connected {
+			rh.connectivity.dialFailed(p, err)
+		}
+	}
+	rh.stopDials.release()
+	logSlow("stop_stream_open", time.Since(start), p.String())
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("⚠️ Stop stream to %s not opened within %s, failing the circuit", p, rh.cfg.stopTimeout)
+		}
+		release()
+		return nil, err
+	}
+	return &stopStream{Stream: s, rh: rh, dest: p}, nil
+}
+
+// === Circuit protection ===
+// The relay only tags circuit peers, which a trim can still outweigh, so both
+// ends are protected while the circuit is open and for CIRCUIT_CLOSE_GRACE
+// after (a closed circuit is often followed by another in the same burst).
+func (rh *relayHost) protectCircuit(c *circuit) {
+	cm := rh.ConnManager()
+	cm.Protect(c.src, c.tag())
+	cm.Protect(c.dst, c.tag())
+}
+
+func (rh *relayHost) releaseCircuit(c *circuit) {
+	rh.circuits.remove(c)
+	rh.peerDebug.circuitClosed(c)
+	rh.sessions.circuitClosed(c)
+	release := func() {
+		cm := rh.ConnManager()
+		cm.Unprotect(c.src, c.tag())
+		cm.Unprotect(c.dst, c.tag())
+	}
+	if rh.cfg.circuitGrace <= 0 {
+		release()
+		return
+	}
+	time.AfterFunc(rh.cfg.circuitGrace, release)
+}
+
+// checkTrimmed logs a relayed stream that died because the conn manager
+// garbage-collected a connection we had protected.
+func (rh *relayHost) checkTrimmed(err error, p peer.ID) {
+	var ce *network.ConnError
+	if !errors.As(err, &ce) || ce.Remote || ce.ErrorCode != network.ConnGarbageCollected {
+		return
+	}
+	if rh.ConnManager().IsProtected(p, "") {
+		log.Printf("⚠️ BUG: protected connection to %s was trimmed by the connection manager", p)
+	}
+}
+
+// adjustReservation rewrites a granted reservation before it goes out.
+// Returns false when the message should be sent untouched.
+func (rh *relayHost) adjustReservation(s network.Stream, rsvp *pbv2.Reservation) bool {
+	if !rh.cfg.ReservationTTLJitter || rsvp.Expire == nil {
+		return false
+	}
+
+	// The relay granted maxTTL; pick this reservation's TTL inside the band.
+	f := rh.cfg.JitterPercent / 100
+	granted := time.Duration(float64(rh.cfg.baseTTL) * (1 + f*(2*rand.Float64()-1)))
+	expire := time.Unix(int64(rsvp.GetExpire()), 0).Add(granted - rh.cfg.maxTTL())
+
+	p := s.Conn().RemotePeer()
+	envelope, err := record.Seal(&proto.ReservationVoucher{
+		Relay:      rh.ID(),
+		Peer:       p,
+		Expiration: expire,
+	}, rh.Peerstore().PrivKey(rh.ID()))
+	if err != nil {
+		log.Printf("reservation jitter: seal voucher for %s failed: %v", p, err)
+		return false
+	}
+	voucher, err := envelope.Marshal()
+	if err != nil {
+		log.Printf("reservation jitter: marshal voucher for %s failed: %v", p, err)
+		return false
+	}
+
+	expireUnix := uint64(expire.Unix())
+	rsvp.Expire = &expireUnix
+	rsvp.Voucher = voucher
+	return true
+}
+
+// checkLimit warns (once) if the limit the relay advertises in an OK STATUS
+// response ever drifts from the configured Resources.
+func (rh *relayHost) checkLimit(l *pbv2.Limit) {
+	want := rh.cfg.relayResources().Limit
+	var ok bool
+	if want == nil {
+		ok = l == nil
+	} else {
+		ok = l != nil && time.Duration(l.GetDuration())*time.Second == want.Duration && int64(l.GetData()) == want.Data
+	}
+	if !ok && rh.limitWarned.CompareAndSwap(false, true) {
+		log.Printf("⚠️ Relay advertised limit %v, configured %+v", l, want)
+	}
+}
+
+// checkVoucher handles the voucher in an OK RESERVE response: it is stripped
+// when RESERVATION_VOUCHERS is off, otherwise verified (warning once) to be a
+// ReservationVoucher for p that verifies against the relay's own peer ID, and
+// with LOG_VOUCHERS logged as sent. Returns true if rsvp was modified.
+func (rh *relayHost) checkVoucher(p peer.ID, rsvp *pbv2.Reservation) bool {
+	if !rh.cfg.ReservationVouchers {
+		changed := rsvp.Voucher != nil
+		rsvp.Voucher = nil
+		return changed
+	}
+
+	v, err := verifyVoucher(rsvp.GetVoucher(), rh.ID(), p)
+	if err != nil && rh.voucherWarned.CompareAndSwap(false, true) {
+		log.Printf("⚠️ BUG: reservation voucher for %s does not verify: %v", p, err)
+	}
+	if err == nil && rh.cfg.LogVouchers {
+		log.Printf("event=voucher_issued relay=%s peer=%s expire=%s fingerprint=%s",
+			v.Relay, v.Peer, v.Expiration.UTC().Format(time.RFC3339), voucherFingerprint(rsvp.GetVoucher()))
+	}
+	return false
+}
+
+// verifyVoucher is what a third party does with a voucher a client shows it:
+// open the envelope, check it was signed by the relay's key and names the
+// client.
+func verifyVoucher(b []byte, relayID, p peer.ID) (*proto.ReservationVoucher, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("no voucher")
+	}
+	env, rec, err := record.ConsumeEnvelope(b, proto.RecordDomain)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := rec.(*proto.ReservationVoucher)
+	if !ok {
+		return nil, fmt.Errorf("unexpected record type %T", rec)
+	}
+	if !relayID.MatchesPublicKey(env.PublicKey) {
+		return nil, fmt.Errorf("signed by a key other than %s", relayID)
+	}
+	if v.Relay != relayID || v.Peer != p {
+		return nil, fmt.Errorf("voucher is for relay %s / peer %s", v.Relay, v.Peer)
+	}
+	return v, nil
+}
+
+// voucherFingerprint identifies a voucher by the first 8 bytes of the SHA-256
+// of its wire bytes, which a client can compute over the voucher it received.
+func voucherFingerprint(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// hopStream intercepts the first message on a hop stream in each direction:
+// the peer's request on the way in and the relay's STATUS response on the way
+// out. Everything after (relayed circuit data) passes through.
+type hopStream struct {
+	network.Stream
+	rh    *relayHost
+	start time.Time
+
+	req      []byte
+	request  *pbv2.HopMessage
+	readDone bool
+
+	// reserving is set while a RESERVE holds a reserves slot; reserveBusy
+	// when it got none, so the relay's error response becomes
+	// RESOURCE_LIMIT_EXCEEDED. connecting and connectBusy are the same for a
+	// CONNECT and its source's srcDials slot, held until the response.
+	reserving   bool
+	reserveBusy bool
+	connecting  bool
+	connectBusy bool
+
+	pending []byte
+	done    bool
+
+	tier      *limitTier
+	circ      *circuit
+	limitT    *time.Timer
+	closeOnce sync.Once
+}
+
+func (s *hopStream) Read(b []byte) (int, error) {
+	if s.circ != nil {
+		left := s.circ.remaining(true)
+		if left <= 0 {
+			return 0, s.limitReached()
+		}
+		b = b[:min(int64(len(b)), left)]
+	}
+	n, err := s.Stream.Read(b)
+	if s.readDone {
+		if s.circ != nil {
+			s.rh.bandwidth.wait(s.circ.priority, n)
+			if s.circ.sample != nil && n > 0 {
+				s.circ.sample.add(b[:n])
+			}
+			s.rh.circuits.record(s.circ, true, n)
+			s.rh.checkTrimmed(err, s.circ.src)
+		}
+		return n, err
+	}
+	if n == 0 {
+		return n, err
+	}
+
+	// The relay reads the varint byte by byte and then the exact body, so
+	// tee until one full message has gone by.
+	s.req = append(s.req, b[:n]...)
+	size, vn, verr := varint.FromUvarint(s.req)
+	if verr == varint.ErrUnderflow || (verr == nil && uint64(len(s.req)-vn) < size) {
+		return n, err
+	}
+	s.readDone = true
+	if verr == nil {
+		var msg pbv2.HopMessage
+		if pb.Unmarshal(s.req[vn:vn+int(size)], &msg) == nil {
+			s.request = &msg
+		}
+	}
+	s.req = nil
+	if s.request.GetType() == pbv2.HopMessage_RESERVE {
+		if !s.rh.reserves.acquire(s.Conn().RemotePeer()) {
+			s.reserveBusy = true
+			return 0, errReserveBusy
+		}
+		s.reserving = true
+	}
+	if s.request.GetType() == pbv2.HopMessage_CONNECT {
+		if !s.rh.srcDials.acquire(s.Conn().RemotePeer()) {
+			s.connectBusy = true
+			return 0, errSourceDialBusy
+		}
+		s.connecting = true
+	}
+	return n, err
+}
+
+func (s *hopStream) releaseReserve() {
+	if s.reserving {
+		s.reserving = false
+		s.rh.reserves.release()
+	}
+}
+
+func (s *hopStream) releaseConnect() {
+	if s.connecting {
+		s.connecting = false
+		s.rh.srcDials.release(s.Conn().RemotePeer())
+	}
+}
+
+func (s *hopStream) Write(b []byte) (int, error) {
+	if s.done {
+		var cut bool
+		if s.circ != nil {
+			left := s.circ.remaining(false)
+			if left <= 0 {
+				return 0, s.limitReached()
+			}
+			if int64(len(b)) > left {
+				b, cut = b[:left], true
+			}
+			s.rh.bandwidth.wait(s.circ.priority, len(b))
+		}
+		n, err := s.Stream.Write(b)
+		if s.circ != nil {
+			if s.circ.sample != nil && n > 0 {
+				s.circ.sample.add(b[:n])
+			}
+			s.rh.circuits.record(s.circ, false, n)
+			s.rh.checkTrimmed(err, s.circ.src)
+		}
+		if cut && err == nil {
+			err = s.limitReached()
+		}
+		return n, err
+	}
+
+	// pbio writes the varint length and the message body as separate calls,
+	// so hold writes back until the whole first message is here.
+	s.pending = append(s.pending, b...)
+	size, n, err := varint.FromUvarint(s.pending)
+	if err == varint.ErrUnderflow || (err == nil && uint64(len(s.pending)-n) < size) {
+		return len(b), nil
+	}
+	s.done = true
+
+	out := s.pending
+	s.pending = nil
+	if err == nil {
+		out = s.rewrite(out[n:n+int(size)], out[n+int(size):], out)
+	}
+	s.releaseConnect()
+	if _, err := s.Stream.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// rewrite returns the bytes to put on the wire for the first hop message.
+func (s *hopStream) rewrite(body, rest, orig []byte) []byte {
+	var msg pbv2.HopMessage
+	if err := pb.Unmarshal(body, &msg); err != nil || msg.GetType() != pbv2.HopMessage_STATUS {
+		return orig
+	}
+
+	var adjusted bool
+	if s.reserveBusy || s.connectBusy {
+		msg.Status = pbv2.Status_RESOURCE_LIMIT_EXCEEDED.Enum()
+		adjusted = true
+	}
+	if msg.GetStatus() == pbv2.Status_OK {
+		s.rh.checkLimit(msg.GetLimit())
+		adjusted = s.applyTier(&msg)
+	}
+	if msg.Reservation != nil && s.rh.adjustReservation(s.Stream, msg.Reservation) {
+		adjusted = true
+	}
+	if msg.Reservation != nil && s.rh.checkVoucher(s.Conn().RemotePeer(), msg.Reservation) {
+		adjusted = true
+	}
+	s.notify(&msg)
+	if !adjusted {
+		return orig
+	}
+
+	out, err := pb.Marshal(&msg)
+	if err != nil {
+		return orig
+	}
+	return append(append(varint.ToUvarint(uint64(len(out))), out...), rest...)
+}
+
+// applyTier picks the tier of the reservation holder (the requester for
+// RESERVE, the destination for CONNECT) and advertises its limit in place of
+// the relay-wide ceiling. Returns true if msg was modified.
+func (s *hopStream) applyTier(msg *pbv2.HopMessage) bool {
+	if s.request == nil {
+		return false
+	}
+	holder := s.Conn().RemotePeer()
+	if s.request.GetType() == pbv2.HopMessage_CONNECT {
+		holder, _ = peer.IDFromBytes(s.request.GetPeer().GetId())
+	}
+	s.tier = s.rh.cfg.tierFor(holder)
+	if msg.Limit == nil || (time.Duration(msg.Limit.GetDuration())*time.Second == s.tier.limit.Duration &&
+		int64(msg.Limit.GetData()) == s.tier.limit.Data) {
+		return false
+	}
+	secs, data := uint32(s.tier.limit.Duration/time.Second), uint64(s.tier.limit.Data)
+	msg.Limit = &pbv2.Limit{Duration: &secs, Data: &data}
+	return true
+}
+
+// limitReached resets a circuit that used up its tier's data or time.
+func (s *hopStream) limitReached() error {
+	if s.circ.limitData < s.circ.advertisedData && (s.circ.remaining(true) <= 0 || s.circ.remaining(false) <= 0) {
+		s.rh.circuits.enforcedLimitHit(s.circ, s.circ.limitData)
+	}
+	eventf("circuit_limit", "event=circuit_limit id=%d src=%s dst=%s tier=%s", s.circ.id, s.circ.src, s.circ.dst, s.circ.tier)
+	_ = s.Reset()
+	return network.ErrReset
+}
+
+func (s *hopStream) Close() error {
+	s.closeCircuit()
+	return s.Stream.Close()
+}
+
+func (s *hopStream) Reset() error {
+	s.closeCircuit()
+	if !s.readDone && len(s.req) == 0 && !s.done {
+		return s.rh.rcmgrBlocked(s)
+	}
+	return s.Stream.Reset()
+}
+
+func (s *hopStream) closeCircuit() {
+	s.closeOnce.Do(func() {
+		if s.limitT != nil {
+			s.limitT.Stop()
+		}
+		if s.circ != nil {
+			s.rh.releaseCircuit(s.circ)
+		}
+	})
+}
+
+func (s *hopStream) notify(resp *pbv2.HopMessage) {
+	if s.request == nil {
+		return
+	}
+
+	ev := hopEvent{
+		Type:   s.request.GetType(),
+		Peer:   s.Conn().RemotePeer(),
+		Addr:   s.Conn().RemoteMultiaddr(),
+		Status: resp.GetStatus(),
+		Start:  s.start,
+	}
+	if s.request.GetType() == pbv2.HopMessage_CONNECT {
+		ev.Dest, _ = peer.IDFromBytes(s.request.GetPeer().GetId())
+		if ev.Status == pbv2.Status_OK && s.tier != nil {
+			s.circ = s.rh.circuits.add(ev.Peer, ev.Dest, s.tier)
+			s.rh.sessions.circuitOpened(s.circ)
+			s.rh.protectCircuit(s.circ)
+			if d := s.tier.limit.Duration; d < s.rh.cfg.relayLimit().Duration {
+				s.limitT = time.AfterFunc(d, func() { _ = s.limitReached() })
+			}
+		}
+	}
+	if s.tier != nil {
+		ev.Tier = s.tier.Name
+	}
+	if rsvp := resp.GetReservation(); rsvp != nil {
+		ev.Expire = time.Unix(int64(rsvp.GetExpire()), 0)
+	}
+	if ev.Type == pbv2.HopMessage_RESERVE {
+		logSlow("reservation", time.Since(ev.Start), ev.Peer.String())
+	} else {
+		logSlow("connect", time.Since(ev.Start), ev.Peer.String())
+	}
+	for _, fn := range s.rh.observers {
+		fn(ev)
+	}
+}
+
+// stopStream is the relay's stream to a circuit's destination.
+type stopStream struct {
+	network.Stream
+	rh   *relayHost
+	dest peer.ID
+
+	// handshake is true while the relay has a deadline set for the stop
+	// handshake; it clears the deadline once the destination answered.
+	handshake atomic.Bool
+	logged    atomic.Bool
+	released  atomic.Bool
+}
+
+// Close and Reset end the circuit: the relay calls one of them on every
+// stop stream it opened. Its DEST_MAX_CIRCUITS slot and buffer accounting
+// are freed once.
+func (s *stopStream) Close() error {
+	s.release()
+	return s.Stream.Close()
+}
+
+func (s *stopStream) Reset() error {
+	s.release()
+	return s.Stream.Reset()
+}
+
+func (s *stopStream) release() {
+	if s.released.CompareAndSwap(false, true) {
+		s.rh.buffers.release()
+		s.rh.dests.release(s.dest)
+	}
+}
+
+func (s *stopStream) SetDeadline(t time.Time) error {
+	s.handshake.Store(!t.IsZero())
+	if limit := time.Now().Add(s.rh.cfg.stopTimeout); !t.IsZero() && t.After(limit) {
+		t = limit
+	}
+	return s.Stream.SetDeadline(t)
+}
+
+func (s *stopStream) Read(b []byte) (int, error) {
+	n, err := s.Stream.Read(b)
+	s.check(err)
+	return n, err
+}
+
+func (s *stopStream) Write(b []byte) (int, error) {
+	n, err := s.Stream.Write(b)
+	s.check(err)
+	return n, err
+}
+
+func (s *stopStream) check(err error) {
+	if err == nil {
+		return
+	}
+	p := s.Conn().RemotePeer()
+	s.rh.checkTrimmed(err, p)
+	var ne net.Error
+	if s.handshake.Load() && errors.As(err, &ne) && ne.Timeout() && s.logged.CompareAndSwap(false, true) {
+		log.Printf("⚠️ Stop handshake with %s timed out after %s, failing the circuit", p, s.rh.cfg.stopTimeout)
+	}
+}
+
+// transportName names the transport a connection came in over, e.g. "wss".
+func transportName(a ma.Multiaddr) string {
+	if a == nil {
+		return "unknown"
+	}
+	secure := false
+	name := "unknown"
+	for _, c := range a {
+		switch c.Protocol().Code {
+		case ma.P_CIRCUIT:
+			return "relay"
+		case ma.P_WEBTRANSPORT:
+			return "webtransport"
+		case ma.P_WEBRTC_DIRECT:
+			return "webrtc-direct"
+		case ma.P_TLS:
+			secure = true
+		case ma.P_WSS:
+			name = "wss"
+		case ma.P_WS:
+			name = "ws"
+			if secure {
+				name = "wss"
+			}
+		case ma.P_QUIC_V1:
+			name = "quic-v1"
+		case ma.P_TCP:
+			if name == "unknown" {
+				name = "tcp"
+			}
+		}
+	}
+	return name
+}
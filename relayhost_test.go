@@ -0,0 +1,156 @@
+// relayhost_test.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/util"
+)
+
+// TestReserveAdvertisesConfiguredLimit checks the limit a RESERVE response
+// carries against the configured Resources. Under the renewal data window
+// Resources lift the data cut-off, and the per-window limit is advertised.
+func TestReserveAdvertisesConfiguredLimit(t *testing.T) {
+	for _, window := range []string{dataWindowCumulative, dataWindowRenewal} {
+		t.Run(window, func(t *testing.T) {
+			n := newTestRelay(t, map[string]string{
+				"RELAY_LIMIT_DURATION": "3m",
+				"RELAY_LIMIT_DATA":     "4194304",
+				"CIRCUIT_DATA_WINDOW":  window,
+			})
+			rsvp := reserveTestClient(t, n, newTestClient(t, n))
+
+			want := n.cfg.relayResources().Limit
+			if want == nil {
+				t.Fatal("configured Resources carry no limit")
+			}
+			if want.Duration != 3*time.Minute {
+				t.Fatalf("configured duration = %s, want 3m (RELAY_LIMIT_DURATION)", want.Duration)
+			}
+			if rsvp.LimitDuration != want.Duration {
+				t.Errorf("advertised duration = %s, configured %s", rsvp.LimitDuration, want.Duration)
+			}
+			wantData := want.Data
+			if window == dataWindowRenewal {
+				wantData = n.cfg.relayLimit().Data
+			}
+			if int64(rsvp.LimitData) != wantData {
+				t.Errorf("advertised data = %d, configured %d", rsvp.LimitData, wantData)
+			}
+		})
+	}
+}
+
+// TestReserveVoucherVerifies reserves over a raw hop stream, so the voucher
+// is taken as the wire bytes of the rewritten response, and opens it the
+// way a third party would.
+func TestReserveVoucherVerifies(t *testing.T) {
+	n := newTestRelay(t, map[string]string{"RESERVATION_VOUCHERS": "true"})
+	h, other := newTestClient(t, n), newTestClient(t, n)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s, err := h.NewStream(ctx, n.h.ID(), proto.ProtoIDv2Hop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	_ = s.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := util.NewDelimitedWriter(s).WriteMsg(&pbv2.HopMessage{Type: pbv2.HopMessage_RESERVE.Enum()}); err != nil {
+		t.Fatal(err)
+	}
+	var msg pbv2.HopMessage
+	if err := util.NewDelimitedReader(s, 4096).ReadMsg(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.GetStatus() != pbv2.Status_OK {
+		t.Fatalf("RESERVE status = %s", msg.GetStatus())
+	}
+	b := msg.GetReservation().GetVoucher()
+
+	env, rec, err := record.ConsumeEnvelope(b, proto.RecordDomain)
+	if err != nil {
+		t.Fatalf("ConsumeEnvelope: %v", err)
+	}
+	if !env.PublicKey.Equals(n.h.Peerstore().PubKey(n.h.ID())) {
+		t.Fatal("voucher not signed by the relay's key")
+	}
+	if v, ok := rec.(*proto.ReservationVoucher); !ok || v.Relay != n.h.ID() || v.Peer != h.ID() {
+		t.Fatalf("voucher record = %+v, want relay %s / peer %s", rec, n.h.ID(), h.ID())
+	}
+	if _, err := verifyVoucher(b, n.h.ID(), h.ID()); err != nil {
+		t.Fatalf("verifyVoucher: %v", err)
+	}
+	if _, err := verifyVoucher(b, n.h.ID(), other.ID()); err == nil {
+		t.Fatal("verifyVoucher accepted the voucher for another peer")
+	}
+}
+
+// TestTrimKeepsCircuitPeers forces a conn manager trim with a circuit open:
+// the relay's connections to both circuit ends survive it while idle peers
+// are trimmed.
+func TestTrimKeepsCircuitPeers(t *testing.T) {
+	// Trims close unprotected conns down to low water (1, as 0 disables it).
+	cm, err := connmgr.NewConnManager(1, 2, connmgr.WithGracePeriod(time.Millisecond), connmgr.WithSilencePeriod(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := extraHostOptions
+	extraHostOptions = []libp2p.Option{libp2p.ConnectionManager(cm)}
+	t.Cleanup(func() { extraHostOptions = prev })
+
+	n := newTestRelay(t, nil)
+	src, dst := newTestClient(t, n), newTestClient(t, n)
+	var idle []peer.ID
+	for range 3 {
+		idle = append(idle, newTestClient(t, n).ID())
+	}
+	reserveTestClient(t, n, dst)
+	s := openTestCircuit(t, n, src, dst)
+	echo := func(msg string) {
+		t.Helper()
+		buf := make([]byte, len(msg))
+		if _, err := s.Write([]byte(msg)); err != nil {
+			t.Fatalf("circuit write: %v", err)
+		}
+		if _, err := io.ReadFull(s, buf); err != nil || !bytes.Equal(buf, []byte(msg)) {
+			t.Fatalf("circuit echo: %q, %v", buf, err)
+		}
+	}
+	echo("ping")
+
+	time.Sleep(10 * time.Millisecond) // past the grace period
+	n.h.ConnManager().TrimOpenConns(context.Background())
+
+	if n.h.Network().Connectedness(src.ID()) != network.Connected {
+		t.Error("relay connection to the circuit source was trimmed")
+	}
+	if n.h.Network().Connectedness(dst.ID()) != network.Connected {
+		t.Error("relay connection to the circuit destination was trimmed")
+	}
+	trimmed := func() (k int) {
+		for _, p := range idle {
+			if n.h.Network().Connectedness(p) != network.Connected {
+				k++
+			}
+		}
+		return k
+	}
+	for deadline := time.Now().Add(5 * time.Second); trimmed() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("trim closed no idle peer; nothing was tested")
+		}
+	}
+	echo("pong")
+}
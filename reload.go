@@ -0,0 +1,24 @@
+// reload.go
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// === SIGHUP reload ===
+// onSIGHUP runs every fn, in order, each time the process gets SIGHUP.
+func onSIGHUP(fns ...func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			log.Println("SIGHUP received, reloading")
+			for _, fn := range fns {
+				fn()
+			}
+		}
+	}()
+}
@@ -0,0 +1,96 @@
+// renderenv.go
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	crypto "github.com/libp2p/go-libp2p/core/crypto"
+)
+
+// === Render env block (RENDER_ENV_SNIPPET, admin /render-env) ===
+// With RENDER_ENV_SNIPPET=true, admin GET /render-env returns a .env block to
+// paste into the Render service (Environment, "Add from .env"), so a freshly
+// generated identity and sane limits get there without copying values one by
+// one:
+//
+//	# torrentium-relay env for peer 12D3KooW..., generated 2025-01-01T00:00:00Z
+//	RELAY_PRIVATE_KEY_B64=CAESQ...
+//	# recommended
+//	HOP_MAX_CONCURRENT=64
+//
+// It carries the running key, then renderEnvLimits: those the relay was
+// started with keep their current value, the rest get the recommended one,
+// each group under its own comment. ADMIN_TOKEN and the other secrets are never
+// echoed back. Like /key it holds the private key, so it is off by default,
+// admin-only, sent with no-store and logged on every export.
+type renderEnvVar struct {
+	name        string
+	recommended string
+}
+
+var renderEnvLimits = []renderEnvVar{
+	{"RESERVE_RATE_LIMIT", "10"},
+	{"HOP_MAX_CONCURRENT", "64"},
+	{"RESERVE_MAX_CONCURRENT", "16"},
+	{"STOP_DIAL_MAX_CONCURRENT", "32"},
+	{"DEST_MAX_CIRCUITS", "16"},
+	{"HTTP_MAX_CONNS", "256"},
+	{"CONN_HANDSHAKE_TIMEOUT", "15s"},
+	{"KEEPALIVE_PING_INTERVAL", "1m"},
+	{"RESERVATION_LIVENESS_INTERVAL", "2m"},
+	{"RESERVATION_IDLE_TIMEOUT", "30m"},
+	{"PRINT_GENERATED_KEY", "false"},
+}
+
+func renderEnv(priv crypto.PrivKey, peerID string) (string, error) {
+	raw, err := crypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# torrentium-relay env for peer %s, generated %s\n", peerID, time.Now().UTC().Format(time.RFC3339))
+	b.WriteString("# Holds the private key: paste into Render and discard. ADMIN_TOKEN is not included, keep yours.\n")
+	fmt.Fprintf(&b, "RELAY_PRIVATE_KEY_B64=%s\n", base64.StdEncoding.EncodeToString(raw))
+	var current, recommended []string
+	for _, v := range renderEnvLimits {
+		if val := os.Getenv(v.name); val != "" {
+			current = append(current, v.name+"="+val)
+		} else {
+			recommended = append(recommended, v.name+"="+v.recommended)
+		}
+	}
+	if len(current) > 0 {
+		b.WriteString("# current (set on this relay)\n" + strings.Join(current, "\n") + "\n")
+	}
+	if len(recommended) > 0 {
+		b.WriteString("# recommended\n" + strings.Join(recommended, "\n") + "\n")
+	}
+	return b.String(), nil
+}
+
+// GET /render-env
+func (s *statusServer) handleRenderEnv(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.RenderEnvSnippet {
+		writeError(w, http.StatusNotFound, "render env block disabled (set RENDER_ENV_SNIPPET=true)")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	body, err := renderEnv(s.h.Peerstore().PrivKey(s.h.ID()), s.h.ID().String())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("⚠️ Private key exported via admin /render-env to %s", r.RemoteAddr)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(body))
+}
@@ -0,0 +1,202 @@
+// reservations.go
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Reservation tracking ===
+// Mirrors the relay's own reservation table: granted on RESERVE -> OK,
+// dropped on expiry or when the peer fully disconnects (as the relay does).
+// A RESERVE from a peer that still holds a live reservation is a renewal:
+// granted stays at the first grant and renewals counts the refreshes; with
+// DUPLICATE_RESERVATION_POLICY=replace it starts a new reservation instead.
+type reservation struct {
+	peer     peer.ID
+	addr     ma.Multiaddr
+	granted  time.Time
+	renewed  time.Time
+	renewals int
+	expire   time.Time
+	tier     string
+
+	// lastCircuit is when a circuit to peer was last opened.
+	lastCircuit time.Time
+}
+
+type reservationInfo struct {
+	Peer        string     `json:"peer"`
+	Addr        string     `json:"addr"`
+	Granted     time.Time  `json:"granted"`
+	LastRenewed *time.Time `json:"lastRenewed,omitempty"`
+	Renewals    int        `json:"renewals"`
+	Expire      time.Time  `json:"expire"`
+	TTL         string     `json:"ttl"`
+	Tier        string     `json:"tier"`
+	LastCircuit *time.Time `json:"lastCircuit,omitempty"`
+	Idle        string     `json:"idle"`
+}
+
+type reservationTracker struct {
+	duplicates string // DUPLICATE_RESERVATION_POLICY
+
+	mu   sync.Mutex
+	byID map[peer.ID]*reservation
+
+	// freed is closed (and replaced) whenever a reservation is dropped.
+	freed chan struct{}
+}
+
+func newReservationTracker(cfg *relayConfig) *reservationTracker {
+	return &reservationTracker{duplicates: cfg.DuplicatePolicy, byID: make(map[peer.ID]*reservation), freed: make(chan struct{})}
+}
+
+// observe is a relayHost hop observer.
+func (t *reservationTracker) observe(ev hopEvent) {
+	if ev.Status != pbv2.Status_OK {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ev.Type == pbv2.HopMessage_CONNECT {
+		if r, ok := t.byID[ev.Dest]; ok {
+			r.lastCircuit = now
+		}
+		return
+	}
+	if ev.Type != pbv2.HopMessage_RESERVE {
+		return
+	}
+	if r, ok := t.byID[ev.Peer]; ok && now.Before(r.expire) {
+		if t.duplicates == dupReplace {
+			eventf("duplicate_reservation", "event=duplicate_reservation peer=%s policy=%s action=replaced held_for=%s renewals=%d", ev.Peer, dupReplace, now.Sub(r.granted).Round(time.Second), r.renewals)
+			t.byID[ev.Peer] = &reservation{peer: ev.Peer, addr: ev.Addr, granted: now, expire: ev.Expire, tier: ev.Tier, lastCircuit: r.lastCircuit}
+			return
+		}
+		eventf("duplicate_reservation", "event=duplicate_reservation peer=%s policy=%s action=extended expire=%s", ev.Peer, dupExtend, ev.Expire.UTC().Format("15:04:05"))
+		r.addr, r.expire, r.tier = ev.Addr, ev.Expire, ev.Tier
+		r.renewed = now
+		r.renewals++
+		return
+	}
+	t.byID[ev.Peer] = &reservation{peer: ev.Peer, addr: ev.Addr, granted: now, expire: ev.Expire, tier: ev.Tier}
+}
+
+// notifiee drops reservations of peers that are gone.
+func (t *reservationTracker) notifiee() network.Notifiee {
+	return &network.NotifyBundle{
+		DisconnectedF: func(n network.Network, c network.Conn) {
+			p := c.RemotePeer()
+			if n.Connectedness(p) == network.Connected {
+				return
+			}
+			t.mu.Lock()
+			if _, ok := t.byID[p]; ok {
+				delete(t.byID, p)
+				t.signalFreed()
+			}
+			t.mu.Unlock()
+		},
+	}
+}
+
+// signalFreed wakes everyone waiting in released. Callers hold t.mu.
+func (t *reservationTracker) signalFreed() {
+	close(t.freed)
+	t.freed = make(chan struct{})
+}
+
+// released returns a channel closed the next time a reservation is dropped.
+func (t *reservationTracker) released() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.freed
+}
+
+// count returns the number of unexpired reservations.
+func (t *reservationTracker) count() int {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, r := range t.byID {
+		if now.Before(r.expire) {
+			n++
+		}
+	}
+	return n
+}
+
+// has reports whether p holds an unexpired reservation.
+func (t *reservationTracker) has(p peer.ID) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.byID[p]
+	return ok && time.Now().Before(r.expire)
+}
+
+// get returns p's live reservation.
+func (t *reservationTracker) get(p peer.ID) (reservationInfo, bool) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.byID[p]
+	if !ok || !now.Before(r.expire) {
+		return reservationInfo{}, false
+	}
+	return r.info(now), true
+}
+
+// list returns live reservations, soonest expiry first, pruning expired ones.
+func (t *reservationTracker) list() []reservationInfo {
+	now := time.Now()
+	t.mu.Lock()
+	out := t.listLocked(now)
+	t.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Expire.Before(out[j].Expire) })
+	return out
+}
+
+// listLocked is list without the lock or the ordering. Callers hold t.mu.
+func (t *reservationTracker) listLocked(now time.Time) []reservationInfo {
+	out := make([]reservationInfo, 0, len(t.byID))
+	for p, r := range t.byID {
+		if !now.Before(r.expire) {
+			delete(t.byID, p)
+			continue
+		}
+		out = append(out, r.info(now))
+	}
+	return out
+}
+
+func (r *reservation) info(now time.Time) reservationInfo {
+	info := reservationInfo{
+		Peer:     r.peer.String(),
+		Addr:     r.addr.String(),
+		Granted:  r.granted,
+		Renewals: r.renewals,
+		Expire:   r.expire,
+		TTL:      r.expire.Sub(now).Round(time.Second).String(),
+		Tier:     r.tier,
+		Idle:     r.idleFor(now).Round(time.Second).String(),
+	}
+	if !r.renewed.IsZero() {
+		renewed := r.renewed
+		info.LastRenewed = &renewed
+	}
+	if !r.lastCircuit.IsZero() {
+		last := r.lastCircuit
+		info.LastCircuit = &last
+	}
+	return info
+}
@@ -0,0 +1,91 @@
+// reserveproc.go
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Reservation processing concurrency (RESERVE_MAX_CONCURRENT) ===
+// Caps how many RESERVE requests are processed at once (ACL, limits, voucher
+// signing), apart from the reservation cap and from HOP_MAX_CONCURRENT,
+// which counts CONNECTs too. The request is held once read, waiting up to
+// RESERVE_CONCURRENCY_TIMEOUT for a slot, and then answered with
+// RESOURCE_LIMIT_EXCEEDED.
+var errReserveBusy = errors.New("reservation processing limit reached")
+
+type reserveProcLimiter struct {
+	sem  chan struct{}
+	wait time.Duration
+
+	inFlight atomic.Int64
+	queued   atomic.Int64
+	stats    *relayStats
+
+	mu      sync.Mutex
+	lastLog time.Time
+}
+
+func newReserveProcLimiter(cfg *relayConfig, stats *relayStats) *reserveProcLimiter {
+	l := &reserveProcLimiter{wait: cfg.reserveProcTimeout, stats: stats}
+	if cfg.ReserveMaxConcurrent > 0 {
+		l.sem = make(chan struct{}, cfg.ReserveMaxConcurrent)
+	}
+	return l
+}
+
+// acquire takes a processing slot for p's reservation, or returns false once
+// the wait is over.
+func (l *reserveProcLimiter) acquire(p peer.ID) bool {
+	if l.sem == nil {
+		l.inFlight.Add(1)
+		return true
+	}
+
+	select {
+	case l.sem <- struct{}{}:
+		l.inFlight.Add(1)
+		return true
+	default:
+	}
+	if l.wait > 0 {
+		l.queued.Add(1)
+		t := time.NewTimer(l.wait)
+		select {
+		case l.sem <- struct{}{}:
+			t.Stop()
+			l.queued.Add(-1)
+			l.inFlight.Add(1)
+			return true
+		case <-t.C:
+			l.queued.Add(-1)
+		}
+	}
+	l.refused(p)
+	return false
+}
+
+func (l *reserveProcLimiter) release() {
+	l.inFlight.Add(-1)
+	if l.sem != nil {
+		<-l.sem
+	}
+}
+
+func (l *reserveProcLimiter) refused(p peer.ID) {
+	n := l.stats.reserveProcRefused.Add(1)
+
+	// one line per 10s at most during a storm
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.lastLog) >= 10*time.Second {
+		l.lastLog = time.Now()
+		log.Printf("⚠️ Reservation processing limit reached (%d in flight, %d queued), refused reservation from %s (%d refused so far)",
+			cap(l.sem), l.queued.Load(), p, n)
+	}
+}
@@ -0,0 +1,69 @@
+// reservequeue.go
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Soft reservation limit (RESERVE_QUEUE_SIZE) ===
+// At capacity, a new reservation request waits up to RESERVE_QUEUE_TIMEOUT
+// for a slot to free instead of being refused at once. The wait happens in
+// the relay's ACL check, before it looks at its own limits, so a request that
+// times out (or finds the queue full) gets the relay's normal refusal.
+type reserveQueue struct {
+	size    int
+	timeout time.Duration
+	max     int
+
+	reservations *reservationTracker
+	vip          *vipPool
+	waiting      atomic.Int64
+}
+
+func newReserveQueue(cfg *relayConfig, reservations *reservationTracker) *reserveQueue {
+	return &reserveQueue{
+		size:         cfg.ReserveQueueSize,
+		timeout:      cfg.reserveQueueTimeout,
+		max:          cfg.relayResources().MaxReservations,
+		reservations: reservations,
+	}
+}
+
+func (q *reserveQueue) depth() int64 {
+	return q.waiting.Load()
+}
+
+// wait blocks p until the relay has room for it or the timeout passes.
+// Renewals never wait: they replace their own slot.
+func (q *reserveQueue) wait(p peer.ID) {
+	limit := q.vip.limit(p, q.max)
+	if q.size <= 0 || q.reservations.has(p) || q.reservations.count() < limit {
+		return
+	}
+	if q.waiting.Add(1) > int64(q.size) {
+		q.waiting.Add(-1)
+		debugf("reservation queue full, %s refused", p)
+		return
+	}
+	defer q.waiting.Add(-1)
+
+	deadline := time.NewTimer(q.timeout)
+	defer deadline.Stop()
+	// expiries are pruned lazily, so poll as well as wait for releases
+	tick := time.NewTicker(250 * time.Millisecond)
+	defer tick.Stop()
+	start := time.Now()
+	for q.reservations.count() >= limit {
+		select {
+		case <-q.reservations.released():
+		case <-tick.C:
+		case <-deadline.C:
+			debugf("reservation for %s timed out in queue after %s", p, q.timeout)
+			return
+		}
+	}
+	debugf("reservation for %s dequeued after %s", p, time.Since(start).Round(time.Millisecond))
+}
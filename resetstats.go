@@ -0,0 +1,145 @@
+// resetstats.go
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// === POST /reset-stats ===
+// Zeros the cumulative counters so a measurement window can start from a
+// clean baseline without a restart. Only what counts up since start is
+// reset:
+//
+//   - every node's relay counters (circuits opened, relayed bytes, the
+//     limiters' refusals, revoked reservations, ...);
+//   - connection rejections by reason and transport errors by kind;
+//   - denied destinations, circuit protocol refusals, handshake phase
+//     timeouts, buffer budget refusals, non-reserving evictions and
+//     HTTP_HEAVY_MAX_CONCURRENT refusals;
+//   - the circuit size window and the compression samples (/stats
+//     percentiles and ratio); the buffer peak restarts from what is in use.
+//
+// Live state is left alone: reservations, connections, open circuits and
+// their byte counts, in-flight and queued counts. So are the Prometheus
+// histograms, which can't be zeroed. Counters on /metrics simply drop, which
+// Prometheus reads as a counter reset; StatsD pushes carry on from zero.
+// Each reset is logged (event=stats_reset) with the caller and a request ID,
+// taken from X-Request-ID or made up, and answers with the relay counters as
+// they stood.
+func (s *statusServer) handleResetStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	id := r.Header.Get("X-Request-ID")
+	if id == "" {
+		b := make([]byte, 8)
+		_, _ = rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	w.Header().Set("X-Request-ID", id)
+
+	before := make(map[string]statsSnapshot, len(s.nodes))
+	for _, n := range s.nodes {
+		before[n.name] = n.rh.stats.snapshot()
+		n.resetStats()
+	}
+	connRejections.reset()
+	transportErrs.reset()
+	s.heavy.refused.Store(0)
+	prev := s.countersSince()
+	now := time.Now().UTC()
+	s.statsSince.Store(&now)
+
+	log.Printf("✅ event=stats_reset by=%s request_id=%s previous_since=%s", adminCaller(r), id, prev.Format(time.RFC3339))
+	writeJSON(w, http.StatusOK, map[string]any{
+		"requestId":     id,
+		"since":         now,
+		"previousSince": prev,
+		"before":        before,
+	})
+}
+
+// countersSince is when the cumulative counters started: the last reset,
+// or startup.
+func (s *statusServer) countersSince() time.Time {
+	if t := s.statsSince.Load(); t != nil {
+		return *t
+	}
+	return s.started.UTC()
+}
+
+// adminCaller names who made an admin request: the client certificate's
+// subject when there is one, and the remote address.
+func adminCaller(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0].Subject.CommonName + "@" + r.RemoteAddr
+	}
+	return r.RemoteAddr
+}
+
+func (n *relayNode) resetStats() {
+	n.rh.stats.reset()
+	n.rh.denied.reset()
+	n.rh.buffers.refused.Store(0)
+	n.rh.buffers.peak.Store(n.rh.buffers.inUse.Load())
+	n.rh.circuits.sizes.reset()
+	n.rh.circuits.compression.reset()
+	if p := n.acl.protocols; p != nil {
+		p.refusedSource.Store(0)
+		p.refusedDest.Store(0)
+	}
+	n.phases.timedOutTransport.Store(0)
+	n.phases.timedOutSecurity.Store(0)
+	n.phases.timedOutMuxer.Store(0)
+	n.purpose.evicted.Store(0)
+}
+
+func (s *relayStats) reset() {
+	for _, c := range []*atomic.Int64{
+		&s.circuitsOpened, &s.relayedBytes, &s.bytesSrcToDst, &s.bytesDstToSrc,
+		&s.reservationsGranted, &s.reservationsRefused, &s.nearLimitWarnings, &s.hopRefused,
+		&s.reserveProcRefused, &s.stopDialRefused, &s.sourceDialRefused,
+		&s.destCircuitRefused, &s.enforcedLimitHits, &s.rcmgrBlockedReservations,
+		&s.idleRevokedReservations, &s.deadRevokedReservations, &s.expiryNoticesSent,
+	} {
+		c.Store(0)
+	}
+}
+
+func (r *rejectionCounts) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clear(r.counts)
+}
+
+func (t *transportErrCounts) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.counts)
+}
+
+func (d *deniedDests) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	clear(d.counts)
+	d.total.Store(0)
+}
+
+func (s *circuitSizes) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recent = s.recent[:0]
+	s.count = 0
+}
+
+func (c *compressionSampler) reset() {
+	c.raw.Store(0)
+	c.compressed.Store(0)
+	c.circuits.Store(0)
+}
@@ -0,0 +1,67 @@
+// resources.go
+package main
+
+import (
+	"fmt"
+
+	relay "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
+)
+
+// === Relay resources (MAX_RESERVATIONS, MAX_CIRCUITS_PER_PEER, RELAY_LIMIT_*) ===
+// The circuit v2 resources that had no setting of their own: the
+// reservation cap (RESERVATIONS_PER_MB sizes it from memory instead, so only
+// one of the two may be set), the circuits one peer may have open through
+// the relay at once, as source or destination, and the default tier's
+// per-circuit duration and data limits (RELAY_LIMIT_DURATION,
+// RELAY_LIMIT_DATA), which RELAY_TIERS entries override for the peers they
+// list. Unset, each keeps the go-libp2p default; the effective values are on
+// /limits.
+func maxReservationsEnv(perMB float64, fromMemory int) (int, error) {
+	n, err := envInt("MAX_RESERVATIONS", 0)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case n < 0:
+		return 0, fmt.Errorf("MAX_RESERVATIONS must not be negative, got %d", n)
+	case n > 0 && perMB > 0:
+		return 0, fmt.Errorf("MAX_RESERVATIONS and RESERVATIONS_PER_MB both size the reservation cap; set one")
+	case n > 0:
+		return n, nil
+	}
+	return fromMemory, nil
+}
+
+func maxCircuitsPerPeer() (int, error) {
+	n, err := envInt("MAX_CIRCUITS_PER_PEER", relay.DefaultResources().MaxCircuits)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, fmt.Errorf("MAX_CIRCUITS_PER_PEER must be positive, got %d", n)
+	}
+	return n, nil
+}
+
+// defaultLimit is the default tier's circuit limit; circuit v2 has no
+// unlimited setting short of dropping limits for every tier, so both parts
+// must be positive.
+func defaultLimit() (relay.RelayLimit, error) {
+	l := *relay.DefaultResources().Limit
+	d, err := envDuration("RELAY_LIMIT_DURATION", l.Duration)
+	if err != nil {
+		return l, err
+	}
+	if d <= 0 {
+		return l, fmt.Errorf("RELAY_LIMIT_DURATION must be positive, got %s", d)
+	}
+	data, err := envInt("RELAY_LIMIT_DATA", int(l.Data))
+	if err != nil {
+		return l, err
+	}
+	if data <= 0 {
+		return l, fmt.Errorf("RELAY_LIMIT_DATA must be positive, got %d", data)
+	}
+	l.Duration, l.Data = d, int64(data)
+	return l, nil
+}
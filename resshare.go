@@ -0,0 +1,59 @@
+// resshare.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
+)
+
+// === Per-source reservation caps (MAX_RESERVATIONS_PER_IP, _PER_ASN) ===
+// How many reservations may come from one IP address or one ASN, as a count
+// ("8") or as a share of the reservation cap ("5%"), so the same fairness
+// policy fits a small instance and a big one. A share is turned into a count
+// at startup, after RESERVATIONS_PER_MB has sized the cap, rounding down but
+// never below 1, and the result is logged and shown on /limits. There is no
+// per-peer cap to set: circuit v2 holds one reservation per peer, a renewal
+// replacing the last.
+func reservationShare(name string, def, total int) (spec string, n int, err error) {
+	v := strings.TrimSpace(envString(name, ""))
+	if v == "" {
+		return "", def, nil
+	}
+	if pct, ok := strings.CutSuffix(v, "%"); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(pct), 64)
+		if err != nil || f <= 0 || f > 100 {
+			return "", 0, fmt.Errorf("invalid %s %q (want a count or a percentage above 0%% and up to 100%%)", name, v)
+		}
+		n = max(1, int(math.Floor(float64(total)*f/100)))
+		log.Printf("%s: %d (%s of %d reservations)", name, n, v, total)
+		return v, n, nil
+	}
+	n, err = strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return "", 0, fmt.Errorf("invalid %s %q (want a count or a percentage above 0%% and up to 100%%)", name, v)
+	}
+	return v, n, nil
+}
+
+// reservationShares reads both caps against total reservations (0 for the
+// libp2p default).
+func reservationShares(total int) (perIPSpec string, perIP int, perASNSpec string, perASN int, err error) {
+	def := relay.DefaultResources()
+	if total <= 0 {
+		total = def.MaxReservations
+	}
+	perIPSpec, perIP, err = reservationShare("MAX_RESERVATIONS_PER_IP", def.MaxReservationsPerIP, total)
+	if err != nil {
+		return "", 0, "", 0, err
+	}
+	perASNSpec, perASN, err = reservationShare("MAX_RESERVATIONS_PER_ASN", def.MaxReservationsPerASN, total)
+	if err != nil {
+		return "", 0, "", 0, err
+	}
+	return perIPSpec, perIP, perASNSpec, perASN, nil
+}
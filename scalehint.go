@@ -0,0 +1,141 @@
+// scalehint.go
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// === Autoscaling hint (/scale-hint) ===
+// Samples reservation utilization and relayed throughput. The hint is "up"
+// when utilization stayed above SCALE_UP_PCT for the whole SCALE_HINT_WINDOW,
+// "down" when it stayed below SCALE_DOWN_PCT, otherwise "hold".
+const scaleSampleEvery = 15 * time.Second
+
+type scaleSample struct {
+	at          time.Time
+	utilization float64 // percent of MaxReservations
+	relayed     int64
+}
+
+type scaleHinter struct {
+	cfg          *relayConfig
+	reservations *reservationTracker
+	circuits     *circuitTracker
+
+	mu      sync.Mutex
+	samples []scaleSample
+}
+
+type scaleHint struct {
+	Hint               string  `json:"hint"`
+	Reason             string  `json:"reason"`
+	Reservations       int     `json:"reservations"`
+	MaxReservations    int     `json:"maxReservations"`
+	UtilizationPct     float64 `json:"utilizationPct"`
+	BandwidthBytesPerS float64 `json:"bandwidthBytesPerSec"`
+	BandwidthTrend     string  `json:"bandwidthTrend"`
+	Window             string  `json:"window"`
+	WindowCoveredPct   float64 `json:"windowCoveredPct"`
+	ScaleUpThreshold   float64 `json:"scaleUpPct"`
+	ScaleDownThreshold float64 `json:"scaleDownPct"`
+}
+
+func newScaleHinter(cfg *relayConfig, reservations *reservationTracker, circuits *circuitTracker) *scaleHinter {
+	return &scaleHinter{cfg: cfg, reservations: reservations, circuits: circuits}
+}
+
+func (s *scaleHinter) run() {
+	s.sample()
+	for range time.Tick(scaleSampleEvery) {
+		s.sample()
+	}
+}
+
+func (s *scaleHinter) sample() {
+	now := time.Now()
+	maxRes := s.cfg.relayResources().MaxReservations
+	util := 0.0
+	if maxRes > 0 {
+		util = float64(len(s.reservations.list())) / float64(maxRes) * 100
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples = append(s.samples, scaleSample{at: now, utilization: util, relayed: s.circuits.stats.relayedBytes.Load()})
+	// keep one sample older than the window so coverage can reach 100%
+	cut := 0
+	for cut+1 < len(s.samples) && now.Sub(s.samples[cut+1].at) >= s.cfg.scaleWindow {
+		cut++
+	}
+	s.samples = s.samples[cut:]
+}
+
+func (s *scaleHinter) hint() scaleHint {
+	maxRes := s.cfg.relayResources().MaxReservations
+	n := len(s.reservations.list())
+	h := scaleHint{
+		Hint:               "hold",
+		Reservations:       n,
+		MaxReservations:    maxRes,
+		BandwidthTrend:     "flat",
+		Window:             s.cfg.scaleWindow.String(),
+		ScaleUpThreshold:   s.cfg.ScaleUpPercent,
+		ScaleDownThreshold: s.cfg.ScaleDownPercent,
+	}
+	if maxRes > 0 {
+		h.UtilizationPct = float64(n) / float64(maxRes) * 100
+	}
+
+	s.mu.Lock()
+	samples := append([]scaleSample(nil), s.samples...)
+	s.mu.Unlock()
+	if len(samples) < 2 {
+		h.Reason = "not enough samples yet"
+		return h
+	}
+
+	first, last := samples[0], samples[len(samples)-1]
+	span := last.at.Sub(first.at)
+	h.WindowCoveredPct = min(100, float64(span)/float64(s.cfg.scaleWindow)*100)
+	h.BandwidthBytesPerS = float64(last.relayed-first.relayed) / span.Seconds()
+
+	// trend: second half of the window against the first half
+	mid := samples[len(samples)/2]
+	early := rate(first, mid)
+	late := rate(mid, last)
+	switch {
+	case late > early*1.2 && late-early > 1024:
+		h.BandwidthTrend = "rising"
+	case late < early*0.8 && early-late > 1024:
+		h.BandwidthTrend = "falling"
+	}
+
+	allAbove, allBelow := true, true
+	for _, sm := range samples {
+		allAbove = allAbove && sm.utilization > s.cfg.ScaleUpPercent
+		allBelow = allBelow && sm.utilization < s.cfg.ScaleDownPercent
+	}
+	switch {
+	case span < s.cfg.scaleWindow:
+		h.Reason = fmt.Sprintf("observed %s of %s window", span.Round(time.Second), s.cfg.scaleWindow)
+	case allAbove:
+		h.Hint = "up"
+		h.Reason = fmt.Sprintf("reservations above %.0f%% for %s", s.cfg.ScaleUpPercent, s.cfg.scaleWindow)
+	case allBelow && h.BandwidthTrend != "rising":
+		h.Hint = "down"
+		h.Reason = fmt.Sprintf("reservations below %.0f%% for %s", s.cfg.ScaleDownPercent, s.cfg.scaleWindow)
+	default:
+		h.Reason = "utilization within thresholds"
+	}
+	return h
+}
+
+func rate(a, b scaleSample) float64 {
+	d := b.at.Sub(a.at).Seconds()
+	if d <= 0 {
+		return 0
+	}
+	return float64(b.relayed-a.relayed) / d
+}
@@ -0,0 +1,134 @@
+// schedule.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+	_ "time/tzdata" // RESERVE_SCHEDULE_TZ must work on images without zoneinfo
+)
+
+// === Reservation blackout hours (RESERVE_BLACKOUT_WINDOWS) ===
+// Comma-separated HH:MM-HH:MM windows, in RESERVE_SCHEDULE_TZ, during which
+// new reservations are refused; a window may wrap midnight (22:00-06:00).
+// Renewals by peers already holding a reservation and open circuits are
+// unaffected, as with maintenance mode.
+type clockWindow struct {
+	start, end time.Duration // offset from local midnight
+}
+
+type reserveSchedule struct {
+	spec    string
+	loc     *time.Location
+	windows []clockWindow
+
+	// logged remembers the last state logged, so refusals are logged once
+	// per transition rather than per request.
+	logged atomic.Bool
+}
+
+type scheduleInfo struct {
+	Accepting  bool      `json:"accepting"`
+	Windows    string    `json:"blackoutWindows"`
+	TimeZone   string    `json:"timeZone"`
+	NextChange time.Time `json:"nextChange"`
+}
+
+func parseSchedule(spec, tz string) (*reserveSchedule, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RESERVE_SCHEDULE_TZ %q: %w", tz, err)
+	}
+	s := &reserveSchedule{spec: spec, loc: loc}
+	for _, f := range strings.Split(spec, ",") {
+		f = strings.TrimSpace(f)
+		from, to, ok := strings.Cut(f, "-")
+		start, err1 := parseClock(from)
+		end, err2 := parseClock(to)
+		if !ok || err1 != nil || err2 != nil || start == end {
+			return nil, fmt.Errorf("RESERVE_BLACKOUT_WINDOWS: %q is not HH:MM-HH:MM", f)
+		}
+		s.windows = append(s.windows, clockWindow{start: start, end: end})
+	}
+	return s, nil
+}
+
+func parseClock(v string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(v))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// refusing reports whether t falls in a blackout window. A nil schedule
+// never refuses.
+func (s *reserveSchedule) refusing(t time.Time) bool {
+	if s == nil {
+		return false
+	}
+	t = t.In(s.loc)
+	y, m, d := t.Date()
+	offset := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, s.loc))
+	for _, w := range s.windows {
+		if w.start < w.end && offset >= w.start && offset < w.end {
+			return true
+		}
+		if w.start > w.end && (offset >= w.start || offset < w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextChange is the first window edge after t at which refusing flips.
+func (s *reserveSchedule) nextChange(t time.Time) time.Time {
+	now := s.refusing(t)
+	t = t.In(s.loc)
+	y, m, d := t.Date()
+	var next time.Time
+	for day := 0; day <= 2; day++ {
+		midnight := time.Date(y, m, d+day, 0, 0, 0, 0, s.loc)
+		for _, w := range s.windows {
+			for _, edge := range []time.Duration{w.start, w.end} {
+				e := midnight.Add(edge)
+				if e.After(t) && s.refusing(e) != now && (next.IsZero() || e.Before(next)) {
+					next = e
+				}
+			}
+		}
+	}
+	return next
+}
+
+// allow is the ACL check for a peer without an existing reservation.
+func (s *reserveSchedule) allow() bool {
+	refusing := s.refusing(time.Now())
+	if s.logged.Swap(refusing) != refusing {
+		if refusing {
+			log.Printf("Reservation blackout window started, refusing new reservations until %s",
+				s.nextChange(time.Now()).Format(time.RFC3339))
+		} else {
+			log.Printf("Reservation blackout window ended, accepting new reservations")
+		}
+	}
+	return !refusing
+}
+
+func (s *reserveSchedule) info() *scheduleInfo {
+	if s == nil {
+		return nil
+	}
+	now := time.Now()
+	return &scheduleInfo{
+		Accepting:  !s.refusing(now),
+		Windows:    s.spec,
+		TimeZone:   s.loc.String(),
+		NextChange: s.nextChange(now),
+	}
+}
@@ -0,0 +1,85 @@
+// secrets.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// === Secrets (RELAY_SECRETS_URL) ===
+// Without RELAY_SECRETS_URL secrets come straight from the env. With it, the
+// URL must resolve to a JSON object keyed by the env var names, e.g.
+// {"RELAY_PRIVATE_KEY_B64": "...", "ADMIN_TOKEN": "..."}. Keys missing from
+// the document fall back to the env.
+//
+//	file:///run/secrets/relay.json  read a JSON file
+//	env://RELAY_SECRETS_JSON        read JSON from another env var
+//	https://vault.internal/relay    GET, expects a JSON body
+type relaySecrets struct {
+	PrivateKeyB64 string
+	AdminToken    string
+}
+
+func loadSecrets() (*relaySecrets, error) {
+	s := &relaySecrets{
+		PrivateKeyB64: os.Getenv("RELAY_PRIVATE_KEY_B64"),
+		AdminToken:    os.Getenv("ADMIN_TOKEN"),
+	}
+
+	raw := os.Getenv("RELAY_SECRETS_URL")
+	if raw == "" {
+		return s, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RELAY_SECRETS_URL: %w", err)
+	}
+
+	data, err := fetchSecrets(u)
+	if err != nil {
+		return nil, fmt.Errorf("resolve RELAY_SECRETS_URL (%s): %w", u.Scheme, err)
+	}
+	var doc map[string]string
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("resolve RELAY_SECRETS_URL (%s): invalid JSON: %w", u.Scheme, err)
+	}
+
+	if v := doc["RELAY_PRIVATE_KEY_B64"]; v != "" {
+		s.PrivateKeyB64 = v
+	}
+	if v := doc["ADMIN_TOKEN"]; v != "" {
+		s.AdminToken = v
+	}
+	return s, nil
+}
+
+func fetchSecrets(u *url.URL) ([]byte, error) {
+	switch u.Scheme {
+	case "file":
+		return os.ReadFile(u.Path)
+	case "env":
+		v := os.Getenv(u.Host)
+		if v == "" {
+			return nil, fmt.Errorf("env var %q is empty", u.Host)
+		}
+		return []byte(v), nil
+	case "http", "https":
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Get(u.String())
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q (want file, env, http or https)", u.Scheme)
+	}
+}
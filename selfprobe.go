@@ -0,0 +1,193 @@
+// selfprobe.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Self-reachability probe (SELF_PROBE_INTERVAL) ===
+// A throwaway client dials each of the relay's public advertised addresses,
+// the same way a remote client would; the relay is reachable when any of them
+// works, and the per-address results are on /dialability. While all fail the
+// next attempt backs off exponentially from the interval up to
+// SELF_PROBE_MAX_BACKOFF; the first success goes back to the normal interval.
+type selfProbeState struct {
+	State       string     `json:"state"` // pending, reachable, unreachable
+	Failures    int        `json:"consecutiveFailures"`
+	LastAttempt *time.Time `json:"lastAttempt,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	NextAttempt *time.Time `json:"nextAttempt,omitempty"`
+}
+
+type selfProbe struct {
+	node       *relayNode
+	interval   time.Duration
+	maxBackoff time.Duration
+	timeout    time.Duration
+
+	mu    sync.Mutex
+	state selfProbeState
+	addrs []addrProbe
+}
+
+// addrProbe is the last probe of one advertised address.
+type addrProbe struct {
+	Addr       string     `json:"addr"`
+	Passed     bool       `json:"passed"`
+	LastProbe  time.Time  `json:"lastProbe"`
+	LastPassed *time.Time `json:"lastPassed,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+func startSelfProbe(ctx context.Context, n *relayNode, cfg *relayConfig) *selfProbe {
+	p := &selfProbe{
+		node:       n,
+		interval:   cfg.selfProbeInterval,
+		maxBackoff: cfg.selfProbeMaxBackoff,
+		timeout:    cfg.selfProbeTimeout,
+		state:      selfProbeState{State: "pending"},
+	}
+	if p.interval > 0 {
+		go p.run(ctx)
+		log.Printf("✅ Self-probe of public addresses every %s (backoff up to %s)", p.interval, p.maxBackoff)
+	}
+	return p
+}
+
+func (p *selfProbe) run(ctx context.Context) {
+	// first probe once warmup has had a chance to finish
+	wait := p.node.cfg.warmup + time.Second
+	for {
+		next := time.Now().Add(wait)
+		p.mu.Lock()
+		p.state.NextAttempt = &next
+		p.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = p.probeOnce(ctx)
+	}
+}
+
+// probeOnce dials once, records the outcome and returns the delay until the
+// next attempt.
+func (p *selfProbe) probeOnce(ctx context.Context) time.Duration {
+	now := time.Now()
+	results, err := p.dial(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.LastAttempt = &now
+	p.recordAddrs(results, now)
+	if err == nil {
+		if p.state.State != "reachable" {
+			log.Printf("✅ Self-probe: relay reachable at its public addresses")
+		}
+		p.state.State = "reachable"
+		p.state.Failures = 0
+		p.state.LastError = ""
+		p.state.LastSuccess = &now
+		return p.interval
+	}
+
+	p.state.State = "unreachable"
+	p.state.Failures++
+	p.state.LastError = err.Error()
+	wait := p.interval
+	for i := 1; i < p.state.Failures && wait < p.maxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, p.maxBackoff)
+	log.Printf("⚠️ Self-probe failed (%d in a row), next attempt in %s: %v", p.state.Failures, wait, err)
+	return wait
+}
+
+// dial tries every public address on its own, returning the error of each
+// (nil when it worked) and an error if none worked.
+func (p *selfProbe) dial(ctx context.Context) (map[string]error, error) {
+	adv := p.node.adv.Load()
+	if len(adv.public) == 0 {
+		return nil, fmt.Errorf("no public addresses advertised")
+	}
+	results := make(map[string]error, len(adv.public))
+	var errs []error
+	for _, a := range adv.public {
+		err := p.dialAddr(ctx, a)
+		results[a.String()] = err
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", a, err))
+		}
+	}
+	if len(errs) == len(adv.public) {
+		return results, errors.Join(errs...)
+	}
+	return results, nil
+}
+
+func (p *selfProbe) dialAddr(ctx context.Context, a ma.Multiaddr) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	// a fresh client per address, so one connection doesn't stand in for all
+	c, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		return fmt.Errorf("start probe client: %w", err)
+	}
+	defer c.Close()
+	return c.Connect(ctx, peer.AddrInfo{ID: p.node.h.ID(), Addrs: []ma.Multiaddr{a}})
+}
+
+// recordAddrs folds one probe's results into the per-address state,
+// dropping addresses no longer advertised. Callers hold p.mu.
+func (p *selfProbe) recordAddrs(results map[string]error, now time.Time) {
+	adv := p.node.adv.Load()
+	out := make([]addrProbe, 0, len(adv.public))
+	for _, a := range adv.public {
+		key := a.String()
+		ap := addrProbe{Addr: key}
+		if i := slices.IndexFunc(p.addrs, func(o addrProbe) bool { return o.Addr == key }); i >= 0 {
+			ap = p.addrs[i]
+		}
+		if err, ok := results[key]; ok {
+			ap.LastProbe, ap.Passed, ap.Error = now, err == nil, ""
+			if err == nil {
+				ap.LastPassed = &now
+			} else {
+				ap.Error = err.Error()
+			}
+		}
+		out = append(out, ap)
+	}
+	p.addrs = out
+}
+
+// addrResults returns the per-address state; addresses not probed yet have
+// a zero LastProbe.
+func (p *selfProbe) addrResults() []addrProbe {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.addrs)
+}
+
+func (p *selfProbe) info() selfProbeState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.interval == 0 {
+		return selfProbeState{State: "off"}
+	}
+	return p.state
+}
@@ -0,0 +1,126 @@
+// selftest.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"time"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Self-test (--selftest, admin POST /selftest) ===
+// Two throwaway in-process clients dial the relay over loopback; one
+// reserves, the other opens a circuit to it and round-trips a payload.
+const selfTestProto = protocol.ID("/torrentium-relay/selftest/1.0.0")
+
+type selfTestStep struct {
+	Name     string `json:"name"`
+	Duration string `json:"duration"`
+}
+
+type selfTestResult struct {
+	Pass  bool           `json:"pass"`
+	Error string         `json:"error,omitempty"`
+	Steps []selfTestStep `json:"steps"`
+	Total string         `json:"total"`
+}
+
+func runSelfTest(ctx context.Context, relayH host.Host) selfTestResult {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	res := selfTestResult{Steps: []selfTestStep{}}
+	err := selfTest(ctx, relayH, func(name string, t time.Time) {
+		res.Steps = append(res.Steps, selfTestStep{Name: name, Duration: time.Since(t).Round(time.Microsecond).String()})
+	})
+	res.Total = time.Since(start).Round(time.Microsecond).String()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Pass = true
+	return res
+}
+
+func selfTest(ctx context.Context, relayH host.Host, step func(string, time.Time)) error {
+	addrs, err := relayH.Network().InterfaceListenAddresses()
+	if err != nil {
+		return fmt.Errorf("relay listen addrs: %w", err)
+	}
+	relayInfo := peer.AddrInfo{ID: relayH.ID(), Addrs: addrs}
+
+	src, err := libp2p.New(libp2p.NoListenAddrs, libp2p.EnableRelay())
+	if err != nil {
+		return fmt.Errorf("start client: %w", err)
+	}
+	defer src.Close()
+	dst, err := libp2p.New(libp2p.NoListenAddrs, libp2p.EnableRelay())
+	if err != nil {
+		return fmt.Errorf("start client: %w", err)
+	}
+	defer dst.Close()
+
+	t := time.Now()
+	if err := src.Connect(ctx, relayInfo); err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	if err := dst.Connect(ctx, relayInfo); err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	step("connect", t)
+
+	t = time.Now()
+	if _, err := client.Reserve(ctx, dst, relayInfo); err != nil {
+		return fmt.Errorf("reserve: %w", err)
+	}
+	step("reserve", t)
+
+	dst.SetStreamHandler(selfTestProto, func(s network.Stream) {
+		defer s.Close()
+		_, _ = io.Copy(s, s)
+	})
+
+	t = time.Now()
+	circ, err := ma.NewMultiaddr(fmt.Sprintf("/p2p/%s/p2p-circuit/p2p/%s", relayH.ID(), dst.ID()))
+	if err != nil {
+		return err
+	}
+	src.Peerstore().AddAddr(dst.ID(), circ, time.Minute)
+	s, err := src.NewStream(network.WithAllowLimitedConn(ctx, "selftest"), dst.ID(), selfTestProto)
+	if err != nil {
+		return fmt.Errorf("open circuit: %w", err)
+	}
+	defer s.Close()
+	step("circuit", t)
+
+	t = time.Now()
+	payload := make([]byte, 1024)
+	_, _ = rand.Read(payload)
+	if dl, ok := ctx.Deadline(); ok {
+		_ = s.SetDeadline(dl)
+	}
+	if _, err := s.Write(payload); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	_ = s.CloseWrite()
+	echo, err := io.ReadAll(s)
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	if !bytes.Equal(echo, payload) {
+		return fmt.Errorf("round trip: got %d bytes back, want %d identical", len(echo), len(payload))
+	}
+	step("roundtrip", t)
+	return nil
+}
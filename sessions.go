@@ -0,0 +1,190 @@
+// sessions.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+)
+
+// === Session summaries (SESSION_SUMMARIES, SESSION_SUMMARY_FILE) ===
+// A session runs from a peer's first connection to the relay until its last
+// one closes and the circuits it was part of are done. For each one the
+// relay keeps a few totals and, at the end, logs them as one
+// event=session_summary line: how long it lasted, how many connections it
+// used and over which transports, reservations granted (renewals included),
+// circuits it opened as source and took as destination, and the bytes it
+// sent and received through them. With SESSION_SUMMARY_FILE each summary is
+// also appended there as a JSON line, for billing or abuse tooling to pick
+// up. A peer that reconnects before its last circuit is done carries on the
+// same session.
+type sessionTracker struct {
+	file *os.File
+
+	mu       sync.Mutex
+	sessions map[peer.ID]*session
+}
+
+type session struct {
+	start, end        time.Time
+	conns, open       int // connections ever, open now
+	transports        []string
+	reservations      int
+	circuitsOut       int
+	circuitsIn        int
+	openCircuits      int
+	bytesOut, bytesIn int64
+}
+
+type sessionSummary struct {
+	Peer         string    `json:"peer"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	Duration     string    `json:"duration"`
+	Conns        int       `json:"connections"`
+	Transports   []string  `json:"transports"`
+	Reservations int       `json:"reservations"`
+	CircuitsOut  int       `json:"circuitsOpened"`
+	CircuitsIn   int       `json:"circuitsReceived"`
+	BytesOut     int64     `json:"bytesSent"`
+	BytesIn      int64     `json:"bytesReceived"`
+}
+
+// startSessions hooks n up for SESSION_SUMMARIES; nil when it's off.
+func startSessions(n *relayNode, cfg *relayConfig) (*sessionTracker, error) {
+	if !cfg.SessionSummaries {
+		return nil, nil
+	}
+	t := &sessionTracker{sessions: make(map[peer.ID]*session)}
+	if cfg.SessionSummaryFile != "" {
+		f, err := os.OpenFile(cfg.SessionSummaryFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("SESSION_SUMMARY_FILE: %w", err)
+		}
+		t.file = f
+	}
+	n.rh.onHop(t.observe)
+	n.h.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(_ network.Network, c network.Conn) {
+			t.connected(c.RemotePeer(), transportOf(c.RemoteMultiaddr()))
+		},
+		DisconnectedF: func(_ network.Network, c network.Conn) {
+			t.disconnected(c.RemotePeer())
+		},
+	})
+	return t, nil
+}
+
+func (t *sessionTracker) connected(p peer.ID, transport string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.sessions[p]
+	if s == nil {
+		s = &session{start: time.Now()}
+		t.sessions[p] = s
+	}
+	s.conns++
+	s.open++
+	if !slices.Contains(s.transports, transport) {
+		s.transports = append(s.transports, transport)
+	}
+}
+
+func (t *sessionTracker) disconnected(p peer.ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s := t.sessions[p]; s != nil {
+		s.open--
+		t.endIfDone(p, s)
+	}
+}
+
+func (t *sessionTracker) observe(ev hopEvent) {
+	if ev.Type != pbv2.HopMessage_RESERVE || ev.Status != pbv2.Status_OK {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s := t.sessions[ev.Peer]; s != nil {
+		s.reservations++
+	}
+}
+
+// circuitOpened and circuitClosed count c for both ends; t may be nil.
+func (t *sessionTracker) circuitOpened(c *circuit) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s := t.sessions[c.src]; s != nil {
+		s.circuitsOut++
+		s.openCircuits++
+	}
+	if s := t.sessions[c.dst]; s != nil {
+		s.circuitsIn++
+		s.openCircuits++
+	}
+}
+
+func (t *sessionTracker) circuitClosed(c *circuit) {
+	if t == nil {
+		return
+	}
+	srcToDst, dstToSrc := c.srcToDst.Load(), c.dstToSrc.Load()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s := t.sessions[c.src]; s != nil {
+		s.bytesOut += srcToDst
+		s.bytesIn += dstToSrc
+		s.openCircuits--
+		t.endIfDone(c.src, s)
+	}
+	if s := t.sessions[c.dst]; s != nil {
+		s.bytesOut += dstToSrc
+		s.bytesIn += srcToDst
+		s.openCircuits--
+		t.endIfDone(c.dst, s)
+	}
+}
+
+// endIfDone emits p's summary once it has neither connections nor circuits
+// left. Called with t.mu held.
+func (t *sessionTracker) endIfDone(p peer.ID, s *session) {
+	if s.open > 0 || s.openCircuits > 0 {
+		return
+	}
+	delete(t.sessions, p)
+	s.end = time.Now()
+	sum := sessionSummary{
+		Peer:         p.String(),
+		Start:        s.start.UTC(),
+		End:          s.end.UTC(),
+		Duration:     s.end.Sub(s.start).Round(time.Millisecond).String(),
+		Conns:        s.conns,
+		Transports:   s.transports,
+		Reservations: s.reservations,
+		CircuitsOut:  s.circuitsOut,
+		CircuitsIn:   s.circuitsIn,
+		BytesOut:     s.bytesOut,
+		BytesIn:      s.bytesIn,
+	}
+	log.Printf("event=session_summary peer=%s duration=%s conns=%d transports=%s reservations=%d circuits_opened=%d circuits_received=%d bytes_sent=%d bytes_received=%d",
+		p, sum.Duration, sum.Conns, strings.Join(sum.Transports, ","), sum.Reservations, sum.CircuitsOut, sum.CircuitsIn, sum.BytesOut, sum.BytesIn)
+	if t.file == nil {
+		return
+	}
+	b, _ := json.Marshal(sum)
+	if _, err := t.file.Write(append(b, '\n')); err != nil {
+		log.Printf("⚠️ SESSION_SUMMARY_FILE write failed: %v", err)
+	}
+}
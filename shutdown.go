@@ -0,0 +1,133 @@
+// shutdown.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// === Ordered shutdown (SHUTDOWN_STEP_TIMEOUTS) ===
+// Once awaitShutdown returns (the drain step: new reservations refused,
+// circuits given DRAIN_TIMEOUT), the relay stops in fixed steps, each only
+// after the one before it:
+//
+//   - discovery: background loops stop, mDNS goes quiet and the coordinator
+//     hears the relay is leaving, while the host can still reach it;
+//   - host: every relay host closes, ending connections;
+//   - flush: the last StatsD push and buffered trace spans go out;
+//   - http: the status server stops accepting and lets requests in flight
+//     finish, so /readyz and /drain answer until the very end.
+//
+// Subsystems register what they need done under a step; a step's entries run
+// together. SHUTDOWN_STEP_TIMEOUTS bounds each step, e.g.
+// "host=20s,http=2s" (defaults: shutdownStepDefaults); a step that runs over
+// is logged and left behind so the process still exits. Every step logs
+// event=shutdown_step with how long it took.
+const (
+	stepDiscovery = "discovery"
+	stepHost      = "host"
+	stepFlush     = "flush"
+	stepHTTP      = "http"
+)
+
+var shutdownSteps = []string{stepDiscovery, stepHost, stepFlush, stepHTTP}
+
+var shutdownStepDefaults = map[string]time.Duration{
+	stepDiscovery: 5 * time.Second,
+	stepHost:      10 * time.Second,
+	stepFlush:     5 * time.Second,
+	stepHTTP:      5 * time.Second,
+}
+
+func parseShutdownTimeouts(v string) (map[string]time.Duration, error) {
+	out := make(map[string]time.Duration, len(shutdownStepDefaults))
+	for step, d := range shutdownStepDefaults {
+		out[step] = d
+	}
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		step, dur, ok := strings.Cut(f, "=")
+		step = strings.TrimSpace(step)
+		if _, known := shutdownStepDefaults[step]; !ok || !known {
+			return nil, fmt.Errorf("invalid SHUTDOWN_STEP_TIMEOUTS entry %q (want <step>=<duration>, steps: %s)", f, strings.Join(shutdownSteps, ", "))
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(dur))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid SHUTDOWN_STEP_TIMEOUTS entry %q (want a positive duration)", f)
+		}
+		out[step] = d
+	}
+	return out, nil
+}
+
+type shutdownTask struct {
+	name string
+	fn   func(context.Context) error
+}
+
+type shutdownSequence struct {
+	timeouts map[string]time.Duration
+
+	mu    sync.Mutex
+	tasks map[string][]shutdownTask
+	once  sync.Once
+}
+
+func newShutdownSequence(cfg *relayConfig) *shutdownSequence {
+	return &shutdownSequence{timeouts: cfg.shutdownTimeouts, tasks: make(map[string][]shutdownTask)}
+}
+
+// add registers fn to run in step. fn should give up when ctx is done.
+func (s *shutdownSequence) add(step, name string, fn func(context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[step] = append(s.tasks[step], shutdownTask{name, fn})
+}
+
+// run goes through the steps in order; only the first call does anything.
+func (s *shutdownSequence) run() {
+	s.once.Do(func() {
+		for _, step := range shutdownSteps {
+			s.mu.Lock()
+			tasks := s.tasks[step]
+			s.mu.Unlock()
+			if len(tasks) > 0 {
+				s.runStep(step, tasks)
+			}
+		}
+	})
+}
+
+func (s *shutdownSequence) runStep(step string, tasks []shutdownTask) {
+	timeout := s.timeouts[step]
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, t := range tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := t.fn(ctx); err != nil {
+				log.Printf("⚠️ shutdown step %s: %s: %v", step, t.name, err)
+			}
+		}()
+	}
+	go func() { wg.Wait(); close(done) }()
+
+	select {
+	case <-done:
+		log.Printf("event=shutdown_step step=%s tasks=%d took=%s", step, len(tasks), time.Since(start).Round(time.Millisecond))
+	case <-ctx.Done():
+		log.Printf("⚠️ event=shutdown_step step=%s tasks=%d timed_out_after=%s (SHUTDOWN_STEP_TIMEOUTS), moving on", step, len(tasks), timeout)
+	}
+}
@@ -0,0 +1,70 @@
+// snapshot.go
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// === Reservation and circuit snapshot (GET /snapshot) ===
+// One download of a node's whole relay state for audits and migration
+// planning: every live reservation and open circuit with their timers and
+// counters, plus the limits they run under. Both trackers are locked for the
+// duration, so no reservation or circuit comes or goes between the two lists.
+type relaySnapshot struct {
+	Node         string            `json:"node"`
+	PeerID       string            `json:"peerId"`
+	Taken        time.Time         `json:"taken"`
+	Addrs        []string          `json:"addrs"`
+	Limits       limitsInfo        `json:"limits"`
+	Reservations []reservationInfo `json:"reservations"`
+	Circuits     []circuitSnapshot `json:"circuits"`
+}
+
+type circuitSnapshot struct {
+	circuitInfo
+	Age         string    `json:"age"`
+	LimitData   int64     `json:"limitDataBytes"`
+	Advertised  int64     `json:"advertisedLimitDataBytes"`
+	WindowStart time.Time `json:"dataWindowStart"`
+}
+
+func (n *relayNode) snapshot() relaySnapshot {
+	snap := relaySnapshot{Node: n.name, PeerID: n.h.ID().String(), Addrs: n.publicMultiaddrs(), Limits: n.cfg.limits()}
+
+	res, circuits := n.reservations, n.rh.circuits
+	res.mu.Lock()
+	circuits.mu.Lock()
+	now := time.Now()
+	snap.Taken = now
+	snap.Reservations = res.listLocked(now)
+	snap.Circuits = make([]circuitSnapshot, 0, len(circuits.open))
+	for _, c := range circuits.open {
+		snap.Circuits = append(snap.Circuits, circuitSnapshot{
+			circuitInfo: c.info(),
+			Age:         now.Sub(c.start).Round(time.Second).String(),
+			LimitData:   c.limitData,
+			Advertised:  c.advertisedData,
+			WindowStart: time.Unix(0, c.winStart.Load()),
+		})
+	}
+	circuits.mu.Unlock()
+	res.mu.Unlock()
+
+	sort.Slice(snap.Reservations, func(i, j int) bool { return snap.Reservations[i].Expire.Before(snap.Reservations[j].Expire) })
+	sort.Slice(snap.Circuits, func(i, j int) bool { return snap.Circuits[i].ID < snap.Circuits[j].ID })
+	return snap
+}
+
+// GET /snapshot[?node=<name>] (primary by default), served as a download
+func (s *statusServer) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	n, ok := s.nodeParam(w, r)
+	if !ok {
+		return
+	}
+	snap := n.snapshot()
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="relay-snapshot-%s-%s.json"`, n.name, snap.Taken.UTC().Format("20060102T150405Z")))
+	writeJSON(w, http.StatusOK, snap)
+}
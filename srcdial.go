@@ -0,0 +1,119 @@
+// srcdial.go
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Stop dials per source (STOP_DIAL_PER_SOURCE) ===
+// STOP_DIAL_MAX_CONCURRENT bounds stop dials relay-wide, so one source asking
+// for circuits to many destinations at once can still take every slot. This
+// caps how many of a single source's CONNECTs are in progress (ACL, the stop
+// dial and its handshake) at a time. The CONNECT is held once read, waiting
+// up to STOP_DIAL_PER_SOURCE_WAIT for one of the source's own earlier ones to
+// finish, and then answered with RESOURCE_LIMIT_EXCEEDED (logged as
+// event=source_dial_limit).
+var errSourceDialBusy = errors.New("per-source stop dial limit reached")
+
+type sourceDialLimiter struct {
+	max   int
+	wait  time.Duration
+	stats *relayStats
+
+	mu      sync.Mutex
+	sources map[peer.ID]*sourceDials
+	lastLog map[peer.ID]time.Time
+}
+
+type sourceDials struct {
+	sem   chan struct{}
+	users int
+}
+
+func newSourceDialLimiter(cfg *relayConfig, stats *relayStats) *sourceDialLimiter {
+	return &sourceDialLimiter{
+		max:     cfg.StopDialPerSource,
+		wait:    cfg.sourceDialWait,
+		stats:   stats,
+		sources: make(map[peer.ID]*sourceDials),
+		lastLog: make(map[peer.ID]time.Time),
+	}
+}
+
+// acquire takes one of src's CONNECT slots, or returns false once the wait
+// is over.
+func (l *sourceDialLimiter) acquire(src peer.ID) bool {
+	if l.max <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	d := l.sources[src]
+	if d == nil {
+		d = &sourceDials{sem: make(chan struct{}, l.max)}
+		l.sources[src] = d
+	}
+	d.users++
+	l.mu.Unlock()
+
+	select {
+	case d.sem <- struct{}{}:
+		return true
+	default:
+	}
+	if l.wait > 0 {
+		t := time.NewTimer(l.wait)
+		select {
+		case d.sem <- struct{}{}:
+			t.Stop()
+			return true
+		case <-t.C:
+		}
+	}
+	l.done(src, d)
+	l.refused(src)
+	return false
+}
+
+func (l *sourceDialLimiter) release(src peer.ID) {
+	if l.max <= 0 {
+		return
+	}
+	l.mu.Lock()
+	d := l.sources[src]
+	l.mu.Unlock()
+	<-d.sem
+	l.done(src, d)
+}
+
+// done drops src's entry once nobody holds or waits for a slot.
+func (l *sourceDialLimiter) done(src peer.ID, d *sourceDials) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if d.users--; d.users == 0 {
+		delete(l.sources, src)
+	}
+}
+
+func (l *sourceDialLimiter) refused(src peer.ID) {
+	n := l.stats.sourceDialRefused.Add(1)
+
+	// one line per source per 10s at most during a burst
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.lastLog[src]) < 10*time.Second {
+		return
+	}
+	for p, at := range l.lastLog {
+		if now.Sub(at) >= 10*time.Second {
+			delete(l.lastLog, p)
+		}
+	}
+	l.lastLog[src] = now
+	log.Printf("⚠️ event=source_dial_limit src=%s max=%d refused_total=%d", src, l.max, n)
+}
@@ -0,0 +1,45 @@
+// startupjitter.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// === Startup jitter (STARTUP_JITTER) ===
+// After a fleet-wide redeploy every relay would bind, advertise and turn
+// ready in the same second, and their clients reconnect in one storm. With
+// STARTUP_JITTER=<max> or <min>-<max> the relay waits a random time in that
+// band after loading its config, key and files (so those still fail fast)
+// and before binding any listener; nothing is reachable or advertised until
+// then. --selftest doesn't wait.
+func parseStartupJitter(v string) (time.Duration, time.Duration, error) {
+	if v == "" {
+		return 0, 0, nil
+	}
+	lo, hi, band := strings.Cut(v, "-")
+	if !band {
+		lo, hi = "0s", v
+	}
+	minD, err1 := time.ParseDuration(strings.TrimSpace(lo))
+	maxD, err2 := time.ParseDuration(strings.TrimSpace(hi))
+	if err1 != nil || err2 != nil || minD < 0 || maxD < minD {
+		return 0, 0, fmt.Errorf("invalid STARTUP_JITTER %q (want <max> or <min>-<max>, e.g. 30s or 5s-30s)", v)
+	}
+	return minD, maxD, nil
+}
+
+func startupJitter(cfg *relayConfig) {
+	if cfg.jitterMax == 0 {
+		return
+	}
+	d := cfg.jitterMin
+	if span := cfg.jitterMax - cfg.jitterMin; span > 0 {
+		d += rand.N(span)
+	}
+	log.Printf("Startup jitter: waiting %s before binding listeners (STARTUP_JITTER=%s)", d.Round(time.Millisecond), cfg.StartupJitter)
+	time.Sleep(d)
+}
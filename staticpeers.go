@@ -0,0 +1,217 @@
+// staticpeers.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Static peers (STATIC_PEERS) ===
+// Bootstrap/sibling relays the relay keeps a connection to. Each has a
+// supervisor that redials with exponential backoff (±20% jitter), capped at
+// STATIC_PEER_MAX_RETRIES attempts per hour.
+const (
+	staticPeerBaseBackoff = time.Second
+	staticPeerDialTimeout = 15 * time.Second
+	staticPeerRetryWindow = time.Hour
+	staticPeerTag         = "static-peer"
+)
+
+type staticPeerState struct {
+	Peer           string     `json:"peer"`
+	Addrs          []string   `json:"addrs"`
+	Connected      bool       `json:"connected"`
+	ConnectedSince *time.Time `json:"connectedSince,omitempty"`
+	Failures       int        `json:"consecutiveFailures"`
+	WindowAttempts int        `json:"attemptsThisHour"`
+	LastError      string     `json:"lastError,omitempty"`
+	NextAttempt    *time.Time `json:"nextAttempt,omitempty"`
+}
+
+type staticPeer struct {
+	info peer.AddrInfo
+	wake chan struct{}
+
+	mu          sync.Mutex
+	state       staticPeerState
+	windowStart time.Time
+}
+
+type staticPeers struct {
+	h          host.Host
+	maxBackoff time.Duration
+	maxRetries int
+	peers      []*staticPeer
+}
+
+// parsePeerAddrs parses the comma-separated /p2p/ multiaddrs in env var
+// name (STATIC_PEERS, MIGRATION_TARGETS), grouping addresses by peer.
+func parsePeerAddrs(name, v string) ([]peer.AddrInfo, error) {
+	var addrs []ma.Multiaddr
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		a, err := ma.NewMultiaddr(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry %q: %w", name, f, err)
+		}
+		addrs = append(addrs, a)
+	}
+	infos, err := peer.AddrInfosFromP2pAddrs(addrs...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return infos, nil
+}
+
+func startStaticPeers(ctx context.Context, h host.Host, cfg *relayConfig) *staticPeers {
+	sp := &staticPeers{h: h, maxBackoff: cfg.staticPeerMaxBackoff, maxRetries: cfg.StaticPeerMaxRetries}
+	for _, info := range cfg.staticPeers {
+		p := &staticPeer{info: info, wake: make(chan struct{}, 1)}
+		p.state.Peer = info.ID.String()
+		for _, a := range info.Addrs {
+			p.state.Addrs = append(p.state.Addrs, a.String())
+		}
+		sp.peers = append(sp.peers, p)
+		h.Peerstore().AddAddrs(info.ID, info.Addrs, time.Duration(1<<62))
+		h.ConnManager().Protect(info.ID, staticPeerTag)
+	}
+	if len(sp.peers) == 0 {
+		return sp
+	}
+
+	h.Network().Notify(&network.NotifyBundle{
+		DisconnectedF: func(n network.Network, c network.Conn) {
+			for _, p := range sp.peers {
+				if p.info.ID == c.RemotePeer() && n.Connectedness(p.info.ID) != network.Connected {
+					select {
+					case p.wake <- struct{}{}:
+					default:
+					}
+				}
+			}
+		},
+	})
+	for _, p := range sp.peers {
+		go sp.supervise(ctx, p)
+	}
+	log.Printf("✅ Supervising %d static peers", len(sp.peers))
+	return sp
+}
+
+func (sp *staticPeers) supervise(ctx context.Context, p *staticPeer) {
+	for {
+		if sp.h.Network().Connectedness(p.info.ID) == network.Connected {
+			p.connected()
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.wake:
+				log.Printf("⚠️ Static peer %s disconnected", p.info.ID)
+				p.disconnected()
+			}
+			continue
+		}
+
+		wait := sp.attempt(ctx, p)
+		if wait == 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// attempt dials once (if the hourly budget allows) and returns how long to
+// wait before the next try; 0 means connected.
+func (sp *staticPeers) attempt(ctx context.Context, p *staticPeer) time.Duration {
+	now := time.Now()
+	p.mu.Lock()
+	if now.Sub(p.windowStart) >= staticPeerRetryWindow {
+		p.windowStart, p.state.WindowAttempts = now, 0
+	}
+	if sp.maxRetries > 0 && p.state.WindowAttempts >= sp.maxRetries {
+		wait := p.windowStart.Add(staticPeerRetryWindow).Sub(now)
+		p.setNext(now.Add(wait))
+		p.mu.Unlock()
+		return wait
+	}
+	p.state.WindowAttempts++
+	p.mu.Unlock()
+
+	// The swarm keeps its own dial backoff; the supervisor's schedule replaces it.
+	if sw, ok := sp.h.Network().(*swarm.Swarm); ok {
+		sw.Backoff().Clear(p.info.ID)
+	}
+	dctx, cancel := context.WithTimeout(ctx, staticPeerDialTimeout)
+	err := sp.h.Connect(dctx, p.info)
+	cancel()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		p.state.Failures = 0
+		p.state.LastError = ""
+		p.state.NextAttempt = nil
+		log.Printf("✅ Connected to static peer %s", p.info.ID)
+		return 0
+	}
+
+	p.state.Failures++
+	p.state.LastError = err.Error()
+	backoff := min(sp.maxBackoff, staticPeerBaseBackoff<<min(p.state.Failures-1, 30))
+	backoff = time.Duration(float64(backoff) * (0.8 + 0.4*rand.Float64()))
+	p.setNext(time.Now().Add(backoff))
+	log.Printf("⚠️ Static peer %s dial failed (attempt %d), retrying in %s: %v",
+		p.info.ID, p.state.Failures, backoff.Round(time.Millisecond), err)
+	return backoff
+}
+
+// setNext records the next attempt time. Callers hold p.mu.
+func (p *staticPeer) setNext(t time.Time) {
+	p.state.NextAttempt = &t
+}
+
+func (p *staticPeer) connected() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.state.Connected {
+		now := time.Now()
+		p.state.Connected = true
+		p.state.ConnectedSince = &now
+	}
+}
+
+func (p *staticPeer) disconnected() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.Connected = false
+	p.state.ConnectedSince = nil
+}
+
+func (sp *staticPeers) states() []staticPeerState {
+	out := make([]staticPeerState, 0, len(sp.peers))
+	for _, p := range sp.peers {
+		p.mu.Lock()
+		st := p.state
+		p.mu.Unlock()
+		out = append(out, st)
+	}
+	return out
+}
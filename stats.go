@@ -0,0 +1,91 @@
+// stats.go
+package main
+
+import (
+	"sync/atomic"
+
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+)
+
+// === Relay counters ===
+// relayStats holds one node's cumulative counters. Their owners (circuit
+// tracker, hop, reservation, stop-dial (relay-wide and per source) and destination limiters, the rcmgr block handler, the idle and dead-peer revokers, its own hop observer for RESERVE outcomes) bump them
+// from the relay's stream goroutines; /stats, /metrics and StatsD all read
+// them through snapshot, so every consumer reports the same numbers and
+// nothing outside this struct is counted by hand.
+type relayStats struct {
+	circuitsOpened           atomic.Int64
+	relayedBytes             atomic.Int64
+	bytesSrcToDst            atomic.Int64
+	bytesDstToSrc            atomic.Int64
+	reservationsGranted      atomic.Int64
+	reservationsRefused      atomic.Int64
+	nearLimitWarnings        atomic.Int64
+	hopRefused               atomic.Int64
+	reserveProcRefused       atomic.Int64
+	stopDialRefused          atomic.Int64
+	sourceDialRefused        atomic.Int64
+	destCircuitRefused       atomic.Int64
+	enforcedLimitHits        atomic.Int64
+	rcmgrBlockedReservations atomic.Int64
+	idleRevokedReservations  atomic.Int64
+	deadRevokedReservations  atomic.Int64
+	expiryNoticesSent        atomic.Int64
+}
+
+type statsSnapshot struct {
+	CircuitsOpened           int64 `json:"circuitsOpened"`
+	RelayedBytes             int64 `json:"relayedBytes"`
+	BytesSrcToDst            int64 `json:"relayedBytesSrcToDst"`
+	BytesDstToSrc            int64 `json:"relayedBytesDstToSrc"`
+	ReservationsGranted      int64 `json:"reservationsGranted"`
+	ReservationsRefused      int64 `json:"reservationsRefused"`
+	NearLimitWarnings        int64 `json:"nearLimitWarnings"`
+	HopRefused               int64 `json:"hopRefused"`
+	ReserveProcRefused       int64 `json:"reserveProcRefused"`
+	StopDialRefused          int64 `json:"stopDialRefused"`
+	SourceDialRefused        int64 `json:"sourceDialRefused"`
+	DestCircuitRefused       int64 `json:"destCircuitRefused"`
+	EnforcedLimitHits        int64 `json:"enforcedLimitHits"`
+	RcmgrBlockedReservations int64 `json:"rcmgrBlockedReservations"`
+	IdleRevokedReservations  int64 `json:"idleRevokedReservations"`
+	DeadRevokedReservations  int64 `json:"deadRevokedReservations"`
+	ExpiryNoticesSent        int64 `json:"expiryNoticesSent"`
+}
+
+// snapshot reads every counter. Each load is atomic; the set as a whole is
+// not taken under one lock, which counters that only grow (short of POST
+// /reset-stats) don't need.
+func (s *relayStats) snapshot() statsSnapshot {
+	return statsSnapshot{
+		CircuitsOpened:           s.circuitsOpened.Load(),
+		RelayedBytes:             s.relayedBytes.Load(),
+		BytesSrcToDst:            s.bytesSrcToDst.Load(),
+		BytesDstToSrc:            s.bytesDstToSrc.Load(),
+		ReservationsGranted:      s.reservationsGranted.Load(),
+		ReservationsRefused:      s.reservationsRefused.Load(),
+		NearLimitWarnings:        s.nearLimitWarnings.Load(),
+		HopRefused:               s.hopRefused.Load(),
+		ReserveProcRefused:       s.reserveProcRefused.Load(),
+		StopDialRefused:          s.stopDialRefused.Load(),
+		SourceDialRefused:        s.sourceDialRefused.Load(),
+		DestCircuitRefused:       s.destCircuitRefused.Load(),
+		EnforcedLimitHits:        s.enforcedLimitHits.Load(),
+		RcmgrBlockedReservations: s.rcmgrBlockedReservations.Load(),
+		IdleRevokedReservations:  s.idleRevokedReservations.Load(),
+		DeadRevokedReservations:  s.deadRevokedReservations.Load(),
+		ExpiryNoticesSent:        s.expiryNoticesSent.Load(),
+	}
+}
+
+// observe counts RESERVE outcomes, renewals included.
+func (s *relayStats) observe(ev hopEvent) {
+	if ev.Type != pbv2.HopMessage_RESERVE {
+		return
+	}
+	if ev.Status == pbv2.Status_OK {
+		s.reservationsGranted.Add(1)
+	} else {
+		s.reservationsRefused.Add(1)
+	}
+}
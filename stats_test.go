@@ -0,0 +1,92 @@
+// stats_test.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestRelayStatsConcurrent bumps every counter from many goroutines while
+// others read them through snapshot and /stats. Run it with -race.
+func TestRelayStatsConcurrent(t *testing.T) {
+	n := newTestRelay(t, nil)
+	st := n.rh.stats
+	counters := []*atomic.Int64{
+		&st.circuitsOpened, &st.relayedBytes, &st.bytesSrcToDst, &st.bytesDstToSrc,
+		&st.reservationsGranted, &st.reservationsRefused, &st.nearLimitWarnings,
+		&st.hopRefused, &st.reserveProcRefused, &st.stopDialRefused,
+		&st.sourceDialRefused, &st.destCircuitRefused, &st.enforcedLimitHits,
+		&st.rcmgrBlockedReservations, &st.idleRevokedReservations,
+		&st.deadRevokedReservations, &st.expiryNoticesSent,
+	}
+	if len(counters) != reflect.TypeOf(relayStats{}).NumField() {
+		t.Fatalf("test covers %d counters, relayStats has %d", len(counters), reflect.TypeOf(relayStats{}).NumField())
+	}
+	base := sumSnapshot(st.snapshot())
+
+	var ready atomic.Bool
+	ready.Store(true)
+	s := newTestStatusServer(t, n, &ready)
+
+	const writers, bumps = 8, 500
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range bumps {
+				for _, c := range counters {
+					c.Add(1)
+				}
+			}
+		}()
+	}
+	var readers sync.WaitGroup
+	for i := range 4 {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if i%2 == 0 {
+					_ = st.snapshot()
+					continue
+				}
+				rec := httptest.NewRecorder()
+				s.handleStats(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+				var body map[string]any
+				if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &body) != nil {
+					t.Errorf("/stats: %d %s", rec.Code, rec.Body.String())
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	readers.Wait()
+
+	if got, want := sumSnapshot(st.snapshot())-base, int64(writers*bumps*len(counters)); got != want {
+		t.Fatalf("snapshot counted %d bumps, want %d", got, want)
+	}
+}
+
+// sumSnapshot adds up every counter in snap.
+func sumSnapshot(snap statsSnapshot) int64 {
+	var sum int64
+	v := reflect.ValueOf(snap)
+	for i := range v.NumField() {
+		sum += v.Field(i).Int()
+	}
+	return sum
+}
@@ -0,0 +1,160 @@
+// statsd.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+)
+
+// === StatsD push (STATSD_ADDR) ===
+// For setups that collect metrics by push rather than scraping /stats: every
+// STATSD_FLUSH_INTERVAL the relay sends its reservation, connection, circuit
+// and bandwidth numbers as StatsD lines over UDP. Gauges are current values;
+// counters are the increase since the previous flush. STATSD_TAGS adds
+// DogStatsD-style tags, which plain StatsD servers don't understand.
+const statsdMaxPacket = 1432 // fits a 1500-byte MTU with IP/UDP headers
+
+type statsdPusher struct {
+	cfg          *relayConfig
+	h            host.Host
+	reservations *reservationTracker
+	circuits     *circuitTracker
+	hops         *hopLimiter
+	stopDials    *stopDialLimiter
+	stats        *relayStats
+
+	conn net.Conn
+	tags string
+	last map[string]int64
+	done chan struct{}
+}
+
+func startStatsD(ctx context.Context, cfg *relayConfig, h host.Host, reservations *reservationTracker, rh *relayHost) (*statsdPusher, error) {
+	if cfg.StatsdAddr == "" {
+		return nil, nil
+	}
+	conn, err := net.Dial("udp", cfg.StatsdAddr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd %s: %w", cfg.StatsdAddr, err)
+	}
+	s := &statsdPusher{
+		cfg:          cfg,
+		h:            h,
+		reservations: reservations,
+		circuits:     rh.circuits,
+		hops:         rh.hops,
+		stopDials:    rh.stopDials,
+		stats:        rh.stats,
+		conn:         conn,
+		last:         make(map[string]int64),
+		done:         make(chan struct{}),
+	}
+	if len(cfg.StatsdTags) > 0 {
+		s.tags = "|#" + strings.Join(cfg.StatsdTags, ",")
+	}
+	go s.run(ctx)
+	log.Printf("✅ StatsD metrics to %s every %s (prefix %q)", cfg.StatsdAddr, cfg.statsdInterval, cfg.StatsdPrefix)
+	return s, nil
+}
+
+func (s *statsdPusher) run(ctx context.Context) {
+	defer close(s.done)
+	s.flush() // sets the counter baselines
+	t := time.NewTicker(s.cfg.statsdInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.flush()
+		}
+	}
+}
+
+// close sends the last push once the loop has stopped (the discovery step
+// cancels it) and closes the socket.
+func (s *statsdPusher) close(ctx context.Context) error {
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	s.flush()
+	return s.conn.Close()
+}
+
+func (s *statsdPusher) flush() {
+	var lines []string
+	gauge := func(name string, v int64) {
+		lines = append(lines, fmt.Sprintf("%s%s:%d|g%s", s.cfg.StatsdPrefix, name, v, s.tags))
+	}
+	counter := func(name string, total int64) {
+		prev, seen := s.last[name]
+		s.last[name] = total
+		if seen && total < prev {
+			prev = 0 // POST /reset-stats
+		}
+		if seen && total > prev {
+			lines = append(lines, fmt.Sprintf("%s%s:%d|c%s", s.cfg.StatsdPrefix, name, total-prev, s.tags))
+		}
+	}
+
+	gauge("reservations", int64(s.reservations.count()))
+	gauge("connected_peers", int64(len(s.h.Network().Peers())))
+	gauge("connections", int64(len(s.h.Network().Conns())))
+	gauge("circuits.active", int64(len(s.circuits.list("", ""))))
+	gauge("hop.in_flight", s.hops.inFlight.Load())
+	gauge("stop_dial.in_flight", s.stopDials.inFlight.Load())
+	st := s.stats.snapshot()
+	counter("circuits.opened", st.CircuitsOpened)
+	counter("relayed_bytes", st.RelayedBytes)
+	counter("relayed_bytes.src_to_dst", st.BytesSrcToDst)
+	counter("relayed_bytes.dst_to_src", st.BytesDstToSrc)
+	counter("reservations.granted", st.ReservationsGranted)
+	counter("reservations.refused", st.ReservationsRefused)
+	counter("hop.refused", st.HopRefused)
+	counter("stop_dial.refused", st.StopDialRefused)
+	counter("source_dial.refused", st.SourceDialRefused)
+	counter("rcmgr_blocked_reservations", st.RcmgrBlockedReservations)
+	counter("dest_circuit_refused", st.DestCircuitRefused)
+	counter("enforced_limit_hits", st.EnforcedLimitHits)
+	counter("idle_revoked_reservations", st.IdleRevokedReservations)
+	counter("dead_revoked_reservations", st.DeadRevokedReservations)
+	counter("expiry_notices_sent", st.ExpiryNoticesSent)
+	for reason, n := range connRejections.snapshot() {
+		counter("conn_rejected."+string(reason), n)
+	}
+
+	s.send(lines)
+}
+
+// send packs lines into as few datagrams as fit statsdMaxPacket.
+func (s *statsdPusher) send(lines []string) {
+	var pkt strings.Builder
+	write := func() {
+		if pkt.Len() == 0 {
+			return
+		}
+		if _, err := s.conn.Write([]byte(pkt.String())); err != nil {
+			debugf("statsd write: %v", err)
+		}
+		pkt.Reset()
+	}
+	for _, l := range lines {
+		if pkt.Len() > 0 && pkt.Len()+1+len(l) > statsdMaxPacket {
+			write()
+		}
+		if pkt.Len() > 0 {
+			pkt.WriteByte('\n')
+		}
+		pkt.WriteString(l)
+	}
+	write()
+}
@@ -0,0 +1,693 @@
+// status.go
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	crypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Internal HTTP status server (not routed by Render) ===
+// statusPort is the default internal port (HTTP_BIND_ADDR); it must not be $PORT.
+const statusPort = "8080"
+
+type statusServer struct {
+	cfg        *relayConfig
+	h          host.Host
+	adminToken string
+	adminTLS   *adminTLS
+	ready      *atomic.Bool
+	circuits   *circuitTracker
+	acl        *relayACL
+
+	reservations *reservationTracker
+	started      time.Time
+	policy       *policyDoc
+	addrs        *addrWatcher
+	drain        *drainer
+	nodes        []*relayNode
+	scale        *scaleHinter
+	hops         *hopLimiter
+	stopDials    *stopDialLimiter
+	dials        *dialThrottle
+	static       *staticPeers
+	events       *eventFeed
+	keepalive    *keepalive
+	pruner       *peerstorePruner
+	shedder      *metricsShedder
+	refresher    *advertRefresher
+	probe        *selfProbe
+	warm         *warmConn
+	heavy        *heavyLimiter
+	clock        *clockSkew
+	heartbeat    *heartbeat
+	statsSince   atomic.Pointer[time.Time] // last POST /reset-stats
+}
+
+// readiness is what /readyz answers: "ready", or why the relay isn't.
+func (s *statusServer) readiness() string {
+	if !s.ready.Load() {
+		return "warming up"
+	}
+	for _, n := range s.nodes {
+		if !n.listening.Load() {
+			return "listeners not bound"
+		}
+	}
+	if err := s.nodes[0].adv.Load().err; err != nil {
+		return err.Error()
+	}
+	if s.acl.draining.Load() {
+		return "draining"
+	}
+	if s.acl.maintenance.Load() {
+		return "maintenance"
+	}
+	return "ready"
+}
+
+func (s *statusServer) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	// exactly "/" is the health check; anything unrouted is a 404, so a
+	// typo doesn't pass for a healthy relay
+	mux.HandleFunc("/{$}", s.handleRoot)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "unknown path "+r.URL.Path)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		state := s.readiness()
+		if state != "ready" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_, _ = w.Write([]byte(state))
+		// then, per node, the transports it actually came up with
+		for _, n := range s.nodes {
+			if !n.listening.Load() {
+				continue
+			}
+			fmt.Fprintf(w, "\nnode=%s transports=%s", n.name, strings.Join(n.advertisedTransports().Listening, ","))
+			if len(n.unavailable) > 0 {
+				down := make([]string, len(n.unavailable))
+				for i, u := range n.unavailable {
+					down[i] = u.Transport
+				}
+				fmt.Fprintf(w, " unavailable=%s", strings.Join(down, ","))
+			}
+		}
+	})
+	mux.HandleFunc("/peerid", func(w http.ResponseWriter, r *http.Request) {
+		s.writeCached(w, r, "text/plain; charset=utf-8", []byte(s.h.ID().String()))
+	})
+	mux.HandleFunc("/multiaddr", func(w http.ResponseWriter, r *http.Request) {
+		addr := s.nodes[0].publicMultiaddr()
+		if addr == "" {
+			addr = "no-public-hostname-set"
+		}
+		s.writeCached(w, r, "text/plain; charset=utf-8", []byte(addr))
+	})
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		s.writeCachedJSON(w, r, map[string]string{"version": relayVersion(), "go": runtime.Version()})
+	})
+	mux.HandleFunc("/qr", s.handleQR)
+	mux.HandleFunc("/config", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, s.cfg)
+	})
+	mux.HandleFunc("/limits", func(w http.ResponseWriter, r *http.Request) {
+		s.writeCachedJSON(w, r, s.cfg.limits())
+	})
+	mux.HandleFunc("/client-config", s.handleClientConfig)
+	mux.HandleFunc("/stats", s.heavy.wrap(s.handleStats))
+	mux.Handle("/metrics", metricsHandler())
+	mux.HandleFunc("/metrics.json", s.heavy.wrap(s.handleMetricsJSON))
+	mux.HandleFunc("/transports", s.handleTransports)
+	mux.HandleFunc("/swarm/{infohash}", s.handleSwarm)
+	mux.HandleFunc("/dialability", s.handleDialability)
+	mux.HandleFunc("/relays", func(w http.ResponseWriter, _ *http.Request) {
+		out := make([]relayNodeInfo, 0, len(s.nodes))
+		for _, n := range s.nodes {
+			out = append(out, n.info())
+		}
+		writeJSON(w, http.StatusOK, out)
+	})
+	mux.Handle("/policy", s.policy)
+	mux.HandleFunc("/scale-hint", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, s.scale.hint())
+	})
+	mux.HandleFunc("/drain", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, s.drain.status())
+	})
+	mux.HandleFunc("/circuits", s.admin(s.heavy.wrap(s.handleCircuits)))
+	mux.HandleFunc("/reservations", s.admin(s.heavy.wrap(func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, s.reservations.list())
+	})))
+	mux.HandleFunc("/reservations/{peer}", s.admin(s.handleReservation))
+	mux.HandleFunc("/status", s.admin(s.heavy.wrap(s.handleStatus)))
+	mux.HandleFunc("/maintenance", s.admin(s.handleMaintenance))
+	mux.HandleFunc("/key", s.admin(s.handleKey))
+	mux.HandleFunc("/render-env", s.admin(s.handleRenderEnv))
+	mux.HandleFunc("/advertise", s.admin(s.handleAdvertise))
+	mux.HandleFunc("/readvertise", s.admin(s.handleReadvertise))
+	mux.HandleFunc("/reset-stats", s.admin(s.handleResetStats))
+	mux.HandleFunc("/events", s.admin(s.handleEvents))
+	mux.HandleFunc("/debug/events", s.admin(s.handleDebugEvents))
+	mux.HandleFunc("/verify-client", s.admin(s.handleVerifyClient))
+	mux.HandleFunc("/snapshot", s.admin(s.heavy.wrap(s.handleSnapshot)))
+	mux.HandleFunc("/selftest", s.admin(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		res := runSelfTest(r.Context(), s.h)
+		code := http.StatusOK
+		if !res.Pass {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, res)
+	}))
+	return mux
+}
+
+// start binds HTTP_BIND_ADDR and serves in the background. The returned
+// func stops accepting (closing the listener, which also removes a Unix
+// socket file) and waits for requests in flight; those still running when
+// ctx is done, such as /events streams, are cut.
+func (s *statusServer) start() (stop func(context.Context) error) {
+	ln, err := s.listen()
+	if err != nil {
+		log.Printf("status server failed: %v", err)
+		return func(context.Context) error { return nil }
+	}
+	srv := &http.Server{
+		Handler: s.routes(),
+		// keep slots under HTTP_MAX_CONNS from being held by slow or idle clients
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       30 * time.Second,
+	}
+
+	ln = newLimitListener(ln, s.cfg.HTTPMaxConns)
+	scheme := "HTTP"
+	if s.adminTLS != nil {
+		ln = tls.NewListener(ln, s.adminTLS.config)
+		scheme = "HTTPS"
+		if s.adminTLS.clientCAs != nil {
+			scheme = "HTTPS, admin client certificates from ADMIN_CLIENT_CA"
+		}
+	}
+
+	log.Printf("Internal status server on %s (max %d conns, %s)", s.cfg.HTTPBindAddr, s.cfg.HTTPMaxConns, scheme)
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("status server failed: %v", err)
+		}
+	}()
+	return func(ctx context.Context) error {
+		if err := srv.Shutdown(ctx); err != nil {
+			_ = srv.Close()
+			return err
+		}
+		return nil
+	}
+}
+
+// listen opens the TCP address, or for unix:/path a socket with
+// HTTP_SOCKET_MODE permissions. A stale socket left by a killed process is
+// removed first; any other file at the path is an error.
+func (s *statusServer) listen() (net.Listener, error) {
+	path, ok := strings.CutPrefix(s.cfg.HTTPBindAddr, "unix:")
+	if !ok {
+		return net.Listen("tcp", s.cfg.HTTPBindAddr)
+	}
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("HTTP_BIND_ADDR %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, s.cfg.httpSocketMode); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// admin guards operator-only endpoints with "Authorization: Bearer $ADMIN_TOKEN"
+// and, with ADMIN_CLIENT_CA, a trusted client certificate; both are checked
+// when both are set. With neither configured the admin API is switched off.
+func (s *statusServer) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if code, msg := s.checkAdmin(r); code != 0 {
+			writeError(w, code, msg)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// checkAdmin authenticates r as an admin request: 0, or the status and
+// error to answer with.
+func (s *statusServer) checkAdmin(r *http.Request) (int, string) {
+	mtls := s.adminTLS != nil && s.adminTLS.clientCAs != nil
+	if s.adminToken == "" && !mtls {
+		return http.StatusForbidden, "admin API disabled (set ADMIN_TOKEN or ADMIN_CLIENT_CA)"
+	}
+	if mtls {
+		if err := s.adminTLS.verifyClient(r); err != nil {
+			return http.StatusForbidden, err.Error()
+		}
+	}
+	if s.adminToken != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			return http.StatusUnauthorized, "unauthorized"
+		}
+	}
+	return 0, ""
+}
+
+// GET /stats. Public, so the peer IDs in it are only shown to admin
+// requests, as on the admin-only endpoints that name peers: others get
+// near-limit circuits and flapping peers without them and no per-peer
+// destDenied counts.
+func (s *statusServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	nearLimit := s.circuits.nearLimit()
+	if nearLimit == nil {
+		nearLimit = []circuitInfo{}
+	}
+	destDenied := s.nodes[0].rh.denied.snapshot()
+	flapping := s.nodes[0].churn.flapping()
+	if code, _ := s.checkAdmin(r); code != 0 {
+		for i := range nearLimit {
+			nearLimit[i].Src, nearLimit[i].Dst = "", ""
+		}
+		for i := range flapping {
+			flapping[i].Peer = ""
+		}
+		destDenied = map[string]int64{}
+	}
+	st := s.nodes[0].rh.stats.snapshot()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"peerId":                   s.h.ID().String(),
+		"connectedPeers":           len(s.h.Network().Peers()),
+		"peersByPurpose":           s.nodes[0].purpose.info(),
+		"handshakePhases":          s.nodes[0].phases.info(),
+		"activeCircuits":           len(s.circuits.list("", "")),
+		"weightedLoad":             s.nodes[0].weightedLoad(),
+		"statsSince":               s.countersSince(),
+		"circuitsOpened":           st.CircuitsOpened,
+		"relayedBytes":             st.RelayedBytes,
+		"relayedBytesSrcToDst":     st.BytesSrcToDst,
+		"relayedBytesDstToSrc":     st.BytesDstToSrc,
+		"reservationsGranted":      st.ReservationsGranted,
+		"reservationsRefused":      st.ReservationsRefused,
+		"circuitSize":              s.circuits.sizes.info(),
+		"relayCompression":         s.circuits.compression.info(s.cfg.RelayCompression),
+		"nearLimitCircuits":        nearLimit,
+		"nearLimitWarnings":        st.NearLimitWarnings,
+		"maintenance":              s.acl.maintenance.Load(),
+		"diagnosticMode":           s.acl.diagnostics.info(),
+		"reserveSchedule":          s.acl.schedule.info(),
+		"reserveQueueDepth":        s.acl.queue.depth(),
+		"vipSlots":                 s.acl.vip.info(),
+		"declaredCapacity":         s.acl.capacity.info(),
+		"bandwidthPriority":        s.nodes[0].rh.bandwidth.info(),
+		"httpHeavy":                s.heavy.info(),
+		"clockSkew":                s.clock.snapshot(),
+		"fdLimit":                  fdUsage.info(),
+		"cpuAdmission":             cpuPressure.info(),
+		"peerstoreAddrs":           s.nodes[0].peerstore.info(),
+		"discovery":                s.nodes[0].discovery.info(),
+		"heartbeat":                s.heartbeat.info(),
+		"hopInFlight":              s.hops.inFlight.Load(),
+		"hopRefused":               st.HopRefused,
+		"reserveProcInFlight":      s.nodes[0].rh.reserves.inFlight.Load(),
+		"reserveProcQueued":        s.nodes[0].rh.reserves.queued.Load(),
+		"reserveProcRefused":       st.ReserveProcRefused,
+		"rcmgrBlockedReservations": st.RcmgrBlockedReservations,
+		"idleRevokedReservations":  st.IdleRevokedReservations,
+		"deadRevokedReservations":  st.DeadRevokedReservations,
+		"expiryNoticesSent":        st.ExpiryNoticesSent,
+		"stopDialInFlight":         s.stopDials.inFlight.Load(),
+		"stopDialQueued":           s.stopDials.queued.Load(),
+		"stopDialRefused":          st.StopDialRefused,
+		"sourceDialRefused":        st.SourceDialRefused,
+		"destCircuitRefused":       st.DestCircuitRefused,
+		"circuitBuffers":           s.nodes[0].rh.buffers.info(),
+		"destDenied":               destDenied,
+		"destDeniedTotal":          s.nodes[0].rh.denied.total.Load(),
+		"circuitProtocols":         s.acl.protocols.info(),
+		"metricsShed":              s.shedder.info(),
+		"enforcedLimitHits":        st.EnforcedLimitHits,
+		"localAddrs":               s.addrs.addrs(),
+		"advertRefresh":            s.refresher.info(),
+		"certHashes":               certHashes(s.h),
+		"staticPeers":              s.static.states(),
+		"events":                   s.events.stats(),
+		"keepalivePings":           s.keepalive.pinged.Load(),
+		"keepaliveClosed":          s.keepalive.closed.Load(),
+		"peerstorePeers":           s.pruner.size(),
+		"peerstorePruned":          s.pruner.pruned.Load(),
+		"selfProbe":                s.probe.info(),
+		"warmConnection":           s.warm.info(),
+		"connRejections":           connRejections.snapshot(),
+		"transportConns":           s.nodes[0].transports.info(),
+		"transportErrors":          transportErrs.snapshot(),
+		"flappingPeers":            flapping,
+	})
+}
+
+// GET /transports[?node=<name>] (primary by default)
+func (s *statusServer) handleTransports(w http.ResponseWriter, r *http.Request) {
+	n, ok := s.nodeParam(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, n.advertisedTransports())
+}
+
+// GET /status: one node's /relays entry with its uptime, open connections
+// and who holds a reservation until when, to check a deploy at a glance.
+// Admin-only, as it names peers.
+type nodeStatus struct {
+	relayNodeInfo
+	Uptime      string            `json:"uptime"`
+	Connections int               `json:"connections"`
+	Reserved    []reservationInfo `json:"reservedPeers"`
+}
+
+func (s *statusServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	n, ok := s.nodeParam(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, nodeStatus{
+		relayNodeInfo: n.info(),
+		Uptime:        time.Since(s.started).Round(time.Second).String(),
+		Connections:   len(n.h.Network().Conns()),
+		Reserved:      n.reservations.list(),
+	})
+}
+
+// GET /swarm/{infohash}: who is announced under infohash on the node's
+// discovery protocol, most recent first.
+func (s *statusServer) handleSwarm(w http.ResponseWriter, r *http.Request) {
+	n, ok := s.nodeParam(w, r)
+	if !ok {
+		return
+	}
+	if n.discovery == nil {
+		writeError(w, http.StatusNotFound, "discovery disabled (set DISCOVERY=true)")
+		return
+	}
+	infohash := r.PathValue("infohash")
+	if err := validTopic(infohash); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"infohash": infohash,
+		"peers":    n.discovery.peers(infohash, "", n.discovery.maxPeers, true),
+	})
+}
+
+// nodeParam resolves ?node=<name>, the primary when absent; an unknown name
+// has been answered with a 404 when it returns false.
+func (s *statusServer) nodeParam(w http.ResponseWriter, r *http.Request) (*relayNode, bool) {
+	name := r.URL.Query().Get("node")
+	if name == "" {
+		return s.nodes[0], true
+	}
+	i := slices.IndexFunc(s.nodes, func(n *relayNode) bool { return n.name == name })
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "unknown node "+name)
+		return nil, false
+	}
+	return s.nodes[i], true
+}
+
+// GET /reservations/{peerID}: one peer's reservation, its tier limits and
+// the circuits open to it; 404 without a live reservation
+func (s *statusServer) handleReservation(w http.ResponseWriter, r *http.Request) {
+	p, err := peer.Decode(r.PathValue("peer"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid peer ID")
+		return
+	}
+	res, ok := s.reservations.get(p)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no reservation for "+p.String())
+		return
+	}
+	circuits := s.circuits.list("", p)
+	var up, down int64
+	for _, c := range circuits {
+		up += c.BytesUp
+		down += c.BytesDown
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"reservation":   res,
+		"limits":        s.cfg.tierFor(p),
+		"circuits":      circuits,
+		"bytesToPeer":   up,
+		"bytesFromPeer": down,
+	})
+}
+
+// GET /circuits[?src=<peerID>][&dst=<peerID>]
+func (s *statusServer) handleCircuits(w http.ResponseWriter, r *http.Request) {
+	var src, dst peer.ID
+	for key, id := range map[string]*peer.ID{"src": &src, "dst": &dst} {
+		v := r.URL.Query().Get(key)
+		if v == "" {
+			continue
+		}
+		p, err := peer.Decode(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s peer ID", key))
+			return
+		}
+		*id = p
+	}
+
+	circuits := s.circuits.list(src, dst)
+	byDest := make(map[string]int)
+	for _, c := range circuits {
+		byDest[c.Dst]++
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"count":           len(circuits),
+		"circuits":        circuits,
+		"byDestination":   byDest,
+		"destMaxCircuits": s.cfg.DestMaxCircuits,
+	})
+}
+
+// GET  /maintenance                    current state
+// POST /maintenance {"enabled": true}  toggle
+func (s *statusServer) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var body struct {
+			Enabled *bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Enabled == nil {
+			writeError(w, http.StatusBadRequest, `expected {"enabled": true|false}`)
+			return
+		}
+		s.acl.setMaintenance(*body.Enabled)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "use GET or POST")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"maintenance": s.acl.maintenance.Load()})
+}
+
+// POST /advertise {"hostname": "...", "node": "<name>"} swaps the hostname a
+// node advertises (default: primary) without a restart.
+func (s *statusServer) handleAdvertise(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	var body struct {
+		Hostname string `json:"hostname"`
+		Node     string `json:"node"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Hostname == "" {
+		writeError(w, http.StatusBadRequest, `expected {"hostname": "<dns name>"}`)
+		return
+	}
+
+	n, ok := s.node(body.Node)
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown node "+body.Node)
+		return
+	}
+	if err := n.setHostname(body.Hostname); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	resp := map[string]string{"node": n.name, "multiaddr": n.publicMultiaddr()}
+	if r := n.adv.Load().retiringInfo(); r != "" {
+		resp["stillAdvertising"] = r
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// POST /readvertise {"node": "<name>"} rebuilds a node's advertised
+// addresses (default: primary) for its current hostname and pushes them to
+// connected peers, for when DNS or the proxy in front of the relay changed
+// but the hostname didn't. The body is optional.
+func (s *statusServer) handleReadvertise(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	var body struct {
+		Node string `json:"node"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, `expected {"node": "<name>"} or no body`)
+		return
+	}
+	n, ok := s.node(body.Node)
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown node "+body.Node)
+		return
+	}
+	addrs, err := n.readvertise()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"node": n.name, "addrs": addrs, "peers": len(n.h.Network().Peers())})
+}
+
+// node returns the node called name, or the primary for "".
+func (s *statusServer) node(name string) (*relayNode, bool) {
+	if name == "" {
+		return s.nodes[0], true
+	}
+	i := slices.IndexFunc(s.nodes, func(n *relayNode) bool { return n.name == name })
+	if i < 0 {
+		return nil, false
+	}
+	return s.nodes[i], true
+}
+
+// GET /key exports the primary identity's private key (same encoding as
+// RELAY_PRIVATE_KEY_B64). Every export is logged, without the key.
+func (s *statusServer) handleKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	b, err := crypto.MarshalPrivateKey(s.h.Peerstore().PrivKey(s.h.ID()))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("⚠️ Private key exported via admin /key to %s", r.RemoteAddr)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]string{
+		"peerId":        s.h.ID().String(),
+		"privateKeyB64": base64.StdEncoding.EncodeToString(b),
+	})
+}
+
+// === API envelope ===
+// Every JSON response is {"apiVersion": "1", "data": ...} or, on failure,
+// {"apiVersion": "1", "error": "..."}. apiVersion changes only when existing
+// fields are renamed, removed or change meaning; new fields don't bump it.
+const apiVersion = "1"
+
+type apiResponse struct {
+	APIVersion string `json:"apiVersion"`
+	Data       any    `json:"data,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	writeEnvelope(w, code, apiResponse{APIVersion: apiVersion, Data: v})
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeEnvelope(w, code, apiResponse{APIVersion: apiVersion, Error: msg})
+}
+
+func writeEnvelope(w http.ResponseWriter, code int, resp apiResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// writeCached serves a rarely-changing public response with Cache-Control
+// (HTTP_CACHE_TTL) and an ETag derived from the body, so an address
+// hot-swapped via /advertise invalidates clients' copies on their next
+// revalidation. A matching If-None-Match gets 304 without a body.
+func (s *statusServer) writeCached(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	h := w.Header()
+	h.Set("ETag", etag)
+	if ttl := s.cfg.httpCacheTTL; ttl > 0 {
+		h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(ttl.Seconds())))
+	} else {
+		h.Set("Cache-Control", "no-cache")
+	}
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Type", contentType)
+	_, _ = w.Write(body)
+}
+
+// writeCachedJSON is writeCached for a value in the usual JSON envelope.
+func (s *statusServer) writeCachedJSON(w http.ResponseWriter, r *http.Request, v any) {
+	body, err := json.Marshal(apiResponse{APIVersion: apiVersion, Data: v})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeCached(w, r, "application/json", append(body, '\n'))
+}
+
+// etagMatch reports whether an If-None-Match header lists etag (or "*"),
+// comparing weakly as RFC 9110 asks for conditional GETs.
+func etagMatch(header, etag string) bool {
+	for _, c := range strings.Split(header, ",") {
+		c = strings.TrimPrefix(strings.TrimSpace(c), "W/")
+		if c == "*" || c == etag {
+			return true
+		}
+	}
+	return false
+}
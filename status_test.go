@@ -0,0 +1,206 @@
+// status_test.go
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// newTestStatusServer is the status server of n alone, wired up the way
+// main wires the primary's, its background loops stopped with the test.
+func newTestStatusServer(t testing.TB, n *relayNode, ready *atomic.Bool) *statusServer {
+	t.Helper()
+	ctx, cfg, h, rh := t.Context(), n.cfg, n.h, n.rh
+	nodes := []*relayNode{n}
+	s := &statusServer{
+		cfg:      cfg,
+		h:        h,
+		heavy:    newHeavyLimiter(cfg.HTTPHeavyMaxConcurrent),
+		ready:    ready,
+		circuits: rh.circuits,
+		acl:      n.acl,
+
+		reservations: n.reservations,
+		started:      time.Now(),
+		addrs:        n.addrs,
+		drain:        newDrainer(cfg, h, n.acl, rh.circuits),
+		nodes:        nodes,
+		scale:        newScaleHinter(cfg, n.reservations, rh.circuits),
+		hops:         rh.hops,
+		stopDials:    rh.stopDials,
+		dials:        rh.dials,
+		static:       startStaticPeers(ctx, rh, cfg),
+		events:       newEventFeed(cfg.EventBufferSize),
+		keepalive:    startKeepalive(ctx, h, cfg),
+		pruner:       startPeerstorePruner(ctx, h, cfg),
+		shedder:      startMetricsShedder(ctx, cfg, rh.denied),
+		refresher:    startAdvertRefresher(ctx, cfg, nodes, newCoordinator(cfg, nodes)),
+		probe:        startSelfProbe(ctx, n, cfg),
+		clock:        startClockSkewCheck(ctx, cfg),
+		warm:         startWarmConn(ctx, n, cfg),
+	}
+	s.heartbeat = startHeartbeat(ctx, cfg, s)
+	return s
+}
+
+func TestReadyz(t *testing.T) {
+	n := newTestRelay(t, nil)
+	var ready atomic.Bool
+	mux := newTestStatusServer(t, n, &ready).routes()
+
+	get := func() (int, string) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	if code, body := get(); code != http.StatusServiceUnavailable || !strings.HasPrefix(body, "warming up") {
+		t.Fatalf("before ready: %d %q, want 503 warming up", code, body)
+	}
+	ready.Store(true)
+	if code, body := get(); code != http.StatusOK || !strings.HasPrefix(body, "ready") {
+		t.Fatalf("after ready: %d %q, want 200 ready", code, body)
+	}
+}
+
+// TestURLsShowOnlyOrigin checks that the heartbeat and coordinator URLs,
+// whose paths may hold a token, reach /config and /stats as scheme://host,
+// failed pings included.
+func TestURLsShowOnlyOrigin(t *testing.T) {
+	port, err := freePort("tcp") // nothing listens: every heartbeat fails
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin := fmt.Sprintf("http://127.0.0.1:%d", port)
+	n := newTestRelay(t, map[string]string{
+		"HEARTBEAT_URL":   "http://user:pw@127.0.0.1:" + strconv.Itoa(port) + "/ping/hb-secret",
+		"COORDINATOR_URL": "https://dir.example.com/relays/coord-secret",
+	})
+	var ready atomic.Bool
+	s := newTestStatusServer(t, n, &ready)
+	for deadline := time.Now().Add(5 * time.Second); s.heartbeat.failed.Load() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("heartbeat never failed")
+		}
+	}
+
+	mux := s.routes()
+	for _, path := range []string{"/config", "/stats"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		body := rec.Body.String()
+		for _, secret := range []string{"hb-secret", "coord-secret", "user", "pw@"} {
+			if strings.Contains(body, secret) {
+				t.Errorf("%s shows %q: %s", path, secret, body)
+			}
+		}
+		if !strings.Contains(body, origin) {
+			t.Errorf("%s doesn't show the heartbeat origin %s", path, origin)
+		}
+	}
+}
+
+// TestStatsNamesPeersOnlyToAdmin bans a flapping peer and reads /stats with
+// and without the admin token.
+func TestStatsNamesPeersOnlyToAdmin(t *testing.T) {
+	n := newTestRelay(t, map[string]string{"CHURN_MAX_CONNECTS": "1"})
+	flapper := newTestClient(t, n).ID()
+	for range 3 {
+		n.churn.connect(flapper)
+	}
+	var ready atomic.Bool
+	s := newTestStatusServer(t, n, &ready)
+	s.adminToken = "secret"
+	mux := s.routes()
+
+	stats := func(token string) string {
+		req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("/stats: %d %s", rec.Code, rec.Body.String())
+		}
+		return rec.Body.String()
+	}
+	if body := stats("secret"); !strings.Contains(body, flapper.String()) {
+		t.Fatalf("admin /stats doesn't name the flapping peer: %s", body)
+	}
+	for _, token := range []string{"", "wrong"} {
+		if body := stats(token); strings.Contains(body, flapper.String()) {
+			t.Errorf("/stats with token %q names the flapping peer: %s", token, body)
+		}
+	}
+}
+
+func TestDialabilityNamesPeersOnlyToAdmin(t *testing.T) {
+	n := newTestRelay(t, nil)
+	p := newTestClient(t, n).ID()
+	n.connectivity.dialFailed(p, errors.New("failed to dial "+p.String()+": no addresses"))
+	var ready atomic.Bool
+	s := newTestStatusServer(t, n, &ready)
+	s.adminToken = "secret"
+	mux := s.routes()
+
+	dialOut := func(token string) dialOutInfo {
+		req := httptest.NewRequest(http.MethodGet, "/dialability", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		var env struct{ Data dialabilityReport }
+		if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+			t.Fatalf("/dialability: %d %s", rec.Code, rec.Body.String())
+		}
+		if named, want := strings.Contains(rec.Body.String(), p.String()), token == "secret"; named != want {
+			t.Errorf("/dialability with token %q: peer named = %v, want %v", token, named, want)
+		}
+		return env.Data.DialOut
+	}
+	if d := dialOut("secret"); d.LastDialError == "" || d.State != "failing" {
+		t.Errorf("admin dialOut = %+v, want the failed dial", d)
+	}
+	if d := dialOut(""); d.LastDialError != "" || d.LastPeer != "" || d.State != "failing" {
+		t.Errorf("public dialOut = %+v, want state only", d)
+	}
+}
+
+// TestConfigNamesNoPeers checks that /config gives peer lists as counts.
+func TestConfigNamesNoPeers(t *testing.T) {
+	vip, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(vip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := newTestRelay(t, map[string]string{"VIP_SLOTS": "1", "VIP_PEERS": id.String(), "DEBUG_PEER_IDS": id.String()})
+	var ready atomic.Bool
+	rec := httptest.NewRecorder()
+	newTestStatusServer(t, n, &ready).routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config", nil))
+	body := rec.Body.String()
+	if strings.Contains(body, id.String()) {
+		t.Errorf("/config names VIP and debug peer %s", id)
+	}
+	for _, want := range []string{`"vipPeerCount":1`, `"debugPeerCount":1`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/config lacks %s: %s", want, body)
+		}
+	}
+}
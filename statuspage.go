@@ -0,0 +1,69 @@
+// statuspage.go
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// === Human-facing status page (HTTP_STATUS_PAGE) ===
+// Browsers get HTML at /; anything that doesn't ask for text/html (Render's
+// health probe, curl) still gets the plain "ok".
+var statusPage = template.Must(template.New("status").Parse(`<!doctype html>
+<html>
+<head><meta charset="utf-8"><title>torrentium relay</title>
+<style>body{font-family:sans-serif;margin:2em}td{padding:.2em 1em .2em 0}code{word-break:break-all}</style>
+</head>
+<body>
+<h1>torrentium relay</h1>
+<table>
+<tr><td>Peer ID</td><td><code>{{.PeerID}}</code></td></tr>
+<tr><td>Address</td><td><code>{{.Addr}}</code></td></tr>
+<tr><td>Uptime</td><td>{{.Uptime}}</td></tr>
+<tr><td>Reservations</td><td>{{.Reservations}}</td></tr>
+<tr><td>Circuits</td><td>{{.Circuits}}</td></tr>
+<tr><td>Status</td><td>{{.State}}</td></tr>
+<tr><td>Version</td><td>{{.Version}}</td></tr>
+</table>
+</body>
+</html>
+`))
+
+func (s *statusServer) handleRoot(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.StatusPage || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("ok"))
+		return
+	}
+
+	addr := "no-public-hostname-set"
+	if a := s.nodes[0].publicMultiaddr(); a != "" {
+		addr = a
+	}
+	state := "ready"
+	switch {
+	case !s.ready.Load():
+		state = "warming up"
+	case s.acl.draining.Load():
+		state = "draining"
+	case s.acl.maintenance.Load():
+		state = "maintenance"
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := statusPage.Execute(w, map[string]any{
+		"PeerID":       s.h.ID().String(),
+		"Addr":         addr,
+		"Uptime":       time.Since(s.started).Round(time.Second).String(),
+		"Reservations": len(s.reservations.list()),
+		"Circuits":     len(s.circuits.list("", "")),
+		"State":        state,
+		"Version":      relayVersion(),
+	})
+	if err != nil {
+		log.Printf("status page: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+// stopdial.go
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === Outbound stop-stream pacing (STOP_DIAL_MAX_CONCURRENT) ===
+// Caps how many stop streams (the relay dialling a circuit's destination) are
+// being opened at once. Extra opens wait in a queue of at most
+// STOP_DIAL_QUEUE_SIZE, within the STOP_TIMEOUT budget; beyond that the
+// circuit fails immediately with CONNECTION_FAILED.
+var errStopDialQueueFull = errors.New("stop dial queue full")
+
+type stopDialLimiter struct {
+	sem      chan struct{}
+	maxQueue int64
+
+	inFlight atomic.Int64
+	queued   atomic.Int64
+	stats    *relayStats
+
+	mu      sync.Mutex
+	lastLog time.Time
+}
+
+func newStopDialLimiter(cfg *relayConfig, stats *relayStats) *stopDialLimiter {
+	l := &stopDialLimiter{maxQueue: int64(cfg.StopDialQueueSize), stats: stats}
+	if cfg.StopDialMaxConcurrent > 0 {
+		l.sem = make(chan struct{}, cfg.StopDialMaxConcurrent)
+	}
+	return l
+}
+
+// acquire takes a dial slot for a stop stream to p, queueing until ctx is done.
+func (l *stopDialLimiter) acquire(ctx context.Context, p peer.ID) error {
+	if l.sem == nil {
+		l.inFlight.Add(1)
+		return nil
+	}
+
+	select {
+	case l.sem <- struct{}{}:
+		l.inFlight.Add(1)
+		return nil
+	default:
+	}
+
+	if l.queued.Add(1) > l.maxQueue {
+		l.queued.Add(-1)
+		l.refused(p, errStopDialQueueFull)
+		return errStopDialQueueFull
+	}
+	defer l.queued.Add(-1)
+
+	select {
+	case l.sem <- struct{}{}:
+		l.inFlight.Add(1)
+		return nil
+	case <-ctx.Done():
+		l.refused(p, ctx.Err())
+		return ctx.Err()
+	}
+}
+
+func (l *stopDialLimiter) release() {
+	l.inFlight.Add(-1)
+	if l.sem != nil {
+		<-l.sem
+	}
+}
+
+func (l *stopDialLimiter) refused(p peer.ID, reason error) {
+	n := l.stats.stopDialRefused.Add(1)
+
+	// one line per 10s at most during a burst
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.lastLog) >= 10*time.Second {
+		l.lastLog = time.Now()
+		log.Printf("⚠️ Stop dial limit reached (%d in flight, %d queued), failed circuit to %s: %v (%d refused so far)",
+			cap(l.sem), l.queued.Load(), p, reason, n)
+	}
+}
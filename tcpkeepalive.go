@@ -0,0 +1,58 @@
+// tcpkeepalive.go
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// === TCP keepalive on accepted sockets ===
+// The websocket transport listens with a plain net.Listen, which already turns
+// on keepalive with Go's defaults (15s idle, 15s interval, 9 probes), so a
+// vanished client holds its reservation for about 2.5 minutes of silence.
+// TCP_KEEPALIVE_IDLE/INTERVAL/COUNT tune that. The transport has no socket
+// option hook, but the gater sees the raw accepted conn before the HTTP
+// upgrade, so it's applied there.
+//
+// Platform support follows net.KeepAliveConfig: Linux, the BSDs, macOS and
+// Solaris honour all three; Windows before 10 1709 ignores the count and
+// other platforms may only take the on/off switch.
+type keepAliveSetter interface {
+	SetKeepAliveConfig(net.KeepAliveConfig) error
+}
+
+func tcpKeepaliveConfig() (net.KeepAliveConfig, error) {
+	kc := net.KeepAliveConfig{Enable: true}
+	var err error
+	if kc.Idle, err = envDuration("TCP_KEEPALIVE_IDLE", 15*time.Second); err != nil {
+		return kc, err
+	}
+	if kc.Interval, err = envDuration("TCP_KEEPALIVE_INTERVAL", 15*time.Second); err != nil {
+		return kc, err
+	}
+	if kc.Count, err = envInt("TCP_KEEPALIVE_COUNT", 9); err != nil {
+		return kc, err
+	}
+	// The kernel counts in whole seconds.
+	if kc.Idle < time.Second || kc.Interval < time.Second {
+		return kc, fmt.Errorf("TCP_KEEPALIVE_IDLE and TCP_KEEPALIVE_INTERVAL must be at least 1s")
+	}
+	if kc.Count < 1 || kc.Count > 127 {
+		return kc, fmt.Errorf("TCP_KEEPALIVE_COUNT must be between 1 and 127, got %d", kc.Count)
+	}
+	return kc, nil
+}
+
+// setTCPKeepalive applies kc to an accepted conn if it is a TCP socket.
+func setTCPKeepalive(addrs network.ConnMultiaddrs, kc net.KeepAliveConfig) {
+	c, ok := addrs.(keepAliveSetter)
+	if !ok {
+		return
+	}
+	if err := c.SetKeepAliveConfig(kc); err != nil {
+		debugf("tcp keepalive on %s: %v", addrs.RemoteMultiaddr(), err)
+	}
+}
@@ -0,0 +1,100 @@
+// tiers.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	relay "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
+)
+
+// === Limit tiers (RELAY_TIERS) ===
+// A JSON array, e.g.
+// [{"name":"premium","peers":["12D3KooW..."],"limitDuration":"30m","limitDataBytes":67108864}].
+// A reservation (and every circuit to it) gets the limit of the first tier
+// listing the reserving peer, or the default tier's. go-libp2p applies one
+// limit to all circuits, so the relay runs with the largest tier limit and
+// relayHost advertises and enforces the smaller ones itself.
+const defaultTierName = "default"
+
+type limitTier struct {
+	Name          string   `json:"name"`
+	Peers         []string `json:"peers,omitempty"`
+	LimitDuration string   `json:"limitDuration"`
+	LimitData     int64    `json:"limitDataBytes"`
+	Priority      int      `json:"priority,omitempty"`
+
+	limit relay.RelayLimit
+	peers map[peer.ID]bool
+}
+
+func defaultTier(l relay.RelayLimit) *limitTier {
+	return &limitTier{Name: defaultTierName, LimitDuration: l.Duration.String(), LimitData: l.Data, Priority: 1, limit: l}
+}
+
+func limitTiers() ([]*limitTier, error) {
+	v := envString("RELAY_TIERS", "")
+	if v == "" {
+		return nil, nil
+	}
+	var tiers []*limitTier
+	if err := json.Unmarshal([]byte(v), &tiers); err != nil {
+		return nil, fmt.Errorf("invalid RELAY_TIERS: %w", err)
+	}
+
+	seen := map[string]bool{defaultTierName: true}
+	for _, t := range tiers {
+		if t.Name == "" || seen[t.Name] {
+			return nil, fmt.Errorf("RELAY_TIERS: tier names must be unique, non-empty and not %q (got %q)", defaultTierName, t.Name)
+		}
+		seen[t.Name] = true
+
+		d, err := time.ParseDuration(t.LimitDuration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("RELAY_TIERS: tier %q has invalid limitDuration %q", t.Name, t.LimitDuration)
+		}
+		if t.LimitData <= 0 {
+			return nil, fmt.Errorf("RELAY_TIERS: tier %q needs a positive limitDataBytes", t.Name)
+		}
+		t.limit = relay.RelayLimit{Duration: d, Data: t.LimitData}
+		if t.Priority == 0 {
+			t.Priority = 1
+		}
+		if t.Priority < 1 || t.Priority > 100 {
+			return nil, fmt.Errorf("RELAY_TIERS: tier %q has invalid priority %d (want 1 to 100)", t.Name, t.Priority)
+		}
+
+		t.peers = make(map[peer.ID]bool, len(t.Peers))
+		for _, s := range t.Peers {
+			p, err := peer.Decode(s)
+			if err != nil {
+				return nil, fmt.Errorf("RELAY_TIERS: tier %q has invalid peer %q: %w", t.Name, s, err)
+			}
+			t.peers[p] = true
+		}
+	}
+	return tiers, nil
+}
+
+// tierFor returns the tier whose limits apply to reservations held by p.
+func (c *relayConfig) tierFor(p peer.ID) *limitTier {
+	for _, t := range c.Tiers {
+		if t.peers[p] {
+			return t
+		}
+	}
+	return c.defaultTier
+}
+
+// relayLimit is the ceiling go-libp2p enforces: the largest duration and
+// data limit over all tiers.
+func (c *relayConfig) relayLimit() *relay.RelayLimit {
+	l := c.defaultTier.limit
+	for _, t := range c.Tiers {
+		l.Duration = max(l.Duration, t.limit.Duration)
+		l.Data = max(l.Data, t.limit.Data)
+	}
+	return &l
+}
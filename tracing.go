@@ -0,0 +1,77 @@
+// tracing.go
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// === OpenTelemetry tracing (ENABLE_TRACING) ===
+// Spans are exported over OTLP/HTTP; the exporter reads
+// OTEL_EXPORTER_OTLP_ENDPOINT (and the other standard OTEL_* vars) itself.
+func setupTracing(ctx context.Context, h host.Host, rh *relayHost) (func(context.Context) error, error) {
+	exp, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("otlp exporter: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName("torrentium-relay"),
+			attribute.String("libp2p.relay_id", h.ID().String()),
+		)),
+	)
+	tracer := tp.Tracer("torrentium-relay")
+
+	h.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(_ network.Network, c network.Conn) {
+			_, span := tracer.Start(ctx, "relay.connection",
+				trace.WithTimestamp(c.Stat().Opened),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("libp2p.peer_id", c.RemotePeer().String()),
+					attribute.String("libp2p.transport", transportName(c.RemoteMultiaddr())),
+					attribute.String("libp2p.direction", c.Stat().Direction.String()),
+					attribute.String("net.peer.addr", c.RemoteMultiaddr().String()),
+				))
+			span.End()
+		},
+	})
+
+	rh.onHop(func(ev hopEvent) {
+		name := "relay.reservation"
+		attrs := []attribute.KeyValue{
+			attribute.String("libp2p.peer_id", ev.Peer.String()),
+			attribute.String("libp2p.transport", transportName(ev.Addr)),
+			attribute.String("relay.status", ev.Status.String()),
+		}
+		if ev.Type == pbv2.HopMessage_CONNECT {
+			name = "relay.circuit"
+			attrs = append(attrs, attribute.String("libp2p.dest_peer_id", ev.Dest.String()))
+		} else if !ev.Expire.IsZero() {
+			attrs = append(attrs, attribute.String("relay.reservation_expire", ev.Expire.UTC().Format("2006-01-02T15:04:05Z")))
+		}
+
+		_, span := tracer.Start(ctx, name,
+			trace.WithTimestamp(ev.Start),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attrs...))
+		if ev.Status != pbv2.Status_OK {
+			span.SetStatus(codes.Error, ev.Status.String())
+		}
+		span.End()
+	})
+
+	return tp.Shutdown, nil
+}
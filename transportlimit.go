@@ -0,0 +1,171 @@
+// transportlimit.go
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Per-transport connection caps (TRANSPORT_CONN_LIMITS) ===
+// Comma-separated <transport>=<max> pairs, e.g. "ws=500,webtransport=200".
+// Open connections are counted per transport (both directions) and a new
+// inbound one is refused at accept once its transport is at the cap, so a
+// flood on one transport can't take every slot the resource manager has.
+// Transports without an entry are counted but not capped.
+var limitTransports = []string{"tcp", "ws", "quic", "webtransport"}
+
+func transportConnLimits() (map[string]int, error) {
+	raw := envString("TRANSPORT_CONN_LIMITS", "")
+	if raw == "" {
+		return nil, nil
+	}
+	out := make(map[string]int)
+	for _, f := range strings.Split(raw, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		name, v, ok := strings.Cut(f, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !slices.Contains(limitTransports, name) {
+			return nil, fmt.Errorf("TRANSPORT_CONN_LIMITS: %q is not <%s>=<max>", f, strings.Join(limitTransports, "|"))
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("TRANSPORT_CONN_LIMITS: %q needs a positive limit", f)
+		}
+		if _, dup := out[name]; dup {
+			return nil, fmt.Errorf("TRANSPORT_CONN_LIMITS: %q listed twice", name)
+		}
+		out[name] = n
+	}
+	return out, nil
+}
+
+// transportOf names the outermost transport of a connection address:
+// /ip4/.../tcp/4001/ws is "ws", /ip4/.../udp/4433/quic-v1/webtransport is
+// "webtransport". Relayed connections are "circuit".
+func transportOf(a ma.Multiaddr) string {
+	name := ""
+	for _, c := range a {
+		switch c.Protocol().Code {
+		case ma.P_CIRCUIT:
+			return "circuit"
+		case ma.P_TCP:
+			name = "tcp"
+		case ma.P_WS, ma.P_WSS:
+			name = "ws"
+		case ma.P_QUIC, ma.P_QUIC_V1:
+			name = "quic"
+		case ma.P_WEBTRANSPORT:
+			name = "webtransport"
+		}
+	}
+	if name == "" {
+		return "other"
+	}
+	return name
+}
+
+type transportConns struct {
+	limits map[string]int
+	// listeners maps "tcp/<port>" / "udp/<port>" to the transport listening
+	// there: the shared TCP listener hands the gater raw /tcp addresses
+	// before the websocket upgrade.
+	listeners map[string]string
+
+	mu   sync.Mutex
+	open map[string]int
+}
+
+type transportConnInfo struct {
+	Open  int `json:"open"`
+	Limit int `json:"limit,omitempty"`
+}
+
+func newTransportConns(limits map[string]int) *transportConns {
+	return &transportConns{limits: limits, listeners: make(map[string]string), open: make(map[string]int)}
+}
+
+// bind records the transport behind each listen address; call it before the
+// host starts accepting.
+func (t *transportConns) bind(listen []string) {
+	for _, l := range listen {
+		if a, err := ma.NewMultiaddr(l); err == nil {
+			t.listeners[portKey(a)] = transportOf(a)
+		}
+	}
+}
+
+// classify is transportOf, resolving raw accepted sockets through the
+// listener they arrived on.
+func (t *transportConns) classify(addrs network.ConnMultiaddrs) string {
+	name := transportOf(addrs.RemoteMultiaddr())
+	if name == "tcp" || name == "quic" {
+		if l, ok := t.listeners[portKey(addrs.LocalMultiaddr())]; ok {
+			return l
+		}
+	}
+	return name
+}
+
+// portKey is the "tcp/<port>" or "udp/<port>" part of a.
+func portKey(a ma.Multiaddr) string {
+	for _, c := range a {
+		if code := c.Protocol().Code; code == ma.P_TCP || code == ma.P_UDP {
+			return c.Protocol().Name + "/" + c.Value()
+		}
+	}
+	return ""
+}
+
+// full reports whether the accepted connection's transport is at its cap,
+// with the cap.
+func (t *transportConns) full(addrs network.ConnMultiaddrs) (string, int, bool) {
+	name := t.classify(addrs)
+	limit, ok := t.limits[name]
+	if !ok {
+		return name, 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return name, limit, t.open[name] >= limit
+}
+
+func (t *transportConns) notifiee() network.Notifiee {
+	return &network.NotifyBundle{
+		ConnectedF: func(_ network.Network, c network.Conn) {
+			t.mu.Lock()
+			t.open[t.classify(c)]++
+			t.mu.Unlock()
+		},
+		DisconnectedF: func(_ network.Network, c network.Conn) {
+			name := t.classify(c)
+			t.mu.Lock()
+			if t.open[name]--; t.open[name] <= 0 {
+				delete(t.open, name)
+			}
+			t.mu.Unlock()
+		},
+	}
+}
+
+// info lists every transport with open connections or a configured cap.
+func (t *transportConns) info() map[string]transportConnInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]transportConnInfo, len(t.open)+len(t.limits))
+	for name, limit := range t.limits {
+		out[name] = transportConnInfo{Limit: limit}
+	}
+	for name, n := range t.open {
+		out[name] = transportConnInfo{Open: n, Limit: t.limits[name]}
+	}
+	return out
+}
@@ -0,0 +1,255 @@
+// transportlog.go
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	logging "github.com/ipfs/go-log/v2"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// === Transport log levels (TRANSPORT_LOG_LEVELS) ===
+// The transports log through go-libp2p's own logger (go-log), under names
+// such as websocket-transport and quic-transport, and a failed handshake
+// mostly shows up at debug level or from the upgrader with no transport in
+// its name. Those loggers are routed through transportLogCore, which sorts
+// each failure line by transport (the upgrader's by the address in the
+// message) and kind:
+//
+//   - version: QUIC version negotiation and other version mismatches;
+//   - handshake: TLS, Noise, WebSocket upgrade and protocol negotiation;
+//   - timeout: deadlines and timeouts;
+//   - closed: resets, EOFs and closed connections;
+//   - other.
+//
+// Every failure is counted (torrentium_relay_transport_errors_total, /stats
+// transportErrors), and printed only at or above its transport's level, set
+// per transport with e.g. "quic=off,ws=debug" (debug, info, warn, error,
+// off; default error, as go-log has it).
+var transportLogNames = map[string][]string{
+	"tcp":          {"tcp-tpt", "tcp-demultiplex"},
+	"ws":           {"websocket-transport"},
+	"quic":         {"quic-transport", "quicreuse"},
+	"webtransport": {"webtransport"},
+}
+
+// upgraderLog is the security/muxer upgrade shared by tcp and ws.
+const upgraderLog = "upgrader"
+
+const levelOff = zapcore.FatalLevel + 1
+
+var transportErrs = &transportErrCounts{counts: make(map[[2]string]int64)}
+
+type transportErrCounts struct {
+	mu     sync.Mutex
+	counts map[[2]string]int64 // {transport, kind}
+}
+
+func parseTransportLogLevels(v string) (map[string]zapcore.Level, error) {
+	out := make(map[string]zapcore.Level, len(transportLogNames))
+	for t := range transportLogNames {
+		out[t] = zapcore.ErrorLevel
+	}
+	names := make([]string, 0, len(transportLogNames))
+	for t := range transportLogNames {
+		names = append(names, t)
+	}
+	slices.Sort(names)
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		t, lvl, ok := strings.Cut(f, "=")
+		t, lvl = strings.TrimSpace(t), strings.ToLower(strings.TrimSpace(lvl))
+		if _, known := transportLogNames[t]; !ok || !known {
+			return nil, fmt.Errorf("invalid TRANSPORT_LOG_LEVELS entry %q (want <transport>=<level>, transports: %s)", f, strings.Join(names, ", "))
+		}
+		switch lvl {
+		case "off":
+			out[t] = levelOff
+		case "debug", "info", "warn", "error":
+			l, _ := zapcore.ParseLevel(lvl)
+			out[t] = l
+		default:
+			return nil, fmt.Errorf("invalid TRANSPORT_LOG_LEVELS entry %q (want debug, info, warn, error or off)", f)
+		}
+	}
+	return out, nil
+}
+
+// setupTransportLogs puts transportLogCore in front of go-log's output and
+// opens the transport loggers up to debug so it sees every failure.
+func setupTransportLogs(levels map[string]zapcore.Level) error {
+	out, err := goLogOutput()
+	if err != nil {
+		return err
+	}
+	logging.SetPrimaryCore(&transportLogCore{Core: out, levels: levels})
+	for _, names := range transportLogNames {
+		for _, name := range names {
+			_ = logging.SetLogLevel(name, "debug")
+		}
+	}
+	_ = logging.SetLogLevel(upgraderLog, "debug")
+	return nil
+}
+
+// goLogOutput builds the output core go-log sets up from its GOLOG_*
+// settings, which it doesn't hand out for wrapping.
+func goLogOutput() (zapcore.Core, error) {
+	cfg := logging.GetConfig()
+	var paths []string
+	if cfg.Stderr {
+		paths = append(paths, "stderr")
+	}
+	if cfg.Stdout {
+		paths = append(paths, "stdout")
+	}
+	if cfg.File != "" {
+		paths = append(paths, cfg.File)
+	}
+	if cfg.URL != "" {
+		paths = append(paths, cfg.URL)
+	}
+	ws, _, err := zap.Open(paths...)
+	if err != nil {
+		return nil, fmt.Errorf("go-log output: %w", err)
+	}
+	enc := zap.NewProductionEncoderConfig()
+	enc.EncodeTime = zapcore.ISO8601TimeEncoder
+	var encoder zapcore.Encoder
+	switch cfg.Format {
+	case logging.JSONOutput:
+		encoder = zapcore.NewJSONEncoder(enc)
+	case logging.PlaintextOutput:
+		enc.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(enc)
+	default:
+		enc.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(enc)
+	}
+	core := zapcore.NewCore(encoder, ws, zapcore.DebugLevel)
+	for k, v := range cfg.Labels {
+		core = core.With([]zapcore.Field{zap.String(k, v)})
+	}
+	return core, nil
+}
+
+type transportLogCore struct {
+	zapcore.Core
+	levels map[string]zapcore.Level
+}
+
+func (c *transportLogCore) With(fields []zapcore.Field) zapcore.Core {
+	return &transportLogCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+func (c *transportLogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	transport := transportForLogger(ent.LoggerName, ent.Message)
+	if transport == "" {
+		if ent.LoggerName == upgraderLog && ent.Level < zapcore.ErrorLevel {
+			return ce // no transport to judge by: go-log's default level
+		}
+		return c.Core.Check(ent, ce)
+	}
+	if isTransportFailure(ent) {
+		transportErrs.add(transport, transportErrKind(ent.Message))
+	}
+	if ent.Level < c.levels[transport] {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+var logAddrRe = regexp.MustCompile(`/ip[46]/[^\s,)]+`)
+
+// transportForLogger names the transport a go-log line is about; "" if it
+// isn't from a transport logger.
+func transportForLogger(name, msg string) string {
+	for t, names := range transportLogNames {
+		if slices.Contains(names, name) {
+			return t
+		}
+	}
+	if name != upgraderLog {
+		return ""
+	}
+	for _, s := range logAddrRe.FindAllString(msg, -1) {
+		if a, err := ma.NewMultiaddr(s); err == nil {
+			if t := transportOf(a); t != "other" && t != "circuit" {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+func isTransportFailure(ent zapcore.Entry) bool {
+	if ent.Level >= zapcore.WarnLevel {
+		return true
+	}
+	m := strings.ToLower(ent.Message)
+	return strings.Contains(m, "error") || strings.Contains(m, "fail")
+}
+
+func transportErrKind(msg string) string {
+	m := strings.ToLower(msg)
+	has := func(subs ...string) bool {
+		return slices.ContainsFunc(subs, func(s string) bool { return strings.Contains(m, s) })
+	}
+	switch {
+	case has("version"):
+		return "version"
+	case has("timeout", "deadline", "timed out"):
+		return "timeout"
+	case has("handshake", "upgrade", "negotiat", "tls", "noise", "websocket:"):
+		return "handshake"
+	case has("reset", "closed", "eof", "broken pipe"):
+		return "closed"
+	}
+	return "other"
+}
+
+func (t *transportErrCounts) add(transport, kind string) {
+	t.mu.Lock()
+	t.counts[[2]string{transport, kind}]++
+	t.mu.Unlock()
+}
+
+// snapshot is transport -> kind -> count.
+func (t *transportErrCounts) snapshot() map[string]map[string]int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]map[string]int64)
+	for k, n := range t.counts {
+		if out[k[0]] == nil {
+			out[k[0]] = make(map[string]int64)
+		}
+		out[k[0]][k[1]] = n
+	}
+	return out
+}
+
+// transportErrCollector reports transportErrs as one counter per transport
+// and kind.
+type transportErrCollector struct{}
+
+var transportErrDesc = prometheus.NewDesc("torrentium_relay_transport_errors_total", "Transport failures logged by go-libp2p, by transport and kind (TRANSPORT_LOG_LEVELS).", []string{"transport", "kind"}, nil)
+
+func (transportErrCollector) Describe(ch chan<- *prometheus.Desc) { ch <- transportErrDesc }
+
+func (transportErrCollector) Collect(ch chan<- prometheus.Metric) {
+	transportErrs.mu.Lock()
+	defer transportErrs.mu.Unlock()
+	for k, n := range transportErrs.counts {
+		ch <- prometheus.MustNewConstMetric(transportErrDesc, prometheus.CounterValue, float64(n), k[0], k[1])
+	}
+}
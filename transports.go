@@ -0,0 +1,54 @@
+// transports.go
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Supported transports (GET /transports) ===
+// What a client can dial, grouped by transport and built from the addresses
+// the node advertises right now (the address factory's output), so clients
+// pick one they support instead of trying each. listening is what the host
+// has bound, advertised or not; unavailable, what it started without
+// (ALLOW_PARTIAL_TRANSPORTS).
+type transportInfo struct {
+	Transport string   `json:"transport"`
+	Secure    bool     `json:"secure"`
+	Addrs     []string `json:"addrs"`
+}
+
+type transportsInfo struct {
+	Node        string                `json:"node"`
+	PeerID      string                `json:"peerId"`
+	Listening   []string              `json:"listening"`
+	Unavailable []unavailableListener `json:"unavailable,omitempty"`
+	Advertised  []transportInfo       `json:"advertised"`
+}
+
+func (n *relayNode) advertisedTransports() transportsInfo {
+	out := transportsInfo{Node: n.name, PeerID: n.h.ID().String(), Listening: []string{}, Unavailable: n.unavailable, Advertised: []transportInfo{}}
+	for _, a := range n.h.Network().ListenAddresses() {
+		if t := transportName(a); t != "relay" && !slices.Contains(out.Listening, t) {
+			out.Listening = append(out.Listening, t)
+		}
+	}
+
+	addrs := slices.Clone(n.h.Addrs())
+	// most reachable first, as MAX_ADVERTISED_ADDRS keeps them, then by
+	// ADVERTISE_ORDER
+	slices.SortStableFunc(addrs, func(a, b ma.Multiaddr) int { return addrReachRank(a) - addrReachRank(b) })
+	n.orderAddrs(addrs)
+	for _, a := range addrs {
+		t := transportName(a)
+		i := slices.IndexFunc(out.Advertised, func(ti transportInfo) bool { return ti.Transport == t })
+		if i < 0 {
+			out.Advertised = append(out.Advertised, transportInfo{Transport: t, Secure: t == "wss" || t == "webtransport" || t == "quic-v1"})
+			i = len(out.Advertised) - 1
+		}
+		out.Advertised[i].Addrs = append(out.Advertised[i].Addrs, fmt.Sprintf("%s/p2p/%s", a, n.h.ID()))
+	}
+	return out
+}
@@ -0,0 +1,141 @@
+// verifyclient.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === Client verification (admin POST /verify-client) ===
+// Unlike /selftest, which relays between two in-process clients, this takes
+// a real client and walks the path a peer would use to reach it: can the
+// relay reach the client, does the client hold a reservation, and does a
+// circuit to it come up (the relay opens a stop stream to the client, the
+// client accepts, and the two ends finish a secure handshake over it).
+// Steps run in order and stop at the first failure, which shows where the
+// path breaks.
+const verifyClientTimeout = 30 * time.Second
+
+type verifyStep struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type verifyResult struct {
+	Peer  string       `json:"peer"`
+	Pass  bool         `json:"pass"`
+	Steps []verifyStep `json:"steps"`
+}
+
+func (s *statusServer) handleVerifyClient(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	var body struct {
+		Multiaddr string `json:"multiaddr"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Multiaddr == "" {
+		writeError(w, http.StatusBadRequest, `expected {"multiaddr": "<addr>/p2p/<peerID>"}`)
+		return
+	}
+	a, err := ma.NewMultiaddr(body.Multiaddr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid multiaddr: "+err.Error())
+		return
+	}
+	info, err := peer.AddrInfoFromP2pAddr(a)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "multiaddr needs a /p2p/<peerID> component")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), verifyClientTimeout)
+	defer cancel()
+	res := s.verifyClient(ctx, *info)
+	code := http.StatusOK
+	if !res.Pass {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, res)
+}
+
+func (s *statusServer) verifyClient(ctx context.Context, info peer.AddrInfo) verifyResult {
+	res := verifyResult{Peer: info.ID.String(), Steps: []verifyStep{}}
+	run := func(name string, f func() (string, error)) bool {
+		t := time.Now()
+		detail, err := f()
+		st := verifyStep{Name: name, OK: err == nil, Detail: detail, Duration: time.Since(t).Round(time.Microsecond).String()}
+		if err != nil {
+			st.Error = err.Error()
+		}
+		res.Steps = append(res.Steps, st)
+		return err == nil
+	}
+
+	// a client behind NAT can only be reached over the connection it opened
+	ok := run("dial", func() (string, error) {
+		if s.h.Network().Connectedness(info.ID) == network.Connected {
+			return "already connected", nil
+		}
+		if len(info.Addrs) == 0 {
+			return "", fmt.Errorf("not connected and no address to dial")
+		}
+		if err := s.h.Connect(ctx, info); err != nil {
+			return "", err
+		}
+		return "dialed " + info.Addrs[0].String(), nil
+	})
+	ok = ok && run("reservation", func() (string, error) {
+		list := s.reservations.list()
+		i := slices.IndexFunc(list, func(r reservationInfo) bool { return r.Peer == info.ID.String() })
+		if i < 0 {
+			return "", fmt.Errorf("no reservation on this relay; the client must reserve before peers can reach it")
+		}
+		return fmt.Sprintf("expires in %s, tier %s", list[i].TTL, list[i].Tier), nil
+	})
+	ok = ok && run("circuit", func() (string, error) {
+		return s.verifyCircuit(ctx, info.ID)
+	})
+	res.Pass = ok
+	return res
+}
+
+// verifyCircuit dials the client through the relay from a throwaway peer.
+// A successful dial means the relay's stop stream was accepted and the
+// client completed the handshake over the circuit.
+func (s *statusServer) verifyCircuit(ctx context.Context, p peer.ID) (string, error) {
+	addrs, err := s.h.Network().InterfaceListenAddresses()
+	if err != nil {
+		return "", fmt.Errorf("relay listen addrs: %w", err)
+	}
+	src, err := libp2p.New(libp2p.NoListenAddrs, libp2p.EnableRelay())
+	if err != nil {
+		return "", fmt.Errorf("start probe peer: %w", err)
+	}
+	defer src.Close()
+	if err := src.Connect(ctx, peer.AddrInfo{ID: s.h.ID(), Addrs: addrs}); err != nil {
+		return "", fmt.Errorf("probe peer could not reach the relay: %w", err)
+	}
+
+	circ, err := ma.NewMultiaddr(fmt.Sprintf("/p2p/%s/p2p-circuit", s.h.ID()))
+	if err != nil {
+		return "", err
+	}
+	if err := src.Connect(network.WithAllowLimitedConn(ctx, "verify-client"), peer.AddrInfo{ID: p, Addrs: []ma.Multiaddr{circ}}); err != nil {
+		return "", err
+	}
+	return "circuit established", nil
+}
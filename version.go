@@ -0,0 +1,29 @@
+// version.go
+package main
+
+import "runtime/debug"
+
+// version can be stamped at build time:
+//
+//	go build -ldflags "-X main.version=v1.2.3"
+var version = ""
+
+// relayVersion falls back to the VCS revision Go embeds in the binary.
+func relayVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			return s.Value[:12]
+		}
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	return "dev"
+}
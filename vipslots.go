@@ -0,0 +1,98 @@
+// vipslots.go
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// === VIP reservation slots (VIP_SLOTS, VIP_PEERS) ===
+// The last VIP_SLOTS of MaxReservations are held back for the peers in
+// VIP_PEERS (comma-separated peer IDs). Everyone else sees the relay as full
+// once only those remain, and RESERVE_QUEUE_SIZE waits for a public slot
+// rather than any slot; renewals are never refused. VIP peers can take any
+// free slot, so the pool is a floor, not a partition.
+type vipPool struct {
+	slots int
+	max   int
+	peers map[peer.ID]bool
+
+	reservations *reservationTracker
+	refused      atomic.Int64
+}
+
+type vipInfo struct {
+	Slots int `json:"slots"`
+	// Used is how many of the held-back slots are taken, by anyone's
+	// reservation beyond the public share.
+	Used            int   `json:"used"`
+	VIPReservations int   `json:"vipReservations"`
+	PublicRefused   int64 `json:"publicRefused"`
+}
+
+func vipPeers() (map[peer.ID]bool, error) {
+	peers := make(map[peer.ID]bool)
+	for _, s := range strings.Split(envString("VIP_PEERS", ""), ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		p, err := peer.Decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid VIP_PEERS entry %q: %w", s, err)
+		}
+		peers[p] = true
+	}
+	return peers, nil
+}
+
+// newVIPPool returns nil without VIP_SLOTS; a nil pool holds nothing back.
+func newVIPPool(cfg *relayConfig, reservations *reservationTracker) *vipPool {
+	if cfg.VIPSlots == 0 {
+		return nil
+	}
+	return &vipPool{
+		slots:        cfg.VIPSlots,
+		max:          cfg.relayResources().MaxReservations,
+		peers:        cfg.vipPeers,
+		reservations: reservations,
+	}
+}
+
+// limit is how many reservations in total may exist for p to get a new one.
+func (v *vipPool) limit(p peer.ID, max int) int {
+	if v == nil || v.peers[p] {
+		return max
+	}
+	return max - v.slots
+}
+
+// allow refuses a new reservation from a non-VIP peer when only VIP slots
+// are left.
+func (v *vipPool) allow(p peer.ID) bool {
+	if v == nil || v.peers[p] || v.reservations.has(p) {
+		return true
+	}
+	if n := v.reservations.count(); n >= v.max-v.slots {
+		v.refused.Add(1)
+		debugf("Refusing new reservation from %s: only VIP slots left (%d/%d reserved)", p, n, v.max)
+		return false
+	}
+	return true
+}
+
+func (v *vipPool) info() *vipInfo {
+	if v == nil {
+		return nil
+	}
+	info := &vipInfo{Slots: v.slots, PublicRefused: v.refused.Load()}
+	info.Used = min(v.slots, max(0, v.reservations.count()-(v.max-v.slots)))
+	for p := range v.peers {
+		if v.reservations.has(p) {
+			info.VIPReservations++
+		}
+	}
+	return info
+}
@@ -0,0 +1,169 @@
+// warmconn.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// === Warm connection (WARM_CONNECTION) ===
+// For platforms that idle-suspend a process (or let its runtime go cold)
+// when no traffic comes in: the relay holds one connection open and pings
+// over it every WARM_INTERVAL, so the first real client after a quiet spell
+// doesn't pay for the wake-up.
+//
+//   - self: an in-process client connects to the relay's public advertised
+//     addresses, through the platform's ingress like a remote client would
+//     (the local listen addresses while nothing is advertised).
+//   - <multiaddr>/p2p/<peerID>: the relay connects to a sibling and keeps
+//     that connection protected from trimming.
+//
+// A failed or dropped connection is redialled on the next tick.
+const warmTag = "warm-connection"
+
+type warmState struct {
+	Target   string     `json:"target"`
+	State    string     `json:"state"` // pending, up, down
+	LastPing *time.Time `json:"lastPing,omitempty"`
+	RTT      string     `json:"rtt,omitempty"`
+	Error    string     `json:"lastError,omitempty"`
+}
+
+type warmConn struct {
+	node     *relayNode
+	sibling  *peer.AddrInfo
+	interval time.Duration
+	client   host.Host // self only
+
+	mu    sync.Mutex
+	state warmState
+}
+
+func startWarmConn(ctx context.Context, n *relayNode, cfg *relayConfig) *warmConn {
+	w := &warmConn{node: n, sibling: cfg.warmSibling, interval: cfg.warmInterval}
+	if cfg.WarmConnection == "" {
+		w.state.State = "off"
+		return w
+	}
+	w.state = warmState{Target: cfg.WarmConnection, State: "pending"}
+	go w.run(ctx)
+	log.Printf("✅ Warm connection to %s, pinged every %s", cfg.WarmConnection, w.interval)
+	return w
+}
+
+func (w *warmConn) run(ctx context.Context) {
+	defer func() {
+		if w.client != nil {
+			_ = w.client.Close()
+		}
+	}()
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+	// first attempt once warmup has had a chance to finish
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(w.node.cfg.warmup + time.Second):
+	}
+	for {
+		w.tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (w *warmConn) tick(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, min(w.interval, 15*time.Second))
+	defer cancel()
+	rtt, err := w.ping(ctx)
+
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err != nil {
+		if w.state.State != "down" {
+			log.Printf("⚠️ Warm connection to %s down, redialling every %s: %v", w.state.Target, w.interval, err)
+		}
+		w.state.State, w.state.Error = "down", err.Error()
+		return
+	}
+	if w.state.State != "up" {
+		log.Printf("✅ Warm connection to %s up (rtt %s)", w.state.Target, rtt.Round(time.Microsecond))
+	}
+	w.state.State, w.state.Error = "up", ""
+	w.state.LastPing, w.state.RTT = &now, rtt.Round(time.Microsecond).String()
+}
+
+// ping (re)connects if needed and pings once over the connection.
+func (w *warmConn) ping(ctx context.Context) (time.Duration, error) {
+	from, to, err := w.endpoints()
+	if err != nil {
+		return 0, err
+	}
+	if err := from.Connect(ctx, to); err != nil {
+		return 0, err
+	}
+	res, ok := <-ping.Ping(ctx, from, to.ID)
+	if !ok {
+		return 0, ctx.Err()
+	}
+	return res.RTT, res.Error
+}
+
+// endpoints returns the host that dials and who it dials.
+func (w *warmConn) endpoints() (host.Host, peer.AddrInfo, error) {
+	h := w.node.h
+	if w.sibling != nil {
+		h.ConnManager().Protect(w.sibling.ID, warmTag)
+		return h, *w.sibling, nil
+	}
+	if w.client == nil {
+		c, err := libp2p.New(libp2p.NoListenAddrs)
+		if err != nil {
+			return nil, peer.AddrInfo{}, fmt.Errorf("start warm client: %w", err)
+		}
+		w.client = c
+	}
+	addrs := w.node.adv.Load().public
+	if len(addrs) == 0 {
+		addrs = loopbackAddrs(h.Network().ListenAddresses())
+	}
+	return w.client, peer.AddrInfo{ID: h.ID(), Addrs: addrs}, nil
+}
+
+// loopbackAddrs turns wildcard listen addresses into loopback ones, which
+// can be dialled; others pass through.
+func loopbackAddrs(listen []ma.Multiaddr) []ma.Multiaddr {
+	out := make([]ma.Multiaddr, 0, len(listen))
+	for _, a := range listen {
+		if len(a) == 0 || !manet.IsIPUnspecified(a) {
+			out = append(out, a)
+			continue
+		}
+		loop := ma.StringCast("/ip4/127.0.0.1")
+		if a[0].Protocol().Code == ma.P_IP6 {
+			loop = ma.StringCast("/ip6/::1")
+		}
+		out = append(out, append(loop, a[1:]...))
+	}
+	return out
+}
+
+func (w *warmConn) info() warmState {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.state
+}
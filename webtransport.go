@@ -0,0 +1,60 @@
+// webtransport.go
+package main
+
+import (
+	"github.com/libp2p/go-libp2p/core/host"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// === WebTransport (WEBTRANSPORT_PORT) ===
+// The webtransport transport embeds /certhash components of its rotating
+// self-signed certificates in its listen addresses. Advertised addresses are
+// rebuilt from those on every address refresh, so rotation needs no restart.
+func isWebTransport(a ma.Multiaddr) bool {
+	for _, c := range a {
+		if c.Protocol().Code == ma.P_WEBTRANSPORT {
+			return true
+		}
+	}
+	return false
+}
+
+// publicWebTransport moves webtransport listen addrs onto the advertised
+// host: /ip4/10.0.0.5/udp/4433/quic-v1/webtransport/certhash/... becomes
+// /dns4/<host>/udp/4433/quic-v1/webtransport/certhash/...
+func publicWebTransport(public ma.Multiaddr, addrs []ma.Multiaddr) []ma.Multiaddr {
+	if len(public) == 0 {
+		return nil
+	}
+	hostPart := public[:1]
+
+	var out []ma.Multiaddr
+	seen := map[string]bool{}
+	for _, a := range addrs {
+		if !isWebTransport(a) || len(a) < 2 {
+			continue
+		}
+		m := append(ma.Multiaddr{}, hostPart...)
+		m = append(m, a[1:]...)
+		if !seen[m.String()] {
+			seen[m.String()] = true
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// certHashes lists the certhash values currently advertised by h.
+func certHashes(h host.Host) []string {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, a := range h.Addrs() {
+		for _, c := range a {
+			if c.Protocol().Code == ma.P_CERTHASH && !seen[c.Value()] {
+				seen[c.Value()] = true
+				out = append(out, c.Value())
+			}
+		}
+	}
+	return out
+}